@@ -57,6 +57,43 @@ func (a *BlockValidatorAPI) LatestValidatedBlockHash(ctx context.Context) (commo
 	return hash, nil
 }
 
+type SequencerAPI struct {
+	sequencer *Sequencer
+}
+
+func (a *SequencerAPI) RegisterPriorityLane(ctx context.Context, credential PriorityLaneCredential) error {
+	return a.sequencer.RegisterPriorityLane(&credential)
+}
+
+type ArbTransactionAPI struct {
+	publisher TransactionPublisher
+}
+
+// SendBundle includes the transactions contiguously and in order in a single block, or not at all.
+// If targetBlock is set, the bundle is only included in a block up to and including that one.
+func (a *ArbTransactionAPI) SendBundle(ctx context.Context, encodedTxs []hexutil.Bytes, targetBlock *hexutil.Uint64) ([]common.Hash, error) {
+	txs := make(types.Transactions, 0, len(encodedTxs))
+	for i, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encodedTx); err != nil {
+			return nil, fmt.Errorf("failed to decode bundle transaction %v: %w", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	var target *uint64
+	if targetBlock != nil {
+		target = (*uint64)(targetBlock)
+	}
+	if err := a.publisher.PublishBundle(ctx, txs, target); err != nil {
+		return nil, err
+	}
+	hashes := make([]common.Hash, 0, len(txs))
+	for _, tx := range txs {
+		hashes = append(hashes, tx.Hash())
+	}
+	return hashes, nil
+}
+
 type ArbDebugAPI struct {
 	blockchain        *core.BlockChain
 	blockRangeBound   uint64
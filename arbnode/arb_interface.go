@@ -6,12 +6,16 @@ package arbnode
 import (
 	"context"
 
+	"github.com/tenderly/nitro/go-ethereum/common"
 	"github.com/tenderly/nitro/go-ethereum/core"
 	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/event"
 )
 
 type TransactionPublisher interface {
 	PublishTransaction(ctx context.Context, tx *types.Transaction) error
+	PublishBundle(ctx context.Context, txs types.Transactions, targetBlock *uint64) error
+	PendingTxs() *PendingTxSet
 	Initialize(context.Context) error
 	Start(context.Context) error
 	StopAndWait()
@@ -38,6 +42,22 @@ func (a *ArbInterface) PublishTransaction(ctx context.Context, tx *types.Transac
 	return a.txPublisher.PublishTransaction(ctx, tx)
 }
 
+func (a *ArbInterface) PublishBundle(ctx context.Context, txs types.Transactions, targetBlock *uint64) error {
+	return a.txPublisher.PublishBundle(ctx, txs, targetBlock)
+}
+
+func (a *ArbInterface) PendingTransactions() types.Transactions {
+	return a.txPublisher.PendingTxs().Transactions()
+}
+
+func (a *ArbInterface) PendingTransaction(txHash common.Hash) *types.Transaction {
+	return a.txPublisher.PendingTxs().Transaction(txHash)
+}
+
+func (a *ArbInterface) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return a.txPublisher.PendingTxs().SubscribeNewTxsEvent(ch)
+}
+
 func (a *ArbInterface) TransactionStreamer() *TransactionStreamer {
 	return a.txStreamer
 }
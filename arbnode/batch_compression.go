@@ -0,0 +1,67 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/tenderly/nitro/arbstate"
+)
+
+// BatchCompressionWriter incrementally compresses the segments of a batch.
+// Flush must make everything written so far available in the underlying writer, so the batch size can be measured.
+type BatchCompressionWriter interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// BatchCompressor produces batches in a compression format the inbox multiplexer can decode,
+// identified by the header byte prepended to the batch.
+type BatchCompressor interface {
+	HeaderByte() byte
+	NewWriter(w io.Writer, level int) (BatchCompressionWriter, error)
+}
+
+var batchCompressors = map[string]BatchCompressor{
+	"brotli": brotliBatchCompressor{},
+	"zstd":   zstdBatchCompressor{},
+}
+
+func BatchCompressorByName(name string) (BatchCompressor, error) {
+	compressor, exists := batchCompressors[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown batch compression \"%v\"", name)
+	}
+	return compressor, nil
+}
+
+type brotliBatchCompressor struct{}
+
+func (brotliBatchCompressor) HeaderByte() byte {
+	return arbstate.BrotliMessageHeaderByte
+}
+
+func (brotliBatchCompressor) NewWriter(w io.Writer, level int) (BatchCompressionWriter, error) {
+	return brotli.NewWriterLevel(w, level), nil
+}
+
+type zstdBatchCompressor struct{}
+
+func (zstdBatchCompressor) HeaderByte() byte {
+	return arbstate.ZstdMessageHeaderByte
+}
+
+// NewWriter maps the level onto zstd's own levels, where 1 is the fastest and 22 the best compression
+func (zstdBatchCompressor) NewWriter(w io.Writer, level int) (BatchCompressionWriter, error) {
+	return zstd.NewWriter(
+		w,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+		zstd.WithEncoderConcurrency(1),
+	)
+}
@@ -0,0 +1,118 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/params"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+)
+
+var errMessageTooLargeForBatch = errors.New("message too large to fit in a batch")
+
+// BatchInfo describes a batch as the batch poster would build it, without posting it.
+type BatchInfo struct {
+	FirstMessage     arbutil.MessageIndex
+	EndMessage       arbutil.MessageIndex // exclusive
+	Segments         map[byte]int         // the number of segments of each kind
+	UncompressedSize int                  // the size of the RLP encoded segments
+	Data             []byte               // the sequencer message as it would be posted, including the compression header byte
+	EstimatedL1Gas   uint64
+}
+
+func (b *BatchInfo) CompressionRatio() float64 {
+	if len(b.Data) == 0 {
+		return 0
+	}
+	return float64(b.UncompressedSize) / float64(len(b.Data))
+}
+
+// estimateBatchL1Gas estimates the L1 gas to post a sequencer message from its calldata, plus the configured extra batch gas for execution.
+func estimateBatchL1Gas(seqNum uint64, sequencerMsg []byte, delayedMsg uint64, config *BatchPosterConfig) (uint64, error) {
+	data, err := sequencerBridgeABI.Pack("addSequencerL2BatchFromOrigin", new(big.Int).SetUint64(seqNum), sequencerMsg, new(big.Int).SetUint64(delayedMsg), common.Address{})
+	if err != nil {
+		return 0, err
+	}
+	gas := params.TxGas + config.ExtraBatchGas
+	for _, dataByte := range data {
+		if dataByte == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas, nil
+}
+
+// BuildBatches splits the streamer's messages in [start, end) into batches with the batch poster's logic.
+// The first batch is numbered firstSeqNum, which only affects the gas estimate.
+func BuildBatches(streamer *TransactionStreamer, start, end arbutil.MessageIndex, firstSeqNum uint64, config *BatchPosterConfig) ([]*BatchInfo, error) {
+	compressor, err := BatchCompressorByName(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	var delayedMsg uint64
+	if start > 0 {
+		prev, err := streamer.GetMessage(start - 1)
+		if err != nil {
+			return nil, err
+		}
+		delayedMsg = prev.DelayedMessagesRead
+	}
+	var batches []*BatchInfo
+	pos := start
+	for pos < end {
+		segments, err := newBatchSegments(delayedMsg, config, compressor)
+		if err != nil {
+			return nil, err
+		}
+		batchStart := pos
+		for pos < end {
+			msg, err := streamer.GetMessage(pos)
+			if err != nil {
+				return nil, err
+			}
+			success, err := segments.AddMessage(&msg)
+			if err != nil {
+				return nil, err
+			}
+			if !success {
+				break
+			}
+			pos++
+		}
+		if pos == batchStart {
+			return nil, errMessageTooLargeForBatch
+		}
+		info := &BatchInfo{
+			FirstMessage: batchStart,
+			EndMessage:   pos,
+			Segments:     make(map[byte]int),
+		}
+		data, err := segments.CloseAndGetBytes()
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments.rawSegments {
+			info.Segments[segment[0]]++
+			encoded, err := rlp.EncodeToBytes(segment)
+			if err != nil {
+				return nil, err
+			}
+			info.UncompressedSize += len(encoded)
+		}
+		info.Data = data
+		info.EstimatedL1Gas, err = estimateBatchL1Gas(firstSeqNum+uint64(len(batches)), data, segments.delayedMsg, config)
+		if err != nil {
+			return nil, err
+		}
+		delayedMsg = segments.delayedMsg
+		batches = append(batches, info)
+	}
+	return batches, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tenderly/nitro/arbos"
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/go-ethereum/common"
+)
+
+func TestBuildBatches(t *testing.T) {
+	streamer, _, _ := NewTransactionStreamerForTest(t, common.Address{})
+	var messages []arbstate.MessageWithMetadata
+	for i := 0; i < 20; i++ {
+		// incompressible, so the messages are spread over several batches
+		l2msg := make([]byte, 200)
+		rand.Read(l2msg)
+		messages = append(messages, arbstate.MessageWithMetadata{
+			Message: &arbos.L1IncomingMessage{
+				Header: &arbos.L1IncomingMessageHeader{
+					Kind:      arbos.L1MessageType_L2Message,
+					Timestamp: uint64(i),
+				},
+				L2msg: l2msg,
+			},
+			DelayedMessagesRead: 1,
+		})
+	}
+	Require(t, streamer.AddMessages(1, false, messages))
+	end := arbutil.MessageIndex(1 + len(messages))
+
+	config := TestBatchPosterConfig
+	config.MaxBatchSize = 1000
+	batches, err := BuildBatches(streamer, 1, end, 7, &config)
+	Require(t, err)
+	if len(batches) < 2 {
+		Fail(t, "messages not split into several batches", len(batches))
+	}
+	pos := arbutil.MessageIndex(1)
+	l2Segments := 0
+	for i, batch := range batches {
+		if batch.FirstMessage != pos || batch.EndMessage <= batch.FirstMessage {
+			Fail(t, "batch", i, "covers messages", batch.FirstMessage, "to", batch.EndMessage, "after", pos)
+		}
+		pos = batch.EndMessage
+		if len(batch.Data) > config.MaxBatchSize {
+			Fail(t, "batch", i, "is", len(batch.Data), "bytes, over the maximum of", config.MaxBatchSize)
+		}
+		if batch.Data[0] != arbstate.BrotliMessageHeaderByte {
+			Fail(t, "batch", i, "has compression header", batch.Data[0])
+		}
+		if batch.EstimatedL1Gas <= uint64(len(batch.Data))*4+config.ExtraBatchGas {
+			Fail(t, "batch", i, "gas estimate", batch.EstimatedL1Gas, "below its calldata cost")
+		}
+		l2Segments += batch.Segments[arbstate.BatchSegmentKindL2Message]
+	}
+	if pos != end {
+		Fail(t, "batches end at message", pos, "instead of", end)
+	}
+	if l2Segments != len(messages) {
+		Fail(t, "batches contain", l2Segments, "L2 message segments instead of", len(messages))
+	}
+}
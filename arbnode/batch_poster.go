@@ -6,10 +6,13 @@ package arbnode
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
+	"github.com/tenderly/nitro/arbnode/dataposter"
 	"github.com/tenderly/nitro/arbos"
 	"github.com/tenderly/nitro/util/headerreader"
 
@@ -17,9 +20,13 @@ import (
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/tenderly/nitro/go-ethereum"
 	"github.com/tenderly/nitro/go-ethereum/accounts/abi/bind"
 	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/rawdb"
 	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+	"github.com/tenderly/nitro/go-ethereum/ethdb"
 	"github.com/tenderly/nitro/go-ethereum/log"
 	"github.com/tenderly/nitro/go-ethereum/params"
 	"github.com/tenderly/nitro/go-ethereum/rlp"
@@ -38,26 +45,34 @@ type BatchPoster struct {
 	streamer            *TransactionStreamer
 	config              *BatchPosterConfig
 	inboxContract       *bridgegen.SequencerInbox
+	inboxAddress        common.Address
+	dataPosters         []*dataposter.DataPoster
 	gasRefunder         common.Address
-	transactOpts        *bind.TransactOpts
+	compressor          BatchCompressor
 	building            *buildingBatch
 	pendingMsgTimestamp time.Time
 	lastBatchCount      uint64
+	inFlight            []inFlightBatch
 	das                 das.DataAvailabilityService
 }
 
 type BatchPosterConfig struct {
-	Enable                             bool          `koanf:"enable"`
-	DisableDasFallbackStoreDataOnChain bool          `koanf:"disable-das-fallback-store-data-on-chain"`
-	MaxBatchSize                       int           `koanf:"max-size"`
-	MaxBatchPostInterval               time.Duration `koanf:"max-interval"`
-	BatchPollDelay                     time.Duration `koanf:"poll-delay"`
-	PostingErrorDelay                  time.Duration `koanf:"error-delay"`
-	CompressionLevel                   int           `koanf:"compression-level"`
-	DASRetentionPeriod                 time.Duration `koanf:"das-retention-period"`
-	HighGasThreshold                   float32       `koanf:"high-gas-threshold"`
-	HighGasDelay                       time.Duration `koanf:"high-gas-delay"`
-	GasRefunderAddress                 string        `koanf:"gas-refunder-address"`
+	Enable                             bool                        `koanf:"enable"`
+	DisableDasFallbackStoreDataOnChain bool                        `koanf:"disable-das-fallback-store-data-on-chain"`
+	MaxBatchSize                       int                         `koanf:"max-size"`
+	MaxBatchPostInterval               time.Duration               `koanf:"max-interval"`
+	BatchPollDelay                     time.Duration               `koanf:"poll-delay"`
+	PostingErrorDelay                  time.Duration               `koanf:"error-delay"`
+	Compression                        string                      `koanf:"compression"`
+	CompressionLevel                   int                         `koanf:"compression-level"`
+	DASRetentionPeriod                 time.Duration               `koanf:"das-retention-period"`
+	HighGasThreshold                   float32                     `koanf:"high-gas-threshold"`
+	HighGasDelay                       time.Duration               `koanf:"high-gas-delay"`
+	GasRefunderAddress                 string                      `koanf:"gas-refunder-address"`
+	MaxInFlightBatches                 int                         `koanf:"max-in-flight-batches"`
+	ExtraBatchGas                      uint64                      `koanf:"extra-batch-gas"`
+	ExtraPrivateKeys                   []string                    `koanf:"extra-private-keys"`
+	DataPoster                         dataposter.DataPosterConfig `koanf:"data-poster"`
 }
 
 func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -67,11 +82,16 @@ func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".max-interval", DefaultBatchPosterConfig.MaxBatchPostInterval, "maximum batch posting interval")
 	f.Duration(prefix+".poll-delay", DefaultBatchPosterConfig.BatchPollDelay, "how long to delay after successfully posting batch")
 	f.Duration(prefix+".error-delay", DefaultBatchPosterConfig.PostingErrorDelay, "how long to delay after error posting batch")
+	f.String(prefix+".compression", DefaultBatchPosterConfig.Compression, "batch compression format, either \"brotli\" or \"zstd\" (brotli is used until ArbOS decodes zstd batches)")
 	f.Int(prefix+".compression-level", DefaultBatchPosterConfig.CompressionLevel, "batch compression level")
 	f.Duration(prefix+".das-retention-period", DefaultBatchPosterConfig.DASRetentionPeriod, "In AnyTrust mode, the period which DASes are requested to retain the stored batches.")
 	f.Float32(prefix+".high-gas-threshold", DefaultBatchPosterConfig.HighGasThreshold, "If the gas price in gwei is above this amount, delay posting a batch")
 	f.Duration(prefix+".high-gas-delay", DefaultBatchPosterConfig.HighGasDelay, "The maximum delay while waiting for the gas price to go below the high gas threshold")
 	f.String(prefix+".gas-refunder-address", DefaultBatchPosterConfig.GasRefunderAddress, "The gas refunder contract address (optional)")
+	f.Int(prefix+".max-in-flight-batches", DefaultBatchPosterConfig.MaxInFlightBatches, "maximum number of batches posted to L1 but not yet included")
+	f.Uint64(prefix+".extra-batch-gas", DefaultBatchPosterConfig.ExtraBatchGas, "gas to allow a batch beyond its calldata, used instead of estimating gas while earlier batches are in flight")
+	f.StringSlice(prefix+".extra-private-keys", DefaultBatchPosterConfig.ExtraPrivateKeys, "private keys of additional batch posters to spread in-flight batches across (each must be allowed to post to the sequencer inbox)")
+	dataposter.DataPosterConfigAddOptions(prefix+".data-poster", f)
 }
 
 var DefaultBatchPosterConfig = BatchPosterConfig{
@@ -81,11 +101,16 @@ var DefaultBatchPosterConfig = BatchPosterConfig{
 	BatchPollDelay:                     time.Second * 10,
 	PostingErrorDelay:                  time.Second * 10,
 	MaxBatchPostInterval:               time.Hour,
+	Compression:                        "brotli",
 	CompressionLevel:                   brotli.DefaultCompression,
 	DASRetentionPeriod:                 time.Hour * 24 * 15,
 	HighGasThreshold:                   150.,
 	HighGasDelay:                       14 * time.Hour,
 	GasRefunderAddress:                 "",
+	MaxInFlightBatches:                 1,
+	ExtraBatchGas:                      200_000,
+	ExtraPrivateKeys:                   nil,
+	DataPoster:                         dataposter.DefaultDataPosterConfig,
 }
 
 var TestBatchPosterConfig = BatchPosterConfig{
@@ -94,14 +119,18 @@ var TestBatchPosterConfig = BatchPosterConfig{
 	BatchPollDelay:       time.Millisecond * 10,
 	PostingErrorDelay:    time.Millisecond * 10,
 	MaxBatchPostInterval: 0,
+	Compression:          "brotli",
 	CompressionLevel:     2,
 	DASRetentionPeriod:   time.Hour * 24 * 15,
 	HighGasThreshold:     0.,
 	HighGasDelay:         0,
 	GasRefunderAddress:   "",
+	MaxInFlightBatches:   1,
+	ExtraBatchGas:        200_000,
+	DataPoster:           dataposter.TestDataPosterConfig,
 }
 
-func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, streamer *TransactionStreamer, config *BatchPosterConfig, contractAddress common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService) (*BatchPoster, error) {
+func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, streamer *TransactionStreamer, dataPosterDb ethdb.Database, config *BatchPosterConfig, contractAddress common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService) (*BatchPoster, error) {
 	inboxContract, err := bridgegen.NewSequencerInbox(contractAddress, l1Reader.Client())
 	if err != nil {
 		return nil, err
@@ -109,23 +138,149 @@ func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, st
 	if len(config.GasRefunderAddress) > 0 && !common.IsHexAddress(config.GasRefunderAddress) {
 		return nil, fmt.Errorf("invalid gas refunder address \"%v\"", config.GasRefunderAddress)
 	}
+	compressor, err := BatchCompressorByName(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxInFlightBatches < 1 {
+		return nil, fmt.Errorf("max in-flight batches must be at least 1, got %v", config.MaxInFlightBatches)
+	}
+	auths := []*bind.TransactOpts{transactOpts}
+	for _, hexKey := range config.ExtraPrivateKeys {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra batch poster private key: %w", err)
+		}
+		auths = append(auths, newKeyedTransactor(key))
+	}
+	var dataPosters []*dataposter.DataPoster
+	seen := make(map[common.Address]bool)
+	for _, auth := range auths {
+		if seen[auth.From] {
+			return nil, fmt.Errorf("batch poster address %v configured more than once", auth.From)
+		}
+		seen[auth.From] = true
+		// each key has its own nonces, so it gets its own data poster and table
+		dataPoster, err := dataposter.NewDataPoster(rawdb.NewTable(dataPosterDb, string(auth.From.Bytes())), l1Reader, auth, &config.DataPoster)
+		if err != nil {
+			return nil, err
+		}
+		dataPosters = append(dataPosters, dataPoster)
+	}
 	return &BatchPoster{
 		l1Reader:      l1Reader,
 		inbox:         inbox,
 		streamer:      streamer,
 		config:        config,
 		inboxContract: inboxContract,
-		transactOpts:  transactOpts,
+		inboxAddress:  contractAddress,
+		dataPosters:   dataPosters,
+		compressor:    compressor,
 		gasRefunder:   common.HexToAddress(config.GasRefunderAddress),
 		das:           das,
 	}, nil
 }
 
+// newKeyedTransactor is like bind.NewKeyedTransactorWithChainID, but takes the chain ID from the transaction being signed
+func newKeyedTransactor(key *ecdsa.PrivateKey) *bind.TransactOpts {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return types.SignTx(tx, types.LatestSignerForChainID(tx.ChainId()), key)
+		},
+	}
+}
+
+// inFlightBatch is a batch that's been posted but isn't yet counted by the sequencer inbox
+type inFlightBatch struct {
+	seqNum     uint64
+	msgCount   arbutil.MessageIndex // the message count after this batch
+	delayedMsg uint64               // the delayed message count after this batch
+	dataPoster *dataposter.DataPoster
+	nonce      uint64 // the nonce of the batch's transaction
+}
+
+func (b *BatchPoster) unconfirmedCount() int {
+	count := 0
+	for _, dataPoster := range b.dataPosters {
+		count += dataPoster.UnconfirmedCount()
+	}
+	return count
+}
+
+// selectDataPoster returns the data poster with the fewest unconfirmed transactions
+func (b *BatchPoster) selectDataPoster() *dataposter.DataPoster {
+	selected := b.dataPosters[0]
+	for _, dataPoster := range b.dataPosters[1:] {
+		if dataPoster.UnconfirmedCount() < selected.UnconfirmedCount() {
+			selected = dataPoster
+		}
+	}
+	return selected
+}
+
+// compressorForBatch falls back to brotli until the batch starting after msgCount messages would be read
+// at an ArbOS version which decodes the configured compression
+func (b *BatchPoster) compressorForBatch(msgCount arbutil.MessageIndex) (BatchCompressor, error) {
+	requiredVersion := arbstate.BatchCompressionArbOSVersion(b.compressor.HeaderByte())
+	if requiredVersion == 0 {
+		return b.compressor, nil
+	}
+	version, err := b.streamer.ArbOSVersionAfterMessages(msgCount)
+	if errors.Is(err, errMessagesNotExecuted) {
+		return brotliBatchCompressor{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if version < requiredVersion {
+		return brotliBatchCompressor{}, nil
+	}
+	return b.compressor, nil
+}
+
+// dasStoreContext asks the DAS to store the batch starting after msgCount messages whole, rather than erasure coded,
+// unless it's known to be read at an ArbOS version which accepts erasure coded certificates
+func (b *BatchPoster) dasStoreContext(ctx context.Context, msgCount arbutil.MessageIndex) (context.Context, error) {
+	version, err := b.streamer.ArbOSVersionAfterMessages(msgCount)
+	if errors.Is(err, errMessagesNotExecuted) {
+		return das.WithStoreWhole(ctx), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if version < arbstate.ErasureCodedCertificateArbOSVersion {
+		return das.WithStoreWhole(ctx), nil
+	}
+	return ctx, nil
+}
+
+// checkDASCertVersion returns an error if the certificate is erasure coded but the batch starting after msgCount
+// messages might be read at an ArbOS version before those are accepted, in case the DAS didn't store it whole as asked
+func (b *BatchPoster) checkDASCertVersion(cert *arbstate.DataAvailabilityCertificate, msgCount arbutil.MessageIndex) error {
+	if cert.Version != arbstate.ErasureCodedCertificateVersion {
+		return nil
+	}
+	version, err := b.streamer.ArbOSVersionAfterMessages(msgCount)
+	if errors.Is(err, errMessagesNotExecuted) {
+		return errors.New("can't post an erasure coded DAS certificate before the ArbOS version accepting it is known to be active")
+	} else if err != nil {
+		return err
+	}
+	if version < arbstate.ErasureCodedCertificateArbOSVersion {
+		return fmt.Errorf("can't post an erasure coded DAS certificate at ArbOS version %v, before %v", version, arbstate.ErasureCodedCertificateArbOSVersion)
+	}
+	return nil
+}
+
 var errBatchAlreadyClosed = errors.New("batch segments already closed")
 
 type batchSegments struct {
 	compressedBuffer    *bytes.Buffer
-	compressedWriter    *brotli.Writer
+	compressedWriter    BatchCompressionWriter
+	compressor          BatchCompressor
 	rawSegments         [][]byte
 	timestamp           uint64
 	blockNum            uint64
@@ -144,24 +299,33 @@ type buildingBatch struct {
 	msgCount    arbutil.MessageIndex
 }
 
-func newBatchSegments(firstDelayed uint64, config *BatchPosterConfig) *batchSegments {
+func newBatchSegments(firstDelayed uint64, config *BatchPosterConfig, compressor BatchCompressor) (*batchSegments, error) {
 	compressedBuffer := bytes.NewBuffer(make([]byte, 0, config.MaxBatchSize*2))
 	if config.MaxBatchSize <= 40 {
 		panic("MaxBatchSize too small")
 	}
+	compressedWriter, err := compressor.NewWriter(compressedBuffer, config.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
 	return &batchSegments{
 		compressedBuffer: compressedBuffer,
-		compressedWriter: brotli.NewWriterLevel(compressedBuffer, config.CompressionLevel),
+		compressedWriter: compressedWriter,
+		compressor:       compressor,
 		sizeLimit:        config.MaxBatchSize - 40, // TODO
 		compressionLevel: config.CompressionLevel,
 		rawSegments:      make([][]byte, 0, 128),
 		delayedMsg:       firstDelayed,
-	}
+	}, nil
 }
 
 func (s *batchSegments) recompressAll() error {
 	s.compressedBuffer = bytes.NewBuffer(make([]byte, 0, s.sizeLimit*2))
-	s.compressedWriter = brotli.NewWriterLevel(s.compressedBuffer, s.compressionLevel)
+	compressedWriter, err := s.compressor.NewWriter(s.compressedBuffer, s.compressionLevel)
+	if err != nil {
+		return err
+	}
+	s.compressedWriter = compressedWriter
 	s.newUncompressedSize = 0
 	for _, segment := range s.rawSegments {
 		err := s.addSegmentToCompressed(segment)
@@ -326,36 +490,98 @@ func (s *batchSegments) CloseAndGetBytes() ([]byte, error) {
 	}
 	compressedBytes := s.compressedBuffer.Bytes()
 	fullMsg := make([]byte, 1, len(compressedBytes)+1)
-	fullMsg[0] = arbstate.BrotliMessageHeaderByte
+	fullMsg[0] = s.compressor.HeaderByte()
 	fullMsg = append(fullMsg, compressedBytes...)
 	return fullMsg, nil
 }
 
-func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum uint64) (*types.Transaction, error) {
-	inboxContractCount, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx, Pending: true})
+// updateInFlight drops the in-flight batches counted by the sequencer inbox, given the inbox batch count and,
+// as of before it was read, the number of unconfirmed batch transactions and which in-flight batches' transactions were included.
+// It returns false if no batch should be posted yet.
+func (b *BatchPoster) updateInFlight(batchCount uint64, unconfirmed int, included []bool) bool {
+	for len(b.inFlight) > 0 && b.inFlight[0].seqNum < batchCount {
+		b.inFlight = b.inFlight[1:]
+		included = included[1:]
+	}
+	if len(b.inFlight) > 0 && unconfirmed == 0 {
+		// All batch transactions were included, but some batches didn't make it into the inbox.
+		// Batches from different keys can be included out of order and revert, and reorgs can drop them, so post them again.
+		log.Warn("BatchPoster: in-flight batches missing from sequencer inbox, reposting", "from", b.inFlight[0].seqNum, "count", len(b.inFlight), "inboxBatchCount", batchCount)
+		b.inFlight = nil
+		included = nil
+		b.building = nil
+	}
+	if len(b.inFlight) == 0 && unconfirmed > 0 {
+		// The batch transactions were posted before a restart, so we don't know which batches they contain.
+		// The data posters will replace them if they're stuck, so wait for them to be included.
+		log.Debug("BatchPoster: waiting for batch transactions to be included", "unconfirmed", unconfirmed)
+		return false
+	}
+	for i, batchIncluded := range included {
+		if batchIncluded {
+			// The batch's transaction was included but the inbox didn't count it, so it reverted, most likely by landing
+			// before an earlier batch posted with another key. Every batch after it will revert too, and reposting it now
+			// could race them, so stop posting until all the in-flight transactions are included and then post them again.
+			log.Warn("BatchPoster: in-flight batch reverted, waiting for later batches before reposting", "seqNum", b.inFlight[i].seqNum, "inboxBatchCount", batchCount, "unconfirmed", unconfirmed)
+			return false
+		}
+	}
+	return len(b.inFlight) < b.config.MaxInFlightBatches
+}
+
+func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, trackerBatchCount uint64) (*types.Transaction, error) {
+	// Read which batch transactions were included before the batch count,
+	// so that a batch included in between isn't mistaken for a lost or reverted one.
+	included := make([]bool, len(b.inFlight))
+	for i, batch := range b.inFlight {
+		included[i] = batch.dataPoster.IsIncluded(batch.nonce)
+	}
+	unconfirmed := b.unconfirmedCount()
+	inboxContractCount, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx})
 	if err != nil {
 		return nil, err
 	}
+	batchCount := inboxContractCount.Uint64()
+	if !b.updateInFlight(batchCount, unconfirmed, included) {
+		return nil, nil
+	}
 	timeSinceNextMessage := time.Since(b.pendingMsgTimestamp)
-	if !arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum)) {
-		// If it's been under a minute since the last batch was posted, and the inbox tracker is exactly one batch behind,
-		// then there isn't an error. We're just waiting for the inbox tracker to read the most recently posted batch.
-		if timeSinceNextMessage <= time.Minute && arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum+1)) {
-			return nil, nil
+	var batchSeqNum uint64
+	var prevBatchMeta BatchMetadata
+	if len(b.inFlight) > 0 {
+		last := b.inFlight[len(b.inFlight)-1]
+		batchSeqNum = last.seqNum + 1
+		prevBatchMeta.MessageCount = last.msgCount
+		prevBatchMeta.DelayedMessageCount = last.delayedMsg
+	} else {
+		batchSeqNum = batchCount
+		if trackerBatchCount < batchCount {
+			// If it's been under a minute since the last batch was posted, and the inbox tracker is exactly one batch behind,
+			// then there isn't an error. We're just waiting for the inbox tracker to read the most recently posted batch.
+			if timeSinceNextMessage <= time.Minute && trackerBatchCount+1 == batchCount {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("inbox tracker not synced: contract has %v batches but inbox tracker has %v", batchCount, trackerBatchCount)
+		}
+		if batchSeqNum > 0 {
+			var err error
+			prevBatchMeta, err = b.inbox.GetBatchMetadata(batchSeqNum - 1)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return nil, fmt.Errorf("inbox tracker not synced: contract has %v batches but inbox tracker has %v", inboxContractCount, batchSeqNum)
 	}
-	var prevBatchMeta BatchMetadata
-	if batchSeqNum > 0 {
-		var err error
-		prevBatchMeta, err = b.inbox.GetBatchMetadata(batchSeqNum - 1)
+	if b.building == nil || b.building.batchSeqNum != batchSeqNum {
+		compressor, err := b.compressorForBatch(prevBatchMeta.MessageCount)
+		if err != nil {
+			return nil, err
+		}
+		segments, err := newBatchSegments(prevBatchMeta.DelayedMessageCount, b.config, compressor)
 		if err != nil {
 			return nil, err
 		}
-	}
-	if b.building == nil || b.building.batchSeqNum != batchSeqNum {
 		b.building = &buildingBatch{
-			segments:    newBatchSegments(prevBatchMeta.DelayedMessageCount, b.config),
+			segments:    segments,
 			msgCount:    prevBatchMeta.MessageCount,
 			batchSeqNum: batchSeqNum,
 		}
@@ -412,7 +638,14 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum u
 	}
 
 	if b.das != nil {
-		cert, err := b.das.Store(ctx, sequencerMsg, uint64(time.Now().Add(b.config.DASRetentionPeriod).Unix()), []byte{}) // b.das will append signature if enabled
+		storeCtx, err := b.dasStoreContext(ctx, prevBatchMeta.MessageCount)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := b.das.Store(storeCtx, sequencerMsg, uint64(time.Now().Add(b.config.DASRetentionPeriod).Unix()), []byte{}) // b.das will append signature if enabled
+		if err == nil {
+			err = b.checkDASCertVersion(cert, prevBatchMeta.MessageCount)
+		}
 		if err != nil {
 			log.Warn("Unable to batch to DAS, falling back to storing data on chain", "err", err)
 			if b.config.DisableDasFallbackStoreDataOnChain {
@@ -423,59 +656,61 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum u
 		}
 	}
 
-	txOpts := *b.transactOpts
-	txOpts.Context = ctx
-	txOpts.NoSend = true
-	tx, err := b.inboxContract.AddSequencerL2BatchFromOrigin(&txOpts, new(big.Int).SetUint64(batchSeqNum), sequencerMsg, new(big.Int).SetUint64(b.building.segments.delayedMsg), b.gasRefunder)
+	data, err := sequencerBridgeABI.Pack("addSequencerL2BatchFromOrigin", new(big.Int).SetUint64(batchSeqNum), sequencerMsg, new(big.Int).SetUint64(b.building.segments.delayedMsg), b.gasRefunder)
 	if err != nil {
 		return nil, err
 	}
-	highGasThreshold := new(big.Int).SetUint64(uint64(b.config.HighGasThreshold * params.GWei))
-	if b.config.HighGasThreshold != 0 && tx.GasFeeCap().Cmp(highGasThreshold) >= 0 && timeSinceNextMessage < b.config.HighGasDelay {
-		// The gas fee cap abigen recommended is above the high gas threshold. Check if this is necessary:
-		lastHeader, err := b.l1Reader.LastHeader(ctx)
+	dataPoster := b.selectDataPoster()
+	var gas uint64
+	if len(b.inFlight) == 0 {
+		gas, err = b.l1Reader.Client().EstimateGas(ctx, ethereum.CallMsg{
+			From: dataPoster.From(),
+			To:   &b.inboxAddress,
+			Data: data,
+		})
 		if err != nil {
 			return nil, err
 		}
-		if lastHeader.BaseFee.Cmp(highGasThreshold) >= 0 {
-			log.Info(
-				"not posting batch yet as gas price is high",
-				"baseFee", float32(lastHeader.BaseFee.Uint64())/params.GWei,
-				"highGasThreshold", b.config.HighGasThreshold,
-				"timeSinceBatchPosted", timeSinceNextMessage,
-				"highGasDelay", b.config.HighGasDelay,
-			)
-			return nil, nil
-		} else {
-			// The base fee is below the high gas threshold, so let's lower the gas fee cap and try it.
-			tx = types.NewTx(&types.DynamicFeeTx{
-				ChainID:    tx.ChainId(),
-				Nonce:      tx.Nonce(),
-				GasTipCap:  tx.GasTipCap(),
-				GasFeeCap:  arbmath.BigMulByFrac(highGasThreshold, 6, 5),
-				Gas:        tx.Gas(),
-				To:         tx.To(),
-				Value:      tx.Value(),
-				Data:       tx.Data(),
-				AccessList: tx.AccessList(),
-			})
-			tx, err = txOpts.Signer(txOpts.From, tx)
+	} else {
+		// Estimating gas would revert as the inbox doesn't expect this sequence number yet,
+		// so allow for the calldata and a fixed amount of execution instead.
+		gas = uint64(len(data))*params.TxDataNonZeroGasEIP2028 + b.config.ExtraBatchGas
+	}
+	var maxFeeCap *big.Int
+	if b.config.HighGasThreshold != 0 && timeSinceNextMessage < b.config.HighGasDelay {
+		highGasThreshold := new(big.Int).SetUint64(uint64(b.config.HighGasThreshold * params.GWei))
+		feeCap, _, err := dataPoster.EstimateFees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if feeCap.Cmp(highGasThreshold) >= 0 {
+			// The estimated gas fee cap is above the high gas threshold. Check if this is necessary:
+			lastHeader, err := b.l1Reader.LastHeader(ctx)
 			if err != nil {
 				return nil, err
 			}
+			if lastHeader.BaseFee.Cmp(highGasThreshold) >= 0 {
+				log.Info(
+					"not posting batch yet as gas price is high",
+					"baseFee", float32(lastHeader.BaseFee.Uint64())/params.GWei,
+					"highGasThreshold", b.config.HighGasThreshold,
+					"timeSinceBatchPosted", timeSinceNextMessage,
+					"highGasDelay", b.config.HighGasDelay,
+				)
+				return nil, nil
+			}
+			// The base fee is below the high gas threshold, so let's lower the gas fee cap and try it.
+			maxFeeCap = arbmath.BigMulByFrac(highGasThreshold, 6, 5)
 		}
 	}
-	err = b.l1Reader.Client().SendTransaction(ctx, tx)
+	tx, err := dataPoster.PostTransaction(ctx, b.inboxAddress, data, gas, maxFeeCap, arbmath.UintToBig(batchSeqNum).Bytes())
 	if err != nil {
 		return nil, err
 	}
 	postingMsgCount := b.building.msgCount
+	b.inFlight = append(b.inFlight, inFlightBatch{batchSeqNum, postingMsgCount, b.building.segments.delayedMsg, dataPoster, tx.Nonce()})
 	log.Info("BatchPoster: batch sent", "tx", tx.Hash(), "sequence nr.", batchSeqNum, "from", prevBatchMeta.MessageCount, "to", postingMsgCount, "prev delayed", prevBatchMeta.DelayedMessageCount, "current delayed", b.building.segments.delayedMsg, "total segments", len(b.building.segments.rawSegments))
 	b.building = nil
-	_, err = b.l1Reader.WaitForTxApproval(ctx, tx)
-	if err != nil {
-		return tx, err
-	}
 	if postingMsgCount < msgCount {
 		msg, err := b.streamer.GetMessage(postingMsgCount)
 		if err != nil {
@@ -518,21 +753,25 @@ func (b *BatchPoster) recomputePendingMsgTimestamp(ctx context.Context, batchCou
 
 func (b *BatchPoster) Start(ctxIn context.Context) {
 	b.StopWaiter.Start(ctxIn)
+	for _, dataPoster := range b.dataPosters {
+		dataPoster.Start(b.GetContext())
+	}
 	b.CallIteratively(func(ctx context.Context) time.Duration {
-		batchSeqNum, err := b.inbox.GetBatchCount()
+		batchCount, err := b.inbox.GetBatchCount()
 		if err != nil {
 			log.Error("error getting inbox batch count", "err", err)
 			return b.config.PostingErrorDelay
 		}
-		if batchSeqNum != b.lastBatchCount {
-			err := b.recomputePendingMsgTimestamp(ctx, batchSeqNum)
+		// while batches are in flight, the inbox tracker is behind the messages already posted
+		if batchCount != b.lastBatchCount && len(b.inFlight) == 0 {
+			err := b.recomputePendingMsgTimestamp(ctx, batchCount)
 			if err != nil {
 				log.Error("error getting next message time", "err", err)
 				return b.config.PostingErrorDelay
 			}
-			b.lastBatchCount = batchSeqNum
+			b.lastBatchCount = batchCount
 		}
-		_, err = b.maybePostSequencerBatch(ctx, batchSeqNum)
+		_, err = b.maybePostSequencerBatch(ctx, batchCount)
 		if err != nil {
 			b.building = nil
 			log.Error("error posting batch", "err", err)
@@ -541,3 +780,10 @@ func (b *BatchPoster) Start(ctxIn context.Context) {
 		return b.config.BatchPollDelay
 	})
 }
+
+func (b *BatchPoster) StopAndWait() {
+	b.StopWaiter.StopAndWait()
+	for _, dataPoster := range b.dataPosters {
+		dataPoster.StopAndWait()
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"testing"
+)
+
+func TestBatchPosterInFlightRevert(t *testing.T) {
+	config := TestBatchPosterConfig
+	config.MaxInFlightBatches = 4
+	b := &BatchPoster{config: &config}
+	b.inFlight = []inFlightBatch{
+		{seqNum: 5, msgCount: 10},
+		{seqNum: 6, msgCount: 20},
+		{seqNum: 7, msgCount: 30},
+	}
+	b.building = &buildingBatch{batchSeqNum: 8}
+
+	// batch 5 landed, and batch 7 from another key was included before batch 6 and reverted
+	if b.updateInFlight(6, 1, []bool{true, false, true}) {
+		t.Fatal("posted more batches after an in-flight batch reverted")
+	}
+	if len(b.inFlight) != 2 || b.inFlight[0].seqNum != 6 {
+		t.Fatal("unexpected in-flight batches", b.inFlight)
+	}
+	if b.building == nil {
+		t.Fatal("dropped the batch being built while batches are still in flight")
+	}
+
+	// batch 6 landed after it, so batch 7 is the only one left, still reverted
+	if !b.updateInFlight(7, 0, []bool{true, true}) {
+		t.Fatal("the reverted batch wasn't reposted from the inbox's batch count")
+	}
+	if len(b.inFlight) != 0 || b.building != nil {
+		t.Fatal("reverted batch still in flight", b.inFlight)
+	}
+
+	// batches posted by different keys which haven't been included yet don't hold up posting
+	b.inFlight = []inFlightBatch{
+		{seqNum: 7, msgCount: 30},
+		{seqNum: 8, msgCount: 40},
+	}
+	if !b.updateInFlight(7, 2, []bool{false, false}) {
+		t.Fatal("stopped posting with room for more in-flight batches")
+	}
+	b.inFlight = append(b.inFlight, inFlightBatch{seqNum: 9}, inFlightBatch{seqNum: 10})
+	if b.updateInFlight(7, 4, []bool{false, false, false, false}) {
+		t.Fatal("posted more than the maximum in-flight batches")
+	}
+}
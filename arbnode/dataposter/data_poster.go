@@ -0,0 +1,519 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+// Package dataposter sends transactions to L1, keeping track of their nonces and
+// replacing them with higher fees if they aren't included in time.
+// In-flight transactions are persisted so they survive a restart.
+package dataposter
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/go-ethereum/accounts/abi/bind"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/ethdb"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/params"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+	"github.com/tenderly/nitro/go-ethereum/rpc"
+	"github.com/tenderly/nitro/util/arbmath"
+	"github.com/tenderly/nitro/util/headerreader"
+	"github.com/tenderly/nitro/util/stopwaiter"
+)
+
+type DataPosterConfig struct {
+	ReplacementBlocks uint64  `koanf:"replacement-blocks"`
+	FeeBumpPercent    uint64  `koanf:"fee-bump-percent"`
+	BaseFeeBlocks     int     `koanf:"base-fee-blocks"`
+	MinTipCapGwei     float64 `koanf:"min-tip-cap-gwei"`
+	MaxFeeCapGwei     float64 `koanf:"max-fee-cap-gwei"`
+
+	FallbackFinalityBlocks uint64 `koanf:"fallback-finality-blocks"`
+}
+
+func DataPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Uint64(prefix+".replacement-blocks", DefaultDataPosterConfig.ReplacementBlocks, "number of L1 blocks to wait for a transaction to be included before replacing it with higher fees")
+	f.Uint64(prefix+".fee-bump-percent", DefaultDataPosterConfig.FeeBumpPercent, "percentage to increase the fee cap and tip cap by when replacing a transaction (L1 nodes require at least 10)")
+	f.Int(prefix+".base-fee-blocks", DefaultDataPosterConfig.BaseFeeBlocks, "number of recent L1 headers whose highest base fee the fee cap is estimated from")
+	f.Float64(prefix+".min-tip-cap-gwei", DefaultDataPosterConfig.MinTipCapGwei, "the minimum tip cap to post transactions at")
+	f.Float64(prefix+".max-fee-cap-gwei", DefaultDataPosterConfig.MaxFeeCapGwei, "the maximum fee cap to post transactions at, including when replacing them")
+	f.Uint64(prefix+".fallback-finality-blocks", DefaultDataPosterConfig.FallbackFinalityBlocks, "number of L1 blocks after which an included transaction is forgotten if the L1 node doesn't report a finalized block")
+}
+
+var DefaultDataPosterConfig = DataPosterConfig{
+	ReplacementBlocks: 5,
+	FeeBumpPercent:    25,
+	BaseFeeBlocks:     10,
+	MinTipCapGwei:     0.05,
+	MaxFeeCapGwei:     500,
+
+	FallbackFinalityBlocks: 64,
+}
+
+var TestDataPosterConfig = DataPosterConfig{
+	ReplacementBlocks: 2,
+	FeeBumpPercent:    25,
+	BaseFeeBlocks:     2,
+	MinTipCapGwei:     0.05,
+	MaxFeeCapGwei:     500,
+
+	FallbackFinalityBlocks: 2,
+}
+
+// storedTx is the persisted form of an in-flight transaction
+type storedTx struct {
+	Tx        []byte // the binary encoding of the latest signed version of the transaction
+	Meta      []byte // opaque data the caller attached to the transaction
+	SentBlock uint64 // the L1 block number when the transaction was last broadcast
+}
+
+type queuedTx struct {
+	tx        *types.Transaction
+	meta      []byte
+	sentBlock uint64
+	rejected  bool // whether the L1 node rejected the transaction in a way replacing it won't fix
+}
+
+type DataPoster struct {
+	stopwaiter.StopWaiter
+	headerReader *headerreader.HeaderReader
+	auth         *bind.TransactOpts
+	db           ethdb.Database
+	config       *DataPosterConfig
+
+	mutex         sync.Mutex
+	nonce         uint64 // the next nonce to use, valid once initialized
+	nonceSet      bool
+	includedNonce uint64 // transactions below this nonce are included in the latest L1 block, but kept until finalized
+	queue         map[uint64]*queuedTx
+	baseFees      []*big.Int // the base fees of the most recent L1 headers, oldest first
+	lastBlock     uint64
+}
+
+// NewDataPoster creates a data poster persisting its in-flight transactions in db,
+// which should be a table used only by this data poster.
+func NewDataPoster(db ethdb.Database, headerReader *headerreader.HeaderReader, auth *bind.TransactOpts, config *DataPosterConfig) (*DataPoster, error) {
+	if config.FeeBumpPercent < 10 {
+		return nil, fmt.Errorf("data poster fee bump percent %v is below the minimum of 10", config.FeeBumpPercent)
+	}
+	p := &DataPoster{
+		headerReader: headerReader,
+		auth:         auth,
+		db:           db,
+		config:       config,
+		queue:        make(map[uint64]*queuedTx),
+	}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func nonceKey(nonce uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, nonce)
+	return key
+}
+
+func (p *DataPoster) load() error {
+	iter := p.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		var stored storedTx
+		if err := rlp.DecodeBytes(iter.Value(), &stored); err != nil {
+			return err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(stored.Tx); err != nil {
+			return err
+		}
+		p.queue[tx.Nonce()] = &queuedTx{tx, stored.Meta, stored.SentBlock, false}
+	}
+	return iter.Error()
+}
+
+func (p *DataPoster) persist(queued *queuedTx) error {
+	txBytes, err := queued.tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	value, err := rlp.EncodeToBytes(&storedTx{txBytes, queued.meta, queued.sentBlock})
+	if err != nil {
+		return err
+	}
+	return p.db.Put(nonceKey(queued.tx.Nonce()), value)
+}
+
+func (p *DataPoster) From() common.Address {
+	return p.auth.From
+}
+
+// UnconfirmedCount returns the number of transactions posted but not yet included in an L1 block
+func (p *DataPoster) UnconfirmedCount() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	count := 0
+	for nonce := range p.queue {
+		if nonce >= p.includedNonce {
+			count++
+		}
+	}
+	return count
+}
+
+// IsIncluded returns whether the transaction with the given nonce is included in the latest L1 block the data poster has seen
+func (p *DataPoster) IsIncluded(nonce uint64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return nonce < p.includedNonce
+}
+
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(params.GWei)).Int(nil)
+	return wei
+}
+
+// must hold mutex
+func (p *DataPoster) recordBaseFee(header *types.Header) {
+	if header.BaseFee == nil || header.Number.Uint64() <= p.lastBlock {
+		return
+	}
+	p.lastBlock = header.Number.Uint64()
+	p.baseFees = append(p.baseFees, header.BaseFee)
+	if len(p.baseFees) > p.config.BaseFeeBlocks {
+		p.baseFees = p.baseFees[len(p.baseFees)-p.config.BaseFeeBlocks:]
+	}
+}
+
+// EstimateFees returns the fee cap and tip cap a new transaction would be posted at
+func (p *DataPoster) EstimateFees(ctx context.Context) (*big.Int, *big.Int, error) {
+	header, err := p.headerReader.LastHeader(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tipCap, err := p.headerReader.Client().SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.recordBaseFee(header)
+	return p.estimateFeesImpl(tipCap)
+}
+
+// must hold mutex
+func (p *DataPoster) estimateFeesImpl(suggestedTipCap *big.Int) (*big.Int, *big.Int, error) {
+	if len(p.baseFees) == 0 {
+		return nil, nil, errors.New("no L1 base fee known")
+	}
+	maxBaseFee := p.baseFees[0]
+	for _, baseFee := range p.baseFees[1:] {
+		maxBaseFee = arbmath.BigMax(maxBaseFee, baseFee)
+	}
+	tipCap := arbmath.BigMax(suggestedTipCap, gweiToWei(p.config.MinTipCapGwei))
+	// leave room for the base fee to double before the transaction is priced out
+	feeCap := arbmath.BigAdd(arbmath.BigMulByUint(maxBaseFee, 2), tipCap)
+	maxFeeCap := gweiToWei(p.config.MaxFeeCapGwei)
+	if feeCap.Cmp(maxFeeCap) > 0 {
+		feeCap = maxFeeCap
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = feeCap
+	}
+	return feeCap, tipCap, nil
+}
+
+// PostTransaction signs and sends a transaction with the next nonce, and keeps it in flight until it's included.
+// If maxFeeCap is non-nil, the initial fee cap is limited to it, although replacements may exceed it.
+func (p *DataPoster) PostTransaction(ctx context.Context, to common.Address, calldata []byte, gasLimit uint64, maxFeeCap *big.Int, meta []byte) (*types.Transaction, error) {
+	header, err := p.headerReader.LastHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	suggestedTipCap, err := p.headerReader.Client().SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainId, err := p.headerReader.Client().ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := p.queueTransaction(ctx, header, suggestedTipCap, chainId, to, calldata, gasLimit, maxFeeCap, meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.send(ctx, tx); err != nil {
+		// unless it was rejected outright, it'll be rebroadcast once the replacement period has passed
+		log.Warn("failed to send data poster transaction", "tx", tx.Hash(), "nonce", tx.Nonce(), "err", err)
+	}
+	return tx, nil
+}
+
+// queueTransaction signs a transaction with the next nonce and keeps it in flight, ready to be sent
+func (p *DataPoster) queueTransaction(
+	ctx context.Context, header *types.Header, suggestedTipCap *big.Int, chainId *big.Int,
+	to common.Address, calldata []byte, gasLimit uint64, maxFeeCap *big.Int, meta []byte,
+) (*types.Transaction, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.nonceSet {
+		if err := p.initializeNonce(ctx); err != nil {
+			return nil, err
+		}
+	}
+	p.recordBaseFee(header)
+	feeCap, tipCap, err := p.estimateFeesImpl(suggestedTipCap)
+	if err != nil {
+		return nil, err
+	}
+	if maxFeeCap != nil && feeCap.Cmp(maxFeeCap) > 0 {
+		feeCap = maxFeeCap
+		if tipCap.Cmp(feeCap) > 0 {
+			tipCap = feeCap
+		}
+	}
+	tx, err := p.auth.Signer(p.auth.From, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainId,
+		Nonce:     p.nonce,
+		GasTipCap: tipCap,
+		GasFeeCap: feeCap,
+		Gas:       gasLimit,
+		To:        &to,
+		Data:      calldata,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	queued := &queuedTx{tx, meta, header.Number.Uint64(), false}
+	// persist before sending, so that after a crash we know about the transaction even if it got broadcast
+	if err := p.persist(queued); err != nil {
+		return nil, err
+	}
+	p.queue[tx.Nonce()] = queued
+	p.nonce++
+	return tx, nil
+}
+
+// permanentSendErrors are the errors an L1 node rejects a transaction with which sending it again,
+// even with higher fees, won't fix
+var permanentSendErrors = []error{
+	core.ErrIntrinsicGas,
+	core.ErrGasLimit,
+	core.ErrOversizedData,
+	core.ErrNegativeValue,
+	core.ErrInvalidSender,
+	core.ErrSenderNoEOA,
+	core.ErrTxTypeNotSupported,
+	core.ErrTipAboveFeeCap,
+	core.ErrTipVeryHigh,
+	core.ErrFeeCapVeryHigh,
+}
+
+// isPermanentSendError returns whether the L1 node will never accept the transaction it rejected with err.
+// Errors returned over RPC only keep their message, so they're matched on that too.
+func isPermanentSendError(err error) bool {
+	for _, permanent := range permanentSendErrors {
+		if errors.Is(err, permanent) || strings.Contains(err.Error(), permanent.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// send broadcasts the transaction without holding the mutex, so a slow L1 node doesn't block the data poster.
+// If the L1 node rejects it permanently, it's no longer replaced, which leaves its nonce for the operator to fix.
+func (p *DataPoster) send(ctx context.Context, tx *types.Transaction) error {
+	err := p.headerReader.Client().SendTransaction(ctx, tx)
+	if err == nil || !isPermanentSendError(err) {
+		return err
+	}
+	log.Error("L1 node rejected data poster transaction, no longer replacing it", "tx", tx.Hash(), "nonce", tx.Nonce(), "err", err)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if queued := p.queue[tx.Nonce()]; queued != nil && queued.tx.Hash() == tx.Hash() {
+		queued.rejected = true
+	}
+	return err
+}
+
+// must hold mutex
+func (p *DataPoster) initializeNonce(ctx context.Context) error {
+	nonce, err := p.headerReader.Client().PendingNonceAt(ctx, p.auth.From)
+	if err != nil {
+		return err
+	}
+	for queuedNonce := range p.queue {
+		if queuedNonce >= nonce {
+			nonce = queuedNonce + 1
+		}
+	}
+	p.nonce = nonce
+	p.nonceSet = true
+	return nil
+}
+
+func bumpFee(old *big.Int, percent uint64) *big.Int {
+	return arbmath.BigDivByUint(arbmath.BigMulByUint(old, 100+percent), 100)
+}
+
+// replacement returns the transaction to send in place of the queued one, which is either a replacement with higher fees,
+// or the queued transaction itself if its fee cap is at the maximum.
+// must hold mutex
+func (p *DataPoster) replacement(queued *queuedTx, blockNum uint64, suggestedTipCap *big.Int) (*types.Transaction, error) {
+	feeCap, tipCap, err := p.estimateFeesImpl(suggestedTipCap)
+	if err != nil {
+		return nil, err
+	}
+	oldTx := queued.tx
+	tipCap = arbmath.BigMax(tipCap, bumpFee(oldTx.GasTipCap(), p.config.FeeBumpPercent))
+	feeCap = arbmath.BigMax(feeCap, bumpFee(oldTx.GasFeeCap(), p.config.FeeBumpPercent))
+	maxFeeCap := gweiToWei(p.config.MaxFeeCapGwei)
+	if feeCap.Cmp(maxFeeCap) > 0 {
+		feeCap = maxFeeCap
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = feeCap
+	}
+	if feeCap.Cmp(bumpFee(oldTx.GasFeeCap(), 10)) < 0 || tipCap.Cmp(bumpFee(oldTx.GasTipCap(), 10)) < 0 {
+		log.Warn("unable to replace data poster transaction as the fee cap is at its maximum", "tx", oldTx.Hash(), "nonce", oldTx.Nonce(), "feeCap", oldTx.GasFeeCap())
+		// rebroadcast the existing transaction in case the L1 node dropped it
+		queued.sentBlock = blockNum
+		if err := p.persist(queued); err != nil {
+			return nil, err
+		}
+		return oldTx, nil
+	}
+	newTx, err := p.auth.Signer(p.auth.From, types.NewTx(&types.DynamicFeeTx{
+		ChainID:    oldTx.ChainId(),
+		Nonce:      oldTx.Nonce(),
+		GasTipCap:  tipCap,
+		GasFeeCap:  feeCap,
+		Gas:        oldTx.Gas(),
+		To:         oldTx.To(),
+		Value:      oldTx.Value(),
+		Data:       oldTx.Data(),
+		AccessList: oldTx.AccessList(),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	replacement := &queuedTx{newTx, queued.meta, blockNum, false}
+	if err := p.persist(replacement); err != nil {
+		return nil, err
+	}
+	p.queue[newTx.Nonce()] = replacement
+	log.Info("replacing data poster transaction", "old", oldTx.Hash(), "new", newTx.Hash(), "nonce", newTx.Nonce(), "feeCap", feeCap, "tipCap", tipCap)
+	return newTx, nil
+}
+
+// finalizedNonce returns the account's nonce as of the latest finalized L1 block,
+// or FallbackFinalityBlocks before header if the L1 node doesn't report a finalized block
+func (p *DataPoster) finalizedNonce(ctx context.Context, header *types.Header) (uint64, error) {
+	client := p.headerReader.Client()
+	finalized, err := client.HeaderByNumber(ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
+	if err == nil && finalized != nil {
+		return client.NonceAt(ctx, p.auth.From, finalized.Number)
+	}
+	log.Debug("L1 node didn't report a finalized block, falling back to a fixed depth", "err", err)
+	blockNum := header.Number.Uint64()
+	if blockNum < p.config.FallbackFinalityBlocks {
+		return 0, nil
+	}
+	return client.NonceAt(ctx, p.auth.From, new(big.Int).SetUint64(blockNum-p.config.FallbackFinalityBlocks))
+}
+
+func (p *DataPoster) update(ctx context.Context, header *types.Header) error {
+	includedNonce, err := p.headerReader.Client().NonceAt(ctx, p.auth.From, header.Number)
+	if err != nil {
+		return err
+	}
+	finalizedNonce, err := p.finalizedNonce(ctx, header)
+	if err != nil {
+		return err
+	}
+	suggestedTipCap, err := p.headerReader.Client().SuggestGasTipCap(ctx)
+	if err != nil {
+		return err
+	}
+	toSend, err := p.updateQueue(header, includedNonce, finalizedNonce, suggestedTipCap)
+	if err != nil {
+		return err
+	}
+	for _, tx := range toSend {
+		if err := p.send(ctx, tx); err != nil {
+			log.Warn("failed to replace data poster transaction", "tx", tx.Hash(), "nonce", tx.Nonce(), "err", err)
+		}
+	}
+	return nil
+}
+
+// updateQueue forgets finalized transactions, and returns the replacements for those which are stuck, to be sent
+// once the mutex is released
+func (p *DataPoster) updateQueue(header *types.Header, includedNonce uint64, finalizedNonce uint64, suggestedTipCap *big.Int) ([]*types.Transaction, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.recordBaseFee(header)
+	p.includedNonce = includedNonce
+	blockNum := header.Number.Uint64()
+	nonces := make([]uint64, 0, len(p.queue))
+	for nonce := range p.queue {
+		nonces = append(nonces, nonce)
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	var toSend []*types.Transaction
+	for _, nonce := range nonces {
+		queued := p.queue[nonce]
+		if nonce < finalizedNonce {
+			if err := p.db.Delete(nonceKey(nonce)); err != nil {
+				return nil, err
+			}
+			delete(p.queue, nonce)
+			continue
+		}
+		if nonce < includedNonce || queued.rejected {
+			// an L1 reorg could still drop an included transaction, in which case it's replaced like any other stuck transaction
+			continue
+		}
+		if blockNum >= queued.sentBlock+p.config.ReplacementBlocks {
+			tx, err := p.replacement(queued, blockNum, suggestedTipCap)
+			if err != nil {
+				log.Warn("failed to replace data poster transaction", "tx", queued.tx.Hash(), "nonce", nonce, "err", err)
+				continue
+			}
+			toSend = append(toSend, tx)
+		}
+	}
+	return toSend, nil
+}
+
+func (p *DataPoster) Start(ctxIn context.Context) {
+	p.StopWaiter.Start(ctxIn)
+	headerChan, unsubscribe := p.headerReader.Subscribe(false)
+	p.LaunchThread(func(ctx context.Context) {
+		defer unsubscribe()
+		for {
+			select {
+			case header, ok := <-headerChan:
+				if !ok {
+					return
+				}
+				if err := p.update(ctx, header); err != nil {
+					log.Warn("failed to update data poster", "err", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,289 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package dataposter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/accounts/abi/bind"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/rawdb"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+	"github.com/tenderly/nitro/go-ethereum/params"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+	"github.com/tenderly/nitro/go-ethereum/rpc"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/util/headerreader"
+)
+
+func TestPersistedQueue(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := rawdb.NewMemoryDatabase()
+	poster, err := NewDataPoster(db, nil, auth, &TestDataPosterConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nonce := uint64(3); nonce < 5; nonce++ {
+		tx, err := auth.Signer(auth.From, types.NewTx(&types.DynamicFeeTx{Nonce: nonce, Gas: 21000}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued := &queuedTx{tx, []byte{byte(nonce)}, 10 + nonce, false}
+		if err := poster.persist(queued); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a restarted data poster must pick up where the previous one left off
+	restarted, err := NewDataPoster(db, nil, auth, &TestDataPosterConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.UnconfirmedCount() != 2 {
+		t.Fatal("unexpected number of unconfirmed transactions", restarted.UnconfirmedCount())
+	}
+	for nonce := uint64(3); nonce < 5; nonce++ {
+		queued := restarted.queue[nonce]
+		if queued == nil || queued.tx.Nonce() != nonce || queued.sentBlock != 10+nonce || !bytes.Equal(queued.meta, []byte{byte(nonce)}) {
+			t.Fatal("transaction not restored", nonce)
+		}
+	}
+}
+
+func TestFeeEstimation(t *testing.T) {
+	config := TestDataPosterConfig
+	config.BaseFeeBlocks = 2
+	config.MaxFeeCapGwei = 100
+	poster, err := NewDataPoster(rawdb.NewMemoryDatabase(), nil, &bind.TransactOpts{}, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gwei := func(amount int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(amount), big.NewInt(params.GWei))
+	}
+	for i, baseFee := range []int64{30, 10, 20} {
+		poster.recordBaseFee(&types.Header{Number: big.NewInt(int64(i + 1)), BaseFee: gwei(baseFee)})
+	}
+
+	// the first header has left the window, so the fee cap is twice the 20 gwei base fee plus the tip
+	feeCap, tipCap, err := poster.estimateFeesImpl(gwei(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeCap.Cmp(gwei(41)) != 0 || tipCap.Cmp(gwei(1)) != 0 {
+		t.Fatal("unexpected fees", feeCap, tipCap)
+	}
+
+	poster.recordBaseFee(&types.Header{Number: big.NewInt(4), BaseFee: gwei(80)})
+	feeCap, _, err = poster.estimateFeesImpl(gwei(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeCap.Cmp(gwei(100)) != 0 {
+		t.Fatal("fee cap not limited to the maximum", feeCap)
+	}
+	if bumpFee(gwei(40), config.FeeBumpPercent).Cmp(gwei(50)) != 0 {
+		t.Fatal("unexpected bumped fee")
+	}
+}
+
+// fakeL1 reports the account's nonce at each block, with finalized standing in for the L1 node's finalized block
+type fakeL1 struct {
+	arbutil.L1Interface
+	nonces    map[uint64]uint64
+	finalized *types.Header
+	sent      []*types.Transaction
+	sendErr   error
+	onSend    func()
+}
+
+func (c *fakeL1) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return c.nonces[blockNumber.Uint64()], nil
+}
+
+func (c *fakeL1) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if number.Int64() != rpc.FinalizedBlockNumber.Int64() {
+		return nil, errors.New("unexpected header request")
+	}
+	if c.finalized == nil {
+		return nil, errors.New("finalized block not found")
+	}
+	return c.finalized, nil
+}
+
+func (c *fakeL1) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(params.GWei), nil
+}
+
+func (c *fakeL1) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.onSend != nil {
+		c.onSend()
+	}
+	c.sent = append(c.sent, tx)
+	return c.sendErr
+}
+
+func TestIncludedTransactionsKeptUntilFinalized(t *testing.T) {
+	ctx := context.Background()
+	key, _ := crypto.GenerateKey()
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := &fakeL1{nonces: make(map[uint64]uint64)}
+	config := TestDataPosterConfig
+	config.MaxFeeCapGwei = 1
+	db := rawdb.NewMemoryDatabase()
+	poster, err := NewDataPoster(db, headerreader.New(l1, headerreader.TestConfig), auth, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx, err := auth.Signer(auth.From, types.NewTx(&types.DynamicFeeTx{
+			Nonce:     nonce,
+			Gas:       21000,
+			GasFeeCap: big.NewInt(params.GWei),
+			GasTipCap: big.NewInt(params.GWei),
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued := &queuedTx{tx, nil, 1, false}
+		if err := poster.persist(queued); err != nil {
+			t.Fatal(err)
+		}
+		poster.queue[nonce] = queued
+	}
+	header := func(number uint64) *types.Header {
+		return &types.Header{Number: new(big.Int).SetUint64(number), BaseFee: big.NewInt(1)}
+	}
+
+	// both transactions are included in the latest block, but only the first is finalized
+	l1.nonces[10] = 2
+	l1.nonces[8] = 1
+	l1.finalized = header(8)
+	if err := poster.update(ctx, header(10)); err != nil {
+		t.Fatal(err)
+	}
+	if poster.queue[0] != nil {
+		t.Fatal("finalized transaction still in flight")
+	}
+	if poster.queue[1] == nil {
+		t.Fatal("transaction forgotten before it was finalized")
+	}
+	if poster.UnconfirmedCount() != 0 {
+		t.Fatal("included transaction counted as unconfirmed")
+	}
+	if len(l1.sent) != 0 {
+		t.Fatal("included transaction rebroadcast")
+	}
+
+	// an L1 reorg drops the second transaction, so it's rebroadcast at the maximum fee and the new sent block is persisted
+	l1.nonces[11] = 1
+	if err := poster.update(ctx, header(11)); err != nil {
+		t.Fatal(err)
+	}
+	if poster.UnconfirmedCount() != 1 {
+		t.Fatal("reorged out transaction not counted as unconfirmed")
+	}
+	if len(l1.sent) != 1 || l1.sent[0].Hash() != poster.queue[1].tx.Hash() {
+		t.Fatal("reorged out transaction not rebroadcast")
+	}
+	var stored storedTx
+	value, err := db.Get(nonceKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rlp.DecodeBytes(value, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.SentBlock != 11 {
+		t.Fatal("rebroadcast transaction persisted with sent block", stored.SentBlock)
+	}
+
+	// without a finalized block from the L1 node, transactions are forgotten at a fixed depth
+	l1.finalized = nil
+	l1.nonces[12] = 2
+	l1.nonces[12-config.FallbackFinalityBlocks] = 2
+	if err := poster.update(ctx, header(12)); err != nil {
+		t.Fatal(err)
+	}
+	if len(poster.queue) != 0 {
+		t.Fatal("transaction not forgotten at the fallback finality depth")
+	}
+}
+
+func TestRejectedTransactionNotReplaced(t *testing.T) {
+	ctx := context.Background()
+	key, _ := crypto.GenerateKey()
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1 := &fakeL1{nonces: make(map[uint64]uint64)}
+	poster, err := NewDataPoster(rawdb.NewMemoryDatabase(), headerreader.New(l1, headerreader.TestConfig), auth, &TestDataPosterConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := auth.Signer(auth.From, types.NewTx(&types.DynamicFeeTx{
+		Nonce:     0,
+		Gas:       1000,
+		GasFeeCap: big.NewInt(params.GWei),
+		GasTipCap: big.NewInt(params.GWei),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := &queuedTx{tx, nil, 1, false}
+	if err := poster.persist(queued); err != nil {
+		t.Fatal(err)
+	}
+	poster.queue[0] = queued
+	header := func(number uint64) *types.Header {
+		return &types.Header{Number: new(big.Int).SetUint64(number), BaseFee: big.NewInt(1)}
+	}
+
+	// the data poster is usable while sending, as this would deadlock if the mutex were held
+	l1.onSend = func() {
+		if poster.UnconfirmedCount() != 1 {
+			t.Error("unexpected number of unconfirmed transactions while sending")
+		}
+	}
+	// errors over RPC only keep their message
+	l1.sendErr = errors.New("intrinsic gas too low: have 1000, want 21000")
+	if err := poster.update(ctx, header(10)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l1.sent) != 1 {
+		t.Fatal("stuck transaction not replaced")
+	}
+	if err := poster.update(ctx, header(20)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l1.sent) != 1 {
+		t.Fatal("transaction replaced again after the L1 node rejected it")
+	}
+
+	// a transient error leaves the transaction to be replaced again
+	l1.sendErr = errors.New("connection refused")
+	poster.queue[0].rejected = false
+	if err := poster.update(ctx, header(30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := poster.update(ctx, header(40)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l1.sent) != 3 {
+		t.Fatal("transaction not replaced after a transient send error", len(l1.sent))
+	}
+}
@@ -6,19 +6,25 @@ package arbnode
 import (
 	"context"
 
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
 	"github.com/tenderly/nitro/go-ethereum/core/types"
 	"github.com/tenderly/nitro/go-ethereum/ethclient"
+	"github.com/tenderly/nitro/go-ethereum/rpc"
 	"github.com/pkg/errors"
 )
 
 type TxForwarder struct {
-	target string
-	client *ethclient.Client
+	target     string
+	rpcClient  *rpc.Client
+	client     *ethclient.Client
+	pendingTxs *PendingTxSet
 }
 
 func NewForwarder(target string) *TxForwarder {
 	return &TxForwarder{
-		target: target,
+		target:     target,
+		pendingTxs: NewPendingTxSet(),
 	}
 }
 
@@ -26,19 +32,52 @@ func (f *TxForwarder) PublishTransaction(ctx context.Context, tx *types.Transact
 	if f.client == nil {
 		return errors.New("sequencer temporarily unavailable")
 	}
+	// The sequencer only responds once the tx has been sequenced, so it's pending until then
+	f.pendingTxs.add(tx)
+	defer f.pendingTxs.remove(tx)
 	return f.client.SendTransaction(ctx, tx)
 }
 
+func (f *TxForwarder) PublishBundle(ctx context.Context, txs types.Transactions, targetBlock *uint64) error {
+	if f.rpcClient == nil {
+		return errors.New("sequencer temporarily unavailable")
+	}
+	encodedTxs := make([]hexutil.Bytes, 0, len(txs))
+	for _, tx := range txs {
+		txBytes, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		encodedTxs = append(encodedTxs, txBytes)
+	}
+	var encodedTarget *hexutil.Uint64
+	if targetBlock != nil {
+		encodedTarget = (*hexutil.Uint64)(targetBlock)
+	}
+	for _, tx := range txs {
+		f.pendingTxs.add(tx)
+		defer f.pendingTxs.remove(tx)
+	}
+	var hashes []common.Hash
+	return f.rpcClient.CallContext(ctx, &hashes, "arb_sendBundle", encodedTxs, encodedTarget)
+}
+
+func (f *TxForwarder) PendingTxs() *PendingTxSet {
+	return f.pendingTxs
+}
+
 func (f *TxForwarder) Initialize(ctx context.Context) error {
 	if f.target == "" {
+		f.rpcClient = nil
 		f.client = nil
 		return nil
 	}
-	client, err := ethclient.DialContext(ctx, f.target)
+	rpcClient, err := rpc.DialContext(ctx, f.target)
 	if err != nil {
 		return err
 	}
-	f.client = client
+	f.rpcClient = rpcClient
+	f.client = ethclient.NewClient(rpcClient)
 	return nil
 }
 
@@ -48,16 +87,29 @@ func (f *TxForwarder) Start(ctx context.Context) error {
 
 func (f *TxForwarder) StopAndWait() {}
 
-type TxDropper struct{}
+type TxDropper struct {
+	pendingTxs *PendingTxSet
+}
 
 func NewTxDropper() *TxDropper {
-	return &TxDropper{}
+	return &TxDropper{
+		pendingTxs: NewPendingTxSet(),
+	}
 }
 
 func (f *TxDropper) PublishTransaction(ctx context.Context, tx *types.Transaction) error {
 	return errors.New("transactions not supported by this endpoint")
 }
 
+func (f *TxDropper) PublishBundle(ctx context.Context, txs types.Transactions, targetBlock *uint64) error {
+	return errors.New("transactions not supported by this endpoint")
+}
+
+// PendingTxs returns an always empty set, as no transactions are accepted
+func (f *TxDropper) PendingTxs() *PendingTxSet {
+	return f.pendingTxs
+}
+
 func (f *TxDropper) Initialize(ctx context.Context) error { return nil }
 
 func (f *TxDropper) Start(ctx context.Context) error { return nil }
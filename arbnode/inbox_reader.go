@@ -89,7 +89,9 @@ func (r *InboxReader) Start(ctxIn context.Context) error {
 	r.StopWaiter.Start(ctxIn)
 	r.CallIteratively(func(ctx context.Context) time.Duration {
 		err := r.run(ctx)
-		if err != nil && !errors.Is(err, context.Canceled) && !strings.Contains(err.Error(), "header not found") {
+		if errors.Is(err, errMessagesNotExecuted) {
+			log.Debug("waiting for the messages before the next batch to execute")
+		} else if err != nil && !errors.Is(err, context.Canceled) && !strings.Contains(err.Error(), "header not found") {
 			log.Warn("error reading inbox", "err", err)
 		}
 		return time.Second
@@ -29,7 +29,8 @@ type InboxTracker struct {
 }
 
 func NewInboxTracker(db ethdb.Database, txStreamer *TransactionStreamer, das arbstate.DataAvailabilityReader) (*InboxTracker, error) {
-	if txStreamer.bc.Config().ArbitrumChainParams.DataAvailabilityCommittee && das == nil {
+	// a tracker without a transaction streamer can only read the database, as tools do
+	if txStreamer != nil && txStreamer.bc.Config().ArbitrumChainParams.DataAvailabilityCommittee && das == nil {
 		return nil, errors.New("data availability service required but unconfigured")
 	}
 	tracker := &InboxTracker{
@@ -340,6 +341,8 @@ type multiplexerBackend struct {
 	batchSeqNum           uint64
 	batches               []*SequencerInboxBatch
 	positionWithinMessage uint64
+	// the number of messages before the current batch
+	batchStartMessageCount arbutil.MessageIndex
 
 	ctx    context.Context
 	client arbutil.L1Interface
@@ -380,6 +383,10 @@ func (b *multiplexerBackend) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
 	return data, err
 }
 
+func (b *multiplexerBackend) GetBatchArbOSVersion() (uint64, error) {
+	return b.inbox.txStreamer.ArbOSVersionAfterMessages(b.batchStartMessageCount)
+}
+
 var delayedMessagesMismatch = errors.New("sequencer batch delayed messages missing or different")
 
 func (t *InboxTracker) AddSequencerBatches(ctx context.Context, client arbutil.L1Interface, batches []*SequencerInboxBatch) error {
@@ -447,12 +454,24 @@ func (t *InboxTracker) AddSequencerBatches(ctx context.Context, client arbutil.L
 	multiplexer := arbstate.NewInboxMultiplexer(backend, prevbatchmeta.DelayedMessageCount, t.das)
 	batchMessageCounts := make(map[uint64]arbutil.MessageIndex)
 	currentpos := prevbatchmeta.MessageCount + 1
+	var batchesErr error
 	for {
 		if len(backend.batches) == 0 {
 			break
 		}
 		batchSeqNum := backend.batches[0].SequenceNumber
+		if backend.positionWithinMessage == 0 {
+			backend.batchStartMessageCount = currentpos - 1
+		}
 		msg, err := multiplexer.Pop(ctx)
+		if errors.Is(err, errMessagesNotExecuted) && backend.positionWithinMessage == 0 && batchSeqNum > startPos {
+			// This batch is read with the ArbOS version the previous batches end at,
+			// so add those and come back to it once they're executed.
+			batches = batches[:batchSeqNum-startPos]
+			pos = batchSeqNum
+			batchesErr = err
+			break
+		}
 		if err != nil {
 			return err
 		}
@@ -550,7 +569,7 @@ func (t *InboxTracker) AddSequencerBatches(ctx context.Context, client arbutil.L
 		t.txStreamer.broadcastServer.Confirm(prevbatchmeta.MessageCount - 1)
 	}
 
-	return nil
+	return batchesErr
 }
 
 func (t *InboxTracker) ReorgDelayedTo(count uint64) error {
@@ -52,6 +52,7 @@ import (
 	"github.com/tenderly/nitro/solgen/go/rollupgen"
 	"github.com/tenderly/nitro/statetransfer"
 	"github.com/tenderly/nitro/validator"
+	"github.com/tenderly/nitro/wsbroadcastserver"
 )
 
 type RollupAddresses struct {
@@ -525,6 +526,11 @@ type SequencerConfig struct {
 	MaxRevertGasReject          uint64                   `koanf:"max-revert-gas-reject"`
 	MaxAcceptableTimestampDelta time.Duration            `koanf:"max-acceptable-timestamp-delta"`
 	SenderWhitelist             string                   `koanf:"sender-whitelist"`
+	NonceGapHoldTime            time.Duration            `koanf:"nonce-gap-hold-time"`
+	NonceGapMaxQueuedPerSender  int                      `koanf:"nonce-gap-max-queued-per-sender"`
+	TxFilters                   TxFilterConfig           `koanf:"tx-filters"`
+	Ordering                    TxOrderingConfig         `koanf:"ordering"`
+	ReplacementPriceBump        uint64                   `koanf:"replacement-price-bump"`
 	Dangerous                   DangerousSequencerConfig `koanf:"dangerous"`
 }
 
@@ -533,6 +539,11 @@ var DefaultSequencerConfig = SequencerConfig{
 	MaxBlockSpeed:               time.Millisecond * 100,
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
+	NonceGapHoldTime:            time.Second,
+	NonceGapMaxQueuedPerSender:  64,
+	TxFilters:                   DefaultTxFilterConfig,
+	Ordering:                    DefaultTxOrderingConfig,
+	ReplacementPriceBump:        10,
 	Dangerous:                   DefaultDangerousSequencerConfig,
 }
 
@@ -542,6 +553,11 @@ var TestSequencerConfig = SequencerConfig{
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
 	SenderWhitelist:             "",
+	NonceGapHoldTime:            time.Second,
+	NonceGapMaxQueuedPerSender:  64,
+	TxFilters:                   DefaultTxFilterConfig,
+	Ordering:                    DefaultTxOrderingConfig,
+	ReplacementPriceBump:        10,
 	Dangerous:                   TestDangerousSequencerConfig,
 }
 
@@ -551,6 +567,11 @@ func SequencerConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Uint64(prefix+".max-revert-gas-reject", DefaultSequencerConfig.MaxRevertGasReject, "maximum gas executed in a revert for the sequencer to reject the transaction instead of posting it (anti-DOS)")
 	f.Duration(prefix+".max-acceptable-timestamp-delta", DefaultSequencerConfig.MaxAcceptableTimestampDelta, "maximum acceptable time difference between the local time and the latest L1 block's timestamp")
 	f.String(prefix+".sender-whitelist", DefaultSequencerConfig.SenderWhitelist, "comma separated whitelist of authorized senders (if empty, everyone is allowed)")
+	f.Duration(prefix+".nonce-gap-hold-time", DefaultSequencerConfig.NonceGapHoldTime, "maximum time to hold a transaction whose nonce is too high while waiting for its predecessor (0 to disable)")
+	f.Int(prefix+".nonce-gap-max-queued-per-sender", DefaultSequencerConfig.NonceGapMaxQueuedPerSender, "maximum number of transactions held per sender while waiting for a nonce gap to be filled")
+	TxFilterConfigAddOptions(prefix+".tx-filters", f)
+	TxOrderingConfigAddOptions(prefix+".ordering", f)
+	f.Uint64(prefix+".replacement-price-bump", DefaultSequencerConfig.ReplacementPriceBump, "minimum percentage by which both the fee cap and the tip cap must increase to replace a queued transaction with the same sender and nonce")
 	DangerousSequencerConfigAddOptions(prefix+".dangerous", f)
 }
 
@@ -580,12 +601,38 @@ type Node struct {
 	BlockValidator         *validator.BlockValidator
 	Staker                 *validator.Staker
 	BroadcastServer        *broadcaster.Broadcaster
-	BroadcastClients       []*broadcastclient.BroadcastClient
+	BroadcastClients       *broadcastclient.BroadcastClients
 	SeqCoordinator         *SeqCoordinator
 	DASLifecycleManager    *das.LifecycleManager
 	ClassicOutboxRetriever *ClassicOutboxRetriever
 }
 
+// newFeedSigner returns the signer of the feed's messages, which uses the feed signing key,
+// or the L1 wallet if there's no signing key and it's explicitly allowed to sign the feed
+func newFeedSigner(config *wsbroadcastserver.BroadcasterConfig, l1WalletSigner das.DasSigner) (broadcaster.FeedSigner, error) {
+	if config.SigningKey != "" {
+		key, err := loadSigningKey(config.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load feed signing key: %w", err)
+		}
+		privateKey, err := crypto.ToECDSA(key[:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid feed signing key: %w", err)
+		}
+		log.Info("signing feed messages", "address", crypto.PubkeyToAddress(privateKey.PublicKey))
+		return func(hash []byte) ([]byte, error) {
+			return crypto.Sign(hash, privateKey)
+		}, nil
+	}
+	if !config.SignWithL1Wallet {
+		return nil, errors.New("feed output signing enabled, but no signing key set, and signing with the L1 wallet isn't enabled")
+	}
+	if l1WalletSigner == nil {
+		return nil, errors.New("feed output signing with the L1 wallet enabled, but no L1 wallet to sign with")
+	}
+	return broadcaster.FeedSigner(l1WalletSigner), nil
+}
+
 func createNodeImpl(
 	ctx context.Context,
 	stack *node.Node,
@@ -626,7 +673,14 @@ func createNodeImpl(
 
 	var broadcastServer *broadcaster.Broadcaster
 	if config.Feed.Output.Enable {
-		broadcastServer = broadcaster.NewBroadcaster(config.Feed.Output)
+		var feedSigner broadcaster.FeedSigner
+		if config.Feed.Output.Signed {
+			feedSigner, err = newFeedSigner(&config.Feed.Output, daSigner)
+			if err != nil {
+				return nil, err
+			}
+		}
+		broadcastServer = broadcaster.NewBroadcaster(config.Feed.Output, l2BlockChain.Config().ChainID, feedSigner)
 	}
 
 	var l1Reader *headerreader.HeaderReader
@@ -685,10 +739,20 @@ func createNodeImpl(
 		return nil, err
 	}
 
-	var broadcastClients []*broadcastclient.BroadcastClient
+	var broadcastClients *broadcastclient.BroadcastClients
 	if config.Feed.Input.Enable() {
-		for _, address := range config.Feed.Input.URLs {
-			broadcastClients = append(broadcastClients, broadcastclient.NewBroadcastClient(address, nil, config.Feed.Input.Timeout, txStreamer))
+		messageCount, err := txStreamer.GetMessageCount()
+		if err != nil {
+			return nil, err
+		}
+		// ask the feed to start after the messages we already have, rather than resending its whole backlog
+		var lastInboxSeqNum *big.Int
+		if messageCount > 0 {
+			lastInboxSeqNum = new(big.Int).SetUint64(uint64(messageCount) - 1)
+		}
+		broadcastClients, err = broadcastclient.NewBroadcastClients(config.Feed.Input, lastInboxSeqNum, txStreamer)
+		if err != nil {
+			return nil, err
 		}
 	}
 	if !config.L1Reader.Enable {
@@ -706,7 +770,7 @@ func createNodeImpl(
 	if err != nil {
 		return nil, err
 	}
-	dataAvailabilityService, dasLifecycleManager, err := SetUpDataAvailability(ctx, &config.DataAvailability, l1Reader, deployInfo)
+	dataAvailabilityService, dasLifecycleManager, err := SetUpDataAvailability(ctx, &config.DataAvailability, l1Reader, deployInfo, daSigner)
 	if err != nil {
 		return nil, err
 	}
@@ -724,6 +788,9 @@ func createNodeImpl(
 		dataAvailabilityService = das.NewTimeoutWrapper(
 			dataAvailabilityService, config.DataAvailability.RequestTimeout,
 		)
+		// Erasure coded batches which can't be got whole are reconstructed from shards got through the rest of the stack.
+		// This goes inside the panic wrapper, so missing shards don't panic but failing to reconstruct the batch does.
+		dataAvailabilityService = das.NewShardReconstructingDAS(dataAvailabilityService)
 		if config.DataAvailability.PanicOnError {
 			dataAvailabilityService = das.NewPanicWrapper(dataAvailabilityService)
 		}
@@ -782,7 +849,7 @@ func createNodeImpl(
 		if txOpts == nil {
 			return nil, errors.New("batchposter, but no TxOpts")
 		}
-		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, &config.BatchPoster, deployInfo.SequencerInbox, txOpts, dataAvailabilityService)
+		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, rawdb.NewTable(arbDb, dataPosterPrefix), &config.BatchPoster, deployInfo.SequencerInbox, txOpts, dataAvailabilityService)
 		if err != nil {
 			return nil, err
 		}
@@ -826,7 +893,7 @@ func SetUpDataAvailabilityWithoutNode(
 		}
 		l1Reader = headerreader.New(l1Client, headerreader.DefaultConfig) // TODO: config
 	}
-	das, lifeCycle, err := SetUpDataAvailability(ctx, config, l1Reader, nil)
+	das, lifeCycle, err := SetUpDataAvailability(ctx, config, l1Reader, nil, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -839,11 +906,13 @@ func SetUpDataAvailabilityWithoutNode(
 
 // Set up a das.DataAvailabilityService stack allowing some dependencies
 // that were created for the Node to be injected.
+// The signer is the batch poster's, if any, used to sign erasure coded shards.
 func SetUpDataAvailability(
 	ctx context.Context,
 	config *das.DataAvailabilityConfig,
 	l1Reader *headerreader.HeaderReader,
 	deployInfo *RollupAddresses,
+	daSigner das.DasSigner,
 ) (das.DataAvailabilityService, *das.LifecycleManager, error) {
 	if !config.Enable {
 		return nil, nil, nil
@@ -902,6 +971,7 @@ func SetUpDataAvailability(
 		return nil, nil, err
 	}
 	hasPersistentStorage := topLevelStorageService != nil
+	retentionService, _ := topLevelStorageService.(*das.RetentionStorageService)
 
 	// Create the REST aggregator if one was requested. If other storage types were enabled above, then
 	// the REST aggregator is used as the fallback to them.
@@ -957,6 +1027,9 @@ func SetUpDataAvailability(
 		if err != nil {
 			return nil, nil, err
 		}
+		if daSigner != nil {
+			rpcAggregator.SetShardSigner(daSigner)
+		}
 
 		topLevelDas = rpcAggregator
 	} else if hasPersistentStorage && (config.KeyConfig.KeyDir != "" || config.KeyConfig.PrivKey != "") {
@@ -986,6 +1059,13 @@ func SetUpDataAvailability(
 		if err != nil {
 			return nil, nil, err
 		}
+		if retentionService != nil {
+			deletable, ok := cache.(das.DeletableStorageService)
+			if !ok {
+				return nil, nil, fmt.Errorf("data availability retention can't delete expired data from the redis cache %v", cache)
+			}
+			retentionService.AddBackend(deletable)
+		}
 		topLevelDas = das.NewCacheStorageToDASAdapter(topLevelDas, cache)
 	}
 	if config.LocalCacheConfig.Enable {
@@ -1050,6 +1130,22 @@ func CreateNode(
 		})
 	}
 
+	apis = append(apis, rpc.API{
+		Namespace: "arb",
+		Version:   "1.0",
+		Service:   &ArbTransactionAPI{currentNode.TxPublisher},
+		Public:    true,
+	})
+
+	if sequencer, ok := currentNode.TxPublisher.(*Sequencer); ok {
+		apis = append(apis, rpc.API{
+			Namespace: "arb",
+			Version:   "1.0",
+			Service:   &SequencerAPI{sequencer},
+			Public:    true,
+		})
+	}
+
 	apis = append(apis, rpc.API{
 		Namespace: "arbdebug",
 		Version:   "1.0",
@@ -1134,15 +1230,15 @@ func (n *Node) Start(ctx context.Context) error {
 			return err
 		}
 	}
-	for _, client := range n.BroadcastClients {
-		client.Start(ctx)
+	if n.BroadcastClients != nil {
+		n.BroadcastClients.Start(ctx)
 	}
 	return nil
 }
 
 func (n *Node) StopAndWait() {
-	for _, client := range n.BroadcastClients {
-		client.StopAndWait()
+	if n.BroadcastClients != nil {
+		n.BroadcastClients.StopAndWait()
 	}
 	if n.BroadcastServer != nil {
 		n.BroadcastServer.StopAndWait()
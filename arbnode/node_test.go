@@ -0,0 +1,60 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+	"github.com/tenderly/nitro/wsbroadcastserver"
+)
+
+func TestFeedSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	walletKey, _ := crypto.GenerateKey()
+	walletSigner := func(hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, walletKey)
+	}
+	hash := crypto.Keccak256([]byte("feed message"))
+	signerAddress := func(config *wsbroadcastserver.BroadcasterConfig) string {
+		t.Helper()
+		signer, err := newFeedSigner(config, walletSigner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := signer(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, err := crypto.SigToPub(hash, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crypto.PubkeyToAddress(*pubKey).Hex()
+	}
+
+	// the signing key is used even if signing with the L1 wallet is allowed
+	config := wsbroadcastserver.DefaultBroadcasterConfig
+	config.Signed = true
+	config.SigningKey = hex.EncodeToString(crypto.FromECDSA(key))
+	config.SignWithL1Wallet = true
+	if signerAddress(&config) != crypto.PubkeyToAddress(key.PublicKey).Hex() {
+		t.Fatal("feed not signed with the signing key")
+	}
+
+	config.SigningKey = ""
+	if signerAddress(&config) != crypto.PubkeyToAddress(walletKey.PublicKey).Hex() {
+		t.Fatal("feed not signed with the L1 wallet")
+	}
+	if _, err := newFeedSigner(&config, nil); err == nil {
+		t.Fatal("created feed signer for the L1 wallet without one")
+	}
+
+	// the L1 wallet is only used if that's explicitly allowed
+	config.SignWithL1Wallet = false
+	if _, err := newFeedSigner(&config, walletSigner); err == nil {
+		t.Fatal("created feed signer without a signing key")
+	}
+}
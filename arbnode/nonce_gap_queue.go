@@ -0,0 +1,128 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/pkg/errors"
+)
+
+var ErrNonceGapTimeout = errors.New("timed out waiting for preceding nonce")
+
+type nonceGapItem struct {
+	queueItem txQueueItem
+	err       error
+	expiry    time.Time
+}
+
+// nonceGapQueue holds transactions whose nonce is ahead of their sender's current nonce,
+// until either the gap is filled or the hold time expires.
+// It is only accessed from the sequencing thread, so it isn't thread safe.
+type nonceGapQueue struct {
+	holdTime     time.Duration
+	maxPerSender int
+	priceBump    uint64
+	senders      map[common.Address]map[uint64]*nonceGapItem
+}
+
+func newNonceGapQueue(holdTime time.Duration, maxPerSender int, priceBump uint64) *nonceGapQueue {
+	return &nonceGapQueue{
+		holdTime:     holdTime,
+		maxPerSender: maxPerSender,
+		priceBump:    priceBump,
+		senders:      make(map[common.Address]map[uint64]*nonceGapItem),
+	}
+}
+
+func (q *nonceGapQueue) enabled() bool {
+	return q.holdTime > 0 && q.maxPerSender > 0
+}
+
+// add holds the item until its predecessor is sequenced. If the item can't be held, it returns the error
+// the caller is responsible for returning as the item's result: err itself, or core.ErrReplaceUnderpriced
+// if it would replace a held transaction with the same nonce without paying the replacement price bump.
+func (q *nonceGapQueue) add(sender common.Address, nonce uint64, item txQueueItem, err error, now time.Time) error {
+	if !q.enabled() {
+		return err
+	}
+	held := q.senders[sender]
+	if prev, exists := held[nonce]; exists {
+		if prev.queueItem.tx.Hash() == item.tx.Hash() {
+			return core.ErrAlreadyKnown
+		}
+		if !replacementPriced(prev.queueItem.tx, item.tx, q.priceBump) {
+			return core.ErrReplaceUnderpriced
+		}
+		prev.queueItem.returnResult(fmt.Errorf("%w by transaction %v", ErrReplaced, item.tx.Hash()))
+	} else if len(held) >= q.maxPerSender {
+		return err
+	}
+	if held == nil {
+		held = make(map[uint64]*nonceGapItem)
+		q.senders[sender] = held
+	}
+	held[nonce] = &nonceGapItem{
+		queueItem: item,
+		err:       err,
+		expiry:    now.Add(q.holdTime),
+	}
+	return nil
+}
+
+// release removes and returns all held items of the sender with a nonce up to and including the given one,
+// ordered by nonce. Items with a nonce that's already been used will fail with the appropriate error when re-sequenced.
+func (q *nonceGapQueue) release(sender common.Address, nextNonce uint64) []txQueueItem {
+	held := q.senders[sender]
+	if len(held) == 0 {
+		return nil
+	}
+	var nonces []uint64
+	for nonce := range held {
+		if nonce <= nextNonce {
+			nonces = append(nonces, nonce)
+		}
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	released := make([]txQueueItem, 0, len(nonces))
+	for _, nonce := range nonces {
+		released = append(released, held[nonce].queueItem)
+		delete(held, nonce)
+	}
+	if len(held) == 0 {
+		delete(q.senders, sender)
+	}
+	return released
+}
+
+// expire returns a result to every held item that has timed out or whose context has been cancelled.
+func (q *nonceGapQueue) expire(now time.Time) {
+	for sender, held := range q.senders {
+		for nonce, item := range held {
+			if err := item.queueItem.ctx.Err(); err != nil {
+				item.queueItem.returnResult(err)
+			} else if now.After(item.expiry) {
+				item.queueItem.returnResult(fmt.Errorf("%w %v: %v", ErrNonceGapTimeout, nonce-1, item.err))
+			} else {
+				continue
+			}
+			delete(held, nonce)
+		}
+		if len(held) == 0 {
+			delete(q.senders, sender)
+		}
+	}
+}
+
+func (q *nonceGapQueue) len() int {
+	count := 0
+	for _, held := range q.senders {
+		count += len(held)
+	}
+	return count
+}
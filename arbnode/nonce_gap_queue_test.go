@@ -0,0 +1,136 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// newTestQueueItem wraps a transaction with the given nonce, paying fee as both its tip and fee cap, in a queue item.
+// The transaction is signed with key if it's not nil.
+func newTestQueueItem(t *testing.T, signer types.Signer, key *ecdsa.PrivateKey, nonce uint64, fee int64) (txQueueItem, chan error) {
+	t.Helper()
+	txData := &types.DynamicFeeTx{
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(fee),
+		GasFeeCap: big.NewInt(fee),
+	}
+	tx := types.NewTx(txData)
+	if key != nil {
+		var err error
+		tx, err = types.SignNewTx(key, signer, txData)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	resultChan := make(chan error, 1)
+	return txQueueItem{tx, resultChan, context.Background(), nil}, resultChan
+}
+
+func TestNonceGapQueueRelease(t *testing.T) {
+	queue := newNonceGapQueue(time.Minute, 2, 10)
+	sender := common.HexToAddress("0x1234")
+	now := time.Now()
+
+	for _, nonce := range []uint64{3, 2} {
+		item, _ := newTestQueueItem(t, nil, nil, nonce, 1)
+		if err := queue.add(sender, nonce, item, core.ErrNonceTooHigh, now); err != nil {
+			t.Fatal("failed to hold transaction with nonce", nonce, err)
+		}
+	}
+	item, _ := newTestQueueItem(t, nil, nil, 4, 1)
+	if err := queue.add(sender, 4, item, core.ErrNonceTooHigh, now); !errors.Is(err, core.ErrNonceTooHigh) {
+		t.Fatal("held more transactions than the per sender limit")
+	}
+
+	if released := queue.release(common.HexToAddress("0x5678"), 2); len(released) != 0 {
+		t.Fatal("released transactions of a different sender")
+	}
+	released := queue.release(sender, 2)
+	if len(released) != 1 || released[0].tx.Nonce() != 2 {
+		t.Fatal("unexpected released transactions", released)
+	}
+	released = queue.release(sender, 3)
+	if len(released) != 1 || released[0].tx.Nonce() != 3 {
+		t.Fatal("unexpected released transactions", released)
+	}
+	if queue.len() != 0 {
+		t.Fatal("queue not empty after releasing everything")
+	}
+}
+
+func TestNonceGapQueueExpiry(t *testing.T) {
+	queue := newNonceGapQueue(time.Second, 8, 10)
+	sender := common.HexToAddress("0x1234")
+	now := time.Now()
+
+	item, resultChan := newTestQueueItem(t, nil, nil, 5, 1)
+	if err := queue.add(sender, 5, item, core.ErrNonceTooHigh, now); err != nil {
+		t.Fatal("failed to hold transaction", err)
+	}
+	queue.expire(now)
+	if queue.len() != 1 {
+		t.Fatal("transaction expired before its hold time")
+	}
+	queue.expire(now.Add(2 * time.Second))
+	if queue.len() != 0 {
+		t.Fatal("transaction not expired after its hold time")
+	}
+	err := <-resultChan
+	if !errors.Is(err, ErrNonceGapTimeout) {
+		t.Fatal("unexpected result for expired transaction", err)
+	}
+}
+
+func TestNonceGapQueueDisabled(t *testing.T) {
+	queue := newNonceGapQueue(0, 8, 10)
+	item, _ := newTestQueueItem(t, nil, nil, 1, 1)
+	if err := queue.add(common.Address{}, 1, item, core.ErrNonceTooHigh, time.Now()); !errors.Is(err, core.ErrNonceTooHigh) {
+		t.Fatal("held transaction with the queue disabled")
+	}
+}
+
+func TestNonceGapQueueReplacement(t *testing.T) {
+	queue := newNonceGapQueue(time.Minute, 8, 10)
+	sender := common.HexToAddress("0x1234")
+	now := time.Now()
+
+	original, originalResult := newTestQueueItem(t, nil, nil, 5, 100)
+	if err := queue.add(sender, 5, original, core.ErrNonceTooHigh, now); err != nil {
+		t.Fatal("failed to hold transaction", err)
+	}
+	if err := queue.add(sender, 5, original, core.ErrNonceTooHigh, now); !errors.Is(err, core.ErrAlreadyKnown) {
+		t.Fatal("unexpected error holding the same transaction twice", err)
+	}
+	underpriced, _ := newTestQueueItem(t, nil, nil, 5, 109)
+	if err := queue.add(sender, 5, underpriced, core.ErrNonceTooHigh, now); !errors.Is(err, core.ErrReplaceUnderpriced) {
+		t.Fatal("unexpected error replacing held transaction without a price bump", err)
+	}
+	select {
+	case err := <-originalResult:
+		t.Fatal("held transaction got a result from an underpriced replacement", err)
+	default:
+	}
+
+	replacement, _ := newTestQueueItem(t, nil, nil, 5, 110)
+	if err := queue.add(sender, 5, replacement, core.ErrNonceTooHigh, now); err != nil {
+		t.Fatal("failed to replace held transaction", err)
+	}
+	if err := <-originalResult; !errors.Is(err, ErrReplaced) {
+		t.Fatal("unexpected result for replaced transaction", err)
+	}
+	released := queue.release(sender, 5)
+	if len(released) != 1 || released[0].tx.Hash() != replacement.tx.Hash() {
+		t.Fatal("unexpected released transactions", released)
+	}
+}
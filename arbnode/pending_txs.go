@@ -0,0 +1,82 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"sync"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/event"
+)
+
+type pendingTx struct {
+	tx    *types.Transaction
+	count int // the number of in-flight submissions of this tx
+}
+
+// PendingTxSet tracks transactions from the moment they're published until they're either included or rejected.
+type PendingTxSet struct {
+	mutex sync.Mutex
+	txs   map[common.Hash]*pendingTx
+	feed  event.Feed
+}
+
+func NewPendingTxSet() *PendingTxSet {
+	return &PendingTxSet{
+		txs: make(map[common.Hash]*pendingTx),
+	}
+}
+
+func (p *PendingTxSet) add(tx *types.Transaction) {
+	p.mutex.Lock()
+	existing := p.txs[tx.Hash()]
+	if existing != nil {
+		existing.count++
+		p.mutex.Unlock()
+		return
+	}
+	p.txs[tx.Hash()] = &pendingTx{tx, 1}
+	p.mutex.Unlock()
+
+	p.feed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+}
+
+func (p *PendingTxSet) remove(tx *types.Transaction) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	existing := p.txs[tx.Hash()]
+	if existing == nil {
+		return
+	}
+	existing.count--
+	if existing.count <= 0 {
+		delete(p.txs, tx.Hash())
+	}
+}
+
+func (p *PendingTxSet) Transactions() types.Transactions {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	txs := make(types.Transactions, 0, len(p.txs))
+	for _, pending := range p.txs {
+		txs = append(txs, pending.tx)
+	}
+	return txs
+}
+
+func (p *PendingTxSet) Transaction(txHash common.Hash) *types.Transaction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pending := p.txs[txHash]
+	if pending == nil {
+		return nil
+	}
+	return pending.tx
+}
+
+func (p *PendingTxSet) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return p.feed.Subscribe(ch)
+}
@@ -5,6 +5,7 @@ package arbnode
 
 var (
 	blockValidatorPrefix     string = "v"         // the prefix for all block validator keys
+	dataPosterPrefix         string = "p"         // the prefix for all data poster keys
 	messagePrefix            []byte = []byte("m") // maps a message sequence number to a message
 	delayedMessagePrefix     []byte = []byte("d") // maps a delayed sequence number to an accumulator and a message
 	sequencerBatchMetaPrefix []byte = []byte("s") // maps a batch sequence number to BatchMetadata
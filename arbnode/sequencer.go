@@ -33,6 +33,7 @@ type txQueueItem struct {
 	tx         *types.Transaction
 	resultChan chan<- error
 	ctx        context.Context
+	queued     *queuedTxEntry // set while the item is replaceable in the queue
 }
 
 func (i *txQueueItem) returnResult(err error) {
@@ -40,11 +41,24 @@ func (i *txQueueItem) returnResult(err error) {
 	close(i.resultChan)
 }
 
+type bundleQueueItem struct {
+	txs         types.Transactions
+	targetBlock *uint64
+	resultChan  chan<- error
+	ctx         context.Context
+}
+
+func (i *bundleQueueItem) returnResult(err error) {
+	i.resultChan <- err
+	close(i.resultChan)
+}
+
 type Sequencer struct {
 	stopwaiter.StopWaiter
 
 	txStreamer      *TransactionStreamer
 	txQueue         chan txQueueItem
+	bundleQueue     chan bundleQueueItem
 	l1Reader        *headerreader.HeaderReader
 	config          SequencerConfig
 	senderWhitelist map[common.Address]struct{}
@@ -55,6 +69,15 @@ type Sequencer struct {
 
 	forwarderMutex sync.Mutex
 	forwarder      *TxForwarder
+
+	pendingTxs *PendingTxSet
+	txFilters  *TxFilterChain
+	ordering   *txOrdering
+	queuedTxs  *queuedTxIndex
+
+	// nonceGaps and releasedQueue are only accessed from the sequencing thread
+	nonceGaps     *nonceGapQueue
+	releasedQueue []txQueueItem
 }
 
 func NewSequencer(txStreamer *TransactionStreamer, l1Reader *headerreader.HeaderReader, config SequencerConfig) (*Sequencer, error) {
@@ -69,20 +92,36 @@ func NewSequencer(txStreamer *TransactionStreamer, l1Reader *headerreader.Header
 		}
 		senderWhitelist[common.HexToAddress(address)] = struct{}{}
 	}
+	txFilters, err := NewTxFilterChain(&config.TxFilters)
+	if err != nil {
+		return nil, err
+	}
+	ordering, err := newTxOrdering(&config.Ordering)
+	if err != nil {
+		return nil, err
+	}
 	return &Sequencer{
 		txStreamer:      txStreamer,
 		txQueue:         make(chan txQueueItem, 128),
+		bundleQueue:     make(chan bundleQueueItem, 16),
 		l1Reader:        l1Reader,
 		config:          config,
 		senderWhitelist: senderWhitelist,
 		l1BlockNumber:   0,
 		l1Timestamp:     0,
+		pendingTxs:      NewPendingTxSet(),
+		txFilters:       txFilters,
+		ordering:        ordering,
+		queuedTxs:       newQueuedTxIndex(config.ReplacementPriceBump),
+		nonceGaps:       newNonceGapQueue(config.NonceGapHoldTime, config.NonceGapMaxQueuedPerSender, config.ReplacementPriceBump),
 	}, nil
 }
 
 var ErrRetrySequencer = errors.New("please retry transaction")
 
-func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transaction) error {
+var ErrBundleNotIncluded = errors.New("bundle not included")
+
+func (s *Sequencer) checkSenderWhitelist(tx *types.Transaction) error {
 	if len(s.senderWhitelist) > 0 {
 		signer := types.LatestSigner(s.txStreamer.bc.Config())
 		sender, err := types.Sender(signer, tx)
@@ -94,16 +133,37 @@ func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transactio
 			return errors.New("transaction sender is not on the whitelist")
 		}
 	}
+	return nil
+}
+
+func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := s.checkSenderWhitelist(tx); err != nil {
+		return err
+	}
+
+	signer := types.LatestSigner(s.txStreamer.bc.Config())
+	sender, err := types.Sender(signer, tx)
+	if err != nil {
+		return err
+	}
+
+	s.pendingTxs.add(tx)
+	defer s.pendingTxs.remove(tx)
 
 	resultChan := make(chan error, 1)
 	queueItem := txQueueItem{
 		tx,
 		resultChan,
 		ctx,
+		nil,
+	}
+	if err := s.queuedTxs.add(sender, &queueItem); err != nil {
+		return err
 	}
 	select {
 	case s.txQueue <- queueItem:
 	case <-ctx.Done():
+		s.queuedTxs.remove(&queueItem)
 		return ctx.Err()
 	}
 	select {
@@ -114,15 +174,94 @@ func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transactio
 	}
 }
 
+// PublishBundle sequences the transactions contiguously and in order in a single block, or not at all.
+// If targetBlock is set, the bundle is only included if it's sequenced in a block no later than that one.
+func (s *Sequencer) PublishBundle(ctx context.Context, txs types.Transactions, targetBlock *uint64) error {
+	if len(txs) == 0 {
+		return errors.New("empty bundle")
+	}
+	var totalSize int
+	for _, tx := range txs {
+		if err := s.checkSenderWhitelist(tx); err != nil {
+			return err
+		}
+		txBytes, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		totalSize += len(txBytes)
+	}
+	if totalSize > int(maxTxDataSize) {
+		return core.ErrOversizedData
+	}
+
+	for _, tx := range txs {
+		s.pendingTxs.add(tx)
+		defer s.pendingTxs.remove(tx)
+	}
+
+	resultChan := make(chan error, 1)
+	queueItem := bundleQueueItem{
+		txs,
+		targetBlock,
+		resultChan,
+		ctx,
+	}
+	select {
+	case s.bundleQueue <- queueItem:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case res := <-resultChan:
+		return res
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sequencer) PendingTxs() *PendingTxSet {
+	return s.pendingTxs
+}
+
+// TxFilters returns the chain of policies applied to every sequenced transaction, which custom filters can be added to
+func (s *Sequencer) TxFilters() *TxFilterChain {
+	return s.txFilters
+}
+
+// RegisterPriorityLane grants the credential's address priority ordering until the credential expires
+func (s *Sequencer) RegisterPriorityLane(credential *PriorityLaneCredential) error {
+	return s.ordering.registerCredential(credential)
+}
+
 func (s *Sequencer) preTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error {
-	return nil
+	return s.txFilters.PreTxFilter(state, tx, sender)
 }
 
 func (s *Sequencer) postTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address, dataGas uint64, receipt *types.Receipt) error {
 	if receipt.Status == types.ReceiptStatusFailed && receipt.GasUsed > dataGas && receipt.GasUsed-dataGas <= s.config.MaxRevertGasReject {
 		return vm.ErrExecutionReverted
 	}
-	return nil
+	return s.txFilters.PostTxFilter(state, tx, sender, dataGas, receipt)
+}
+
+// includedTxs returns the transactions which made it into the block produced by sequencing them, if any.
+// An atomic bundle is only included if none of its transactions failed.
+func includedTxs(txes types.Transactions, txErrors []error, err error, atomic bool) types.Transactions {
+	if err != nil {
+		return nil
+	}
+	var included types.Transactions
+	for i, txErr := range txErrors {
+		if txErr != nil {
+			if atomic {
+				return nil
+			}
+			continue
+		}
+		included = append(included, txes[i])
+	}
+	return included
 }
 
 func (s *Sequencer) ForwardTarget() string {
@@ -164,29 +303,159 @@ func (s *Sequencer) forwardIfSet(queueItems []txQueueItem) bool {
 	return true
 }
 
+func (s *Sequencer) forwardBundleIfSet(item bundleQueueItem) bool {
+	s.forwarderMutex.Lock()
+	defer s.forwarderMutex.Unlock()
+	if s.forwarder == nil {
+		return false
+	}
+	item.returnResult(s.forwarder.PublishBundle(item.ctx, item.txs, item.targetBlock))
+	return true
+}
+
+func (s *Sequencer) sequencingHeader() (*arbos.L1IncomingMessageHeader, error) {
+	timestamp := time.Now().Unix()
+	s.L1BlockAndTimeMutex.Lock()
+	l1Block := s.l1BlockNumber
+	l1Timestamp := s.l1Timestamp
+	s.L1BlockAndTimeMutex.Unlock()
+
+	if s.l1Reader != nil && (l1Block == 0 || math.Abs(float64(l1Timestamp)-float64(timestamp)) > s.config.MaxAcceptableTimestampDelta.Seconds()) {
+		log.Error(
+			"cannot sequence: unknown L1 block or L1 timestamp too far from local clock time",
+			"l1Block", l1Block,
+			"l1Timestamp", l1Timestamp,
+			"localTimestamp", timestamp,
+		)
+		return nil, errors.New("unknown L1 block or L1 timestamp too far from local clock time")
+	}
+
+	return &arbos.L1IncomingMessageHeader{
+		Kind:        arbos.L1MessageType_L2Message,
+		Poster:      l1pricing.BatchPosterAddress,
+		BlockNumber: l1Block,
+		Timestamp:   uint64(timestamp),
+		RequestId:   nil,
+		L1BaseFee:   nil,
+	}, nil
+}
+
+func (s *Sequencer) newSequencingHooks() *arbos.SequencingHooks {
+	return &arbos.SequencingHooks{
+		PreTxFilter:            s.preTxFilter,
+		PostTxFilter:           s.postTxFilter,
+		DiscardInvalidTxsEarly: true,
+		TxErrors:               []error{},
+	}
+}
+
+// sequenceBundle sequences a bundle in a block of its own, so it's trivially contiguous
+func (s *Sequencer) sequenceBundle(item bundleQueueItem) {
+	if err := item.ctx.Err(); err != nil {
+		item.returnResult(err)
+		return
+	}
+	if s.forwardBundleIfSet(item) {
+		return
+	}
+
+	header, err := s.sequencingHeader()
+	if err != nil {
+		item.returnResult(err)
+		return
+	}
+	hooks := s.newSequencingHooks()
+	err = s.txStreamer.SequenceBundle(header, item.txs, hooks, item.targetBlock)
+	if err == nil && len(hooks.TxErrors) != len(item.txs) {
+		err = fmt.Errorf("unexpected number of error results: %v vs number of txes %v", len(hooks.TxErrors), len(item.txs))
+	}
+	s.txFilters.txsIncluded(includedTxs(item.txs, hooks.TxErrors, err, true))
+	if errors.Is(err, ErrRetrySequencer) {
+		// we changed roles, so forward the bundle if we have where to, or otherwise let the submitter retry
+		if !s.forwardBundleIfSet(item) {
+			item.returnResult(err)
+		}
+		return
+	}
+	if err != nil {
+		item.returnResult(fmt.Errorf("%w: %v", ErrBundleNotIncluded, err))
+		return
+	}
+	for i, txErr := range hooks.TxErrors {
+		if txErr != nil {
+			item.returnResult(fmt.Errorf("%w: transaction %v (%v) failed: %v", ErrBundleNotIncluded, i, item.txs[i].Hash(), txErr))
+			return
+		}
+	}
+
+	signer := types.LatestSigner(s.txStreamer.bc.Config())
+	for _, tx := range item.txs {
+		if sender, err := types.Sender(signer, tx); err == nil {
+			s.releasedQueue = append(s.releasedQueue, s.nonceGaps.release(sender, tx.Nonce()+1)...)
+		}
+	}
+	item.returnResult(nil)
+}
+
 func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 	var txes types.Transactions
 	var queueItems []txQueueItem
 	var totalBatchSize int
+	var collectionDeadline <-chan time.Time
+	s.nonceGaps.expire(time.Now())
+	select {
+	case bundle := <-s.bundleQueue:
+		s.sequenceBundle(bundle)
+		return
+	default:
+	}
 	for {
 		var queueItem txQueueItem
-		if len(txes) == 0 {
+		if len(s.releasedQueue) > 0 {
+			queueItem = s.releasedQueue[0]
+			s.releasedQueue = s.releasedQueue[1:]
+		} else if len(txes) == 0 {
+			var expiryTimer <-chan time.Time
+			if s.nonceGaps.len() > 0 {
+				// wake up to expire transactions still waiting on a nonce gap
+				expiryTimer = time.After(s.config.NonceGapHoldTime)
+			}
 			select {
 			case queueItem = <-s.txQueue:
+			case bundle := <-s.bundleQueue:
+				s.sequenceBundle(bundle)
+				return
+			case <-expiryTimer:
+				return
 			case <-ctx.Done():
 				return
 			}
 		} else {
 			done := false
-			select {
-			case queueItem = <-s.txQueue:
-			default:
-				done = true
+			if collectionDeadline != nil {
+				// keep collecting transactions to order until the collection window ends
+				select {
+				case queueItem = <-s.txQueue:
+				case <-collectionDeadline:
+					done = true
+				case <-ctx.Done():
+					done = true
+				}
+			} else {
+				select {
+				case queueItem = <-s.txQueue:
+				default:
+					done = true
+				}
 			}
 			if done {
 				break
 			}
 		}
+		if !s.queuedTxs.take(&queueItem) {
+			// this item was replaced while in the queue, and its submitter already has its result
+			continue
+		}
 		err := queueItem.ctx.Err()
 		if err != nil {
 			queueItem.returnResult(err)
@@ -216,47 +485,34 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		totalBatchSize += len(txBytes)
 		txes = append(txes, queueItem.tx)
 		queueItems = append(queueItems, queueItem)
+		if collectionDeadline == nil && s.ordering.enabled() && s.config.Ordering.CollectionWindow > 0 {
+			collectionDeadline = time.After(s.config.Ordering.CollectionWindow)
+		}
 	}
 
-	if s.forwardIfSet(queueItems) {
-		return
+	signer := types.LatestSigner(s.txStreamer.bc.Config())
+	if s.ordering.enabled() {
+		queueItems = s.ordering.order(queueItems, signer)
+		for i, item := range queueItems {
+			txes[i] = item.tx
+		}
 	}
 
-	timestamp := time.Now().Unix()
-	s.L1BlockAndTimeMutex.Lock()
-	l1Block := s.l1BlockNumber
-	l1Timestamp := s.l1Timestamp
-	s.L1BlockAndTimeMutex.Unlock()
-
-	if s.l1Reader != nil && (l1Block == 0 || math.Abs(float64(l1Timestamp)-float64(timestamp)) > s.config.MaxAcceptableTimestampDelta.Seconds()) {
-		log.Error(
-			"cannot sequence: unknown L1 block or L1 timestamp too far from local clock time",
-			"l1Block", l1Block,
-			"l1Timestamp", l1Timestamp,
-			"localTimestamp", timestamp,
-		)
+	if s.forwardIfSet(queueItems) {
 		return
 	}
 
-	header := &arbos.L1IncomingMessageHeader{
-		Kind:        arbos.L1MessageType_L2Message,
-		Poster:      l1pricing.BatchPosterAddress,
-		BlockNumber: l1Block,
-		Timestamp:   uint64(timestamp),
-		RequestId:   nil,
-		L1BaseFee:   nil,
+	header, err := s.sequencingHeader()
+	if err != nil {
+		return
 	}
 
-	hooks := &arbos.SequencingHooks{
-		PreTxFilter:            s.preTxFilter,
-		PostTxFilter:           s.postTxFilter,
-		DiscardInvalidTxsEarly: true,
-		TxErrors:               []error{},
-	}
-	err := s.txStreamer.SequenceTransactions(header, txes, hooks)
+	hooks := s.newSequencingHooks()
+	err = s.txStreamer.SequenceTransactions(header, txes, hooks)
 	if err == nil && len(hooks.TxErrors) != len(txes) {
 		err = fmt.Errorf("unexpected number of error results: %v vs number of txes %v", len(hooks.TxErrors), len(txes))
 	}
+	s.txFilters.txsIncluded(includedTxs(txes, hooks.TxErrors, err, false))
 	if errors.Is(err, ErrRetrySequencer) {
 		// we changed roles
 		// forward if we have where to
@@ -281,6 +537,7 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		return
 	}
 
+	now := time.Now()
 	for i, err := range hooks.TxErrors {
 		queueItem := queueItems[i]
 		if errors.Is(err, core.ErrGasLimit) {
@@ -293,6 +550,20 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 			default:
 			}
 		}
+		if err == nil || errors.Is(err, core.ErrNonceTooHigh) {
+			sender, senderErr := types.Sender(signer, queueItem.tx)
+			if senderErr == nil {
+				if err == nil {
+					// This may have filled a nonce gap, so sequence any successors waiting on it in the next block
+					s.releasedQueue = append(s.releasedQueue, s.nonceGaps.release(sender, queueItem.tx.Nonce()+1)...)
+				} else {
+					err = s.nonceGaps.add(sender, queueItem.tx.Nonce(), queueItem, err, now)
+					if err == nil {
+						continue
+					}
+				}
+			}
+		}
 		queueItem.returnResult(err)
 	}
 }
@@ -346,6 +617,15 @@ func (s *Sequencer) Start(ctxIn context.Context) error {
 
 	}
 
+	if s.config.TxFilters.File != "" {
+		s.CallIteratively(func(ctx context.Context) time.Duration {
+			if err := s.txFilters.reloadFile(&s.config.TxFilters); err != nil {
+				log.Error("failed to reload sequencer filter file", "err", err)
+			}
+			return s.config.TxFilters.FileReloadInterval
+		})
+	}
+
 	s.CallIteratively(func(ctx context.Context) time.Duration {
 		nextBlock := time.Now().Add(s.config.MaxBlockSpeed)
 		s.sequenceTransactions(ctx)
@@ -0,0 +1,82 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/rpc"
+)
+
+type recordedBundle struct {
+	encodedTxs  []hexutil.Bytes
+	targetBlock *hexutil.Uint64
+}
+
+// bundleRecorder stands in for the arb namespace of the sequencer bundles are forwarded to
+type bundleRecorder struct {
+	bundles chan recordedBundle
+}
+
+func (r *bundleRecorder) SendBundle(ctx context.Context, encodedTxs []hexutil.Bytes, targetBlock *hexutil.Uint64) ([]common.Hash, error) {
+	r.bundles <- recordedBundle{encodedTxs, targetBlock}
+	return []common.Hash{}, nil
+}
+
+func TestSequencerForwardsBundle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recorder := &bundleRecorder{bundles: make(chan recordedBundle, 1)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("arb", recorder); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Stop()
+
+	forwarder := NewForwarder(httpServer.URL)
+	if err := forwarder.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// a sequencer which isn't currently the active one forwards bundles without touching its own chain
+	sequencer := &Sequencer{forwarder: forwarder}
+
+	txs := types.Transactions{
+		types.NewTx(&types.LegacyTx{Nonce: 1}),
+		types.NewTx(&types.LegacyTx{Nonce: 2}),
+	}
+	targetBlock := uint64(100)
+	resultChan := make(chan error, 1)
+	sequencer.sequenceBundle(bundleQueueItem{txs, &targetBlock, resultChan, ctx})
+	if err := <-resultChan; err != nil {
+		t.Fatal("failed to forward bundle", err)
+	}
+
+	bundle := <-recorder.bundles
+	if bundle.targetBlock == nil || uint64(*bundle.targetBlock) != targetBlock {
+		t.Fatal("forwarded bundle has the wrong target block", bundle.targetBlock)
+	}
+	if len(bundle.encodedTxs) != len(txs) {
+		t.Fatal("forwarded bundle has", len(bundle.encodedTxs), "transactions instead of", len(txs))
+	}
+	for i, encodedTx := range bundle.encodedTxs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encodedTx); err != nil {
+			t.Fatal(err)
+		}
+		if tx.Hash() != txs[i].Hash() {
+			t.Fatal("forwarded bundle transaction", i, "is", tx.Hash(), "instead of", txs[i].Hash())
+		}
+	}
+	if len(forwarder.PendingTxs().Transactions()) != 0 {
+		t.Fatal("forwarded bundle still pending after it was accepted")
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/json"
+	"github.com/knadh/koanf/providers/file"
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/arbos/arbosState"
+	"github.com/pkg/errors"
+)
+
+var ErrTxFiltered = errors.New("transaction rejected by sequencer policy")
+
+// TxFilter is a sequencer policy deciding whether a transaction may be included in a block.
+// PreTxFilter is called before the transaction is executed, and PostTxFilter after, with its receipt.
+// Filters are only called from the sequencing thread.
+type TxFilter interface {
+	PreTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error
+	PostTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address, dataGas uint64, receipt *types.Receipt) error
+}
+
+// TxInclusionRecorder is optionally implemented by a TxFilter which accounts for the transactions it passes.
+// A transaction passing PostTxFilter may still be rejected by a later filter or fail to make it into the block,
+// so after each attempt to sequence a block, TxsIncluded is called with the transactions which were included.
+type TxInclusionRecorder interface {
+	TxsIncluded(txs types.Transactions)
+}
+
+type TxFilterConfig struct {
+	SenderTxsPerMinute      uint64        `koanf:"sender-txs-per-minute"`
+	SenderCalldataPerMinute uint64        `koanf:"sender-calldata-per-minute"`
+	DeniedDestinations      []string      `koanf:"denied-destinations"`
+	File                    string        `koanf:"file"`
+	FileReloadInterval      time.Duration `koanf:"file-reload-interval"`
+}
+
+var DefaultTxFilterConfig = TxFilterConfig{
+	SenderTxsPerMinute:      0,
+	SenderCalldataPerMinute: 0,
+	DeniedDestinations:      []string{},
+	File:                    "",
+	FileReloadInterval:      time.Second * 10,
+}
+
+func TxFilterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Uint64(prefix+".sender-txs-per-minute", DefaultTxFilterConfig.SenderTxsPerMinute, "maximum number of transactions sequenced per sender per minute (0 = unlimited)")
+	f.Uint64(prefix+".sender-calldata-per-minute", DefaultTxFilterConfig.SenderCalldataPerMinute, "maximum bytes of calldata sequenced per sender per minute (0 = unlimited)")
+	f.StringSlice(prefix+".denied-destinations", DefaultTxFilterConfig.DeniedDestinations, "addresses transactions may not be sent to")
+	f.String(prefix+".file", DefaultTxFilterConfig.File, "JSON file with the filter options above, which is reloaded when modified and overrides them")
+	f.Duration(prefix+".file-reload-interval", DefaultTxFilterConfig.FileReloadInterval, "how often to check the filter file for modifications")
+}
+
+// filters builds the configured filters, with any rate limit recording its usage in the given state
+func (c *TxFilterConfig) filters(rateLimitState *senderRateLimitState) ([]TxFilter, error) {
+	var filters []TxFilter
+	if len(c.DeniedDestinations) > 0 {
+		filter, err := newDestinationDenyFilter(c.DeniedDestinations)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	if c.SenderTxsPerMinute > 0 || c.SenderCalldataPerMinute > 0 {
+		filters = append(filters, newSenderRateLimitFilter(c.SenderTxsPerMinute, c.SenderCalldataPerMinute, time.Minute, rateLimitState))
+	}
+	return filters, nil
+}
+
+// TxFilterChain runs the built-in filters, followed by any custom ones, stopping at the first rejection.
+type TxFilterChain struct {
+	mutex    sync.RWMutex
+	builtin  []TxFilter
+	custom   []TxFilter
+	fileTime time.Time
+	// rateLimitState is kept across reloads, so that senders' usage isn't reset by editing the filter file
+	rateLimitState *senderRateLimitState
+}
+
+func NewTxFilterChain(config *TxFilterConfig) (*TxFilterChain, error) {
+	rateLimitState := newSenderRateLimitState()
+	builtin, err := config.filters(rateLimitState)
+	if err != nil {
+		return nil, err
+	}
+	return &TxFilterChain{builtin: builtin, rateLimitState: rateLimitState}, nil
+}
+
+// Add appends a custom filter to the chain. Custom filters are kept across reloads of the built-in ones.
+func (c *TxFilterChain) Add(filter TxFilter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.custom = append(c.custom, filter)
+}
+
+func (c *TxFilterChain) filters() []TxFilter {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	filters := make([]TxFilter, 0, len(c.builtin)+len(c.custom))
+	filters = append(filters, c.builtin...)
+	return append(filters, c.custom...)
+}
+
+func (c *TxFilterChain) PreTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error {
+	for _, filter := range c.filters() {
+		if err := filter.PreTxFilter(state, tx, sender); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *TxFilterChain) PostTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address, dataGas uint64, receipt *types.Receipt) error {
+	for _, filter := range c.filters() {
+		if err := filter.PostTxFilter(state, tx, sender, dataGas, receipt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txsIncluded reports the transactions included by an attempt to sequence a block to the filters recording them
+func (c *TxFilterChain) txsIncluded(txs types.Transactions) {
+	for _, filter := range c.filters() {
+		if recorder, ok := filter.(TxInclusionRecorder); ok {
+			recorder.TxsIncluded(txs)
+		}
+	}
+}
+
+// reloadFile replaces the built-in filters with ones built from the given config overridden by the filter file,
+// if the file has been modified since the last reload.
+func (c *TxFilterChain) reloadFile(config *TxFilterConfig) error {
+	info, err := os.Stat(config.File)
+	if err != nil {
+		return err
+	}
+	c.mutex.RLock()
+	unmodified := info.ModTime().Equal(c.fileTime)
+	c.mutex.RUnlock()
+	if unmodified {
+		return nil
+	}
+
+	k := koanf.New(".")
+	if err := k.Load(file.Provider(config.File), json.Parser()); err != nil {
+		return errors.Wrap(err, "error loading sequencer filter file")
+	}
+	fileConfig := *config
+	if err := k.UnmarshalWithConf("", &fileConfig, koanf.UnmarshalConf{Tag: "koanf"}); err != nil {
+		return errors.Wrap(err, "error parsing sequencer filter file")
+	}
+	builtin, err := fileConfig.filters(c.rateLimitState)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.builtin = builtin
+	c.fileTime = info.ModTime()
+	log.Info("reloaded sequencer filters", "file", config.File, "filters", len(builtin))
+	return nil
+}
+
+type destinationDenyFilter struct {
+	denied map[common.Address]struct{}
+}
+
+func newDestinationDenyFilter(addresses []string) (*destinationDenyFilter, error) {
+	denied := make(map[common.Address]struct{})
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("sequencer denied destination \"%v\" is not a valid address", address)
+		}
+		denied[common.HexToAddress(address)] = struct{}{}
+	}
+	return &destinationDenyFilter{denied}, nil
+}
+
+func (f *destinationDenyFilter) PreTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error {
+	if tx.To() == nil {
+		return nil
+	}
+	if _, denied := f.denied[*tx.To()]; denied {
+		return fmt.Errorf("%w: destination %v is denied", ErrTxFiltered, *tx.To())
+	}
+	return nil
+}
+
+func (f *destinationDenyFilter) PostTxFilter(*arbosState.ArbosState, *types.Transaction, common.Address, uint64, *types.Receipt) error {
+	return nil
+}
+
+type senderUsage struct {
+	txs      uint64
+	calldata uint64
+}
+
+type pendingSenderUsage struct {
+	sender   common.Address
+	calldata uint64
+}
+
+// senderRateLimitState is the usage recorded by a senderRateLimitFilter
+type senderRateLimitState struct {
+	windowStart time.Time
+	usage       map[common.Address]*senderUsage
+	// pending is the usage of transactions which passed the filter in the block being sequenced,
+	// which only counts towards the sender's usage once they're included
+	pending map[common.Hash]pendingSenderUsage
+}
+
+func newSenderRateLimitState() *senderRateLimitState {
+	return &senderRateLimitState{
+		usage:   make(map[common.Address]*senderUsage),
+		pending: make(map[common.Hash]pendingSenderUsage),
+	}
+}
+
+// senderRateLimitFilter limits the transactions and calldata sequenced per sender over fixed windows of time.
+// Usage is only recorded once a transaction is included in a block, so rejected transactions don't count against the sender.
+type senderRateLimitFilter struct {
+	maxTxs      uint64
+	maxCalldata uint64
+	window      time.Duration
+	state       *senderRateLimitState
+}
+
+func newSenderRateLimitFilter(maxTxs uint64, maxCalldata uint64, window time.Duration, state *senderRateLimitState) *senderRateLimitFilter {
+	return &senderRateLimitFilter{
+		maxTxs:      maxTxs,
+		maxCalldata: maxCalldata,
+		window:      window,
+		state:       state,
+	}
+}
+
+// senderUsage returns the sender's usage in the current window, including that of its transactions pending inclusion
+func (f *senderRateLimitFilter) senderUsage(sender common.Address) senderUsage {
+	if time.Since(f.state.windowStart) >= f.window {
+		f.state.windowStart = time.Now()
+		f.state.usage = make(map[common.Address]*senderUsage)
+	}
+	var usage senderUsage
+	if recorded := f.state.usage[sender]; recorded != nil {
+		usage = *recorded
+	}
+	for _, pending := range f.state.pending {
+		if pending.sender == sender {
+			usage.txs++
+			usage.calldata += pending.calldata
+		}
+	}
+	return usage
+}
+
+func (f *senderRateLimitFilter) PreTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address) error {
+	usage := f.senderUsage(sender)
+	if f.maxTxs > 0 && usage.txs >= f.maxTxs {
+		return fmt.Errorf("%w: sender %v exceeded %v transactions per %v", ErrTxFiltered, sender, f.maxTxs, f.window)
+	}
+	if f.maxCalldata > 0 && usage.calldata+uint64(len(tx.Data())) > f.maxCalldata {
+		return fmt.Errorf("%w: sender %v exceeded %v bytes of calldata per %v", ErrTxFiltered, sender, f.maxCalldata, f.window)
+	}
+	return nil
+}
+
+func (f *senderRateLimitFilter) PostTxFilter(state *arbosState.ArbosState, tx *types.Transaction, sender common.Address, dataGas uint64, receipt *types.Receipt) error {
+	f.state.pending[tx.Hash()] = pendingSenderUsage{sender, uint64(len(tx.Data()))}
+	return nil
+}
+
+func (f *senderRateLimitFilter) TxsIncluded(txs types.Transactions) {
+	for _, tx := range txs {
+		pending, exists := f.state.pending[tx.Hash()]
+		if !exists {
+			continue
+		}
+		usage := f.state.usage[pending.sender]
+		if usage == nil {
+			usage = &senderUsage{}
+			f.state.usage[pending.sender] = usage
+		}
+		usage.txs++
+		usage.calldata += pending.calldata
+	}
+	f.state.pending = make(map[common.Hash]pendingSenderUsage)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+func TestTxFilterChain(t *testing.T) {
+	denied := common.HexToAddress("0xdead")
+	allowed := common.HexToAddress("0xbeef")
+	sender := common.HexToAddress("0x1234")
+	config := DefaultTxFilterConfig
+	config.SenderTxsPerMinute = 2
+	config.DeniedDestinations = []string{denied.Hex()}
+	chain, err := NewTxFilterChain(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deniedTx := types.NewTx(&types.LegacyTx{To: &denied})
+	if err := chain.PreTxFilter(nil, deniedTx, sender); !errors.Is(err, ErrTxFiltered) {
+		t.Fatal("transaction to denied destination wasn't filtered", err)
+	}
+
+	passTx := func(nonce uint64) *types.Transaction {
+		tx := types.NewTx(&types.LegacyTx{Nonce: nonce, To: &allowed})
+		if err := chain.PreTxFilter(nil, tx, sender); err != nil {
+			t.Fatal(err)
+		}
+		if err := chain.PostTxFilter(nil, tx, sender, 0, &types.Receipt{}); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	// only transactions which make it into a block count towards the rate limit
+	included := passTx(0)
+	passTx(1)
+	chain.txsIncluded(types.Transactions{included})
+	included = passTx(1)
+	allowedTx := types.NewTx(&types.LegacyTx{Nonce: 2, To: &allowed})
+	if err := chain.PreTxFilter(nil, allowedTx, sender); !errors.Is(err, ErrTxFiltered) {
+		t.Fatal("sender exceeding its rate limit with transactions pending inclusion wasn't filtered", err)
+	}
+	chain.txsIncluded(types.Transactions{included})
+	if err := chain.PreTxFilter(nil, allowedTx, sender); !errors.Is(err, ErrTxFiltered) {
+		t.Fatal("sender exceeding its rate limit wasn't filtered", err)
+	}
+	if err := chain.PreTxFilter(nil, allowedTx, common.HexToAddress("0x5678")); err != nil {
+		t.Fatal("rate limit applied to a different sender", err)
+	}
+
+	// editing the filter file doesn't reset senders' usage
+	config.File = filepath.Join(t.TempDir(), "filters.json")
+	if err := os.WriteFile(config.File, []byte(`{"sender-txs-per-minute": 3}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.reloadFile(&config); err != nil {
+		t.Fatal(err)
+	}
+	chain.txsIncluded(types.Transactions{passTx(2)})
+	if err := chain.PreTxFilter(nil, allowedTx, sender); !errors.Is(err, ErrTxFiltered) {
+		t.Fatal("sender's usage was reset by reloading the filter file", err)
+	}
+}
+
+func TestTxFilterChainReload(t *testing.T) {
+	denied := common.HexToAddress("0xdead")
+	config := DefaultTxFilterConfig
+	config.File = filepath.Join(t.TempDir(), "filters.json")
+	chain, err := NewTxFilterChain(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := types.NewTx(&types.LegacyTx{To: &denied})
+	if err := chain.PreTxFilter(nil, tx, common.Address{}); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []byte(`{"denied-destinations": ["` + denied.Hex() + `"]}`)
+	if err := os.WriteFile(config.File, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.reloadFile(&config); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.PreTxFilter(nil, tx, common.Address{}); !errors.Is(err, ErrTxFiltered) {
+		t.Fatal("filter from reloaded file wasn't applied", err)
+	}
+
+	if err := os.WriteFile(config.File, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(config.File, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.reloadFile(&config); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.PreTxFilter(nil, tx, common.Address{}); err != nil {
+		t.Fatal("filter removed from file still applied", err)
+	}
+}
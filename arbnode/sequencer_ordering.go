@@ -0,0 +1,203 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+const (
+	TxOrderingFifo         = "fifo"
+	TxOrderingTip          = "tip"
+	TxOrderingPriorityLane = "priority-lane"
+)
+
+type TxOrderingConfig struct {
+	Policy                string        `koanf:"policy"`
+	CollectionWindow      time.Duration `koanf:"collection-window"`
+	PriorityLaneAuthority string        `koanf:"priority-lane-authority"`
+}
+
+var DefaultTxOrderingConfig = TxOrderingConfig{
+	Policy:                TxOrderingFifo,
+	CollectionWindow:      0,
+	PriorityLaneAuthority: "",
+}
+
+func TxOrderingConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".policy", DefaultTxOrderingConfig.Policy, "order of transactions within a block, one of \"fifo\", \"tip\" (highest tip first) or \"priority-lane\" (holders of a priority lane credential first)")
+	f.Duration(prefix+".collection-window", DefaultTxOrderingConfig.CollectionWindow, "time to collect transactions for a block before ordering them (ignored by fifo ordering)")
+	f.String(prefix+".priority-lane-authority", DefaultTxOrderingConfig.PriorityLaneAuthority, "address that signs priority lane credentials")
+}
+
+// PriorityLaneCredential grants transactions of Address priority until the Expiry unix timestamp.
+// The Signature is made by the configured priority lane authority over PriorityLaneCredentialHash.
+type PriorityLaneCredential struct {
+	Address   common.Address `json:"address"`
+	Expiry    hexutil.Uint64 `json:"expiry"`
+	Signature hexutil.Bytes  `json:"signature"`
+}
+
+func PriorityLaneCredentialHash(address common.Address, expiry uint64) common.Hash {
+	var expiryBytes [8]byte
+	binary.BigEndian.PutUint64(expiryBytes[:], expiry)
+	return crypto.Keccak256Hash([]byte("priority lane credential"), address.Bytes(), expiryBytes[:])
+}
+
+var ErrInvalidPriorityLaneCredential = errors.New("invalid priority lane credential")
+
+type txOrdering struct {
+	policy    string
+	authority common.Address
+
+	lanesMutex sync.Mutex
+	lanes      map[common.Address]time.Time
+}
+
+func newTxOrdering(config *TxOrderingConfig) (*txOrdering, error) {
+	ordering := &txOrdering{
+		policy: config.Policy,
+		lanes:  make(map[common.Address]time.Time),
+	}
+	switch config.Policy {
+	case TxOrderingFifo, TxOrderingTip:
+	case TxOrderingPriorityLane:
+		if !common.IsHexAddress(config.PriorityLaneAuthority) {
+			return nil, fmt.Errorf("sequencer priority lane authority \"%v\" is not a valid address", config.PriorityLaneAuthority)
+		}
+		ordering.authority = common.HexToAddress(config.PriorityLaneAuthority)
+	default:
+		return nil, fmt.Errorf("unknown sequencer ordering policy \"%v\"", config.Policy)
+	}
+	return ordering, nil
+}
+
+func (o *txOrdering) enabled() bool {
+	return o.policy != TxOrderingFifo
+}
+
+func (o *txOrdering) registerCredential(credential *PriorityLaneCredential) error {
+	if o.policy != TxOrderingPriorityLane {
+		return errors.New("priority lanes aren't enabled on this sequencer")
+	}
+	expiry := time.Unix(int64(credential.Expiry), 0)
+	if time.Now().After(expiry) {
+		return fmt.Errorf("%w: expired", ErrInvalidPriorityLaneCredential)
+	}
+	hash := PriorityLaneCredentialHash(credential.Address, uint64(credential.Expiry))
+	pubkey, err := crypto.SigToPub(hash.Bytes(), credential.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPriorityLaneCredential, err)
+	}
+	if crypto.PubkeyToAddress(*pubkey) != o.authority {
+		return fmt.Errorf("%w: not signed by the priority lane authority", ErrInvalidPriorityLaneCredential)
+	}
+	o.lanesMutex.Lock()
+	defer o.lanesMutex.Unlock()
+	if expiry.After(o.lanes[credential.Address]) {
+		o.lanes[credential.Address] = expiry
+	}
+	return nil
+}
+
+func (o *txOrdering) priority(tx *types.Transaction, sender common.Address, now time.Time) *big.Int {
+	switch o.policy {
+	case TxOrderingTip:
+		return tx.GasTipCap()
+	case TxOrderingPriorityLane:
+		o.lanesMutex.Lock()
+		defer o.lanesMutex.Unlock()
+		expiry, exists := o.lanes[sender]
+		if !exists {
+			return common.Big0
+		}
+		if now.After(expiry) {
+			delete(o.lanes, sender)
+			return common.Big0
+		}
+		return common.Big1
+	default:
+		return common.Big0
+	}
+}
+
+type orderedTx struct {
+	item     txQueueItem
+	priority *big.Int
+	arrival  int
+}
+
+// senderHeads is a heap of each sender's next transaction, highest priority first and then in arrival order
+type senderHeads [][]*orderedTx
+
+func (h senderHeads) Len() int { return len(h) }
+func (h senderHeads) Less(i, j int) bool {
+	cmp := h[i][0].priority.Cmp(h[j][0].priority)
+	if cmp != 0 {
+		return cmp > 0
+	}
+	return h[i][0].arrival < h[j][0].arrival
+}
+func (h senderHeads) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *senderHeads) Push(x interface{}) { *h = append(*h, x.([]*orderedTx)) }
+func (h *senderHeads) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// order sorts the queue items by the ordering policy, while keeping each sender's transactions in arrival order
+// so that nonces aren't reordered. Ties are broken by arrival order.
+func (o *txOrdering) order(items []txQueueItem, signer types.Signer) []txQueueItem {
+	if !o.enabled() || len(items) < 2 {
+		return items
+	}
+	now := time.Now()
+	bySender := make(map[common.Address][]*orderedTx)
+	var senders []common.Address
+	for i, item := range items {
+		// If the signature is invalid the transaction will be rejected anyways, so the sender doesn't matter
+		sender, _ := types.Sender(signer, item.tx)
+		if _, exists := bySender[sender]; !exists {
+			senders = append(senders, sender)
+		}
+		bySender[sender] = append(bySender[sender], &orderedTx{
+			item:     item,
+			priority: o.priority(item.tx, sender, now),
+			arrival:  i,
+		})
+	}
+	heads := make(senderHeads, 0, len(senders))
+	for _, sender := range senders {
+		heads = append(heads, bySender[sender])
+	}
+	heap.Init(&heads)
+	ordered := make([]txQueueItem, 0, len(items))
+	for heads.Len() > 0 {
+		txs := heads[0]
+		ordered = append(ordered, txs[0].item)
+		if len(txs) > 1 {
+			heads[0] = txs[1:]
+			heap.Fix(&heads, 0)
+		} else {
+			heap.Pop(&heads)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,91 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+)
+
+func checkOrder(t *testing.T, ordered []txQueueItem, expected []txQueueItem) {
+	t.Helper()
+	if len(ordered) != len(expected) {
+		t.Fatal("unexpected number of ordered transactions", len(ordered))
+	}
+	for i := range ordered {
+		if ordered[i].tx.Hash() != expected[i].tx.Hash() {
+			t.Fatal("unexpected transaction at position", i)
+		}
+	}
+}
+
+func TestTipOrdering(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	alice, _ := crypto.GenerateKey()
+	bob, _ := crypto.GenerateKey()
+	ordering, err := newTxOrdering(&TxOrderingConfig{Policy: TxOrderingTip})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice0, _ := newTestQueueItem(t, signer, alice, 0, 1)
+	alice1, _ := newTestQueueItem(t, signer, alice, 1, 100)
+	bob0, _ := newTestQueueItem(t, signer, bob, 0, 10)
+	bob1, _ := newTestQueueItem(t, signer, bob, 1, 10)
+
+	// alice's second tx has the highest tip, but can't be ordered before her first one
+	ordered := ordering.order([]txQueueItem{alice0, alice1, bob0, bob1}, signer)
+	checkOrder(t, ordered, []txQueueItem{bob0, bob1, alice0, alice1})
+
+	fifo, err := newTxOrdering(&DefaultTxOrderingConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ordered = fifo.order([]txQueueItem{alice0, alice1, bob0, bob1}, signer)
+	checkOrder(t, ordered, []txQueueItem{alice0, alice1, bob0, bob1})
+}
+
+func TestPriorityLaneOrdering(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	authority, _ := crypto.GenerateKey()
+	alice, _ := crypto.GenerateKey()
+	bob, _ := crypto.GenerateKey()
+	ordering, err := newTxOrdering(&TxOrderingConfig{
+		Policy:                TxOrderingPriorityLane,
+		PriorityLaneAuthority: crypto.PubkeyToAddress(authority.PublicKey).Hex(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bobAddress := crypto.PubkeyToAddress(bob.PublicKey)
+	expiry := uint64(time.Now().Add(time.Hour).Unix())
+	hash := PriorityLaneCredentialHash(bobAddress, expiry)
+	forged, err := crypto.Sign(hash.Bytes(), alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ordering.registerCredential(&PriorityLaneCredential{bobAddress, hexutil.Uint64(expiry), forged})
+	if err == nil {
+		t.Fatal("accepted credential not signed by the authority")
+	}
+	signature, err := crypto.Sign(hash.Bytes(), authority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ordering.registerCredential(&PriorityLaneCredential{bobAddress, hexutil.Uint64(expiry), signature})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice0, _ := newTestQueueItem(t, signer, alice, 0, 100)
+	bob0, _ := newTestQueueItem(t, signer, bob, 0, 1)
+	ordered := ordering.order([]txQueueItem{alice0, bob0}, signer)
+	checkOrder(t, ordered, []txQueueItem{bob0, alice0})
+}
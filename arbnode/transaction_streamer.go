@@ -236,7 +236,16 @@ func (s *TransactionStreamer) AddMessages(pos arbutil.MessageIndex, force bool,
 	return s.AddMessagesAndEndBatch(pos, force, messages, nil)
 }
 
-func (s *TransactionStreamer) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
+func (s *TransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	if len(feedMessages) == 0 {
+		return nil
+	}
+	pos := feedMessages[0].SequenceNumber
+	messages := make([]arbstate.MessageWithMetadata, 0, len(feedMessages))
+	for _, feedMessage := range feedMessages {
+		messages = append(messages, feedMessage.Message)
+	}
+
 	s.insertionMutex.Lock()
 	defer s.insertionMutex.Unlock()
 
@@ -434,6 +443,19 @@ func messageFromTxes(header *arbos.L1IncomingMessageHeader, txes types.Transacti
 }
 
 func (s *TransactionStreamer) SequenceTransactions(header *arbos.L1IncomingMessageHeader, txes types.Transactions, hooks *arbos.SequencingHooks) error {
+	return s.sequenceTransactions(header, txes, hooks, false, nil)
+}
+
+var ErrBundleTargetBlockPassed = errors.New("bundle target block has passed")
+
+// SequenceBundle is like SequenceTransactions, except that nothing is sequenced unless all the transactions succeed.
+// If maxBlock is set, nothing is sequenced if the block would be after it.
+// The per-transaction results are still recorded in the hooks' TxErrors.
+func (s *TransactionStreamer) SequenceBundle(header *arbos.L1IncomingMessageHeader, txes types.Transactions, hooks *arbos.SequencingHooks, maxBlock *uint64) error {
+	return s.sequenceTransactions(header, txes, hooks, true, maxBlock)
+}
+
+func (s *TransactionStreamer) sequenceTransactions(header *arbos.L1IncomingMessageHeader, txes types.Transactions, hooks *arbos.SequencingHooks, atomic bool, maxBlock *uint64) error {
 	s.insertionMutex.Lock()
 	defer s.insertionMutex.Unlock()
 	s.createBlocksMutex.Lock()
@@ -457,6 +479,9 @@ func (s *TransactionStreamer) SequenceTransactions(header *arbos.L1IncomingMessa
 	if lastBlockHeader.Number.Int64() != expectedBlockNum {
 		return fmt.Errorf("%w: block production not caught up: last block number %v but expected %v", ErrRetrySequencer, lastBlockHeader.Number, expectedBlockNum)
 	}
+	if maxBlock != nil && uint64(expectedBlockNum)+1 > *maxBlock {
+		return fmt.Errorf("%w: next block is %v but target is %v", ErrBundleTargetBlockPassed, expectedBlockNum+1, *maxBlock)
+	}
 	statedb, err := s.bc.StateAt(lastBlockHeader.Root)
 	if err != nil {
 		return err
@@ -487,13 +512,15 @@ func (s *TransactionStreamer) SequenceTransactions(header *arbos.L1IncomingMessa
 	}
 
 	allTxsErrored := true
+	anyTxErrored := false
 	for _, err := range hooks.TxErrors {
 		if err == nil {
 			allTxsErrored = false
-			break
+		} else {
+			anyTxErrored = true
 		}
 	}
-	if allTxsErrored {
+	if allTxsErrored || (atomic && anyTxErrored) {
 		return nil
 	}
 
@@ -626,6 +653,31 @@ func (s *TransactionStreamer) MessageCountToBlockNumber(messageNum arbutil.Messa
 	return arbutil.MessageCountToBlockNumber(messageNum, genesis), nil
 }
 
+var errMessagesNotExecuted = errors.New("messages not yet executed")
+
+// ArbOSVersionAfterMessages returns the ArbOS version of the block produced by the last of the first count messages,
+// which is what a batch starting after them is read with. It returns errMessagesNotExecuted if that block doesn't exist yet
+// and the ArbOS version could still affect how the batch is read.
+func (s *TransactionStreamer) ArbOSVersionAfterMessages(count arbutil.MessageIndex) (uint64, error) {
+	if count == 0 {
+		return 0, nil
+	}
+	blockNum, err := s.MessageCountToBlockNumber(count)
+	if err != nil {
+		return 0, err
+	}
+	header := s.bc.GetHeaderByNumber(uint64(blockNum))
+	if header == nil {
+		// ArbOS versions only go up, so once every batch format is active the exact version no longer matters
+		version := types.DeserializeHeaderExtraInformation(s.bc.CurrentHeader()).ArbOSFormatVersion
+		if version >= arbstate.LatestBatchFormatArbOSVersion {
+			return version, nil
+		}
+		return 0, errMessagesNotExecuted
+	}
+	return types.DeserializeHeaderExtraInformation(header).ArbOSFormatVersion, nil
+}
+
 // Pauses reorgs until a matching call to ResumeReorgs (may be called concurrently)
 func (s *TransactionStreamer) PauseReorgs() {
 	s.reorgMutex.RLock()
@@ -0,0 +1,113 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+var ErrReplaced = errors.New("transaction replaced")
+
+type queuedTxKey struct {
+	sender common.Address
+	nonce  uint64
+}
+
+type queuedTxEntry struct {
+	key      queuedTxKey
+	item     txQueueItem
+	replaced bool
+}
+
+// queuedTxIndex tracks the transactions waiting in the sequencer's queue by sender and nonce,
+// so that a queued transaction can be replaced by one paying a sufficiently higher fee.
+// Once the sequencing thread takes a transaction from the queue it can no longer be replaced.
+type queuedTxIndex struct {
+	mutex     sync.Mutex
+	priceBump uint64
+	entries   map[queuedTxKey]*queuedTxEntry
+}
+
+func newQueuedTxIndex(priceBump uint64) *queuedTxIndex {
+	return &queuedTxIndex{
+		priceBump: priceBump,
+		entries:   make(map[queuedTxKey]*queuedTxEntry),
+	}
+}
+
+// bumped returns whether the value is at least priceBump percent higher than the old one
+func bumped(old *big.Int, value *big.Int, priceBump uint64) bool {
+	threshold := new(big.Int).Mul(old, big.NewInt(int64(100+priceBump)))
+	threshold.Div(threshold, big.NewInt(100))
+	return value.Cmp(threshold) >= 0
+}
+
+// replacementPriced returns whether both the fee cap and the tip cap of the transaction are at least
+// priceBump percent higher than those of the old one it would replace
+func replacementPriced(oldTx *types.Transaction, tx *types.Transaction, priceBump uint64) bool {
+	return bumped(oldTx.GasFeeCap(), tx.GasFeeCap(), priceBump) && bumped(oldTx.GasTipCap(), tx.GasTipCap(), priceBump)
+}
+
+// add registers the item as queued, replacing any queued transaction with the same sender and nonce.
+// The replaced transaction's submitter gets ErrReplaced as its result.
+func (q *queuedTxIndex) add(sender common.Address, item *txQueueItem) error {
+	key := queuedTxKey{sender, item.tx.Nonce()}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if existing := q.entries[key]; existing != nil {
+		oldTx := existing.item.tx
+		if oldTx.Hash() == item.tx.Hash() {
+			return core.ErrAlreadyKnown
+		}
+		if !replacementPriced(oldTx, item.tx, q.priceBump) {
+			return core.ErrReplaceUnderpriced
+		}
+		existing.replaced = true
+		existing.item.returnResult(fmt.Errorf("%w by transaction %v", ErrReplaced, item.tx.Hash()))
+	}
+	entry := &queuedTxEntry{
+		key:  key,
+		item: *item,
+	}
+	q.entries[key] = entry
+	item.queued = entry
+	return nil
+}
+
+// remove unregisters an item that failed to make it into the queue
+func (q *queuedTxIndex) remove(item *txQueueItem) {
+	if item.queued == nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.entries[item.queued.key] == item.queued {
+		delete(q.entries, item.queued.key)
+	}
+}
+
+// take is called by the sequencing thread when it takes an item from the queue.
+// It returns false if the item has been replaced, in which case its result has already been returned.
+func (q *queuedTxIndex) take(item *txQueueItem) bool {
+	if item.queued == nil {
+		return true
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if item.queued.replaced {
+		return false
+	}
+	if q.entries[item.queued.key] == item.queued {
+		delete(q.entries, item.queued.key)
+	}
+	item.queued = nil
+	return true
+}
@@ -0,0 +1,53 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core"
+	"github.com/pkg/errors"
+)
+
+func TestQueuedTxReplacement(t *testing.T) {
+	index := newQueuedTxIndex(10)
+	sender := common.HexToAddress("0x1234")
+
+	original, originalResult := newTestQueueItem(t, nil, nil, 0, 100)
+	if err := index.add(sender, &original); err != nil {
+		t.Fatal(err)
+	}
+	underpriced, _ := newTestQueueItem(t, nil, nil, 0, 109)
+	if err := index.add(sender, &underpriced); !errors.Is(err, core.ErrReplaceUnderpriced) {
+		t.Fatal("accepted underpriced replacement", err)
+	}
+	otherNonce, _ := newTestQueueItem(t, nil, nil, 1, 1)
+	if err := index.add(sender, &otherNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	replacement, _ := newTestQueueItem(t, nil, nil, 0, 110)
+	if err := index.add(sender, &replacement); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-originalResult; !errors.Is(err, ErrReplaced) {
+		t.Fatal("unexpected result for replaced transaction", err)
+	}
+	if index.take(&original) {
+		t.Fatal("replaced transaction taken from the queue")
+	}
+	if !index.take(&replacement) {
+		t.Fatal("replacement transaction not taken from the queue")
+	}
+
+	// once taken from the queue, a transaction can no longer be replaced
+	late, _ := newTestQueueItem(t, nil, nil, 0, 1000)
+	if err := index.add(sender, &late); err != nil {
+		t.Fatal(err)
+	}
+	if !index.take(&late) {
+		t.Fatal("transaction queued after its nonce was taken not taken from the queue")
+	}
+}
@@ -263,6 +263,10 @@ func (state *ArbosState) UpgradeArbosVersion(upgradeTo uint64) {
 			ensure(state.l1PricingState.SetAmortizedCostCapBips(math.MaxUint64))
 		case 3:
 			// no state changes needed
+		case 4:
+			// no state changes needed, version 5 starts decoding zstd batches
+		case 5:
+			// no state changes needed, version 6 starts reading erasure coded DAS certificates
 		default:
 			panic("Unable to perform requested ArbOS upgrade")
 		}
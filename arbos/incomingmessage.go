@@ -59,7 +59,7 @@ func (h L1IncomingMessageHeader) SeqNum() (uint64, error) {
 }
 
 type L1IncomingMessage struct {
-	Header *L1IncomingMessageHeader `json:"header"`
+	Header *L1IncomingMessageHeader `json:"header" rlp:"nil"`
 	L2msg  []byte                   `json:"l2Msg"`
 }
 
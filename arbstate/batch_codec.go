@@ -0,0 +1,85 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbstate
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/tenderly/nitro/arbcompress"
+)
+
+// Indicates that the message is zstd-compressed.
+const ZstdMessageHeaderByte byte = 0x01
+
+// The ArbOS version from which zstd-compressed batches are decoded.
+// Before it, batches with the zstd header byte are of an unknown format and contain no segments, as they always were.
+const ZstdBatchArbOSVersion uint64 = 5
+
+// The ArbOS version from which batches with erasure coded DAS certificates are read.
+// Before it, they're rejected as an unsupported certificate version, as they always were.
+const ErasureCodedCertificateArbOSVersion uint64 = 6
+
+// The highest ArbOS version any batch format depends on.
+// Once a batch is read at or above it, the exact ArbOS version no longer affects how the batch is parsed.
+const LatestBatchFormatArbOSVersion uint64 = ErasureCodedCertificateArbOSVersion
+
+// BatchDecompressor decompresses a sequencer message payload, failing if the result would exceed maxSize.
+type BatchDecompressor func(input []byte, maxSize int) ([]byte, error)
+
+// The decompressors of every batch compression format, by the header byte identifying it.
+// As this determines how batches are read, it's part of the state transition function.
+var batchDecompressors = map[byte]BatchDecompressor{
+	BrotliMessageHeaderByte: arbcompress.Decompress,
+	ZstdMessageHeaderByte:   zstdDecompress,
+}
+
+// The ArbOS version from which each batch compression format is decoded, if it wasn't always.
+var batchCompressionArbOSVersions = map[byte]uint64{
+	ZstdMessageHeaderByte: ZstdBatchArbOSVersion,
+}
+
+// BatchCompressionArbOSVersion returns the ArbOS version a batch must be read at to decode the compression format identified by header.
+func BatchCompressionArbOSVersion(header byte) uint64 {
+	return batchCompressionArbOSVersions[header]
+}
+
+func IsCompressedMessageHeaderByte(header byte) bool {
+	_, exists := batchDecompressors[header]
+	return exists
+}
+
+func decompressBatchPayload(header byte, input []byte, maxSize int) ([]byte, error) {
+	decompress, exists := batchDecompressors[header]
+	if !exists {
+		return nil, errors.New("unknown batch compression format")
+	}
+	return decompress(input, maxSize)
+}
+
+var errZstdTooLarge = errors.New("zstd decompressed data too large")
+
+func zstdDecompress(input []byte, maxSize int) ([]byte, error) {
+	decoder, err := zstd.NewReader(
+		bytes.NewReader(input),
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderLowmem(true),
+		zstd.WithDecoderMaxMemory(uint64(maxSize)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(decoder, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > maxSize {
+		return nil, errZstdTooLarge
+	}
+	return decompressed, nil
+}
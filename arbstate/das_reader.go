@@ -25,6 +25,25 @@ type DataAvailabilityReader interface {
 	ExpirationPolicy(ctx context.Context) (ExpirationPolicy, error)
 }
 
+// ShardedDataAvailabilityReader is implemented by readers which can reconstruct erasure coded batch data
+// from the shards the committee members store, given the commitment to those shards in the certificate
+type ShardedDataAvailabilityReader interface {
+	GetByShards(ctx context.Context, dataHash common.Hash, shardCommitment common.Hash) ([]byte, error)
+}
+
+type shardFallbackKey struct{}
+
+// WithShardFallback marks the context of a request for a whole erasure coded batch, which is reconstructed
+// from its shards if the request fails, so readers shouldn't treat failing to get it whole as fatal
+func WithShardFallback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shardFallbackKey{}, true)
+}
+
+func HasShardFallback(ctx context.Context) bool {
+	fallback, _ := ctx.Value(shardFallbackKey{}).(bool)
+	return fallback
+}
+
 var ErrHashMismatch = errors.New("Result does not match expected hash")
 
 // Indicates that this data is a certificate for the data availability service,
@@ -60,13 +79,19 @@ func IsBrotliMessageHeaderByte(b uint8) bool {
 	return b == BrotliMessageHeaderByte
 }
 
+// Certificates of version 1 commit to the dastree hash of the data, which each committee member stores in full.
+// Those of ErasureCodedCertificateVersion additionally commit to the manifest of the erasure coded shards of the data,
+// one of which each committee member stores.
+const ErasureCodedCertificateVersion uint8 = 2
+
 type DataAvailabilityCertificate struct {
-	KeysetHash  [32]byte
-	DataHash    [32]byte
-	Timeout     uint64
-	SignersMask uint64
-	Sig         blsSignatures.Signature
-	Version     uint8
+	KeysetHash      [32]byte
+	DataHash        [32]byte
+	Timeout         uint64
+	SignersMask     uint64
+	Sig             blsSignatures.Signature
+	Version         uint8
+	ShardCommitment [32]byte // only present in erasure coded certificates
 }
 
 func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err error) {
@@ -107,6 +132,13 @@ func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err e
 		c.Version = versionBuf[0]
 	}
 
+	if c.Version == ErasureCodedCertificateVersion {
+		_, err = io.ReadFull(r, c.ShardCommitment[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var signersMaskBuf [8]byte
 	_, err = io.ReadFull(r, signersMaskBuf[:])
 	if err != nil {
@@ -128,7 +160,7 @@ func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err e
 }
 
 func (c *DataAvailabilityCertificate) SerializeSignableFields() []byte {
-	buf := make([]byte, 0, 32+9)
+	buf := make([]byte, 0, 32+9+32)
 	buf = append(buf, c.DataHash[:]...)
 
 	var intData [8]byte
@@ -139,6 +171,10 @@ func (c *DataAvailabilityCertificate) SerializeSignableFields() []byte {
 		buf = append(buf, c.Version)
 	}
 
+	if c.Version == ErasureCodedCertificateVersion {
+		buf = append(buf, c.ShardCommitment[:]...)
+	}
+
 	return buf
 }
 
@@ -34,10 +34,14 @@ type InboxBackend interface {
 	SetPositionWithinMessage(pos uint64)
 
 	ReadDelayedInbox(seqNum uint64) ([]byte, error)
+
+	// GetBatchArbOSVersion returns the ArbOS version of the block before the first message of the current batch,
+	// or 0 if the batch starts the chain. It's only consulted for batch formats gated on an ArbOS version.
+	GetBatchArbOSVersion() (uint64, error)
 }
 
 type MessageWithMetadata struct {
-	Message             *arbos.L1IncomingMessage `json:"message"`
+	Message             *arbos.L1IncomingMessage `json:"message" rlp:"nil"`
 	DelayedMessagesRead uint64                   `json:"delayedMessagesRead"`
 }
 
@@ -60,7 +64,7 @@ const maxZeroheavyDecompressedLen = 101*maxDecompressedLen/100 + 64
 const MaxSegmentsPerSequencerMessage = 100 * 1024
 const MinLifetimeSecondsForDataAvailabilityCert = 7 * 24 * 60 * 60 // one week
 
-func parseSequencerMessage(ctx context.Context, data []byte, dasReader DataAvailabilityReader) (*sequencerMessage, error) {
+func parseSequencerMessage(ctx context.Context, data []byte, dasReader DataAvailabilityReader, arbOSVersion func() (uint64, error)) (*sequencerMessage, error) {
 	if len(data) < 40 {
 		return nil, errors.New("sequencer message missing L1 header")
 	}
@@ -78,6 +82,9 @@ func parseSequencerMessage(ctx context.Context, data []byte, dasReader DataAvail
 		if dasReader == nil {
 			log.Error("No DAS Reader configured, but sequencer message found with DAS header")
 		} else {
+			if err := checkDASCertArbOSVersion(payload, arbOSVersion); err != nil {
+				return nil, err
+			}
 			var err error
 			payload, err = RecoverPayloadFromDasBatch(ctx, data, dasReader, nil)
 			if err != nil {
@@ -98,8 +105,16 @@ func parseSequencerMessage(ctx context.Context, data []byte, dasReader DataAvail
 		payload = pl
 	}
 
-	if len(payload) > 0 && IsBrotliMessageHeaderByte(payload[0]) {
-		decompressed, err := arbcompress.Decompress(payload[1:], maxDecompressedLen)
+	compressed := len(payload) > 0 && IsCompressedMessageHeaderByte(payload[0])
+	if compressed && BatchCompressionArbOSVersion(payload[0]) > 0 {
+		version, err := arbOSVersion()
+		if err != nil {
+			return nil, err
+		}
+		compressed = version >= BatchCompressionArbOSVersion(payload[0])
+	}
+	if compressed {
+		decompressed, err := decompressBatchPayload(payload[0], payload[1:], maxDecompressedLen)
 		if err == nil {
 			reader := bytes.NewReader(decompressed)
 			stream := rlp.NewStream(reader, uint64(maxDecompressedLen))
@@ -128,6 +143,28 @@ func parseSequencerMessage(ctx context.Context, data []byte, dasReader DataAvail
 	return parsedMsg, nil
 }
 
+// checkDASCertArbOSVersion panics if the certificate is erasure coded but the batch is read before the ArbOS version
+// which accepts those, exactly as it would for any other certificate version the node doesn't support.
+// Certificates which can't be deserialized are left to RecoverPayloadFromDasBatch.
+func checkDASCertArbOSVersion(payload []byte, arbOSVersion func() (uint64, error)) error {
+	cert, err := DeserializeDASCertFrom(bytes.NewReader(payload))
+	if err != nil || cert.Version != ErasureCodedCertificateVersion {
+		return nil
+	}
+	version, err := arbOSVersion()
+	if err != nil {
+		return err
+	}
+	if version < ErasureCodedCertificateArbOSVersion {
+		log.Error(
+			"Committee signed unsuported certificate format",
+			"version", cert.Version, "arbOSVersion", version, "dataHash", common.Hash(cert.DataHash),
+		)
+		panic("node software out of date")
+	}
+	return nil
+}
+
 func RecoverPayloadFromDasBatch(
 	ctx context.Context,
 	sequencerMsg []byte,
@@ -162,13 +199,13 @@ func RecoverPayloadFromDasBatch(
 		switch {
 		case version == 0 && crypto.Keccak256Hash(preimage) != hash:
 			fallthrough
-		case version == 1 && dastree.Hash(preimage) != hash:
+		case version >= 1 && version <= ErasureCodedCertificateVersion && dastree.Hash(preimage) != hash:
 			log.Error(
 				"preimage mismatch for hash",
 				"hash", hash, "err", ErrHashMismatch, "version", version,
 			)
 			return nil, ErrHashMismatch
-		case version >= 2:
+		case version > ErasureCodedCertificateVersion:
 			log.Error(
 				"Committee signed unsuported certificate format",
 				"version", version, "hash", hash, "payload", preimage,
@@ -205,7 +242,22 @@ func RecoverPayloadFromDasBatch(
 	}
 
 	dataHash := cert.DataHash
-	payload, err := getByHash(ctx, dataHash)
+	shardedReader, sharded := dasReader.(ShardedDataAvailabilityReader)
+	sharded = sharded && version == ErasureCodedCertificateVersion
+	dataCtx := ctx
+	if sharded {
+		// failing to get the whole batch isn't final, as it can be reconstructed from shards
+		dataCtx = WithShardFallback(ctx)
+	}
+	payload, err := getByHash(dataCtx, dataHash)
+	if err != nil && sharded {
+		// no one has the whole batch, so reconstruct it from the committee's shards
+		log.Debug("error fetching erasure coded DAS batch, reconstructing it from shards", "hash", dataHash, "err", err)
+		payload, err = shardedReader.GetByShards(ctx, dataHash, cert.ShardCommitment)
+		if err == nil && dastree.Hash(payload) != common.Hash(dataHash) {
+			err = ErrHashMismatch
+		}
+	}
 	if err != nil {
 		log.Error("Couldn't fetch DAS batch contents", "err", err)
 		return nil, err
@@ -266,7 +318,7 @@ func (r *inboxMultiplexer) Pop(ctx context.Context) (*MessageWithMetadata, error
 		}
 		r.cachedSequencerMessageNum = r.backend.GetSequencerInboxPosition()
 		var err error
-		r.cachedSequencerMessage, err = parseSequencerMessage(ctx, bytes, r.dasReader)
+		r.cachedSequencerMessage, err = parseSequencerMessage(ctx, bytes, r.dasReader, r.backend.GetBatchArbOSVersion)
 		if err != nil {
 			return nil, err
 		}
@@ -4,9 +4,17 @@
 package arbstate
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+
+	"github.com/tenderly/nitro/blsSignatures"
 )
 
 type multiplexerBackend struct {
@@ -14,6 +22,7 @@ type multiplexerBackend struct {
 	batch                 []byte
 	delayedMessage        []byte
 	positionWithinMessage uint64
+	arbOSVersion          uint64
 }
 
 func (b *multiplexerBackend) PeekSequencerInbox() ([]byte, error) {
@@ -46,21 +55,193 @@ func (b *multiplexerBackend) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
 	return b.delayedMessage, nil
 }
 
+func (b *multiplexerBackend) GetBatchArbOSVersion() (uint64, error) {
+	return b.arbOSVersion, nil
+}
+
+func popFromBatch(seqMsg []byte, delayedMsg []byte) {
+	backend := &multiplexerBackend{
+		batchSeqNum:           0,
+		batch:                 seqMsg,
+		delayedMessage:        delayedMsg,
+		positionWithinMessage: 0,
+		arbOSVersion:          LatestBatchFormatArbOSVersion,
+	}
+	multiplexer := NewInboxMultiplexer(backend, 0, nil)
+	_, err := multiplexer.Pop(context.TODO())
+	if err != nil {
+		panic(err)
+	}
+}
+
 func FuzzInboxMultiplexer(f *testing.F) {
 	f.Fuzz(func(t *testing.T, seqMsg []byte, delayedMsg []byte) {
 		if len(seqMsg) < 40 {
 			return
 		}
-		backend := &multiplexerBackend{
-			batchSeqNum:           0,
-			batch:                 seqMsg,
-			delayedMessage:        delayedMsg,
-			positionWithinMessage: 0,
+		popFromBatch(seqMsg, delayedMsg)
+	})
+}
+
+func zstdCompressSegments(t testing.TB, segments [][]byte) []byte {
+	var buf bytes.Buffer
+	writer, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range segments {
+		encoded, err := rlp.EncodeToBytes(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// FuzzInboxMultiplexerCodecs fuzzes the payload of batches in each compression format,
+// seeded with well formed compressed segments so the fuzzer reaches the segment decoding.
+func FuzzInboxMultiplexerCodecs(f *testing.F) {
+	segments := [][]byte{
+		{BatchSegmentKindAdvanceTimestamp, 0x01},
+		{BatchSegmentKindL2Message, 0x03, 0x01, 0x02, 0x03},
+	}
+	f.Add(ZstdMessageHeaderByte, zstdCompressSegments(f, segments))
+	f.Add(ZstdMessageHeaderByte, []byte{})
+	f.Add(BrotliMessageHeaderByte, []byte{})
+	f.Fuzz(func(t *testing.T, header byte, payload []byte) {
+		seqMsg := make([]byte, 40, 41+len(payload))
+		seqMsg = append(seqMsg, header)
+		seqMsg = append(seqMsg, payload...)
+		popFromBatch(seqMsg, nil)
+	})
+}
+
+func TestZstdBatchArbOSVersionGate(t *testing.T) {
+	segments := [][]byte{
+		{BatchSegmentKindAdvanceTimestamp, 0x01},
+		{BatchSegmentKindL2Message, 0x03, 0x01, 0x02, 0x03},
+	}
+	seqMsg := make([]byte, 40)
+	seqMsg = append(seqMsg, ZstdMessageHeaderByte)
+	seqMsg = append(seqMsg, zstdCompressSegments(t, segments)...)
+	unknownMsg := make([]byte, 40)
+	unknownMsg = append(unknownMsg, 0x02)
+
+	pop := func(batch []byte, arbOSVersion uint64) *MessageWithMetadata {
+		backend := &multiplexerBackend{batch: batch, arbOSVersion: arbOSVersion}
+		msg, err := NewInboxMultiplexer(backend, 0, nil).Pop(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	// before activation, a zstd batch is read exactly like a batch of an unknown format
+	for _, version := range []uint64{0, ZstdBatchArbOSVersion - 1} {
+		parsed, err := parseSequencerMessage(context.Background(), seqMsg, nil, func() (uint64, error) { return version, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parsed.segments) != 0 {
+			t.Fatal("zstd batch decoded at ArbOS version", version)
+		}
+		msg, err := rlp.EncodeToBytes(pop(seqMsg, version))
+		if err != nil {
+			t.Fatal(err)
 		}
-		multiplexer := NewInboxMultiplexer(backend, 0, nil)
-		_, err := multiplexer.Pop(context.TODO())
+		unknown, err := rlp.EncodeToBytes(pop(unknownMsg, version))
 		if err != nil {
-			panic(err)
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg, unknown) {
+			t.Fatal("zstd batch read differently from an unknown batch format at ArbOS version", version)
+		}
+	}
+
+	parsed, err := parseSequencerMessage(context.Background(), seqMsg, nil, func() (uint64, error) { return ZstdBatchArbOSVersion, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.segments) != len(segments) {
+		t.Fatal("zstd batch decoded into", len(parsed.segments), "segments instead of", len(segments))
+	}
+	for i, segment := range parsed.segments {
+		if !bytes.Equal(segment, segments[i]) {
+			t.Fatal("zstd batch segment", i, "is", segment, "instead of", segments[i])
 		}
+	}
+
+	// brotli batches don't depend on the ArbOS version
+	brotliMsg := make([]byte, 40)
+	brotliMsg = append(brotliMsg, BrotliMessageHeaderByte)
+	_, err = parseSequencerMessage(context.Background(), brotliMsg, nil, func() (uint64, error) {
+		return 0, errors.New("ArbOS version read for a brotli batch")
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type unavailableDASReader struct{}
+
+func (unavailableDASReader) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
+	return nil, errors.New("not available")
+}
+
+func (unavailableDASReader) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (unavailableDASReader) ExpirationPolicy(ctx context.Context) (ExpirationPolicy, error) {
+	return KeepForever, nil
+}
+
+func TestErasureCodedCertificateArbOSVersionGate(t *testing.T) {
+	_, privKey, err := blsSignatures.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &DataAvailabilityCertificate{
+		Version:         ErasureCodedCertificateVersion,
+		DataHash:        common.HexToHash("0x01"),
+		ShardCommitment: common.HexToHash("0x02"),
+	}
+	sig, err := blsSignatures.SignMessage(privKey, cert.SerializeSignableFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqMsg := make([]byte, 40)
+	seqMsg = append(seqMsg, DASMessageHeaderFlag|TreeDASMessageHeaderFlag)
+	seqMsg = append(seqMsg, cert.KeysetHash[:]...)
+	seqMsg = append(seqMsg, cert.SerializeSignableFields()...)
+	seqMsg = append(seqMsg, make([]byte, 8)...) // signers mask
+	seqMsg = append(seqMsg, blsSignatures.SignatureToBytes(sig)...)
+
+	parse := func(version uint64) (panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		// the keyset can't be got, so once the certificate is accepted parsing fails without panicking
+		_, err := parseSequencerMessage(context.Background(), seqMsg, unavailableDASReader{}, func() (uint64, error) { return version, nil })
+		if err == nil {
+			t.Fatal("parsed erasure coded batch without its keyset at ArbOS version", version)
+		}
+		return false
+	}
+
+	// before activation, an erasure coded certificate is rejected like any unsupported certificate version
+	for _, version := range []uint64{0, ErasureCodedCertificateArbOSVersion - 1} {
+		if !parse(version) {
+			t.Fatal("erasure coded certificate accepted at ArbOS version", version)
+		}
+	}
+	if parse(ErasureCodedCertificateArbOSVersion) {
+		t.Fatal("erasure coded certificate rejected at ArbOS version", ErasureCodedCertificateArbOSVersion)
+	}
 }
@@ -4,23 +4,29 @@
 package broadcastclient
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
 	"math/big"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/tenderly/nitro/go-ethereum/common"
 	"github.com/tenderly/nitro/go-ethereum/log"
-	"github.com/tenderly/nitro/arbstate"
 	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/broadcaster"
 	"github.com/tenderly/nitro/util/stopwaiter"
@@ -47,37 +53,81 @@ var FeedConfigDefault = FeedConfig{
 }
 
 type BroadcastClientConfig struct {
-	Timeout time.Duration `koanf:"timeout"`
-	URLs    []string      `koanf:"url"`
+	Timeout           time.Duration    `koanf:"timeout"`
+	URLs              []string         `koanf:"url"`
+	GapTimeout        time.Duration    `koanf:"gap-timeout"`
+	EnableCompression bool             `koanf:"enable-compression"`
+	EnableBinary      bool             `koanf:"enable-binary"`
+	Verify            FeedVerifyConfig `koanf:"verify"`
 }
 
 func (c *BroadcastClientConfig) Enable() bool {
 	return len(c.URLs) > 0 && c.URLs[0] != ""
 }
 
+func (c *BroadcastClientConfig) Validate() error {
+	if c.GapTimeout <= 0 {
+		return fmt.Errorf("invalid feed gap timeout %v", c.GapTimeout)
+	}
+	return nil
+}
+
 func BroadcastClientConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.StringSlice(prefix+".url", DefaultBroadcastClientConfig.URLs, "URL of sequencer feed source")
 	f.Duration(prefix+".timeout", DefaultBroadcastClientConfig.Timeout, "duration to wait before timing out connection to sequencer feed")
+	f.Duration(prefix+".gap-timeout", DefaultBroadcastClientConfig.GapTimeout, "duration to wait for a missing message from any feed source before passing on later messages without it, leaving it to be read from L1")
+	f.Bool(prefix+".enable-compression", DefaultBroadcastClientConfig.EnableCompression, "ask the feed to compress messages with permessage-deflate, which is used if the feed supports it")
+	f.Bool(prefix+".enable-binary", DefaultBroadcastClientConfig.EnableBinary, "ask the feed to send binary encoded messages rather than JSON, which is used if the feed supports it")
+	FeedVerifyConfigAddOptions(prefix+".verify", f)
 }
 
 var DefaultBroadcastClientConfig = BroadcastClientConfig{
-	URLs:    []string{""},
-	Timeout: 20 * time.Second,
+	URLs:              []string{""},
+	Timeout:           20 * time.Second,
+	GapTimeout:        5 * time.Second,
+	EnableCompression: false,
+	EnableBinary:      false,
+	Verify:            DefaultFeedVerifyConfig,
+}
+
+type FeedVerifyConfig struct {
+	AllowedAddresses []string `koanf:"allowed-addresses"`
+	AcceptUnverified bool     `koanf:"accept-unverified"`
+}
+
+func FeedVerifyConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.StringSlice(prefix+".allowed-addresses", DefaultFeedVerifyConfig.AllowedAddresses, "addresses allowed to sign feed messages (if empty, signatures aren't checked)")
+	f.Bool(prefix+".accept-unverified", DefaultFeedVerifyConfig.AcceptUnverified, "accept feed messages with a missing or invalid signature, logging a warning instead of dropping them")
 }
 
+var DefaultFeedVerifyConfig = FeedVerifyConfig{
+	AllowedAddresses: []string{},
+	AcceptUnverified: false,
+}
+
+var (
+	ErrMissingFeedSignature   = errors.New("feed message missing signature")
+	ErrIncorrectFeedSignature = errors.New("feed message signed by an address that isn't allowed")
+)
+
 type TransactionStreamerInterface interface {
-	AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error
+	AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error
 }
 
 type BroadcastClient struct {
 	stopwaiter.StopWaiter
 
-	websocketUrl    string
-	lastInboxSeqNum *big.Int
+	websocketUrl string
 
-	// Protects conn and shuttingDown
+	// Protects conn, shuttingDown and nextSeqNum
 	connMutex sync.Mutex
 	conn      net.Conn
+	// the sequence number to ask the server to start from when (re)connecting, or 0 to get everything it has buffered
+	nextSeqNum arbutil.MessageIndex
+	// whether permessage-deflate was negotiated on the current connection
+	compression bool
+	// whether the binary feed protocol was negotiated on the current connection
+	binary bool
 
 	retryCount int64
 
@@ -86,22 +136,78 @@ type BroadcastClient struct {
 	ConfirmedSequenceNumberListener chan arbutil.MessageIndex
 	idleTimeout                     time.Duration
 	txStreamer                      TransactionStreamerInterface
+	allowedSigners                  map[common.Address]bool // if empty, signatures aren't checked
+	acceptUnverified                bool
+	enableCompression               bool
+	enableBinary                    bool
+
+	// if set, receives every message as it's read from the feed, before any of it is verified or passed on
+	BroadcastMessageListener chan *broadcaster.BroadcastMessage
 }
 
-func NewBroadcastClient(websocketUrl string, lastInboxSeqNum *big.Int, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
-	var seqNum *big.Int
-	if lastInboxSeqNum == nil {
-		seqNum = big.NewInt(0)
-	} else {
-		seqNum = lastInboxSeqNum
+// NewBroadcastClient creates a client for the feed at websocketUrl.
+// If lastInboxSeqNum is set, the client asks the feed to start from the message after it.
+func NewBroadcastClient(config BroadcastClientConfig, websocketUrl string, lastInboxSeqNum *big.Int, txStreamer TransactionStreamerInterface) (*BroadcastClient, error) {
+	var nextSeqNum arbutil.MessageIndex
+	if lastInboxSeqNum != nil && lastInboxSeqNum.Sign() > 0 {
+		if !lastInboxSeqNum.IsUint64() {
+			return nil, fmt.Errorf("invalid last inbox sequence number %v", lastInboxSeqNum)
+		}
+		nextSeqNum = arbutil.MessageIndex(lastInboxSeqNum.Uint64() + 1)
+	}
+
+	allowedSigners := make(map[common.Address]bool)
+	for _, address := range config.Verify.AllowedAddresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid feed signer address \"%v\"", address)
+		}
+		allowedSigners[common.HexToAddress(address)] = true
 	}
 
 	return &BroadcastClient{
-		websocketUrl:    websocketUrl,
-		lastInboxSeqNum: seqNum,
-		idleTimeout:     idleTimeout,
-		txStreamer:      txStreamer,
+		websocketUrl:      websocketUrl,
+		nextSeqNum:        nextSeqNum,
+		idleTimeout:       config.Timeout,
+		txStreamer:        txStreamer,
+		allowedSigners:    allowedSigners,
+		acceptUnverified:  config.Verify.AcceptUnverified,
+		enableCompression: config.EnableCompression,
+		enableBinary:      config.EnableBinary,
+	}, nil
+}
+
+func (bc *BroadcastClient) verifyMessage(message *broadcaster.BroadcastFeedMessage) error {
+	if len(bc.allowedSigners) == 0 {
+		return nil
+	}
+	if len(message.Signature) == 0 {
+		return ErrMissingFeedSignature
+	}
+	signer, err := message.Signer()
+	if err != nil {
+		return err
+	}
+	if !bc.allowedSigners[signer] {
+		return ErrIncorrectFeedSignature
+	}
+	return nil
+}
+
+// verifiedMessages returns the messages up to the first one failing verification, unless unverified messages are accepted
+func (bc *BroadcastClient) verifiedMessages(messages []*broadcaster.BroadcastFeedMessage) []*broadcaster.BroadcastFeedMessage {
+	for i, message := range messages {
+		err := bc.verifyMessage(message)
+		if err == nil {
+			continue
+		}
+		if bc.acceptUnverified {
+			log.Warn("accepting unverified feed message", "url", bc.websocketUrl, "seqNum", message.SequenceNumber, "err", err)
+			continue
+		}
+		log.Error("dropping unverified feed message and its successors", "url", bc.websocketUrl, "seqNum", message.SequenceNumber, "count", len(messages)-i, "err", err)
+		return messages[:i]
 	}
+	return messages
 }
 
 func (bc *BroadcastClient) Start(ctxIn context.Context) {
@@ -114,6 +220,7 @@ func (bc *BroadcastClient) Start(ctxIn context.Context) {
 				break
 			}
 			log.Warn("failed connect to sequencer broadcast, waiting and retrying", "url", bc.websocketUrl, "err", err)
+			atomic.AddInt64(&bc.retryCount, 1)
 			timer := time.NewTimer(5 * time.Second)
 			select {
 			case <-ctx.Done():
@@ -138,12 +245,43 @@ func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reade
 			MinVersion: tls.VersionTLS12,
 		},
 	}
+	if bc.enableCompression {
+		timeoutDialer.Extensions = []httphead.Option{wsflate.DefaultParameters.Option()}
+	}
+	if bc.enableBinary {
+		timeoutDialer.Protocols = []string{wsbroadcastserver.BinaryFeedProtocol}
+	}
 
 	if bc.isShuttingDown() {
 		return
 	}
 
-	conn, br, _, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	bc.connMutex.Lock()
+	nextSeqNum := bc.nextSeqNum
+	bc.connMutex.Unlock()
+	var rejection string
+	if nextSeqNum > 0 {
+		timeoutDialer.Header = ws.HandshakeHeaderHTTP(http.Header{
+			wsbroadcastserver.HTTPHeaderRequestedSequenceNumber: []string{strconv.FormatUint(uint64(nextSeqNum), 10)},
+		})
+		timeoutDialer.OnStatusError = func(status int, reason []byte, resp io.Reader) {
+			rejection = readRejection(resp)
+		}
+	}
+
+	conn, br, hs, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	if errors.Is(err, ws.StatusError(http.StatusGone)) {
+		// the messages we're missing were confirmed, so the inbox reader will get them from L1
+		log.Warn("feed no longer has the requested messages, connecting without requesting a start", "url", bc.websocketUrl, "requested", nextSeqNum, "err", rejection)
+		bc.connMutex.Lock()
+		bc.nextSeqNum = 0
+		bc.connMutex.Unlock()
+		timeoutDialer.Header = nil
+		timeoutDialer.OnStatusError = nil
+		conn, br, hs, err = timeoutDialer.Dial(ctx, bc.websocketUrl)
+	} else if err != nil && rejection != "" {
+		err = fmt.Errorf("%w: %v", err, rejection)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "broadcast client unable to connect")
 	}
@@ -159,8 +297,19 @@ func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reade
 		earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
 	}
 
+	compression := wsbroadcastserver.CompressionAccepted(hs.Extensions)
+	if bc.enableCompression && !compression {
+		log.Info("feed doesn't support compression, continuing without it", "url", bc.websocketUrl)
+	}
+	binary := hs.Protocol == wsbroadcastserver.BinaryFeedProtocol
+	if bc.enableBinary && !binary {
+		log.Info("feed doesn't support binary messages, continuing with JSON", "url", bc.websocketUrl)
+	}
+
 	bc.connMutex.Lock()
 	bc.conn = conn
+	bc.compression = compression
+	bc.binary = binary
 	bc.connMutex.Unlock()
 
 	log.Info("Connected")
@@ -177,7 +326,7 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 			default:
 			}
 
-			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide)
+			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide, bc.compression)
 			if err != nil {
 				if bc.isShuttingDown() {
 					return
@@ -196,12 +345,24 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 
 			if msg != nil {
 				res := broadcaster.BroadcastMessage{}
-				err = json.Unmarshal(msg, &res)
+				if op == ws.OpBinary {
+					err = res.UnmarshalBinary(msg)
+				} else {
+					err = json.Unmarshal(msg, &res)
+				}
 				if err != nil {
 					log.Error("error unmarshalling message", "msg", msg, "err", err)
 					continue
 				}
 
+				if bc.BroadcastMessageListener != nil {
+					select {
+					case bc.BroadcastMessageListener <- &res:
+					case <-ctx.Done():
+						return
+					}
+				}
+
 				if len(res.Messages) > 0 {
 					log.Debug("received batch item", "count", len(res.Messages), "first seq", res.Messages[0].SequenceNumber)
 				} else if res.ConfirmedSequenceNumberMessage != nil {
@@ -211,17 +372,21 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 				}
 
 				if res.Version == 1 {
-					if len(res.Messages) > 0 {
-						messages := []arbstate.MessageWithMetadata{}
-						for _, message := range res.Messages {
-							messages = append(messages, message.Message)
-						}
-						if err := bc.txStreamer.AddBroadcastMessages(res.Messages[0].SequenceNumber, messages); err != nil {
+					messages := bc.verifiedMessages(res.Messages)
+					if len(messages) > 0 {
+						if err := bc.txStreamer.AddBroadcastMessages(messages); err != nil {
 							log.Error("Error adding message from Sequencer Feed", "err", err)
 						}
+						bc.connMutex.Lock()
+						bc.nextSeqNum = messages[len(messages)-1].SequenceNumber + 1
+						bc.connMutex.Unlock()
 					}
 					if res.ConfirmedSequenceNumberMessage != nil && bc.ConfirmedSequenceNumberListener != nil {
-						bc.ConfirmedSequenceNumberListener <- res.ConfirmedSequenceNumberMessage.SequenceNumber
+						select {
+						case bc.ConfirmedSequenceNumberListener <- res.ConfirmedSequenceNumberMessage.SequenceNumber:
+						case <-ctx.Done():
+							return
+						}
 					}
 				}
 			}
@@ -229,10 +394,31 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 	})
 }
 
+// readRejection returns the body of the HTTP response to a rejected websocket upgrade, which explains the rejection
+func readRejection(resp io.Reader) string {
+	response, err := http.ReadResponse(bufio.NewReader(resp), nil)
+	if err != nil {
+		return ""
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(body))
+}
+
 func (bc *BroadcastClient) GetRetryCount() int64 {
 	return atomic.LoadInt64(&bc.retryCount)
 }
 
+// GetNextSeqNum returns the sequence number the client asks the feed to start from when it (re)connects, or 0 if none
+func (bc *BroadcastClient) GetNextSeqNum() arbutil.MessageIndex {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.nextSeqNum
+}
+
 func (bc *BroadcastClient) isShuttingDown() bool {
 	bc.connMutex.Lock()
 	defer bc.connMutex.Unlock()
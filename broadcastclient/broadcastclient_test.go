@@ -6,11 +6,13 @@ package broadcastclient
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/tenderly/nitro/go-ethereum/crypto"
 	"github.com/tenderly/nitro/arbstate"
 	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/broadcaster"
@@ -27,7 +29,7 @@ func TestReceiveMessages(t *testing.T) {
 	messageCount := 1000
 	clientCount := 2
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -60,24 +62,30 @@ func NewDummyTransactionStreamer() *dummyTransactionStreamer {
 	}
 }
 
-func (ts *dummyTransactionStreamer) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
-	for i, message := range messages {
-		ts.messageReceiver <- broadcaster.BroadcastFeedMessage{
-			SequenceNumber: pos + arbutil.MessageIndex(i),
-			Message:        message,
-		}
+func (ts *dummyTransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, feedMessage := range feedMessages {
+		ts.messageReceiver <- *feedMessage
 	}
 	return nil
 }
 
-func newTestBroadcastClient(listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+func newTestBroadcastClient(t *testing.T, verify FeedVerifyConfig, listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+	t.Helper()
 	port := listenerAddress.(*net.TCPAddr).Port
-	return NewBroadcastClient(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil, idleTimeout, txStreamer)
+	config := BroadcastClientConfig{
+		Timeout: idleTimeout,
+		Verify:  verify,
+	}
+	client, err := NewBroadcastClient(config, fmt.Sprintf("ws://127.0.0.1:%d/", port), nil, txStreamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
 }
 
 func startMakeBroadcastClient(ctx context.Context, t *testing.T, addr net.Addr, index int, expectedCount int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, DefaultFeedVerifyConfig, addr, 20*time.Second, ts)
 	broadcastClient.Start(ctx)
 	messageCount := 0
 
@@ -117,7 +125,7 @@ func TestServerClientDisconnect(t *testing.T) {
 	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
 	settings.Ping = 1 * time.Second
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -126,7 +134,7 @@ func TestServerClientDisconnect(t *testing.T) {
 	defer b.StopAndWait()
 
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(b.ListenerAddr(), 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, DefaultFeedVerifyConfig, b.ListenerAddr(), 20*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	b.BroadcastSingle(arbstate.MessageWithMetadata{}, 0)
@@ -168,7 +176,7 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 	settings.Ping = 50 * time.Second
 	settings.ClientTimeout = 150 * time.Second
 
-	b1 := broadcaster.NewBroadcaster(settings)
+	b1 := broadcaster.NewBroadcaster(settings, nil, nil)
 
 	err := b1.Start(ctx)
 	if err != nil {
@@ -176,7 +184,7 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 	}
 	defer b1.StopAndWait()
 
-	broadcastClient := newTestBroadcastClient(b1.ListenerAddr(), 2*time.Second, nil)
+	broadcastClient := newTestBroadcastClient(t, DefaultFeedVerifyConfig, b1.ListenerAddr(), 2*time.Second, nil)
 
 	broadcastClient.Start(ctx)
 
@@ -200,7 +208,7 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 	defer cancel()
 	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -261,7 +269,7 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 
 func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.T, clientIndex int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 60*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, DefaultFeedVerifyConfig, addr, 60*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	go func() {
@@ -302,3 +310,192 @@ func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.
 
 	}()
 }
+
+func TestVerifyFeedSignatures(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sequencerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := func(hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, sequencerKey)
+	}
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil, signer)
+	err = b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	trusted := NewDummyTransactionStreamer()
+	trustingClient := newTestBroadcastClient(t, FeedVerifyConfig{
+		AllowedAddresses: []string{crypto.PubkeyToAddress(sequencerKey.PublicKey).Hex()},
+	}, b.ListenerAddr(), 20*time.Second, trusted)
+	trustingClient.Start(ctx)
+	defer trustingClient.StopAndWait()
+
+	otherKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted := NewDummyTransactionStreamer()
+	distrustingClient := newTestBroadcastClient(t, FeedVerifyConfig{
+		AllowedAddresses: []string{crypto.PubkeyToAddress(otherKey.PublicKey).Hex()},
+	}, b.ListenerAddr(), 20*time.Second, untrusted)
+	distrustingClient.Start(ctx)
+	defer distrustingClient.StopAndWait()
+
+	b.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: 1}, 0)
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case receivedMsg := <-trusted.messageReceiver:
+		if len(receivedMsg.Signature) == 0 {
+			t.Fatal("received message without signature")
+		}
+	case <-timer.C:
+		t.Fatal("client did not receive signed message")
+	}
+	select {
+	case <-untrusted.messageReceiver:
+		t.Fatal("client accepted message signed by an address it doesn't allow")
+	case <-time.After(time.Second):
+	}
+}
+
+func TestCatchupFromRequestedSequenceNumber(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil, nil)
+	err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	for i := 1; i <= 4; i++ {
+		b.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i))
+	}
+	b.Confirm(2)
+	for b.GetCachedMessageCount() != 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := b.CheckRequestedSequenceNumber(2); err == nil {
+		t.Fatal("no error requesting a message older than the buffer")
+	}
+
+	expectMessages := func(lastInboxSeqNum int64, expected ...arbutil.MessageIndex) {
+		t.Helper()
+		ts := NewDummyTransactionStreamer()
+		config := BroadcastClientConfig{Timeout: 20 * time.Second}
+		url := fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port)
+		client, err := NewBroadcastClient(config, url, big.NewInt(lastInboxSeqNum), ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Start(ctx)
+		defer client.StopAndWait()
+		for _, seqNum := range expected {
+			select {
+			case receivedMsg := <-ts.messageReceiver:
+				if receivedMsg.SequenceNumber != seqNum {
+					t.Fatal("unexpected message", receivedMsg.SequenceNumber, "expected", seqNum)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("client did not receive message", seqNum)
+			}
+		}
+	}
+	// only the missing message is sent
+	expectMessages(3, 4)
+	// a client missing confirmed messages gets the whole buffer, after the feed rejects its request
+	expectMessages(1, 3, 4)
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	t.Parallel()
+	for _, serverCompression := range []bool{false, true} {
+		for _, clientCompression := range []bool{false, true} {
+			settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+			settings.EnableCompression = serverCompression
+			config := BroadcastClientConfig{
+				Timeout:           20 * time.Second,
+				EnableCompression: clientCompression,
+			}
+			testNegotiation(t, settings, config)
+		}
+	}
+}
+
+func TestBinaryNegotiation(t *testing.T) {
+	t.Parallel()
+	for _, compression := range []bool{false, true} {
+		for _, serverBinary := range []bool{false, true} {
+			for _, clientBinary := range []bool{false, true} {
+				settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+				settings.EnableCompression = compression
+				settings.EnableBinary = serverBinary
+				config := BroadcastClientConfig{
+					Timeout:           20 * time.Second,
+					EnableCompression: compression,
+					EnableBinary:      clientBinary,
+				}
+				testNegotiation(t, settings, config)
+			}
+		}
+	}
+}
+
+func testNegotiation(t *testing.T, settings wsbroadcastserver.BroadcasterConfig, config BroadcastClientConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := broadcaster.NewBroadcaster(settings, nil, nil)
+	err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	// a message sent while connecting, and one broadcast to the connected client
+	b.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: 1}, 1)
+
+	ts := NewDummyTransactionStreamer()
+	url := fmt.Sprintf("ws://127.0.0.1:%d/", b.ListenerAddr().(*net.TCPAddr).Port)
+	client, err := NewBroadcastClient(config, url, nil, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start(ctx)
+	defer client.StopAndWait()
+
+	for seqNum := arbutil.MessageIndex(1); seqNum <= 2; seqNum++ {
+		select {
+		case receivedMsg := <-ts.messageReceiver:
+			if receivedMsg.SequenceNumber != seqNum || receivedMsg.Message.DelayedMessagesRead != uint64(seqNum) {
+				t.Fatal("unexpected message", receivedMsg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("client did not receive message", seqNum, "server", settings, "client", config)
+		}
+		if seqNum == 1 {
+			b.BroadcastSingle(arbstate.MessageWithMetadata{DelayedMessagesRead: 2}, 2)
+		}
+	}
+	client.connMutex.Lock()
+	compression := client.compression
+	binary := client.binary
+	client.connMutex.Unlock()
+	if compression != (settings.EnableCompression && config.EnableCompression) {
+		t.Fatal("unexpected compression", compression, "server compression", settings.EnableCompression, "client compression", config.EnableCompression)
+	}
+	if binary != (settings.EnableBinary && config.EnableBinary) {
+		t.Fatal("unexpected binary encoding", binary, "server binary", settings.EnableBinary, "client binary", config.EnableBinary)
+	}
+}
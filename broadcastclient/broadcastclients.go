@@ -0,0 +1,248 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/broadcaster"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/metrics"
+	"github.com/tenderly/nitro/util/stopwaiter"
+)
+
+// how long to remember when a sequence number was first received, to measure how far behind the other sources are
+const firstSeenRetention = time.Minute
+
+type feedSource struct {
+	url               string
+	highestSeqNum     arbutil.MessageIndex
+	received          bool
+	lastFirstDelivery time.Time // when this source last delivered a message before any other source
+	lagGauge          metrics.Gauge
+	seqNumLagGauge    metrics.Gauge
+}
+
+// sourceStreamer receives the messages of a single source's client
+type sourceStreamer struct {
+	clients *BroadcastClients
+	source  *feedSource
+}
+
+func (s *sourceStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	return s.clients.addMessages(s.source, feedMessages)
+}
+
+// BroadcastClients connects to all the configured feed sources at once, and passes their new messages on
+// in sequence number order, so a lagging or disconnected source doesn't delay the feed.
+type BroadcastClients struct {
+	stopwaiter.StopWaiter
+	clients    []*BroadcastClient
+	sources    []*feedSource
+	txStreamer TransactionStreamerInterface
+	gapTimeout time.Duration
+
+	mutex      sync.Mutex
+	nextSeqNum arbutil.MessageIndex
+	started    bool // whether nextSeqNum is set
+	pending    map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage
+	gapSince   time.Time // when we started waiting for nextSeqNum while later messages were pending
+	firstSeen  map[arbutil.MessageIndex]time.Time
+}
+
+func NewBroadcastClients(config BroadcastClientConfig, lastInboxSeqNum *big.Int, txStreamer TransactionStreamerInterface) (*BroadcastClients, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	clients := &BroadcastClients{
+		txStreamer: txStreamer,
+		gapTimeout: config.GapTimeout,
+		pending:    make(map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage),
+		firstSeen:  make(map[arbutil.MessageIndex]time.Time),
+	}
+	for i, url := range config.URLs {
+		source := &feedSource{
+			url:            url,
+			lagGauge:       metrics.GetOrRegisterGauge(fmt.Sprintf("arb/feed/source/%d/lag", i), nil),
+			seqNumLagGauge: metrics.GetOrRegisterGauge(fmt.Sprintf("arb/feed/source/%d/seqnumlag", i), nil),
+		}
+		client, err := NewBroadcastClient(config, url, lastInboxSeqNum, &sourceStreamer{clients, source})
+		if err != nil {
+			return nil, err
+		}
+		clients.sources = append(clients.sources, source)
+		clients.clients = append(clients.clients, client)
+	}
+	return clients, nil
+}
+
+func (bcs *BroadcastClients) addMessages(source *feedSource, feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	bcs.mutex.Lock()
+	defer bcs.mutex.Unlock()
+	now := time.Now()
+	if len(bcs.sources) <= 1 {
+		// nothing to merge, so the messages go on as received like a single client's
+		for _, message := range feedMessages {
+			if !source.received || message.SequenceNumber > source.highestSeqNum {
+				source.highestSeqNum = message.SequenceNumber
+				source.received = true
+			}
+		}
+		if len(feedMessages) > 0 {
+			source.lastFirstDelivery = now
+		}
+		return bcs.txStreamer.AddBroadcastMessages(feedMessages)
+	}
+	// messages already passed on are passed on again, so the streamer can handle a reorg
+	var resent []*broadcaster.BroadcastFeedMessage
+	for _, message := range feedMessages {
+		seqNum := message.SequenceNumber
+		if !source.received || seqNum > source.highestSeqNum {
+			source.highestSeqNum = seqNum
+			source.received = true
+		}
+		if !bcs.started {
+			bcs.nextSeqNum = seqNum
+			bcs.started = true
+		}
+		if firstSeen, seen := bcs.firstSeen[seqNum]; seen {
+			source.lagGauge.Update(now.Sub(firstSeen).Milliseconds())
+		} else {
+			bcs.firstSeen[seqNum] = now
+			source.lastFirstDelivery = now
+			source.lagGauge.Update(0)
+		}
+		if seqNum >= bcs.nextSeqNum {
+			// a later copy replaces a pending one, as it may be the sequencer's reorged message
+			bcs.pending[seqNum] = message
+			continue
+		}
+		if len(resent) > 0 && resent[len(resent)-1].SequenceNumber+1 != seqNum {
+			if err := bcs.txStreamer.AddBroadcastMessages(resent); err != nil {
+				return err
+			}
+			resent = nil
+		}
+		resent = append(resent, message)
+	}
+	if len(resent) > 0 {
+		if err := bcs.txStreamer.AddBroadcastMessages(resent); err != nil {
+			return err
+		}
+	}
+	bcs.updateSeqNumLags()
+	return bcs.flush(now)
+}
+
+// must hold mutex
+func (bcs *BroadcastClients) updateSeqNumLags() {
+	var highest arbutil.MessageIndex
+	for _, source := range bcs.sources {
+		if source.received && source.highestSeqNum > highest {
+			highest = source.highestSeqNum
+		}
+	}
+	for _, source := range bcs.sources {
+		if source.received {
+			source.seqNumLagGauge.Update(int64(highest - source.highestSeqNum))
+		}
+	}
+}
+
+// flush passes on the pending messages following on from those already passed on.
+// Messages after a gap are held back until a source sends the missing one, or until the gap timeout passes,
+// after which they're passed on without it, leaving the streamer to get the missing messages from L1.
+// must hold mutex
+func (bcs *BroadcastClients) flush(now time.Time) error {
+	if len(bcs.pending) == 0 {
+		return nil
+	}
+	if _, ok := bcs.pending[bcs.nextSeqNum]; !ok {
+		if bcs.gapSince == (time.Time{}) {
+			bcs.gapSince = now
+		}
+		if now.Sub(bcs.gapSince) < bcs.gapTimeout {
+			return nil
+		}
+		lowest := bcs.nextSeqNum
+		for seqNum := range bcs.pending {
+			if lowest == bcs.nextSeqNum || seqNum < lowest {
+				lowest = seqNum
+			}
+		}
+		log.Warn("no feed source sent the missing messages in time, passing on later messages without them", "missingFrom", bcs.nextSeqNum, "missingTo", lowest-1, "pending", len(bcs.pending))
+		bcs.nextSeqNum = lowest
+	}
+	bcs.gapSince = time.Time{}
+	var messages []*broadcaster.BroadcastFeedMessage
+	for {
+		message, ok := bcs.pending[bcs.nextSeqNum]
+		if !ok {
+			break
+		}
+		delete(bcs.pending, bcs.nextSeqNum)
+		messages = append(messages, message)
+		bcs.nextSeqNum++
+	}
+	if len(bcs.pending) > 0 {
+		bcs.gapSince = now
+	}
+	return bcs.txStreamer.AddBroadcastMessages(messages)
+}
+
+// FreshestSource returns the URL of the source which most recently delivered a message first, or "" if none has yet
+func (bcs *BroadcastClients) FreshestSource() string {
+	bcs.mutex.Lock()
+	defer bcs.mutex.Unlock()
+	var freshest *feedSource
+	for _, source := range bcs.sources {
+		if source.lastFirstDelivery == (time.Time{}) {
+			continue
+		}
+		if freshest == nil || source.lastFirstDelivery.After(freshest.lastFirstDelivery) {
+			freshest = source
+		}
+	}
+	if freshest == nil {
+		return ""
+	}
+	return freshest.url
+}
+
+func (bcs *BroadcastClients) Clients() []*BroadcastClient {
+	return bcs.clients
+}
+
+func (bcs *BroadcastClients) Start(ctxIn context.Context) {
+	bcs.StopWaiter.Start(ctxIn)
+	for _, client := range bcs.clients {
+		client.Start(ctxIn)
+	}
+	bcs.CallIteratively(func(ctx context.Context) time.Duration {
+		bcs.mutex.Lock()
+		defer bcs.mutex.Unlock()
+		now := time.Now()
+		if err := bcs.flush(now); err != nil {
+			log.Error("Error adding message from Sequencer Feed", "err", err)
+		}
+		for seqNum, firstSeen := range bcs.firstSeen {
+			if now.Sub(firstSeen) > firstSeenRetention {
+				delete(bcs.firstSeen, seqNum)
+			}
+		}
+		return bcs.gapTimeout / 2
+	})
+}
+
+func (bcs *BroadcastClients) StopAndWait() {
+	for _, client := range bcs.clients {
+		client.StopAndWait()
+	}
+	bcs.StopWaiter.StopAndWait()
+}
@@ -0,0 +1,137 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/broadcaster"
+)
+
+type recordingTransactionStreamer struct {
+	seqNums []arbutil.MessageIndex
+}
+
+func (ts *recordingTransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, feedMessage := range feedMessages {
+		ts.seqNums = append(ts.seqNums, feedMessage.SequenceNumber)
+	}
+	return nil
+}
+
+func feedMessages(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+	var messages []*broadcaster.BroadcastFeedMessage
+	for _, seqNum := range seqNums {
+		messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+	}
+	return messages
+}
+
+func TestMergeFeedSources(t *testing.T) {
+	config := DefaultBroadcastClientConfig
+	config.URLs = []string{"ws://first", "ws://second"}
+	config.GapTimeout = time.Hour
+	ts := &recordingTransactionStreamer{}
+	clients, err := NewBroadcastClients(config, nil, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := clients.sources[0], clients.sources[1]
+
+	Require := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	requireSeqNums := func(expected ...arbutil.MessageIndex) {
+		t.Helper()
+		if len(ts.seqNums) != len(expected) {
+			t.Fatal("unexpected messages", ts.seqNums)
+		}
+		for i, seqNum := range expected {
+			if ts.seqNums[i] != seqNum {
+				t.Fatal("unexpected messages", ts.seqNums)
+			}
+		}
+		ts.seqNums = nil
+	}
+	Require(clients.addMessages(first, feedMessages(10, 11)))
+	requireSeqNums(10, 11)
+	// messages already passed on go to the streamer again in case they're reorgs,
+	// and the gap at 13 holds back 14 until a source fills it
+	Require(clients.addMessages(second, feedMessages(10, 11, 12, 14)))
+	requireSeqNums(10, 11, 12)
+	Require(clients.addMessages(first, feedMessages(13)))
+	requireSeqNums(13, 14)
+	Require(clients.addMessages(second, feedMessages(13, 15)))
+	requireSeqNums(13, 15)
+
+	if clients.FreshestSource() != "ws://second" {
+		t.Fatal("unexpected freshest source", clients.FreshestSource())
+	}
+	if first.highestSeqNum != 13 || second.highestSeqNum != 15 {
+		t.Fatal("unexpected highest sequence numbers", first.highestSeqNum, second.highestSeqNum)
+	}
+
+	// a missing message holds back later ones until the gap timeout passes
+	Require(clients.addMessages(first, feedMessages(17)))
+	requireSeqNums()
+	Require(clients.flush(time.Now().Add(time.Minute)))
+	requireSeqNums()
+	Require(clients.addMessages(second, feedMessages(16)))
+	requireSeqNums(16, 17)
+
+	// after which later messages are passed on without it, and it's passed on as a resend if it turns up
+	Require(clients.addMessages(first, feedMessages(20, 19)))
+	requireSeqNums()
+	Require(clients.flush(time.Now().Add(2 * time.Hour)))
+	requireSeqNums(19, 20)
+	if len(clients.pending) != 0 {
+		t.Fatal("messages still held back after the gap timeout", len(clients.pending))
+	}
+	Require(clients.addMessages(second, feedMessages(18, 21)))
+	requireSeqNums(18, 21)
+}
+
+func TestFeedGapTimeoutValidation(t *testing.T) {
+	config := DefaultBroadcastClientConfig
+	config.URLs = []string{"ws://first", "ws://second"}
+	config.GapTimeout = 0
+	if _, err := NewBroadcastClients(config, nil, &recordingTransactionStreamer{}); err == nil {
+		t.Fatal("accepted a zero gap timeout")
+	}
+}
+
+func TestSingleFeedSourcePassthrough(t *testing.T) {
+	config := DefaultBroadcastClientConfig
+	config.URLs = []string{"ws://only"}
+	ts := &recordingTransactionStreamer{}
+	clients, err := NewBroadcastClients(config, nil, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := clients.sources[0]
+
+	// with one source, messages go on as received, gaps and reorgs included
+	for _, batch := range [][]arbutil.MessageIndex{{10, 11}, {13}, {11, 12}} {
+		if err := clients.addMessages(source, feedMessages(batch...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []arbutil.MessageIndex{10, 11, 13, 11, 12}
+	if len(ts.seqNums) != len(expected) {
+		t.Fatal("unexpected messages", ts.seqNums)
+	}
+	for i, seqNum := range expected {
+		if ts.seqNums[i] != seqNum {
+			t.Fatal("unexpected messages", ts.seqNums)
+		}
+	}
+	if len(clients.pending) != 0 {
+		t.Fatal("single source messages held back", len(clients.pending))
+	}
+}
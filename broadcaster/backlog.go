@@ -0,0 +1,300 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/go-ethereum/ethdb"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/util/stopwaiter"
+)
+
+type BacklogConfig struct {
+	Enable  bool          `koanf:"enable"`
+	Dir     string        `koanf:"dir"`
+	MaxSize uint64        `koanf:"max-size"`
+	MaxAge  time.Duration `koanf:"max-age"`
+}
+
+func BacklogConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultBacklogConfig.Enable, "store feed messages on disk, to catch up clients from before the in-memory buffer and to resume after a restart")
+	f.String(prefix+".dir", DefaultBacklogConfig.Dir, "directory to store the feed backlog in")
+	f.Uint64(prefix+".max-size", DefaultBacklogConfig.MaxSize, "size in bytes of stored messages above which the oldest are deleted (0 for no limit)")
+	f.Duration(prefix+".max-age", DefaultBacklogConfig.MaxAge, "age of stored messages after which they're deleted (0 for no limit)")
+}
+
+var DefaultBacklogConfig = BacklogConfig{
+	Enable:  false,
+	Dir:     "feed-backlog",
+	MaxSize: 1 << 30,
+	MaxAge:  24 * time.Hour,
+}
+
+var TestBacklogConfig = BacklogConfig{
+	Enable:  true,
+	MaxSize: 1 << 20,
+	MaxAge:  time.Hour,
+}
+
+// the number of messages sent to a catching up client at once
+const backlogReadBatch = 1024
+
+type queuedBacklogMessage struct {
+	message *BroadcastFeedMessage
+	added   time.Time
+}
+
+// FeedBacklog stores a contiguous range of feed messages in a database, deleting the oldest by size and age.
+// Each message is stored under its big endian sequence number, as the time it was added followed by its JSON encoding.
+// Once started, messages can be queued to be stored in the background, off the broadcast path.
+type FeedBacklog struct {
+	stopwaiter.StopWaiter
+	db     ethdb.Database
+	config BacklogConfig
+
+	queueMutex sync.Mutex
+	queue      []queuedBacklogMessage
+	queued     chan struct{}
+
+	mutex       sync.Mutex
+	count       uint64
+	firstSeqNum arbutil.MessageIndex
+	lastSeqNum  arbutil.MessageIndex
+	firstAdded  time.Time
+	size        uint64
+}
+
+func backlogKey(seqNum arbutil.MessageIndex) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], uint64(seqNum))
+	return key[:]
+}
+
+func decodeBacklogEntry(value []byte) (time.Time, []byte, error) {
+	if len(value) < 8 {
+		return time.Time{}, nil, errors.New("feed backlog entry too short")
+	}
+	added := time.Unix(0, int64(binary.BigEndian.Uint64(value[:8])))
+	return added, value[8:], nil
+}
+
+// NewFeedBacklog loads the backlog stored in db, which must be dedicated to it
+func NewFeedBacklog(db ethdb.Database, config BacklogConfig) (*FeedBacklog, error) {
+	b := &FeedBacklog{
+		db:     db,
+		config: config,
+		queued: make(chan struct{}, 1),
+	}
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if len(iter.Key()) != 8 {
+			return nil, fmt.Errorf("unexpected key %x in feed backlog", iter.Key())
+		}
+		seqNum := arbutil.MessageIndex(binary.BigEndian.Uint64(iter.Key()))
+		added, _, err := decodeBacklogEntry(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if b.count == 0 {
+			b.firstSeqNum = seqNum
+			b.firstAdded = added
+		} else if seqNum != b.lastSeqNum+1 {
+			return nil, fmt.Errorf("feed backlog skips from message %v to %v", b.lastSeqNum, seqNum)
+		}
+		b.lastSeqNum = seqNum
+		b.count++
+		b.size += uint64(len(iter.Value()))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if b.count > 0 {
+		log.Info("loaded feed backlog", "first", b.firstSeqNum, "last", b.lastSeqNum, "size", b.size)
+	}
+	return b, nil
+}
+
+// Range returns the first and last stored sequence numbers, or false if the backlog is empty
+func (b *FeedBacklog) Range() (arbutil.MessageIndex, arbutil.MessageIndex, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.firstSeqNum, b.lastSeqNum, b.count > 0
+}
+
+// Add stores a message following on from the last one. A message skipping ahead clears the backlog,
+// so that it stays contiguous, and one which is already stored is ignored.
+func (b *FeedBacklog) Add(message *BroadcastFeedMessage, now time.Time) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	seqNum := message.SequenceNumber
+	if b.count > 0 {
+		if seqNum >= b.firstSeqNum && seqNum <= b.lastSeqNum {
+			return nil
+		}
+		if seqNum != b.lastSeqNum+1 {
+			log.Warn("feed message doesn't follow on from the backlog, clearing it", "seqNum", seqNum, "last", b.lastSeqNum)
+			if err := b.clear(); err != nil {
+				return err
+			}
+		}
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	value := make([]byte, 8, 8+len(encoded))
+	binary.BigEndian.PutUint64(value, uint64(now.UnixNano()))
+	value = append(value, encoded...)
+	if err := b.db.Put(backlogKey(seqNum), value); err != nil {
+		return err
+	}
+	if b.count == 0 {
+		b.firstSeqNum = seqNum
+		b.firstAdded = now
+	}
+	b.lastSeqNum = seqNum
+	b.count++
+	b.size += uint64(len(value))
+	return b.prune(now)
+}
+
+// Enqueue queues a message to be added by the background writer, without waiting for the database
+func (b *FeedBacklog) Enqueue(message *BroadcastFeedMessage, now time.Time) {
+	b.queueMutex.Lock()
+	b.queue = append(b.queue, queuedBacklogMessage{message, now})
+	b.queueMutex.Unlock()
+	select {
+	case b.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (b *FeedBacklog) addQueued() {
+	b.queueMutex.Lock()
+	queue := b.queue
+	b.queue = nil
+	b.queueMutex.Unlock()
+	for _, queued := range queue {
+		if err := b.Add(queued.message, queued.added); err != nil {
+			log.Error("error storing feed message in backlog", "seqNum", queued.message.SequenceNumber, "err", err)
+		}
+	}
+}
+
+// Start launches the background writer adding queued messages, which adds any still queued when it's stopped
+func (b *FeedBacklog) Start(ctxIn context.Context) {
+	b.StopWaiter.Start(ctxIn)
+	b.LaunchThread(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				b.addQueued()
+				return
+			case <-b.queued:
+				b.addQueued()
+			}
+		}
+	})
+}
+
+func (b *FeedBacklog) expired(now time.Time) bool {
+	if b.config.MaxSize != 0 && b.size > b.config.MaxSize {
+		return true
+	}
+	return b.config.MaxAge != 0 && now.Sub(b.firstAdded) > b.config.MaxAge
+}
+
+// must hold mutex
+func (b *FeedBacklog) prune(now time.Time) error {
+	for b.count > 0 && b.expired(now) {
+		key := backlogKey(b.firstSeqNum)
+		value, err := b.db.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := b.db.Delete(key); err != nil {
+			return err
+		}
+		b.size -= uint64(len(value))
+		b.count--
+		b.firstSeqNum++
+		if b.count == 0 {
+			break
+		}
+		next, err := b.db.Get(backlogKey(b.firstSeqNum))
+		if err != nil {
+			return err
+		}
+		b.firstAdded, _, err = decodeBacklogEntry(next)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// must hold mutex
+func (b *FeedBacklog) clear() error {
+	batch := b.db.NewBatch()
+	for seqNum := b.firstSeqNum; b.count > 0 && seqNum <= b.lastSeqNum; seqNum++ {
+		if err := batch.Delete(backlogKey(seqNum)); err != nil {
+			return err
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	b.count = 0
+	b.size = 0
+	return nil
+}
+
+// Messages returns up to limit stored messages in [start, end)
+func (b *FeedBacklog) Messages(start, end arbutil.MessageIndex, limit int) ([]*BroadcastFeedMessage, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.count == 0 {
+		return nil, nil
+	}
+	if start < b.firstSeqNum {
+		start = b.firstSeqNum
+	}
+	if end > b.lastSeqNum+1 {
+		end = b.lastSeqNum + 1
+	}
+	var messages []*BroadcastFeedMessage
+	for seqNum := start; seqNum < end && len(messages) < limit; seqNum++ {
+		value, err := b.db.Get(backlogKey(seqNum))
+		if err != nil {
+			return nil, err
+		}
+		_, encoded, err := decodeBacklogEntry(value)
+		if err != nil {
+			return nil, err
+		}
+		var message BroadcastFeedMessage
+		if err := json.Unmarshal(encoded, &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
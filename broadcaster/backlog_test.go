@@ -0,0 +1,116 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/go-ethereum/core/rawdb"
+)
+
+func expectBacklogRange(t *testing.T, backlog *FeedBacklog, first, last arbutil.MessageIndex) {
+	t.Helper()
+	gotFirst, gotLast, ok := backlog.Range()
+	if !ok || gotFirst != first || gotLast != last {
+		t.Fatal("unexpected backlog range", gotFirst, gotLast, ok, "expected", first, last)
+	}
+}
+
+func TestFeedBacklogRetention(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	config := TestBacklogConfig
+	backlog, err := NewFeedBacklog(db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 1; i <= 10; i++ {
+		message := &BroadcastFeedMessage{
+			SequenceNumber: arbutil.MessageIndex(i),
+			Message:        arbstate.MessageWithMetadata{DelayedMessagesRead: uint64(i)},
+		}
+		if err := backlog.Add(message, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectBacklogRange(t, backlog, 1, 10)
+
+	// a restarted relay picks up the stored messages
+	backlog, err = NewFeedBacklog(db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 1, 10)
+	messages, err := backlog.Messages(3, 100, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 4 || messages[0].SequenceNumber != 3 || messages[3].Message.DelayedMessagesRead != 6 {
+		t.Fatal("unexpected messages read from backlog", messages)
+	}
+
+	// messages older than an hour are deleted when the next one is added
+	if err := backlog.Add(&BroadcastFeedMessage{SequenceNumber: 11}, start.Add(63*time.Minute+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 4, 11)
+
+	// as are the oldest messages over the size limit
+	backlog.config.MaxSize = backlog.size - 1
+	if err := backlog.Add(&BroadcastFeedMessage{SequenceNumber: 12}, start.Add(64*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 6, 12)
+
+	// a message skipping ahead replaces the backlog, which must stay contiguous
+	if err := backlog.Add(&BroadcastFeedMessage{SequenceNumber: 20}, start.Add(65*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 20, 20)
+	backlog, err = NewFeedBacklog(db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 20, 20)
+}
+
+func TestFeedBacklogQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := rawdb.NewMemoryDatabase()
+	backlog, err := NewFeedBacklog(db, TestBacklogConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backlog.Start(ctx)
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		backlog.Enqueue(&BroadcastFeedMessage{SequenceNumber: arbutil.MessageIndex(i)}, now)
+	}
+	for i := 0; ; i++ {
+		if _, last, ok := backlog.Range(); ok && last == 5 {
+			break
+		}
+		if i >= 200 {
+			t.Fatal("queued messages not stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expectBacklogRange(t, backlog, 1, 5)
+
+	// messages still queued are stored when the writer stops
+	for i := 6; i <= 10; i++ {
+		backlog.Enqueue(&BroadcastFeedMessage{SequenceNumber: arbutil.MessageIndex(i)}, now)
+	}
+	backlog.StopAndWait()
+	backlog, err = NewFeedBacklog(db, TestBacklogConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectBacklogRange(t, backlog, 1, 10)
+}
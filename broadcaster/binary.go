@@ -0,0 +1,65 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+)
+
+// The binary encoding of a BroadcastMessage, sent to clients which negotiate the binary feed protocol,
+// is binaryFeedVersion followed by the RLP encoding of a binaryBroadcastMessage.
+const binaryFeedVersion byte = 1
+
+// binaryBroadcastMessage is the RLP layout of a BroadcastMessage. Like the JSON format it's forwards compatible:
+// fields added later are appended to the list, and ignored by older clients.
+type binaryBroadcastMessage struct {
+	Version                        uint64
+	Messages                       []*BroadcastFeedMessage
+	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `rlp:"nil"`
+	TransactionMessages            []*BroadcastTransactionMessage
+	Rest                           []rlp.RawValue `rlp:"tail"`
+}
+
+func (m BroadcastMessage) MarshalBinary() ([]byte, error) {
+	if m.Version < 0 {
+		return nil, fmt.Errorf("invalid broadcast message version %v", m.Version)
+	}
+	encoded, err := rlp.EncodeToBytes(&binaryBroadcastMessage{
+		Version:                        uint64(m.Version),
+		Messages:                       m.Messages,
+		ConfirmedSequenceNumberMessage: m.ConfirmedSequenceNumberMessage,
+		TransactionMessages:            m.TransactionMessages,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{binaryFeedVersion}, encoded...), nil
+}
+
+func (m *BroadcastMessage) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty binary broadcast message")
+	}
+	if data[0] != binaryFeedVersion {
+		return fmt.Errorf("unsupported binary broadcast message version %v", data[0])
+	}
+	var decoded binaryBroadcastMessage
+	if err := rlp.DecodeBytes(data[1:], &decoded); err != nil {
+		return err
+	}
+	if decoded.Version > math.MaxInt32 {
+		return fmt.Errorf("invalid broadcast message version %v", decoded.Version)
+	}
+	*m = BroadcastMessage{
+		Version:                        int(decoded.Version),
+		Messages:                       decoded.Messages,
+		ConfirmedSequenceNumberMessage: decoded.ConfirmedSequenceNumberMessage,
+		TransactionMessages:            decoded.TransactionMessages,
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+
+	"github.com/tenderly/nitro/arbos"
+	"github.com/tenderly/nitro/arbstate"
+)
+
+func ExampleBroadcastMessage_MarshalBinary_broadcastfeedmessage() {
+	var requestId common.Hash
+	msg := BroadcastMessage{
+		Version: 1,
+		Messages: []*BroadcastFeedMessage{
+			{
+				SequenceNumber: 12345,
+				Message: arbstate.MessageWithMetadata{
+					Message: &arbos.L1IncomingMessage{
+						Header: &arbos.L1IncomingMessageHeader{
+							Kind:        0,
+							Poster:      [20]byte{},
+							BlockNumber: 0,
+							Timestamp:   0,
+							RequestId:   &requestId,
+							L1BaseFee:   big.NewInt(0),
+						},
+						L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+					},
+					DelayedMessagesRead: 3333,
+				},
+			},
+		},
+	}
+	encoded, _ := msg.MarshalBinary()
+	fmt.Printf("%x\n", encoded)
+	// Output: 01f85301f84ef84c823039f846f841f83a809400000000000000000000000000000000000000008080a000000000000000000000000000000000000000000000000000000000000000008084deadbeef820d0580c0c0
+}
+
+func ExampleBroadcastMessage_MarshalBinary_emptymessage() {
+	msg := BroadcastMessage{
+		Version: 1,
+	}
+	encoded, _ := msg.MarshalBinary()
+	fmt.Printf("%x\n", encoded)
+	// Output: 01c401c0c0c0
+}
+
+func ExampleBroadcastMessage_MarshalBinary_confirmedseqnum() {
+	msg := BroadcastMessage{
+		Version: 1,
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{
+			SequenceNumber: 1234,
+		},
+	}
+	encoded, _ := msg.MarshalBinary()
+	fmt.Printf("%x\n", encoded)
+	// Output: 01c701c0c38204d2c0
+}
+
+func TestBinaryBroadcastMessage(t *testing.T) {
+	requestId := common.HexToHash("0x1234")
+	to := common.HexToAddress("0x5678")
+	messages := []BroadcastMessage{
+		{Version: 1},
+		{
+			Version: 1,
+			Messages: []*BroadcastFeedMessage{
+				{
+					SequenceNumber: 1,
+					Message: arbstate.MessageWithMetadata{
+						Message: &arbos.L1IncomingMessage{
+							Header: &arbos.L1IncomingMessageHeader{
+								Kind:        arbos.L1MessageType_L2Message,
+								Poster:      common.HexToAddress("0x9abc"),
+								BlockNumber: 10,
+								Timestamp:   20,
+								RequestId:   &requestId,
+								L1BaseFee:   big.NewInt(30),
+							},
+							L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+						},
+						DelayedMessagesRead: 2,
+					},
+					Signature: []byte{1, 2, 3},
+				},
+				{SequenceNumber: 2},
+			},
+			ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{1},
+		},
+		{
+			Version: 1,
+			TransactionMessages: []*BroadcastTransactionMessage{
+				{
+					SequenceNumber: 3,
+					Kind:           arbos.L2MessageKind_SignedTx,
+					Sender:         common.HexToAddress("0xdef0"),
+					Transaction:    types.NewTx(&types.LegacyTx{Nonce: 1, To: &to, Value: big.NewInt(1), Gas: 21000, GasPrice: big.NewInt(1)}),
+				},
+			},
+		},
+	}
+	for i, msg := range messages {
+		encoded, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded BroadcastMessage
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		// the JSON encoding of the decoded message should be the same as the original's
+		expected, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(expected) != string(actual) {
+			t.Fatal("message", i, "decoded as", string(actual), "expected", string(expected))
+		}
+	}
+
+	// fields added by a later version of the feed are ignored
+	extended, err := rlp.EncodeToBytes([]interface{}{uint64(1), []interface{}{}, &ConfirmedSequenceNumberMessage{5}, []interface{}{}, "new field"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BroadcastMessage
+	if err := decoded.UnmarshalBinary(append([]byte{binaryFeedVersion}, extended...)); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ConfirmedSequenceNumberMessage == nil || decoded.ConfirmedSequenceNumberMessage.SequenceNumber != 5 {
+		t.Fatal("unexpected message decoded with an extra field", decoded)
+	}
+
+	encoded, err := messages[0].MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded[0] = binaryFeedVersion + 1
+	if err := decoded.UnmarshalBinary(encoded); err == nil {
+		t.Fatal("decoded a message with an unsupported binary version")
+	}
+}
@@ -5,20 +5,30 @@ package broadcaster
 
 import (
 	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
 	"net"
 	"sync/atomic"
 	"time"
 
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
 	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
 
 	"github.com/tenderly/nitro/arbstate"
 	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/wsbroadcastserver"
 )
 
+// FeedSigner takes the 32 byte hash of a feed message and produces its signature
+type FeedSigner func([]byte) ([]byte, error)
+
 type Broadcaster struct {
 	server        *wsbroadcastserver.WSBroadcastServer
 	catchupBuffer *SequenceNumberCatchupBuffer
+	signer        FeedSigner
 }
 
 /*
@@ -42,11 +52,40 @@ type BroadcastMessage struct {
 	// TODO better name than messages since there are different types of messages
 	Messages                       []*BroadcastFeedMessage         `json:"messages,omitempty"`
 	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `json:"confirmedSequenceNumberMessage,omitempty"`
+	// only sent to filtered subscriptions, in place of Messages
+	TransactionMessages []*BroadcastTransactionMessage `json:"transactionMessages,omitempty"`
 }
 
 type BroadcastFeedMessage struct {
 	SequenceNumber arbutil.MessageIndex         `json:"sequenceNumber"`
 	Message        arbstate.MessageWithMetadata `json:"message"`
+	Signature      []byte                       `json:"signature,omitempty"`
+}
+
+var feedMessageHashPrefix = []byte("Arbitrum Nitro Feed:")
+
+// Hash returns the hash the sequencer signs, which commits to the sequence number and the message but not the signature
+func (m *BroadcastFeedMessage) Hash() (common.Hash, error) {
+	encodedMessage, err := rlp.EncodeToBytes(&m.Message)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var seqNumBytes [8]byte
+	binary.BigEndian.PutUint64(seqNumBytes[:], uint64(m.SequenceNumber))
+	return crypto.Keccak256Hash(feedMessageHashPrefix, seqNumBytes[:], encodedMessage), nil
+}
+
+// Signer recovers the address which signed the message
+func (m *BroadcastFeedMessage) Signer() (common.Address, error) {
+	hash, err := m.Hash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	pubkey, err := crypto.SigToPub(hash.Bytes(), m.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
 }
 
 type ConfirmedSequenceNumberMessage struct {
@@ -56,30 +95,126 @@ type ConfirmedSequenceNumberMessage struct {
 type SequenceNumberCatchupBuffer struct {
 	messages     []*BroadcastFeedMessage
 	messageCount int32
+	firstSeqNum  uint64 // sequence number of messages[0], valid while messageCount is non-zero
+	confirmed    uint64 // one more than the last confirmed sequence number, or 0 if none has been
+	backlog      *FeedBacklog
+	// one more than the last message broadcast, or 0 if none has been, which the backlog sent to clients stops at
+	broadcastEnd arbutil.MessageIndex
 }
 
-func NewSequenceNumberCatchupBuffer() *SequenceNumberCatchupBuffer {
-	return &SequenceNumberCatchupBuffer{}
+// NewSequenceNumberCatchupBuffer creates a catchup buffer, which also serves clients from backlog if it's non-nil
+func NewSequenceNumberCatchupBuffer(backlog *FeedBacklog) *SequenceNumberCatchupBuffer {
+	return &SequenceNumberCatchupBuffer{
+		backlog: backlog,
+	}
 }
 
-func (b *SequenceNumberCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
-	start := time.Now()
+func (b *SequenceNumberCatchupBuffer) CheckRequestedSequenceNumber(requestedSeqNum arbutil.MessageIndex) error {
+	if requestedSeqNum == 0 {
+		return nil
+	}
+	var firstSeqNum arbutil.MessageIndex
+	available := false
+	if atomic.LoadInt32(&b.messageCount) > 0 {
+		firstSeqNum = arbutil.MessageIndex(atomic.LoadUint64(&b.firstSeqNum))
+		available = true
+	}
+	if b.backlog != nil {
+		if backlogFirst, _, ok := b.backlog.Range(); ok && (!available || backlogFirst < firstSeqNum) {
+			firstSeqNum = backlogFirst
+			available = true
+		}
+	}
+	if available && requestedSeqNum < firstSeqNum {
+		return fmt.Errorf("requested sequence number %v is older than the feed's buffer, which starts at %v", requestedSeqNum, firstSeqNum)
+	}
+	return nil
+}
+
+// messagesFrom returns the buffered messages from the requested sequence number on, or all of them if it's 0
+func (b *SequenceNumberCatchupBuffer) messagesFrom(requestedSeqNum arbutil.MessageIndex) []*BroadcastFeedMessage {
+	if requestedSeqNum == 0 || len(b.messages) == 0 || requestedSeqNum <= b.messages[0].SequenceNumber {
+		return b.messages
+	}
+	index := uint64(requestedSeqNum - b.messages[0].SequenceNumber)
+	if index >= uint64(len(b.messages)) {
+		return nil
+	}
+	return b.messages[index:]
+}
+
+// backlogEnd returns the sequence number the stored messages sent to a newly registered client should stop before,
+// as those from there on are either buffered or broadcast to it once it's registered
+func (b *SequenceNumberCatchupBuffer) backlogEnd() arbutil.MessageIndex {
 	if len(b.messages) > 0 {
-		// send the newly connected client all the messages we've got...
-		bm := BroadcastMessage{
+		return b.messages[0].SequenceNumber
+	}
+	if b.broadcastEnd > 0 {
+		return b.broadcastEnd
+	}
+	if _, last, ok := b.backlog.Range(); ok {
+		return last + 1
+	}
+	return 0
+}
+
+// sendBacklog sends the client the stored messages in [start, end), returning how many it sent
+func (b *SequenceNumberCatchupBuffer) sendBacklog(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection, start, end arbutil.MessageIndex) (int, error) {
+	sent := 0
+	for start < end {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		messages, err := b.backlog.Messages(start, end, backlogReadBatch)
+		if err != nil || len(messages) == 0 {
+			return sent, err
+		}
+		err = clientConnection.Write(BroadcastMessage{
 			Version:  1,
-			Messages: b.messages,
+			Messages: messages,
+		})
+		if err != nil {
+			return sent, err
 		}
+		sent += len(messages)
+		start = messages[len(messages)-1].SequenceNumber + 1
+	}
+	return sent, nil
+}
 
-		err := clientConnection.Write(bm)
+// OnRegisterClient is called on the client manager's thread, so it only takes what the client is missing from the
+// buffer, and leaves reading the backlog and sending it all to the client's own thread
+func (b *SequenceNumberCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
+	requestedSeqNum := clientConnection.RequestedSeqNum()
+	messages := b.messagesFrom(requestedSeqNum)
+	var backlogEnd arbutil.MessageIndex
+	if b.backlog != nil && requestedSeqNum != 0 {
+		backlogEnd = b.backlogEnd()
+	}
+	clientConnection.SetCatchup(func(ctx context.Context) error {
+		start := time.Now()
+		fromBacklog, err := b.sendBacklog(ctx, clientConnection, requestedSeqNum, backlogEnd)
 		if err != nil {
-			log.Error("error sending client cached messages", err, "client", clientConnection.Name, "elapsed", time.Since(start))
+			log.Error("error sending client messages from backlog", "err", err, "client", clientConnection.Name, "elapsed", time.Since(start))
 			return err
 		}
-	}
-
-	log.Info("client registered", "client", clientConnection.Name, "elapsed", time.Since(start))
+		if len(messages) > 0 {
+			// send the newly connected client all the messages it's missing...
+			bm := BroadcastMessage{
+				Version:  1,
+				Messages: messages,
+			}
+
+			err := clientConnection.Write(bm)
+			if err != nil {
+				log.Error("error sending client cached messages", err, "client", clientConnection.Name, "elapsed", time.Since(start))
+				return err
+			}
+		}
 
+		log.Info("client registered", "client", clientConnection.Name, "requestedSeqNum", requestedSeqNum, "fromBacklog", fromBacklog, "sent", len(messages), "elapsed", time.Since(start))
+		return nil
+	})
 	return nil
 }
 
@@ -88,9 +223,15 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 	if !ok {
 		log.Crit("Requested to broadcast messasge of unknown type")
 	}
-	defer func() { atomic.StoreInt32(&b.messageCount, int32(len(b.messages))) }()
+	defer func() {
+		if len(b.messages) > 0 {
+			atomic.StoreUint64(&b.firstSeqNum, uint64(b.messages[0].SequenceNumber))
+		}
+		atomic.StoreInt32(&b.messageCount, int32(len(b.messages)))
+	}()
 
 	if confirmMsg := broadcastMessage.ConfirmedSequenceNumberMessage; confirmMsg != nil {
+		atomic.StoreUint64(&b.confirmed, uint64(confirmMsg.SequenceNumber)+1)
 		if len(b.messages) == 0 {
 			return nil
 		}
@@ -121,6 +262,12 @@ func (b *SequenceNumberCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
 	}
 
 	for _, newMsg := range broadcastMessage.Messages {
+		if b.backlog != nil {
+			b.backlog.Enqueue(newMsg, time.Now())
+		}
+		if newMsg.SequenceNumber >= b.broadcastEnd {
+			b.broadcastEnd = newMsg.SequenceNumber + 1
+		}
 		if len(b.messages) == 0 {
 			b.messages = append(b.messages, newMsg)
 		} else if expectedSequenceNumber := b.messages[len(b.messages)-1].SequenceNumber + 1; newMsg.SequenceNumber == expectedSequenceNumber {
@@ -146,11 +293,33 @@ func (b *SequenceNumberCatchupBuffer) GetMessageCount() int {
 	return int(atomic.LoadInt32(&b.messageCount))
 }
 
-func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig) *Broadcaster {
-	catchupBuffer := NewSequenceNumberCatchupBuffer()
+// ConfirmedSequenceNumber returns the last confirmed sequence number broadcast, or false if there hasn't been one
+func (b *SequenceNumberCatchupBuffer) ConfirmedSequenceNumber() (arbutil.MessageIndex, bool) {
+	confirmed := atomic.LoadUint64(&b.confirmed)
+	if confirmed == 0 {
+		return 0, false
+	}
+	return arbutil.MessageIndex(confirmed - 1), true
+}
+
+// NewBroadcaster creates a broadcaster, which signs the messages it broadcasts if signer is non-nil,
+// and decodes their transactions for filtered subscriptions if chainId is non-nil
+func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig, chainId *big.Int, signer FeedSigner) *Broadcaster {
+	return NewBroadcasterWithBacklog(settings, chainId, signer, nil)
+}
+
+// NewBroadcasterWithBacklog creates a broadcaster which also stores the messages it broadcasts in backlog,
+// to catch up clients requesting messages from before its in-memory buffer
+func NewBroadcasterWithBacklog(settings wsbroadcastserver.BroadcasterConfig, chainId *big.Int, signer FeedSigner, backlog *FeedBacklog) *Broadcaster {
+	catchupBuffer := NewSequenceNumberCatchupBuffer(backlog)
+	var filters wsbroadcastserver.ClientFilters
+	if chainId != nil {
+		filters = newFeedFilters(chainId, catchupBuffer)
+	}
 	return &Broadcaster{
-		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer),
+		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer, filters),
 		catchupBuffer: catchupBuffer,
+		signer:        signer,
 	}
 }
 
@@ -158,6 +327,16 @@ func (b *Broadcaster) BroadcastSingle(msg arbstate.MessageWithMetadata, seq arbu
 	var broadcastMessages []*BroadcastFeedMessage
 
 	bfm := BroadcastFeedMessage{SequenceNumber: seq, Message: msg}
+	if b.signer != nil {
+		hash, err := bfm.Hash()
+		if err == nil {
+			bfm.Signature, err = b.signer(hash.Bytes())
+		}
+		if err != nil {
+			// clients requiring signatures will drop or flag the unsigned message
+			log.Error("error signing feed message", "seqNum", seq, "err", err)
+		}
+	}
 	broadcastMessages = append(broadcastMessages, &bfm)
 
 	bm := BroadcastMessage{
@@ -190,10 +369,21 @@ func (b *Broadcaster) GetCachedMessageCount() int {
 	return b.catchupBuffer.GetMessageCount()
 }
 
+// CheckRequestedSequenceNumber returns an error if a client couldn't catch up from the requested sequence number
+func (b *Broadcaster) CheckRequestedSequenceNumber(requestedSeqNum arbutil.MessageIndex) error {
+	return b.catchupBuffer.CheckRequestedSequenceNumber(requestedSeqNum)
+}
+
 func (b *Broadcaster) Start(ctx context.Context) error {
+	if b.catchupBuffer.backlog != nil {
+		b.catchupBuffer.backlog.Start(ctx)
+	}
 	return b.server.Start(ctx)
 }
 
 func (b *Broadcaster) StopAndWait() {
 	b.server.StopAndWait()
+	if b.catchupBuffer.backlog != nil {
+		b.catchupBuffer.backlog.StopAndWait()
+	}
 }
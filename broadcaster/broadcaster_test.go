@@ -57,7 +57,7 @@ func TestBroadcasterMessagesRemovedOnConfirmation(t *testing.T) {
 
 	broadcasterSettings := wsbroadcastserver.DefaultTestBroadcasterConfig
 
-	b := NewBroadcaster(broadcasterSettings)
+	b := NewBroadcaster(broadcasterSettings, nil, nil)
 	Require(t, b.Start(ctx))
 	defer b.StopAndWait()
 
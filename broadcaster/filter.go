@@ -0,0 +1,215 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/log"
+
+	"github.com/tenderly/nitro/arbos"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/wsbroadcastserver"
+)
+
+// BroadcastTransactionMessage is a transaction decoded from a feed message, which filtered subscriptions are sent
+// in place of the message. It isn't signed, so clients needing to verify the feed must subscribe to all of it.
+type BroadcastTransactionMessage struct {
+	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
+	Kind           uint8                `json:"kind"`
+	Sender         common.Address       `json:"sender"`
+	Transaction    *types.Transaction   `json:"transaction"`
+}
+
+// feedFilters decodes the transactions in broadcast messages for the filtered subscriptions to select from
+type feedFilters struct {
+	chainId       *big.Int
+	signer        types.Signer
+	catchupBuffer *SequenceNumberCatchupBuffer
+}
+
+func newFeedFilters(chainId *big.Int, catchupBuffer *SequenceNumberCatchupBuffer) *feedFilters {
+	return &feedFilters{
+		chainId:       chainId,
+		signer:        types.LatestSignerForChainID(chainId),
+		catchupBuffer: catchupBuffer,
+	}
+}
+
+type decodedBroadcastMessage struct {
+	transactions []*BroadcastTransactionMessage
+	confirmed    *ConfirmedSequenceNumberMessage
+}
+
+// Batch posting reports aren't decoded, as that needs the batch they report on
+func (f *feedFilters) decodeMessage(msg *BroadcastFeedMessage) []*BroadcastTransactionMessage {
+	l1Message := msg.Message.Message
+	if l1Message == nil || l1Message.Header == nil || l1Message.Header.Kind == arbos.L1MessageType_BatchPostingReport {
+		return nil
+	}
+	txs, err := l1Message.ParseL2Transactions(f.chainId, nil)
+	if err != nil {
+		log.Debug("filtered feed skipping message without valid transactions", "seqNum", msg.SequenceNumber, "err", err)
+		return nil
+	}
+	decoded := make([]*BroadcastTransactionMessage, 0, len(txs))
+	for _, tx := range txs {
+		sender, err := types.Sender(f.signer, tx)
+		if err != nil {
+			log.Debug("filtered feed skipping transaction with invalid signature", "seqNum", msg.SequenceNumber, "tx", tx.Hash(), "err", err)
+			continue
+		}
+		decoded = append(decoded, &BroadcastTransactionMessage{
+			SequenceNumber: msg.SequenceNumber,
+			Kind:           l1Message.Header.Kind,
+			Sender:         sender,
+			Transaction:    tx,
+		})
+	}
+	return decoded
+}
+
+func (f *feedFilters) Decode(bmi interface{}) interface{} {
+	broadcastMessage, ok := bmi.(BroadcastMessage)
+	if !ok {
+		log.Error("filtered feed asked to decode message of unknown type")
+		return nil
+	}
+	decoded := &decodedBroadcastMessage{
+		confirmed: broadcastMessage.ConfirmedSequenceNumberMessage,
+	}
+	for _, msg := range broadcastMessage.Messages {
+		decoded.transactions = append(decoded.transactions, f.decodeMessage(msg)...)
+	}
+	return decoded
+}
+
+func (f *feedFilters) Heartbeat() interface{} {
+	confirmed, ok := f.catchupBuffer.ConfirmedSequenceNumber()
+	if !ok {
+		return nil
+	}
+	return BroadcastMessage{
+		Version:                        1,
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{confirmed},
+	}
+}
+
+// FeedFilter selects the transactions from any of its senders, to any of its recipients, in any of its kinds of L1
+// message, ignoring whichever of those are empty
+type FeedFilter struct {
+	Senders    map[common.Address]bool
+	Recipients map[common.Address]bool
+	Kinds      map[uint8]bool
+}
+
+// queryValues splits comma separated values, so that each parameter can be given either way
+func queryValues(query url.Values, key string) []string {
+	var values []string
+	for _, value := range query[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+func parseAddresses(query url.Values, key string) (map[common.Address]bool, error) {
+	values := queryValues(query, key)
+	if len(values) == 0 {
+		return nil, nil
+	}
+	addresses := make(map[common.Address]bool, len(values))
+	for _, value := range values {
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid %v address %v", key, value)
+		}
+		addresses[common.HexToAddress(value)] = true
+	}
+	return addresses, nil
+}
+
+// ParseFeedFilter parses the sender, recipient and kind query parameters of a filtered subscription
+func ParseFeedFilter(query url.Values) (*FeedFilter, error) {
+	for key := range query {
+		if key != "sender" && key != "recipient" && key != "kind" {
+			return nil, fmt.Errorf("unknown filter parameter %v", key)
+		}
+	}
+	var filter FeedFilter
+	var err error
+	filter.Senders, err = parseAddresses(query, "sender")
+	if err != nil {
+		return nil, err
+	}
+	filter.Recipients, err = parseAddresses(query, "recipient")
+	if err != nil {
+		return nil, err
+	}
+	if kinds := queryValues(query, "kind"); len(kinds) > 0 {
+		filter.Kinds = make(map[uint8]bool, len(kinds))
+		for _, value := range kinds {
+			kind, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid L1 message kind %v", value)
+			}
+			filter.Kinds[uint8(kind)] = true
+		}
+	}
+	if filter.Senders == nil && filter.Recipients == nil && filter.Kinds == nil {
+		return nil, errors.New("filter needs a sender, recipient or kind")
+	}
+	return &filter, nil
+}
+
+func (f *feedFilters) NewFilter(query url.Values) (wsbroadcastserver.ClientFilter, error) {
+	filter, err := ParseFeedFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (f *FeedFilter) Matches(tx *BroadcastTransactionMessage) bool {
+	if f.Kinds != nil && !f.Kinds[tx.Kind] {
+		return false
+	}
+	if f.Senders != nil && !f.Senders[tx.Sender] {
+		return false
+	}
+	if f.Recipients != nil && (tx.Transaction.To() == nil || !f.Recipients[*tx.Transaction.To()]) {
+		return false
+	}
+	return true
+}
+
+func (f *FeedFilter) Filter(decodedi interface{}) interface{} {
+	decoded, ok := decodedi.(*decodedBroadcastMessage)
+	if !ok || decoded == nil {
+		return nil
+	}
+	var matching []*BroadcastTransactionMessage
+	for _, tx := range decoded.transactions {
+		if f.Matches(tx) {
+			matching = append(matching, tx)
+		}
+	}
+	if len(matching) == 0 && decoded.confirmed == nil {
+		return nil
+	}
+	return BroadcastMessage{
+		Version:                        1,
+		TransactionMessages:            matching,
+		ConfirmedSequenceNumberMessage: decoded.confirmed,
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"math/big"
+	"net/url"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+
+	"github.com/tenderly/nitro/arbos"
+	"github.com/tenderly/nitro/arbstate"
+)
+
+func filterFromQuery(t *testing.T, query string) *FeedFilter {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ParseFeedFilter(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func TestFeedFilter(t *testing.T) {
+	chainId := big.NewInt(412346)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0x1234")
+	other := common.HexToAddress("0x5678")
+	tx := types.MustSignNewTx(key, types.LatestSignerForChainID(chainId), &types.DynamicFeeTx{
+		ChainID:   chainId,
+		Nonce:     1,
+		GasTipCap: big.NewInt(0),
+		GasFeeCap: big.NewInt(1e9),
+		Gas:       21000,
+		To:        &recipient,
+		Value:     big.NewInt(1),
+	})
+	encodedTx, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedMessage := &BroadcastFeedMessage{
+		SequenceNumber: 5,
+		Message: arbstate.MessageWithMetadata{
+			Message: &arbos.L1IncomingMessage{
+				Header: &arbos.L1IncomingMessageHeader{
+					Kind:      arbos.L1MessageType_L2Message,
+					L1BaseFee: big.NewInt(0),
+				},
+				L2msg: append([]byte{arbos.L2MessageKind_SignedTx}, encodedTx...),
+			},
+		},
+	}
+
+	catchupBuffer := NewSequenceNumberCatchupBuffer(nil)
+	filters := newFeedFilters(chainId, catchupBuffer)
+	decoded := filters.Decode(BroadcastMessage{
+		Version:  1,
+		Messages: []*BroadcastFeedMessage{feedMessage},
+	})
+
+	for _, query := range []string{
+		"recipient=" + recipient.Hex(),
+		"sender=" + other.Hex() + "," + sender.Hex(),
+		"sender=" + sender.Hex() + "&kind=3&recipient=" + recipient.Hex(),
+	} {
+		filtered, ok := filterFromQuery(t, query).Filter(decoded).(BroadcastMessage)
+		if !ok || len(filtered.TransactionMessages) != 1 {
+			t.Fatal("expected filter", query, "to select the transaction, got", filtered)
+		}
+		txMessage := filtered.TransactionMessages[0]
+		if txMessage.SequenceNumber != 5 || txMessage.Sender != sender || txMessage.Transaction.Hash() != tx.Hash() {
+			t.Fatal("unexpected transaction message", txMessage)
+		}
+	}
+	for _, query := range []string{
+		"recipient=" + other.Hex(),
+		"sender=" + recipient.Hex(),
+		"kind=12",
+		"kind=12&recipient=" + recipient.Hex(),
+	} {
+		if filtered := filterFromQuery(t, query).Filter(decoded); filtered != nil {
+			t.Fatal("expected filter", query, "to skip the transaction, got", filtered)
+		}
+	}
+
+	// confirmations are passed on, and then sent as heartbeats
+	if filters.Heartbeat() != nil {
+		t.Fatal("expected no heartbeat before a confirmation")
+	}
+	confirmation := BroadcastMessage{
+		Version:                        1,
+		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{4},
+	}
+	if err := catchupBuffer.OnDoBroadcast(confirmation); err != nil {
+		t.Fatal(err)
+	}
+	filtered, ok := filterFromQuery(t, "kind=12").Filter(filters.Decode(confirmation)).(BroadcastMessage)
+	if !ok || filtered.ConfirmedSequenceNumberMessage == nil || filtered.ConfirmedSequenceNumberMessage.SequenceNumber != 4 {
+		t.Fatal("expected confirmation to be passed on, got", filtered)
+	}
+	heartbeat, ok := filters.Heartbeat().(BroadcastMessage)
+	if !ok || heartbeat.ConfirmedSequenceNumberMessage == nil || heartbeat.ConfirmedSequenceNumberMessage.SequenceNumber != 4 {
+		t.Fatal("unexpected heartbeat", heartbeat)
+	}
+
+	for _, query := range []string{"", "sender=0x12zz", "kind=256", "from=0x1234"} {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseFeedFilter(values); err == nil {
+			t.Fatal("expected invalid filter", query, "to be rejected")
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/log"
+)
+
+// A feed recording is a gzip stream of feedRecordingMagic and the time recording started as big endian unix nanoseconds,
+// followed by a record for each message received. Each record is the nanoseconds since the previous one and the length
+// of the message's JSON encoding as uvarints, then the encoding itself.
+const feedRecordingMagic = "ARBFEED\x01"
+
+// the largest message a recording is trusted to contain
+const maxRecordedMessageSize = 64 * 1024 * 1024
+
+type FeedRecordWriter struct {
+	gzip *gzip.Writer
+	last time.Time
+}
+
+// NewFeedRecordWriter starts a recording, which must be closed to be complete
+func NewFeedRecordWriter(w io.Writer, start time.Time) (*FeedRecordWriter, error) {
+	gzipWriter := gzip.NewWriter(w)
+	header := make([]byte, len(feedRecordingMagic)+8)
+	copy(header, feedRecordingMagic)
+	binary.BigEndian.PutUint64(header[len(feedRecordingMagic):], uint64(start.UnixNano()))
+	if _, err := gzipWriter.Write(header); err != nil {
+		return nil, err
+	}
+	return &FeedRecordWriter{
+		gzip: gzipWriter,
+		last: start,
+	}, nil
+}
+
+// Write records a message received at the given time, which is taken to be no earlier than the previous message
+func (w *FeedRecordWriter) Write(received time.Time, msg *BroadcastMessage) error {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if received.Before(w.last) {
+		received = w.last
+	}
+	record := make([]byte, 2*binary.MaxVarintLen64, 2*binary.MaxVarintLen64+len(encoded))
+	n := binary.PutUvarint(record, uint64(received.Sub(w.last)))
+	n += binary.PutUvarint(record[n:], uint64(len(encoded)))
+	record = append(record[:n], encoded...)
+	if _, err := w.gzip.Write(record); err != nil {
+		return err
+	}
+	w.last = received
+	return nil
+}
+
+// Flush writes out the messages recorded so far, so that they're readable even if the recording isn't closed
+func (w *FeedRecordWriter) Flush() error {
+	return w.gzip.Flush()
+}
+
+func (w *FeedRecordWriter) Close() error {
+	return w.gzip.Close()
+}
+
+type FeedRecordReader struct {
+	gzip   *gzip.Reader
+	reader *bufio.Reader
+	last   time.Time
+}
+
+func NewFeedRecordReader(r io.Reader) (*FeedRecordReader, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(gzipReader)
+	header := make([]byte, len(feedRecordingMagic)+8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("error reading feed recording header: %w", err)
+	}
+	if string(header[:len(feedRecordingMagic)]) != feedRecordingMagic {
+		return nil, errors.New("not a feed recording, or one from an unsupported version")
+	}
+	start := time.Unix(0, int64(binary.BigEndian.Uint64(header[len(feedRecordingMagic):])))
+	return &FeedRecordReader{
+		gzip:   gzipReader,
+		reader: reader,
+		last:   start,
+	}, nil
+}
+
+// Next returns the next recorded message and when it was received, or io.EOF at the end of the recording.
+// A recording which wasn't closed, because the recorder was killed, ends with io.ErrUnexpectedEOF.
+func (r *FeedRecordReader) Next() (time.Time, *BroadcastMessage, error) {
+	delay, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	length, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return time.Time{}, nil, unexpectedEOF(err)
+	}
+	if length > maxRecordedMessageSize {
+		return time.Time{}, nil, fmt.Errorf("recorded message length %v is too large", length)
+	}
+	encoded := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, encoded); err != nil {
+		return time.Time{}, nil, unexpectedEOF(err)
+	}
+	var msg BroadcastMessage
+	if err := json.Unmarshal(encoded, &msg); err != nil {
+		return time.Time{}, nil, err
+	}
+	r.last = r.last.Add(time.Duration(delay))
+	return r.last, &msg, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *FeedRecordReader) Close() error {
+	return r.gzip.Close()
+}
+
+// Replay broadcasts the messages in a recording, at the intervals they were received divided by speed,
+// or as fast as possible if speed is 0. It returns how many messages it broadcast once it reaches the end.
+func (b *Broadcaster) Replay(ctx context.Context, recording *FeedRecordReader, speed float64) (int, error) {
+	var started, firstReceived time.Time
+	count := 0
+	for {
+		received, msg, err := recording.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if count == 0 {
+			started = time.Now()
+			firstReceived = received
+		}
+		if speed > 0 {
+			due := started.Add(time.Duration(float64(received.Sub(firstReceived)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return count, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		} else if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		b.Broadcast(*msg)
+		count++
+		if count%10000 == 0 {
+			log.Info("replaying feed recording", "messages", count, "received", received)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/wsbroadcastserver"
+)
+
+func TestFeedRecording(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var recording bytes.Buffer
+	start := time.Now()
+	writer, err := NewFeedRecordWriter(&recording, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []BroadcastMessage{
+		{Version: 1, Messages: []*BroadcastFeedMessage{{SequenceNumber: 1, Message: arbstate.MessageWithMetadata{DelayedMessagesRead: 1}}}},
+		{Version: 1, Messages: []*BroadcastFeedMessage{{SequenceNumber: 2}, {SequenceNumber: 3}}},
+		{Version: 1, ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{1}},
+	}
+	for i := range messages {
+		if err := writer.Write(start.Add(time.Duration(i)*10*time.Millisecond), &messages[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	unclosed := append([]byte{}, recording.Bytes()...)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewFeedRecordReader(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range messages {
+		received, msg, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !received.Equal(start.Add(time.Duration(i) * 10 * time.Millisecond)) {
+			t.Fatal("unexpected time recorded for message", i, received)
+		}
+		if len(msg.Messages) != len(messages[i].Messages) || (msg.ConfirmedSequenceNumberMessage == nil) != (messages[i].ConfirmedSequenceNumberMessage == nil) {
+			t.Fatal("unexpected message recorded", msg)
+		}
+	}
+	if _, _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatal("expected the recording to end, got", err)
+	}
+
+	// a recorder which was killed still leaves the messages it flushed readable
+	reader, err = NewFeedRecordReader(bytes.NewReader(unclosed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range messages {
+		if _, _, err := reader.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := reader.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatal("expected the unclosed recording to be truncated, got", err)
+	}
+
+	b := NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil, nil)
+	if err := b.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+	reader, err = NewFeedRecordReader(bytes.NewReader(recording.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayStart := time.Now()
+	count, err := b.Replay(ctx, reader, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(messages) || time.Since(replayStart) < 10*time.Millisecond {
+		t.Fatal("unexpected replay of", count, "messages in", time.Since(replayStart))
+	}
+	// the confirmation removes the first message from the catchup buffer
+	waitUntilUpdated(t, &messageCountPredicate{b, 2, "after replaying the recording", 0})
+	if err := b.CheckRequestedSequenceNumber(arbutil.MessageIndex(2)); err != nil {
+		t.Fatal(err)
+	}
+}
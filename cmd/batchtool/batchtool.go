@@ -0,0 +1,353 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/arbnode"
+	"github.com/tenderly/nitro/arbos"
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/cmd/genericconf"
+	"github.com/tenderly/nitro/cmd/util"
+	"github.com/tenderly/nitro/das"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/core/rawdb"
+	"github.com/tenderly/nitro/go-ethereum/ethclient"
+	"github.com/tenderly/nitro/go-ethereum/ethdb"
+)
+
+func main() {
+	args := os.Args
+	if len(args) < 2 {
+		panic("Usage: batchtool [build|decode] ...")
+	}
+
+	var err error
+	switch strings.ToLower(args[1]) {
+	case "build":
+		err = startBuild(args[2:])
+	case "decode":
+		err = startDecode(args[2:])
+	default:
+		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'build', 'decode'", args[1]))
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func openArbDb(path string) (ethdb.Database, error) {
+	if path == "" {
+		return nil, errors.New("--db must be set to the node's arbitrumdata directory")
+	}
+	return rawdb.NewLevelDBDatabase(path, 0, 0, "", true)
+}
+
+var segmentKindNames = map[byte]string{
+	arbstate.BatchSegmentKindL2Message:            "l2",
+	arbstate.BatchSegmentKindL2MessageBrotli:      "l2-brotli",
+	arbstate.BatchSegmentKindDelayedMessages:      "delayed",
+	arbstate.BatchSegmentKindAdvanceTimestamp:     "timestamp",
+	arbstate.BatchSegmentKindAdvanceL1BlockNumber: "l1-block",
+}
+
+func formatSegments(segments map[byte]int) string {
+	var kinds []int
+	for kind := range segments {
+		kinds = append(kinds, int(kind))
+	}
+	sort.Ints(kinds)
+	var parts []string
+	for _, kind := range kinds {
+		name, exists := segmentKindNames[byte(kind)]
+		if !exists {
+			name = fmt.Sprintf("kind-%v", kind)
+		}
+		parts = append(parts, fmt.Sprintf("%v=%v", name, segments[byte(kind)]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// batchtool build
+
+type BuildConfig struct {
+	DB          string                    `koanf:"db"`
+	Start       uint64                    `koanf:"start"`
+	End         uint64                    `koanf:"end"`
+	FirstBatch  uint64                    `koanf:"first-batch"`
+	BatchPoster arbnode.BatchPosterConfig `koanf:"batch-poster"`
+	ConfConfig  genericconf.ConfConfig    `koanf:"conf"`
+}
+
+func parseBuildConfig(args []string) (*BuildConfig, error) {
+	f := flag.NewFlagSet("batchtool build", flag.ContinueOnError)
+	f.String("db", "", "path to the node's arbitrumdata database")
+	f.Uint64("start", 0, "first message to put in a batch")
+	f.Uint64("end", 0, "message to stop batching before (0 for the node's message count)")
+	f.Uint64("first-batch", 0, "sequence number of the first batch, which only affects the gas estimate")
+	arbnode.BatchPosterConfigAddOptions("batch-poster", f)
+	genericconf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config BuildConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func startBuild(args []string) error {
+	config, err := parseBuildConfig(args)
+	if err != nil {
+		return err
+	}
+	db, err := openArbDb(config.DB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	streamer, err := arbnode.NewTransactionStreamer(db, nil, nil)
+	if err != nil {
+		return err
+	}
+	end := arbutil.MessageIndex(config.End)
+	if end == 0 {
+		end, err = streamer.GetMessageCount()
+		if err != nil {
+			return err
+		}
+	}
+	if arbutil.MessageIndex(config.Start) >= end {
+		return fmt.Errorf("no messages in range [%v, %v)", config.Start, end)
+	}
+
+	batches, err := arbnode.BuildBatches(streamer, arbutil.MessageIndex(config.Start), end, config.FirstBatch, &config.BatchPoster)
+	if err != nil {
+		return err
+	}
+	var totalUncompressed, totalSize int
+	var totalGas uint64
+	for i, batch := range batches {
+		fmt.Printf(
+			"batch %v: messages [%v, %v) size %v uncompressed %v ratio %.2f segments %v estimated L1 gas %v\n",
+			config.FirstBatch+uint64(i), batch.FirstMessage, batch.EndMessage, len(batch.Data), batch.UncompressedSize,
+			batch.CompressionRatio(), formatSegments(batch.Segments), batch.EstimatedL1Gas,
+		)
+		totalUncompressed += batch.UncompressedSize
+		totalSize += len(batch.Data)
+		totalGas += batch.EstimatedL1Gas
+	}
+	fmt.Printf(
+		"total: %v batches size %v uncompressed %v ratio %.2f estimated L1 gas %v\n",
+		len(batches), totalSize, totalUncompressed, float64(totalUncompressed)/float64(totalSize), totalGas,
+	)
+	return nil
+}
+
+// batchtool decode
+
+type DecodeConfig struct {
+	Data                string                 `koanf:"data"`
+	L1URL               string                 `koanf:"l1-url"`
+	SequencerInbox      string                 `koanf:"sequencer-inbox"`
+	L1Block             uint64                 `koanf:"l1-block"`
+	Batch               uint64                 `koanf:"batch"`
+	DB                  string                 `koanf:"db"`
+	DelayedMessagesRead uint64                 `koanf:"delayed-messages-read"`
+	ChainID             uint64                 `koanf:"chain-id"`
+	ArbOSVersion        uint64                 `koanf:"arbos-version"`
+	DASURL              string                 `koanf:"das-url"`
+	ConfConfig          genericconf.ConfConfig `koanf:"conf"`
+}
+
+func parseDecodeConfig(args []string) (*DecodeConfig, error) {
+	f := flag.NewFlagSet("batchtool decode", flag.ContinueOnError)
+	f.String("data", "", "hex encoded sequencer message including its 40 byte L1 header, instead of reading the batch from L1")
+	f.String("l1-url", "", "URL of the L1 node to read the batch from")
+	f.String("sequencer-inbox", "", "address of the sequencer inbox contract")
+	f.Uint64("l1-block", 0, "L1 block the batch was posted in")
+	f.Uint64("batch", 0, "sequence number of the batch")
+	f.String("db", "", "path to the node's arbitrumdata database, to read delayed messages from (optional)")
+	f.Uint64("delayed-messages-read", 0, "delayed message count before the batch, if not read from the database")
+	f.Uint64("chain-id", 0, "L2 chain ID, to list the transactions in each message (optional)")
+	f.Uint64("arbos-version", arbstate.LatestBatchFormatArbOSVersion, "ArbOS version the batch is read at, which decides the batch formats it may use")
+	f.String("das-url", "", "URL of a DAS REST endpoint to fetch the contents of batches posted to a data availability committee from")
+	genericconf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config DecodeConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// decodeBackend feeds a single batch to the inbox multiplexer
+type decodeBackend struct {
+	batch                 []byte
+	batchSeqNum           uint64
+	positionWithinMessage uint64
+	advanced              bool
+	arbOSVersion          uint64
+	inbox                 *arbnode.InboxTracker
+}
+
+func (b *decodeBackend) PeekSequencerInbox() ([]byte, error) {
+	if b.advanced {
+		return nil, errors.New("reading past the decoded batch")
+	}
+	return b.batch, nil
+}
+
+func (b *decodeBackend) GetSequencerInboxPosition() uint64 {
+	return b.batchSeqNum
+}
+
+func (b *decodeBackend) AdvanceSequencerInbox() {
+	b.advanced = true
+}
+
+func (b *decodeBackend) GetPositionWithinMessage() uint64 {
+	return b.positionWithinMessage
+}
+
+func (b *decodeBackend) SetPositionWithinMessage(pos uint64) {
+	b.positionWithinMessage = pos
+}
+
+func (b *decodeBackend) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
+	if b.inbox == nil {
+		return nil, fmt.Errorf("batch reads delayed message %v, but no database is configured to read it from", seqNum)
+	}
+	return b.inbox.GetDelayedMessageBytes(seqNum)
+}
+
+func (b *decodeBackend) GetBatchArbOSVersion() (uint64, error) {
+	return b.arbOSVersion, nil
+}
+
+func readBatch(ctx context.Context, config *DecodeConfig) ([]byte, error) {
+	if config.Data != "" {
+		return hexutil.Decode(config.Data)
+	}
+	if config.L1URL == "" || !common.IsHexAddress(config.SequencerInbox) {
+		return nil, errors.New("either --data or --l1-url, --sequencer-inbox and --l1-block must be set")
+	}
+	client, err := ethclient.DialContext(ctx, config.L1URL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	seqInbox, err := arbnode.NewSequencerInbox(client, common.HexToAddress(config.SequencerInbox), 0)
+	if err != nil {
+		return nil, err
+	}
+	block := new(big.Int).SetUint64(config.L1Block)
+	batches, err := seqInbox.LookupBatchesInRange(ctx, block, block)
+	if err != nil {
+		return nil, err
+	}
+	for _, batch := range batches {
+		if batch.SequenceNumber == config.Batch {
+			return batch.Serialize(ctx, client)
+		}
+	}
+	return nil, fmt.Errorf("batch %v not found in L1 block %v", config.Batch, config.L1Block)
+}
+
+func startDecode(args []string) error {
+	config, err := parseDecodeConfig(args)
+	if err != nil {
+		return err
+	}
+	return decode(context.Background(), config, os.Stdout)
+}
+
+func decode(ctx context.Context, config *DecodeConfig, out io.Writer) error {
+	data, err := readBatch(ctx, config)
+	if err != nil {
+		return err
+	}
+	var dasReader arbstate.DataAvailabilityReader
+	if len(data) > 40 && arbstate.IsDASMessageHeaderByte(data[40]) {
+		// without a DAS reader the multiplexer would quietly decode the batch as empty
+		if config.DASURL == "" {
+			return errors.New("batch contents are stored in a data availability committee, set --das-url to fetch them")
+		}
+		dasReader, err = das.NewRestfulDasClientFromURL(config.DASURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	backend := &decodeBackend{
+		batch:        data,
+		batchSeqNum:  config.Batch,
+		arbOSVersion: config.ArbOSVersion,
+	}
+	delayedMessagesRead := config.DelayedMessagesRead
+	if config.DB != "" {
+		db, err := openArbDb(config.DB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		backend.inbox, err = arbnode.NewInboxTracker(db, nil, nil)
+		if err != nil {
+			return err
+		}
+		if config.Batch > 0 {
+			prevBatchMeta, err := backend.inbox.GetBatchMetadata(config.Batch - 1)
+			if err != nil {
+				return err
+			}
+			delayedMessagesRead = prevBatchMeta.DelayedMessageCount
+		}
+	}
+
+	multiplexer := arbstate.NewInboxMultiplexer(backend, delayedMessagesRead, dasReader)
+	for i := 0; !backend.advanced; i++ {
+		msg, err := multiplexer.Pop(ctx)
+		if err != nil {
+			return err
+		}
+		header := msg.Message.Header
+		fmt.Fprintf(
+			out,
+			"message %v: kind %v timestamp %v l1 block %v delayed messages read %v l2msg %v bytes\n",
+			i, header.Kind, header.Timestamp, header.BlockNumber, msg.DelayedMessagesRead, len(msg.Message.L2msg),
+		)
+		if header.Kind == arbos.L1MessageType_L2Message && config.ChainID != 0 {
+			txs, err := msg.Message.ParseL2Transactions(new(big.Int).SetUint64(config.ChainID), nil)
+			if err != nil {
+				fmt.Fprintf(out, "  unable to parse transactions: %v\n", err)
+				continue
+			}
+			for _, tx := range txs {
+				fmt.Fprintf(out, "  tx %v\n", tx.Hash())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/tenderly/nitro/arbcompress"
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/rlp"
+	"github.com/tenderly/nitro/util/testhelpers"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	var segments []byte
+	for _, segment := range [][]byte{
+		{arbstate.BatchSegmentKindAdvanceTimestamp, 0x05},
+		{arbstate.BatchSegmentKindL2Message, 0x01, 0x02, 0x03},
+		{arbstate.BatchSegmentKindL2Message, 0x04},
+	} {
+		encoded, err := rlp.EncodeToBytes(segment)
+		testhelpers.RequireImpl(t, err)
+		segments = append(segments, encoded...)
+	}
+	compressed, err := arbcompress.CompressWell(segments)
+	testhelpers.RequireImpl(t, err)
+	batch := make([]byte, 40)
+	binary.BigEndian.PutUint64(batch[8:16], 10) // the max timestamp
+	batch = append(batch, arbstate.BrotliMessageHeaderByte)
+	batch = append(batch, compressed...)
+
+	config, err := parseDecodeConfig([]string{"--data", hexutil.Encode(batch)})
+	testhelpers.RequireImpl(t, err)
+	var out bytes.Buffer
+	testhelpers.RequireImpl(t, decode(context.Background(), config, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		testhelpers.FailImpl(t, "unexpected decoded messages", out.String())
+	}
+	if !strings.Contains(lines[0], "timestamp 5 ") || !strings.Contains(lines[0], "l2msg 3 bytes") {
+		testhelpers.FailImpl(t, "unexpected first message", lines[0])
+	}
+	if !strings.Contains(lines[1], "timestamp 5 ") || !strings.Contains(lines[1], "l2msg 1 bytes") {
+		testhelpers.FailImpl(t, "unexpected second message", lines[1])
+	}
+}
+
+func TestDecodeDASBatchRequiresURL(t *testing.T) {
+	batch := make([]byte, 40)
+	batch = append(batch, arbstate.DASMessageHeaderFlag|arbstate.TreeDASMessageHeaderFlag)
+	batch = append(batch, make([]byte, 32)...)
+	config, err := parseDecodeConfig([]string{"--data", hexutil.Encode(batch)})
+	testhelpers.RequireImpl(t, err)
+	err = decode(context.Background(), config, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "--das-url") {
+		testhelpers.FailImpl(t, "DAS batch decoded without a DAS reader", err)
+	}
+}
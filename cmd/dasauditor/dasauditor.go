@@ -0,0 +1,211 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/cmd/genericconf"
+	"github.com/tenderly/nitro/cmd/util"
+	"github.com/tenderly/nitro/das"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/metrics"
+	"github.com/tenderly/nitro/go-ethereum/metrics/exp"
+)
+
+func main() {
+	if err := startup(); err != nil {
+		log.Error("Error running DAS auditor", "err", err)
+		os.Exit(1)
+	}
+}
+
+func printSampleUsage() {
+	progname := os.Args[0]
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage:                  %s --l1-node-url ws://l1:8546 --sequencer-inbox-address 0x... --auditor.members '[{\"url\":\"http://member:9877\",\"pubkey\":\"...\"}]' --report-file report.json --metrics \n", progname)
+}
+
+type DASAuditorConfig struct {
+	Conf     genericconf.ConfConfig `koanf:"conf"`
+	LogLevel int                    `koanf:"log-level"`
+	LogType  string                 `koanf:"log-type"`
+
+	L1NodeURL             string `koanf:"l1-node-url"`
+	L1ConnectionAttempts  int    `koanf:"l1-connection-attempts"`
+	SequencerInboxAddress string `koanf:"sequencer-inbox-address"`
+
+	Auditor        das.AuditorConfig `koanf:"auditor"`
+	ReportFile     string            `koanf:"report-file"`
+	ReportInterval time.Duration     `koanf:"report-interval"`
+
+	Metrics       bool                            `koanf:"metrics"`
+	MetricsServer genericconf.MetricsServerConfig `koanf:"metrics-server"`
+}
+
+var DASAuditorConfigDefault = DASAuditorConfig{
+	Conf:                  genericconf.ConfConfigDefault,
+	LogLevel:              int(log.LvlInfo),
+	LogType:               "plaintext",
+	L1NodeURL:             "",
+	L1ConnectionAttempts:  15,
+	SequencerInboxAddress: "",
+	Auditor:               das.DefaultAuditorConfig,
+	ReportFile:            "",
+	ReportInterval:        time.Minute,
+	Metrics:               false,
+	MetricsServer:         genericconf.MetricsServerConfigDefault,
+}
+
+func DASAuditorConfigAddOptions(f *flag.FlagSet) {
+	genericconf.ConfConfigAddOptions("conf", f)
+	f.Int("log-level", DASAuditorConfigDefault.LogLevel, "log level; 1: ERROR, 2: WARN, 3: INFO, 4: DEBUG, 5: TRACE")
+	f.String("log-type", DASAuditorConfigDefault.LogType, "log type")
+	f.String("l1-node-url", DASAuditorConfigDefault.L1NodeURL, "URL of the L1 node to read batches from")
+	f.Int("l1-connection-attempts", DASAuditorConfigDefault.L1ConnectionAttempts, "L1 connection attempts (0 = infinity)")
+	f.String("sequencer-inbox-address", DASAuditorConfigDefault.SequencerInboxAddress, "L1 address of the SequencerInbox contract")
+	das.AuditorConfigAddOptions("auditor", f)
+	f.String("report-file", DASAuditorConfigDefault.ReportFile, "file to write the JSON availability report to")
+	f.Duration("report-interval", DASAuditorConfigDefault.ReportInterval, "how often to write the report")
+	f.Bool("metrics", DASAuditorConfigDefault.Metrics, "enable metrics")
+	genericconf.MetricsServerAddOptions("metrics-server", f)
+}
+
+func ParseDASAuditor(args []string) (*DASAuditorConfig, error) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+
+	DASAuditorConfigAddOptions(f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config DASAuditorConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Conf.Dump {
+		err = util.DumpConfig(k, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.L1NodeURL == "" {
+		return nil, errors.New("--l1-node-url is required")
+	}
+	if !common.IsHexAddress(config.SequencerInboxAddress) {
+		return nil, errors.New("--sequencer-inbox-address must be set to a valid contract address")
+	}
+	if err := config.Auditor.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func writeReport(path string, report das.AuditReport) error {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Use a temp file and rename to achieve atomic writes.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func startup() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vcsRevision, vcsTime := genericconf.GetVersion()
+	config, err := ParseDASAuditor(os.Args[1:])
+	if err != nil {
+		fmt.Printf("\nrevision: %v, vcs.time: %v\n", vcsRevision, vcsTime)
+		printSampleUsage()
+		if !strings.Contains(err.Error(), "help requested") {
+			fmt.Printf("%s\n", err.Error())
+		}
+
+		return nil
+	}
+
+	logFormat, err := genericconf.ParseLogType(config.LogType)
+	if err != nil {
+		flag.Usage()
+		return fmt.Errorf("error parsing log type: %w", err)
+	}
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, logFormat))
+	glogger.Verbosity(log.Lvl(config.LogLevel))
+	log.Root().SetHandler(glogger)
+
+	log.Info("Running Arbitrum nitro DAS auditor", "revision", vcsRevision, "vcs.time", vcsTime)
+
+	if config.Metrics {
+		go metrics.CollectProcessMetrics(config.MetricsServer.UpdateInterval)
+
+		if config.MetricsServer.Addr != "" {
+			address := fmt.Sprintf("%v:%v", config.MetricsServer.Addr, config.MetricsServer.Port)
+			exp.Setup(address)
+		}
+	}
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+
+	l1Client, err := das.GetL1Client(ctx, config.L1ConnectionAttempts, config.L1NodeURL)
+	if err != nil {
+		return err
+	}
+	auditor, err := das.NewAuditor(config.Auditor, l1Client, common.HexToAddress(config.SequencerInboxAddress))
+	if err != nil {
+		return err
+	}
+	auditor.Start(ctx)
+	defer auditor.StopAndWait()
+
+	report := func() {
+		if config.ReportFile == "" {
+			return
+		}
+		if err := writeReport(config.ReportFile, auditor.Report()); err != nil {
+			log.Error("failed to write DAS availability report", "file", config.ReportFile, "err", err)
+		}
+	}
+	ticker := time.NewTicker(config.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			report()
+		case <-sigint:
+			report()
+			return nil
+		}
+	}
+}
@@ -37,6 +37,7 @@ type DAServerConfig struct {
 	RESTAddr           string                              `koanf:"rest-addr"`
 	RESTPort           uint64                              `koanf:"rest-port"`
 	RESTServerTimeouts genericconf.HTTPServerTimeoutConfig `koanf:"rest-server-timeouts"`
+	RESTInventory      bool                                `koanf:"rest-inventory"`
 
 	DAConf das.DataAvailabilityConfig `koanf:"data-availability"`
 
@@ -56,6 +57,7 @@ var DefaultDAServerConfig = DAServerConfig{
 	RESTAddr:           "localhost",
 	RESTPort:           9877,
 	RESTServerTimeouts: genericconf.HTTPServerTimeoutConfigDefault,
+	RESTInventory:      false,
 	DAConf:             das.DefaultDataAvailabilityConfig,
 	ConfConfig:         genericconf.ConfConfigDefault,
 	Metrics:            false,
@@ -86,6 +88,7 @@ func parseDAServer(args []string) (*DAServerConfig, error) {
 	f.String("rest-addr", DefaultDAServerConfig.RESTAddr, "REST server listening interface")
 	f.Uint64("rest-port", DefaultDAServerConfig.RESTPort, "REST server listening port")
 	genericconf.HTTPServerTimeoutConfigAddOptions("rest-server-timeouts", f)
+	f.Bool("rest-inventory", DefaultDAServerConfig.RESTInventory, "enable listing the keys of the stored data at the REST server's /inventory endpoint")
 
 	f.Bool("metrics", DefaultDAServerConfig.Metrics, "enable metrics")
 	genericconf.MetricsServerAddOptions("metrics-server", f)
@@ -182,7 +185,7 @@ func startup() error {
 	if serverConfig.EnableREST {
 		log.Info("Starting REST server", "addr", serverConfig.RESTAddr, "port", serverConfig.RESTPort)
 
-		restServer, err = das.NewRestfulDasServer(serverConfig.RESTAddr, serverConfig.RESTPort, serverConfig.RESTServerTimeouts, dasImpl)
+		restServer, err = das.NewRestfulDasServer(serverConfig.RESTAddr, serverConfig.RESTPort, serverConfig.RESTServerTimeouts, serverConfig.RESTInventory, dasImpl)
 		if err != nil {
 			return err
 		}
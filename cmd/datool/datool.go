@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -26,7 +27,7 @@ import (
 func main() {
 	args := os.Args
 	if len(args) < 2 {
-		panic("Usage: datool [client|keygen] ...")
+		panic("Usage: datool [client|keygen|migrate] ...")
 	}
 
 	var err error
@@ -35,8 +36,10 @@ func main() {
 		err = startClient(args[2:])
 	case "keygen":
 		err = startKeyGen(args[2:])
+	case "migrate":
+		err = startMigrate(args[2:])
 	default:
-		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'client', 'keygen'", args[1]))
+		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'client', 'keygen', 'migrate'", args[1]))
 	}
 	if err != nil {
 		panic(err)
@@ -280,3 +283,107 @@ func startKeyGen(args []string) error {
 	}
 	return nil
 }
+
+// datool migrate
+
+type MigrateStorageConfig struct {
+	LocalDBStorageConfig   das.LocalDBStorageConfig   `koanf:"local-db-storage"`
+	LocalFileStorageConfig das.LocalFileStorageConfig `koanf:"local-file-storage"`
+	S3StorageServiceConfig das.S3StorageServiceConfig `koanf:"s3-storage"`
+}
+
+func migrateStorageConfigAddOptions(prefix string, f *flag.FlagSet) {
+	das.LocalDBStorageConfigAddOptions(prefix+".local-db-storage", f)
+	das.LocalFileStorageConfigAddOptions(prefix+".local-file-storage", f)
+	das.S3ConfigAddOptions(prefix+".s3-storage", f)
+}
+
+type MigrateConfig struct {
+	Source             MigrateStorageConfig   `koanf:"source"`
+	Destination        MigrateStorageConfig   `koanf:"destination"`
+	Checkpoint         string                 `koanf:"checkpoint"`
+	CheckpointInterval time.Duration          `koanf:"checkpoint-interval"`
+	Workers            int                    `koanf:"workers"`
+	VerifyOnly         bool                   `koanf:"verify-only"`
+	DASRetentionPeriod time.Duration          `koanf:"das-retention-period"`
+	ConfConfig         genericconf.ConfConfig `koanf:"conf"`
+}
+
+func parseMigrateConfig(args []string) (*MigrateConfig, error) {
+	f := flag.NewFlagSet("datool migrate", flag.ContinueOnError)
+	migrateStorageConfigAddOptions("source", f)
+	migrateStorageConfigAddOptions("destination", f)
+	f.String("checkpoint", "", "File in which to record the migration's progress, to resume it from if it exists.")
+	f.Duration("checkpoint-interval", 10*time.Second, "How often to update the checkpoint file.")
+	f.Int("workers", 16, "Number of keys to migrate in parallel.")
+	f.Bool("verify-only", false, "Check that the destination holds everything in the source, without copying anything.")
+	f.Duration("das-retention-period", 0, "The period from now for which the destination is requested to retain migrated batches whose expiry the source doesn't record, which is required if the destination discards data after its timeout. Batches whose expiry the source records keep it.")
+	genericconf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config MigrateConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func createMigrateStorageService(ctx context.Context, config MigrateStorageConfig) (das.StorageService, *das.LifecycleManager, error) {
+	dasConfig := das.DefaultDataAvailabilityConfig
+	dasConfig.LocalDBStorageConfig = config.LocalDBStorageConfig
+	dasConfig.LocalFileStorageConfig = config.LocalFileStorageConfig
+	dasConfig.S3StorageServiceConfig = config.S3StorageServiceConfig
+	storageService, lifecycleManager, err := das.CreatePersistentStorageService(ctx, &dasConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if storageService == nil {
+		return nil, nil, errors.New("no storage backend is enabled")
+	}
+	return storageService, lifecycleManager, nil
+}
+
+func startMigrate(args []string) error {
+	config, err := parseMigrateConfig(args)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	source, sourceLifecycleManager, err := createMigrateStorageService(ctx, config.Source)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer sourceLifecycleManager.StopAndWaitUntil(time.Second)
+	iterableSource, ok := source.(das.IterableStorageService)
+	if !ok {
+		return fmt.Errorf("source %v can't list its keys to be migrated", source)
+	}
+	destination, destinationLifecycleManager, err := createMigrateStorageService(ctx, config.Destination)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer destinationLifecycleManager.StopAndWaitUntil(time.Second)
+
+	var expiry uint64
+	if config.DASRetentionPeriod > 0 {
+		expiry = uint64(time.Now().Add(config.DASRetentionPeriod).Unix())
+	}
+	result, err := das.MigrateStorage(ctx, iterableSource, destination, das.MigrationOptions{
+		Checkpoint:         config.Checkpoint,
+		CheckpointInterval: config.CheckpointInterval,
+		Workers:            config.Workers,
+		VerifyOnly:         config.VerifyOnly,
+		Expiry:             expiry,
+	})
+	if config.VerifyOnly {
+		fmt.Printf("Verified: %d, failed: %d\n", result.Migrated, result.Failed)
+	} else {
+		fmt.Printf("Migrated: %d, failed: %d\n", result.Migrated, result.Failed)
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/broadcastclient"
+	"github.com/tenderly/nitro/broadcaster"
+	"github.com/tenderly/nitro/cmd/genericconf"
+	"github.com/tenderly/nitro/cmd/util"
+	"github.com/tenderly/nitro/go-ethereum/log"
+)
+
+func main() {
+	if err := startup(); err != nil {
+		log.Error("Error running feed recorder", "err", err)
+		os.Exit(1)
+	}
+}
+
+func printSampleUsage() {
+	progname := os.Args[0]
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage:                  %s --feed.input.url ws://sequencer:9642 --file feed.rec \n", progname)
+	fmt.Printf("                               %s --replay.enable --replay.speed 10 --file feed.rec --feed.output.port 9642 \n", progname)
+}
+
+type FeedRecorderConfig struct {
+	Conf     genericconf.ConfConfig     `koanf:"conf"`
+	LogLevel int                        `koanf:"log-level"`
+	LogType  string                     `koanf:"log-type"`
+	File     string                     `koanf:"file"`
+	Replay   ReplayConfig               `koanf:"replay"`
+	Feed     broadcastclient.FeedConfig `koanf:"feed"`
+}
+
+var FeedRecorderConfigDefault = FeedRecorderConfig{
+	Conf:     genericconf.ConfConfigDefault,
+	LogLevel: int(log.LvlInfo),
+	LogType:  "plaintext",
+	File:     "",
+	Replay:   ReplayConfigDefault,
+	Feed:     broadcastclient.FeedConfigDefault,
+}
+
+func FeedRecorderConfigAddOptions(f *flag.FlagSet) {
+	genericconf.ConfConfigAddOptions("conf", f)
+	f.Int("log-level", FeedRecorderConfigDefault.LogLevel, "log level")
+	f.String("log-type", FeedRecorderConfigDefault.LogType, "log type")
+	f.String("file", FeedRecorderConfigDefault.File, "file to record the feed to, or to replay it from")
+	ReplayConfigAddOptions("replay", f)
+	broadcastclient.FeedConfigAddOptions("feed", f, true, true)
+}
+
+type ReplayConfig struct {
+	Enable bool    `koanf:"enable"`
+	Speed  float64 `koanf:"speed"`
+	Wait   bool    `koanf:"wait"`
+}
+
+var ReplayConfigDefault = ReplayConfig{
+	Enable: false,
+	Speed:  1,
+	Wait:   true,
+}
+
+func ReplayConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", ReplayConfigDefault.Enable, "serve the recorded feed on the feed output instead of recording")
+	f.Float64(prefix+".speed", ReplayConfigDefault.Speed, "how many times faster than it was recorded to replay the feed (0 for as fast as possible)")
+	f.Bool(prefix+".wait", ReplayConfigDefault.Wait, "keep serving the replayed messages to clients catching up until interrupted, rather than exiting at the end of the recording")
+}
+
+func ParseFeedRecorder(_ context.Context, args []string) (*FeedRecorderConfig, error) {
+	f := flag.NewFlagSet("", flag.ContinueOnError)
+
+	FeedRecorderConfigAddOptions(f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config FeedRecorderConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+
+	if config.Conf.Dump {
+		err = util.DumpConfig(k, map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.File == "" {
+		return nil, errors.New("--file is required")
+	}
+	if config.Replay.Speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed %v", config.Replay.Speed)
+	}
+	if !config.Replay.Enable && !config.Feed.Input.Enable() {
+		return nil, errors.New("--feed.input.url is required to record a feed")
+	}
+	if !config.Replay.Enable && len(config.Feed.Input.URLs) > 1 {
+		return nil, errors.New("a feed can only be recorded from a single --feed.input.url")
+	}
+
+	return &config, nil
+}
+
+func startup() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	vcsRevision, vcsTime := genericconf.GetVersion()
+	config, err := ParseFeedRecorder(ctx, os.Args[1:])
+	if err != nil {
+		fmt.Printf("\nrevision: %v, vcs.time: %v\n", vcsRevision, vcsTime)
+		printSampleUsage()
+		if !strings.Contains(err.Error(), "help requested") {
+			fmt.Printf("%s\n", err.Error())
+		}
+
+		return nil
+	}
+
+	logFormat, err := genericconf.ParseLogType(config.LogType)
+	if err != nil {
+		flag.Usage()
+		return fmt.Errorf("error parsing log type: %w", err)
+	}
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, logFormat))
+	glogger.Verbosity(log.Lvl(config.LogLevel))
+	log.Root().SetHandler(glogger)
+
+	log.Info("Running Arbitrum nitro feed recorder", "revision", vcsRevision, "vcs.time", vcsTime)
+
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigint
+		cancel()
+	}()
+
+	if config.Replay.Enable {
+		return replay(ctx, config)
+	}
+	return record(ctx, config)
+}
+
+// discardStreamer drops the messages the client has verified, as the recording is taken from what it reads
+type discardStreamer struct{}
+
+func (discardStreamer) AddBroadcastMessages([]*broadcaster.BroadcastFeedMessage) error {
+	return nil
+}
+
+// record writes each message read from a single feed connection to the recording, exactly as it was sent,
+// so that duplicates and reorgs are replayed as the feed sent them
+func record(ctx context.Context, config *FeedRecorderConfig) error {
+	// never append to or overwrite an existing recording
+	file, err := os.OpenFile(config.File, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer, err := broadcaster.NewFeedRecordWriter(file, time.Now())
+	if err != nil {
+		return err
+	}
+
+	url := config.Feed.Input.URLs[0]
+	client, err := broadcastclient.NewBroadcastClient(config.Feed.Input, url, nil, discardStreamer{})
+	if err != nil {
+		return err
+	}
+	received := make(chan *broadcaster.BroadcastMessage, 100)
+	client.BroadcastMessageListener = received
+	client.Start(ctx)
+	defer client.StopAndWait()
+
+	log.Info("recording feed", "url", url, "file", config.File)
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
+	count := 0
+	for {
+		select {
+		case <-ctx.Done():
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			log.Info("finished recording feed", "messages", count, "file", config.File)
+			return nil
+		case msg := <-received:
+			if err := writer.Write(time.Now(), msg); err != nil {
+				return err
+			}
+			count++
+		case <-flushTicker.C:
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func replay(ctx context.Context, config *FeedRecorderConfig) error {
+	file, err := os.Open(config.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := broadcaster.NewFeedRecordReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// the recorded messages keep the sequencer's signatures, so the replay doesn't sign them itself
+	b := broadcaster.NewBroadcaster(config.Feed.Output, nil, nil)
+	if err := b.Start(ctx); err != nil {
+		return err
+	}
+	defer b.StopAndWait()
+
+	log.Info("replaying feed", "file", config.File, "speed", config.Replay.Speed, "address", b.ListenerAddr())
+	count, err := b.Replay(ctx, reader, config.Replay.Speed)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	log.Info("finished replaying feed", "messages", count)
+	if config.Replay.Wait {
+		<-ctx.Done()
+	}
+	return nil
+}
@@ -405,7 +405,9 @@ func main() {
 		}
 
 		validatorNeedsKey := nodeConfig.Node.Validator.Enable && !strings.EqualFold(nodeConfig.Node.Validator.Strategy, "watchtower")
-		if nodeConfig.Node.BatchPoster.Enable || validatorNeedsKey {
+		feedOutput := &nodeConfig.Node.Feed.Output
+		feedNeedsKey := feedOutput.Enable && feedOutput.Signed && feedOutput.SigningKey == "" && feedOutput.SignWithL1Wallet
+		if nodeConfig.Node.BatchPoster.Enable || validatorNeedsKey || feedNeedsKey {
 			l1TransactionOpts, err = util.GetTransactOptsFromWallet(
 				l1Wallet,
 				new(big.Int).SetUint64(nodeConfig.L1.ChainID),
@@ -745,13 +747,14 @@ func ParseNode(ctx context.Context, args []string) (*NodeConfig, *genericconf.Wa
 		return nil, nil, nil, nil, nil, err
 	}
 
-	// Don't print wallet passwords
+	// Don't print wallet passwords or private keys
 	if nodeConfig.Conf.Dump {
 		err = util.DumpConfig(k, map[string]interface{}{
-			"l1.wallet.password":    "",
-			"l1.wallet.private-key": "",
-			"l2.wallet.password":    "",
-			"l2.wallet.private-key": "",
+			"l1.wallet.password":                   "",
+			"l1.wallet.private-key":                "",
+			"l2.wallet.password":                   "",
+			"l2.wallet.private-key":                "",
+			"node.batch-poster.extra-private-keys": []string{},
 		})
 		if err != nil {
 			return nil, nil, nil, nil, nil, err
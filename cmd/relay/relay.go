@@ -5,7 +5,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,6 +19,7 @@ import (
 	flag "github.com/spf13/pflag"
 
 	"github.com/tenderly/nitro/broadcastclient"
+	"github.com/tenderly/nitro/broadcaster"
 	"github.com/tenderly/nitro/cmd/genericconf"
 	"github.com/tenderly/nitro/relay"
 	"github.com/tenderly/nitro/wsbroadcastserver"
@@ -65,19 +68,26 @@ func startup() error {
 	log.Info("Running Arbitrum nitro relay", "revision", vcsRevision, "vcs.time", vcsTime)
 
 	serverConf := wsbroadcastserver.BroadcasterConfig{
-		Addr:          relayConfig.Node.Feed.Output.Addr,
-		IOTimeout:     relayConfig.Node.Feed.Output.IOTimeout,
-		Port:          relayConfig.Node.Feed.Output.Port,
-		Ping:          relayConfig.Node.Feed.Output.Ping,
-		ClientTimeout: relayConfig.Node.Feed.Output.ClientTimeout,
-		Queue:         relayConfig.Node.Feed.Output.Queue,
-		Workers:       relayConfig.Node.Feed.Output.Workers,
-		MaxSendQueue:  relayConfig.Node.Feed.Output.MaxSendQueue,
+		Addr:              relayConfig.Node.Feed.Output.Addr,
+		IOTimeout:         relayConfig.Node.Feed.Output.IOTimeout,
+		Port:              relayConfig.Node.Feed.Output.Port,
+		Ping:              relayConfig.Node.Feed.Output.Ping,
+		ClientTimeout:     relayConfig.Node.Feed.Output.ClientTimeout,
+		Queue:             relayConfig.Node.Feed.Output.Queue,
+		Workers:           relayConfig.Node.Feed.Output.Workers,
+		MaxSendQueue:      relayConfig.Node.Feed.Output.MaxSendQueue,
+		EnableCompression: relayConfig.Node.Feed.Output.EnableCompression,
+		EnableFilters:     relayConfig.Node.Feed.Output.EnableFilters,
+		EnableBinary:      relayConfig.Node.Feed.Output.EnableBinary,
+		ConnectionLimits:  relayConfig.Node.Feed.Output.ConnectionLimits,
 	}
 
 	clientConf := broadcastclient.BroadcastClientConfig{
-		Timeout: relayConfig.Node.Feed.Input.Timeout,
-		URLs:    relayConfig.Node.Feed.Input.URLs,
+		Timeout:           relayConfig.Node.Feed.Input.Timeout,
+		URLs:              relayConfig.Node.Feed.Input.URLs,
+		EnableCompression: relayConfig.Node.Feed.Input.EnableCompression,
+		EnableBinary:      relayConfig.Node.Feed.Input.EnableBinary,
+		Verify:            relayConfig.Node.Feed.Input.Verify,
 	}
 
 	defer log.Info("Cleanly shutting down relay")
@@ -85,8 +95,18 @@ func startup() error {
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 
+	var chainId *big.Int
+	if relayConfig.L2.ChainID != 0 {
+		chainId = new(big.Int).SetUint64(relayConfig.L2.ChainID)
+	} else if serverConf.EnableFilters {
+		return errors.New("filtered subscriptions need --l2.chain-id to decode transactions")
+	}
+
 	// Start up an arbitrum sequencer relay
-	newRelay := relay.NewRelay(serverConf, clientConf)
+	newRelay, err := relay.NewRelay(serverConf, clientConf, relayConfig.Node.Backlog, relayConfig.Node.Tree, chainId)
+	if err != nil {
+		return err
+	}
 	err = newRelay.Start(ctx)
 	if err != nil {
 		return err
@@ -100,6 +120,7 @@ type RelayConfig struct {
 	Conf     genericconf.ConfConfig `koanf:"conf"`
 	LogLevel int                    `koanf:"log-level"`
 	LogType  string                 `koanf:"log-type"`
+	L2       RelayL2Config          `koanf:"l2"`
 	Node     RelayNodeConfig        `koanf:"node"`
 }
 
@@ -107,6 +128,7 @@ var RelayConfigDefault = RelayConfig{
 	Conf:     genericconf.ConfConfigDefault,
 	LogLevel: int(log.LvlInfo),
 	LogType:  "plaintext",
+	L2:       RelayL2ConfigDefault,
 	Node:     RelayNodeConfigDefault,
 }
 
@@ -114,19 +136,38 @@ func RelayConfigAddOptions(f *flag.FlagSet) {
 	genericconf.ConfConfigAddOptions("conf", f)
 	f.Int("log-level", RelayConfigDefault.LogLevel, "log level")
 	f.String("log-type", RelayConfigDefault.LogType, "log type")
+	RelayL2ConfigAddOptions("l2", f)
 	RelayNodeConfigAddOptions("node", f)
 }
 
+type RelayL2Config struct {
+	ChainID uint64 `koanf:"chain-id"`
+}
+
+var RelayL2ConfigDefault = RelayL2Config{
+	ChainID: 0,
+}
+
+func RelayL2ConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Uint64(prefix+".chain-id", RelayL2ConfigDefault.ChainID, "L2 chain ID, needed to decode transactions for filtered subscriptions")
+}
+
 type RelayNodeConfig struct {
-	Feed broadcastclient.FeedConfig `koanf:"feed"`
+	Feed    broadcastclient.FeedConfig `koanf:"feed"`
+	Backlog broadcaster.BacklogConfig  `koanf:"backlog"`
+	Tree    relay.TreeConfig           `koanf:"tree"`
 }
 
 var RelayNodeConfigDefault = RelayNodeConfig{
-	Feed: broadcastclient.FeedConfigDefault,
+	Feed:    broadcastclient.FeedConfigDefault,
+	Backlog: broadcaster.DefaultBacklogConfig,
+	Tree:    relay.DefaultTreeConfig,
 }
 
 func RelayNodeConfigAddOptions(prefix string, f *flag.FlagSet) {
 	broadcastclient.FeedConfigAddOptions(prefix+".feed", f, true, true)
+	broadcaster.BacklogConfigAddOptions(prefix+".backlog", f)
+	relay.TreeConfigAddOptions(prefix+".tree", f)
 }
 
 func ParseRelay(_ context.Context, args []string) (*RelayConfig, error) {
@@ -47,7 +47,10 @@ func (c WavmChainContext) GetHeader(hash common.Hash, num uint64) *types.Header
 	return header
 }
 
-type WavmInbox struct{}
+type WavmInbox struct {
+	lastBlockHeader *types.Header
+	genesisBlockNum uint64
+}
 
 func (i WavmInbox) PeekSequencerInbox() ([]byte, error) {
 	pos := wavmio.GetInboxPosition()
@@ -83,6 +86,24 @@ func (i WavmInbox) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
 	return wavmio.ReadDelayedInboxMessage(seqNum), nil
 }
 
+// GetBatchArbOSVersion walks back from the last block over the messages already read from the current batch
+func (i WavmInbox) GetBatchArbOSVersion() (uint64, error) {
+	header := i.lastBlockHeader
+	for pos := wavmio.GetPositionWithinMessage(); pos > 0; pos-- {
+		if header == nil || header.Number.Uint64() <= i.genesisBlockNum {
+			// the batch starts the chain
+			return 0, nil
+		}
+		header = getBlockHeaderByHash(header.ParentHash)
+	}
+	if header == nil {
+		return 0, nil
+	}
+	version := types.DeserializeHeaderExtraInformation(header).ArbOSFormatVersion
+	log.Info("GetBatchArbOSVersion", "version", version)
+	return version, nil
+}
+
 type PreimageDASReader struct {
 }
 
@@ -122,7 +143,7 @@ func main() {
 		panic(fmt.Sprintf("Error opening state db: %v", err.Error()))
 	}
 
-	readMessage := func(dasEnabled bool) *arbstate.MessageWithMetadata {
+	readMessage := func(dasEnabled bool, genesisBlockNum uint64) *arbstate.MessageWithMetadata {
 		var delayedMessagesRead uint64
 		if lastBlockHeader != nil {
 			delayedMessagesRead = lastBlockHeader.Nonce.Uint64()
@@ -131,7 +152,7 @@ func main() {
 		if dasEnabled {
 			dasReader = &PreimageDASReader{}
 		}
-		inboxMultiplexer := arbstate.NewInboxMultiplexer(WavmInbox{}, delayedMessagesRead, dasReader)
+		inboxMultiplexer := arbstate.NewInboxMultiplexer(WavmInbox{lastBlockHeader, genesisBlockNum}, delayedMessagesRead, dasReader)
 		ctx := context.Background()
 		message, err := inboxMultiplexer.Pop(ctx)
 		if err != nil {
@@ -163,7 +184,7 @@ func main() {
 			panic(err)
 		}
 
-		message := readMessage(chainConfig.ArbitrumChainParams.DataAvailabilityCommittee)
+		message := readMessage(chainConfig.ArbitrumChainParams.DataAvailabilityCommittee, genesisBlockNum)
 
 		chainContext := WavmChainContext{}
 		batchFetcher := func(batchNum uint64) ([]byte, error) {
@@ -177,7 +198,7 @@ func main() {
 	} else {
 		// Initialize ArbOS with this init message and create the genesis block.
 
-		message := readMessage(false)
+		message := readMessage(false, 0)
 
 		chainId, err := message.Message.ParseInitMessage()
 		if err != nil {
@@ -27,16 +27,46 @@ import (
 )
 
 type AggregatorConfig struct {
-	Enable        bool   `koanf:"enable"`
-	AssumedHonest int    `koanf:"assumed-honest"`
-	Backends      string `koanf:"backends"`
-	DumpKeyset    bool   `koanf:"dump-keyset"`
+	Enable        bool                `koanf:"enable"`
+	AssumedHonest int                 `koanf:"assumed-honest"`
+	Backends      string              `koanf:"backends"`
+	DumpKeyset    bool                `koanf:"dump-keyset"`
+	ErasureCoding ErasureCodingConfig `koanf:"erasure-coding"`
 }
 
 var DefaultAggregatorConfig = AggregatorConfig{
 	AssumedHonest: 0,
 	Backends:      "",
 	DumpKeyset:    false,
+	ErasureCoding: DefaultErasureCodingConfig,
+}
+
+type ErasureCodingConfig struct {
+	Enable     bool `koanf:"enable"`
+	DataShards int  `koanf:"data-shards"`
+}
+
+var DefaultErasureCodingConfig = ErasureCodingConfig{
+	Enable:     false,
+	DataShards: 1,
+}
+
+func ErasureCodingConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultErasureCodingConfig.Enable, "store a Reed-Solomon shard of each batch on each backend, rather than the whole batch; this requires backends which support it, and batches are stored whole instead until ArbOS accepts erasure coded certificates")
+	f.Int(prefix+".data-shards", DefaultErasureCodingConfig.DataShards, "Number of shards (S) any of which are enough to reconstruct a batch, which can be at most the number of assumed honest backends (H). If there are N backends, N-H+S valid responses are required to consider a Store request to be successful.")
+}
+
+type storeWholeKey struct{}
+
+// WithStoreWhole marks the context of a Store request for a batch which must be stored whole on each backend,
+// even if erasure coding is enabled, such as one which may be read before ArbOS accepts erasure coded certificates
+func WithStoreWhole(ctx context.Context) context.Context {
+	return context.WithValue(ctx, storeWholeKey{}, true)
+}
+
+func storeWhole(ctx context.Context) bool {
+	whole, _ := ctx.Value(storeWholeKey{}).(bool)
+	return whole
 }
 
 func AggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -44,6 +74,7 @@ func AggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".assumed-honest", DefaultAggregatorConfig.AssumedHonest, "Number of assumed honest backends (H). If there are N backends, K=N+1-H valid responses are required to consider an Store request to be successful.")
 	f.String(prefix+".backends", DefaultAggregatorConfig.Backends, "JSON RPC backend configuration")
 	f.Bool(prefix+".dump-keyset", DefaultAggregatorConfig.DumpKeyset, "Dump the keyset encoded in hexadecimal for the backends string")
+	ErasureCodingConfigAddOptions(prefix+".erasure-coding", f)
 }
 
 type Aggregator struct {
@@ -56,6 +87,7 @@ type Aggregator struct {
 	keysetHash                     [32]byte
 	keysetBytes                    []byte
 	bpVerifier                     *BatchPosterVerifier
+	shardSigner                    DasSigner
 }
 
 type ServiceDetails struct {
@@ -128,6 +160,18 @@ func NewAggregatorWithSeqInboxCaller(
 		return nil, errors.New("At least two signers share a mask")
 	}
 
+	// Without erasure coding, each backend stores the whole batch, so it's enough for one honest backend to sign.
+	requiredHonestSigners := 1
+	if config.ErasureCoding.Enable {
+		if config.ErasureCoding.DataShards < 1 || config.ErasureCoding.DataShards > config.AssumedHonest {
+			return nil, fmt.Errorf("Erasure coding data shards must be between 1 and the %d assumed honest backends, was %d", config.AssumedHonest, config.ErasureCoding.DataShards)
+		}
+		if len(services) > maxShards {
+			return nil, fmt.Errorf("Erasure coding supports at most %d backends", maxShards)
+		}
+		requiredHonestSigners = config.ErasureCoding.DataShards
+	}
+
 	keyset := &arbstate.DataAvailabilityKeyset{
 		AssumedHonest: uint64(config.AssumedHonest),
 		PubKeys:       pubKeys,
@@ -154,14 +198,21 @@ func NewAggregatorWithSeqInboxCaller(
 	return &Aggregator{
 		config:                         config,
 		services:                       services,
-		requiredServicesForStore:       len(services) + 1 - config.AssumedHonest,
-		maxAllowedServiceStoreFailures: config.AssumedHonest - 1,
+		requiredServicesForStore:       len(services) + requiredHonestSigners - config.AssumedHonest,
+		maxAllowedServiceStoreFailures: config.AssumedHonest - requiredHonestSigners,
 		keysetHash:                     keysetHash,
 		keysetBytes:                    ksBuf.Bytes(),
 		bpVerifier:                     bpVerifier,
 	}, nil
 }
 
+// SetShardSigner sets the signer used to sign the shard manifests sent to backends when erasure coding
+// is enabled, which they check is the batch poster's. It must be set to store erasure coded batches,
+// as backends reject unsigned shards.
+func (a *Aggregator) SetShardSigner(signer DasSigner) {
+	a.shardSigner = signer
+}
+
 func (a *Aggregator) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
 	// Query all services, even those that didn't sign.
 	// They may have been late in returning a response after storing the data,
@@ -227,6 +278,10 @@ type storeResponse struct {
 // constructed, calls to Store(...) will try to verify the passed-in data's signature
 // is from the batch poster. If the contract details are not provided, then the
 // signature is not checked, which is useful for testing.
+//
+// If erasure coding is enabled, Store instead splits the message into a shard for each
+// backend and calls StoreShard on each with its shard, returning an erasure coded
+// certificate committing to the manifest of the shards, unless the context is from WithStoreWhole.
 func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
 	log.Trace("das.Aggregator.Store", "message", pretty.FirstFewBytes(message), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(sig))
 	if a.bpVerifier != nil {
@@ -243,44 +298,94 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64,
 		}
 	}
 
+	if a.config.ErasureCoding.Enable && !storeWhole(ctx) {
+		return a.storeShards(ctx, message, timeout)
+	}
+
 	responses := make(chan storeResponse, len(a.services))
 
-	expectedHash := dastree.Hash(message)
+	expectedCert := &arbstate.DataAvailabilityCertificate{
+		DataHash: dastree.Hash(message),
+		Timeout:  timeout,
+		Version:  1,
+	}
 	for _, d := range a.services {
 		go func(ctx context.Context, d ServiceDetails) {
 			cert, err := d.service.Store(ctx, message, timeout, sig)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
+			responses <- checkStoreResponse(d, cert, err, expectedCert)
+		}(ctx, d)
+	}
 
-			verified, err := blsSignatures.VerifySignature(
-				cert.Sig, cert.SerializeSignableFields(), d.pubKey,
-			)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
-			if !verified {
-				responses <- storeResponse{d, nil, errors.New("Signature verification failed.")}
-				return
-			}
+	return a.aggregateResponses(ctx, responses, expectedCert)
+}
 
-			// SignersMask from backend DAS is ignored.
+func (a *Aggregator) storeShards(ctx context.Context, message []byte, timeout uint64) (*arbstate.DataAvailabilityCertificate, error) {
+	manifest, shards, err := EncodeShards(message, a.config.ErasureCoding.DataShards, len(a.services))
+	if err != nil {
+		return nil, err
+	}
+	manifestBytes := manifest.Serialize()
+	if a.shardSigner == nil {
+		return nil, errors.New("can't store erasure coded batches without a signer for the shard manifests")
+	}
+	manifestSig, err := applyDasSigner(a.shardSigner, manifestBytes, timeout)
+	if err != nil {
+		return nil, err
+	}
 
-			if cert.DataHash != expectedHash {
-				responses <- storeResponse{d, nil, errors.New("Hash verification failed.")}
-				return
-			}
-			if cert.Timeout != timeout {
-				responses <- storeResponse{d, nil, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, timeout)}
-				return
-			}
+	responses := make(chan storeResponse, len(a.services))
 
-			responses <- storeResponse{d, cert.Sig, nil}
-		}(ctx, d)
+	expectedCert := &arbstate.DataAvailabilityCertificate{
+		DataHash:        manifest.DataHash,
+		Timeout:         timeout,
+		Version:         arbstate.ErasureCodedCertificateVersion,
+		ShardCommitment: dastree.Hash(manifestBytes),
+	}
+	for i, d := range a.services {
+		go func(ctx context.Context, d ServiceDetails, index uint64) {
+			cert, err := storeShard(ctx, d.service, expectedCert.DataHash, expectedCert.ShardCommitment, manifestBytes, index, shards[index], timeout, manifestSig)
+			responses <- checkStoreResponse(d, cert, err, expectedCert)
+		}(ctx, d, uint64(i))
+	}
+
+	return a.aggregateResponses(ctx, responses, expectedCert)
+}
+
+func checkStoreResponse(d ServiceDetails, cert *arbstate.DataAvailabilityCertificate, err error, expectedCert *arbstate.DataAvailabilityCertificate) storeResponse {
+	if err != nil {
+		return storeResponse{d, nil, err}
+	}
+
+	verified, err := blsSignatures.VerifySignature(
+		cert.Sig, cert.SerializeSignableFields(), d.pubKey,
+	)
+	if err != nil {
+		return storeResponse{d, nil, err}
+	}
+	if !verified {
+		return storeResponse{d, nil, errors.New("Signature verification failed.")}
 	}
 
+	// SignersMask from backend DAS is ignored.
+
+	if cert.DataHash != expectedCert.DataHash {
+		return storeResponse{d, nil, errors.New("Hash verification failed.")}
+	}
+	if cert.Timeout != expectedCert.Timeout {
+		return storeResponse{d, nil, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, expectedCert.Timeout)}
+	}
+	if expectedCert.Version == arbstate.ErasureCodedCertificateVersion {
+		if cert.Version != expectedCert.Version || cert.ShardCommitment != expectedCert.ShardCommitment {
+			return storeResponse{d, nil, errors.New("Shard commitment verification failed.")}
+		}
+	}
+
+	return storeResponse{d, cert.Sig, nil}
+}
+
+// aggregateResponses collects the backends' responses until enough have stored the data to aggregate their signatures
+// into a certificate with the expected signable fields, or until that's impossible.
+func (a *Aggregator) aggregateResponses(ctx context.Context, responses chan storeResponse, expectedCert *arbstate.DataAvailabilityCertificate) (*arbstate.DataAvailabilityCertificate, error) {
 	var pubKeys []blsSignatures.PublicKey
 	var sigs []blsSignatures.Signature
 	var aggCert arbstate.DataAvailabilityCertificate
@@ -312,10 +417,11 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64,
 	aggCert.Sig = blsSignatures.AggregateSignatures(sigs)
 	aggPubKey := blsSignatures.AggregatePublicKeys(pubKeys)
 	aggCert.SignersMask = aggSignersMask
-	aggCert.DataHash = expectedHash
-	aggCert.Timeout = timeout
+	aggCert.DataHash = expectedCert.DataHash
+	aggCert.Timeout = expectedCert.Timeout
 	aggCert.KeysetHash = a.keysetHash
-	aggCert.Version = 1
+	aggCert.Version = expectedCert.Version
+	aggCert.ShardCommitment = expectedCert.ShardCommitment
 
 	verified, err := blsSignatures.VerifySignature(aggCert.Sig, aggCert.SerializeSignableFields(), aggPubKey)
 	if err != nil {
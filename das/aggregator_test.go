@@ -16,8 +16,10 @@ import (
 	"time"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
 	"github.com/tenderly/nitro/go-ethereum/log"
 	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/das/dastree"
 )
 
 func TestDAS_BasicAggregationLocal(t *testing.T) {
@@ -70,6 +72,179 @@ func TestDAS_BasicAggregationLocal(t *testing.T) {
 	}
 }
 
+// testBatchPosterVerifier accepts the given address as the batch poster without a sequencer inbox
+func testBatchPosterVerifier(batchPoster common.Address) *BatchPosterVerifier {
+	return &BatchPosterVerifier{
+		cache:       map[common.Address]bool{batchPoster: true},
+		cacheExpiry: time.Now().Add(time.Hour),
+	}
+}
+
+func TestDAS_ErasureCodedAggregationLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batchPosterKey, err := crypto.GenerateKey()
+	Require(t, err)
+	batchPoster := crypto.PubkeyToAddress(batchPosterKey.PublicKey)
+
+	numBackendDAS := 10
+	var backends []ServiceDetails
+	var members []*SignAfterStoreDAS
+	for i := 0; i < numBackendDAS; i++ {
+		dbPath := t.TempDir()
+		_, _, err := GenerateAndStoreKeys(dbPath)
+		Require(t, err)
+
+		config := DataAvailabilityConfig{
+			Enable: true,
+			KeyConfig: KeyConfig{
+				KeyDir: dbPath,
+			},
+			LocalFileStorageConfig: LocalFileStorageConfig{
+				Enable:  true,
+				DataDir: dbPath,
+			},
+			L1NodeURL: "none",
+		}
+
+		storageService, lifecycleManager, err := CreatePersistentStorageService(ctx, &config)
+		Require(t, err)
+		defer lifecycleManager.StopAndWaitUntil(time.Second)
+		das, err := NewSignAfterStoreDAS(ctx, config, storageService)
+		Require(t, err)
+		das.bpVerifier = testBatchPosterVerifier(batchPoster)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		details, err := NewServiceDetails(das, *pubKey, uint64(1<<i))
+		Require(t, err)
+		backends = append(backends, *details)
+		members = append(members, das)
+	}
+
+	dataShards := 3
+	aggregatorConfig := AggregatorConfig{
+		AssumedHonest: 6,
+		ErasureCoding: ErasureCodingConfig{Enable: true, DataShards: dataShards},
+	}
+	aggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggregatorConfig, L1NodeURL: "none"}, backends)
+	Require(t, err)
+
+	// large enough to span several dastree bins
+	rawMsg := make([]byte, 200000)
+	rand.Read(rawMsg)
+	if _, err := aggregator.Store(ctx, rawMsg, 0, []byte{}); err == nil {
+		Fail(t, "Stored erasure coded shards without signing the manifest")
+	}
+	aggregator.SetShardSigner(DasSignerFromPrivateKey(batchPosterKey))
+	cert, err := aggregator.Store(ctx, rawMsg, 0, []byte{})
+	Require(t, err, "Error storing message")
+	if cert.Version != arbstate.ErasureCodedCertificateVersion || cert.DataHash != dastree.Hash(rawMsg) {
+		Fail(t, "Unexpected certificate", cert)
+	}
+	// messages which may be read before ArbOS accepts erasure coded certificates can still be stored whole
+	wholeMsg := rawMsg[:1000]
+	wholeSig, err := applyDasSigner(DasSignerFromPrivateKey(batchPosterKey), wholeMsg, 0)
+	Require(t, err)
+	wholeCert, err := aggregator.Store(WithStoreWhole(ctx), wholeMsg, 0, wholeSig)
+	Require(t, err, "Error storing whole message")
+	if wholeCert.Version != 1 || wholeCert.DataHash != dastree.Hash(wholeMsg) {
+		Fail(t, "Unexpected certificate for whole message", wholeCert)
+	}
+
+	keyset, err := arbstate.DeserializeKeyset(bytes.NewReader(aggregator.keysetBytes))
+	Require(t, err)
+	deserialized, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(Serialize(cert)))
+	Require(t, err)
+	if !bytes.Equal(Serialize(deserialized), Serialize(cert)) {
+		Fail(t, "Certificate didn't survive serialization", deserialized, cert)
+	}
+	Require(t, keyset.VerifySignature(deserialized.SignersMask, deserialized.SerializeSignableFields(), deserialized.Sig))
+
+	if _, err := aggregator.GetByHash(ctx, cert.DataHash); err == nil {
+		Fail(t, "A backend stored the whole message")
+	}
+	messageRetrieved, err := NewShardReconstructingDAS(aggregator).GetByShards(ctx, cert.DataHash, cert.ShardCommitment)
+	Require(t, err, "Failed to reconstruct message")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Reconstructed message is not the same as stored one.")
+	}
+
+	// Only the backends which signed are known to have finished storing their shards,
+	// so reconstruct from just enough of those, including some holding parity shards.
+	var signers []ServiceDetails
+	for i := numBackendDAS - 1; i >= 0 && len(signers) < dataShards; i-- {
+		if cert.SignersMask&backends[i].signersMask != 0 {
+			signers = append(signers, backends[i])
+		}
+	}
+	partialAggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: AggregatorConfig{AssumedHonest: 1}, L1NodeURL: "none"}, signers)
+	Require(t, err)
+	messageRetrieved, err = ReconstructFromShards(ctx, partialAggregator, cert.DataHash, cert.ShardCommitment)
+	Require(t, err, "Failed to reconstruct message from", dataShards, "shards")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Reconstructed message is not the same as stored one.")
+	}
+
+	tooFewAggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: AggregatorConfig{AssumedHonest: 1}, L1NodeURL: "none"}, signers[:dataShards-1])
+	Require(t, err)
+	if _, err := ReconstructFromShards(ctx, tooFewAggregator, cert.DataHash, cert.ShardCommitment); err == nil {
+		Fail(t, "Reconstructed message from too few shards")
+	}
+
+	// members only sign shards matching the certificate, in requests from the batch poster
+	manifest, shards, err := EncodeShards(rawMsg, dataShards, numBackendDAS)
+	Require(t, err)
+	manifestBytes := manifest.Serialize()
+	manifestSig, err := applyDasSigner(DasSignerFromPrivateKey(batchPosterKey), manifestBytes, 0)
+	Require(t, err)
+	member := members[1]
+	_, err = member.StoreShard(ctx, manifest.DataHash, manifest.Commitment(), manifestBytes, 1, shards[1], 0, manifestSig)
+	Require(t, err)
+	otherKey, err := crypto.GenerateKey()
+	Require(t, err)
+	otherSig, err := applyDasSigner(DasSignerFromPrivateKey(otherKey), manifestBytes, 0)
+	Require(t, err)
+	badRequests := map[string]func() error{
+		"unsigned manifest": func() error {
+			_, err := member.StoreShard(ctx, manifest.DataHash, manifest.Commitment(), manifestBytes, 1, shards[1], 0, []byte{})
+			return err
+		},
+		"manifest not signed by the batch poster": func() error {
+			_, err := member.StoreShard(ctx, manifest.DataHash, manifest.Commitment(), manifestBytes, 1, shards[1], 0, otherSig)
+			return err
+		},
+		"wrong shard commitment": func() error {
+			_, err := member.StoreShard(ctx, manifest.DataHash, dastree.Hash([]byte{}), manifestBytes, 1, shards[1], 0, manifestSig)
+			return err
+		},
+		"wrong batch hash": func() error {
+			_, err := member.StoreShard(ctx, dastree.Hash([]byte{}), manifest.Commitment(), manifestBytes, 1, shards[1], 0, manifestSig)
+			return err
+		},
+		"wrong shard": func() error {
+			_, err := member.StoreShard(ctx, manifest.DataHash, manifest.Commitment(), manifestBytes, 1, shards[2], 0, manifestSig)
+			return err
+		},
+		"no batch poster verifier": func() error {
+			unverified := *member
+			unverified.bpVerifier = nil
+			_, err := unverified.StoreShard(ctx, manifest.DataHash, manifest.Commitment(), manifestBytes, 1, shards[1], 0, manifestSig)
+			return err
+		},
+	}
+	for name, request := range badRequests {
+		if request() == nil {
+			Fail(t, "Member accepted a bad shard request:", name)
+		}
+	}
+
+	aggregatorConfig.ErasureCoding.DataShards = aggregatorConfig.AssumedHonest + 1
+	if _, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggregatorConfig, L1NodeURL: "none"}, backends); err == nil {
+		Fail(t, "Allowed more data shards than assumed honest backends")
+	}
+}
+
 type failureType int
 
 const (
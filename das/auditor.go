@@ -0,0 +1,497 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/blsSignatures"
+	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/go-ethereum"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/metrics"
+	"github.com/tenderly/nitro/solgen/go/bridgegen"
+	"github.com/tenderly/nitro/util/stopwaiter"
+)
+
+var (
+	auditorBatchesCounter        = metrics.NewRegisteredCounter("arb/das/auditor/batches", nil)
+	auditorSampledCounter        = metrics.NewRegisteredCounter("arb/das/auditor/sampled", nil)
+	auditorUnknownSignersCounter = metrics.NewRegisteredCounter("arb/das/auditor/unknownsigners", nil)
+	auditorBlockGauge            = metrics.NewRegisteredGauge("arb/das/auditor/block", nil)
+)
+
+type AuditorConfig struct {
+	Members         string        `koanf:"members"`
+	StartBlock      uint64        `koanf:"start-block"`
+	L1BlocksPerRead uint64        `koanf:"l1-blocks-per-read"`
+	L1Confirmations uint64        `koanf:"l1-confirmations"`
+	PollInterval    time.Duration `koanf:"poll-interval"`
+	SampleRate      float64       `koanf:"sample-rate"`
+	RequestTimeout  time.Duration `koanf:"request-timeout"`
+	HistoryPeriod   time.Duration `koanf:"history-period"`
+	HistoryPeriods  int           `koanf:"history-periods"`
+	MaxFlagged      int           `koanf:"max-flagged"`
+}
+
+var DefaultAuditorConfig = AuditorConfig{
+	Members:         "",
+	StartBlock:      0,
+	L1BlocksPerRead: 100,
+	L1Confirmations: 12,
+	PollInterval:    time.Minute,
+	SampleRate:      0.1,
+	RequestTimeout:  10 * time.Second,
+	HistoryPeriod:   time.Hour,
+	HistoryPeriods:  24 * 7,
+	MaxFlagged:      1000,
+}
+
+func AuditorConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.String(prefix+".members", DefaultAuditorConfig.Members, "JSON list of the committee members to audit, each with the url of its REST endpoint and its base64 BLS pubkey")
+	f.Uint64(prefix+".start-block", DefaultAuditorConfig.StartBlock, "L1 block to start auditing batches from")
+	f.Uint64(prefix+".l1-blocks-per-read", DefaultAuditorConfig.L1BlocksPerRead, "max L1 blocks to read per poll")
+	f.Uint64(prefix+".l1-confirmations", DefaultAuditorConfig.L1Confirmations, "how many blocks behind the L1 head to audit batches")
+	f.Duration(prefix+".poll-interval", DefaultAuditorConfig.PollInterval, "how often to poll L1 for new batches once caught up")
+	f.Float64(prefix+".sample-rate", DefaultAuditorConfig.SampleRate, "fraction of batches to fetch from their signers")
+	f.Duration(prefix+".request-timeout", DefaultAuditorConfig.RequestTimeout, "timeout of each fetch from a member")
+	f.Duration(prefix+".history-period", DefaultAuditorConfig.HistoryPeriod, "period of each entry in a member's availability history")
+	f.Int(prefix+".history-periods", DefaultAuditorConfig.HistoryPeriods, "how many periods of availability history to keep")
+	f.Int(prefix+".max-flagged", DefaultAuditorConfig.MaxFlagged, "how many of the most recent failures to serve signed data to keep in the report")
+}
+
+func (c *AuditorConfig) Validate() error {
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		return fmt.Errorf("invalid auditor sample rate %v, it must be in (0, 1]", c.SampleRate)
+	}
+	if c.L1BlocksPerRead == 0 {
+		return errors.New("auditor l1-blocks-per-read must be positive")
+	}
+	if c.HistoryPeriod <= 0 || c.HistoryPeriods <= 0 {
+		return errors.New("auditor history-period and history-periods must be positive")
+	}
+	return nil
+}
+
+type AuditedMemberConfig struct {
+	URL                 string `json:"url"`
+	PubKeyBase64Encoded string `json:"pubkey"`
+}
+
+type AvailabilityCounts struct {
+	Checked     uint64 `json:"checked"`
+	Available   uint64 `json:"available"`
+	Unavailable uint64 `json:"unavailable"`
+}
+
+type AvailabilityPeriod struct {
+	Start time.Time `json:"start"`
+	AvailabilityCounts
+}
+
+type MemberAvailability struct {
+	URL    string `json:"url"`
+	PubKey string `json:"pubkey"`
+	AvailabilityCounts
+	History []AvailabilityPeriod `json:"history"`
+}
+
+// FlaggedUnavailability records a member failing to serve data it signed a certificate for
+type FlaggedUnavailability struct {
+	Time                time.Time   `json:"time"`
+	URL                 string      `json:"url"`
+	BatchSequenceNumber uint64      `json:"batchSequenceNumber"`
+	L1Block             uint64      `json:"l1Block"`
+	Key                 common.Hash `json:"key"`
+	Error               string      `json:"error"`
+}
+
+type AuditReport struct {
+	GeneratedAt    time.Time               `json:"generatedAt"`
+	NextBlock      uint64                  `json:"nextBlock"`
+	Batches        uint64                  `json:"batches"`
+	Sampled        uint64                  `json:"sampled"`
+	UnknownSigners uint64                  `json:"unknownSigners"`
+	Members        []MemberAvailability    `json:"members"`
+	Flagged        []FlaggedUnavailability `json:"flagged"`
+}
+
+type auditedMember struct {
+	client             *RestfulDasClient
+	availability       MemberAvailability
+	checkedCounter     metrics.Counter
+	availableCounter   metrics.Counter
+	unavailableCounter metrics.Counter
+}
+
+func newAuditedMember(index int, config AuditedMemberConfig) (*auditedMember, error) {
+	client, err := NewRestfulDasClientFromURL(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("arb/das/auditor/member/%d/", index)
+	return &auditedMember{
+		client: client,
+		availability: MemberAvailability{
+			URL:     config.URL,
+			PubKey:  config.PubKeyBase64Encoded,
+			History: []AvailabilityPeriod{},
+		},
+		checkedCounter:     metrics.GetOrRegisterCounter(prefix+"checked", nil),
+		availableCounter:   metrics.GetOrRegisterCounter(prefix+"available", nil),
+		unavailableCounter: metrics.GetOrRegisterCounter(prefix+"unavailable", nil),
+	}, nil
+}
+
+// Auditor walks the batches posted to L1, and checks that a sample of them can be fetched from the REST endpoint
+// of each committee member which signed their certificate, flagging the members which can't serve what they signed.
+type Auditor struct {
+	stopwaiter.StopWaiter
+	config        AuditorConfig
+	l1Client      arbutil.L1Interface
+	inboxContract *bridgegen.SequencerInbox
+	inboxAddr     common.Address
+	keysetReader  arbstate.DataAvailabilityReader
+	members       map[string]*auditedMember // by serialized public key
+
+	// these are only used by the auditing thread
+	lastBlock     uint64
+	lastLogIndex  uint
+	resumeWithLog bool
+
+	mutex          sync.Mutex // guards the report, and nextBlock as the auditing thread updates it
+	nextBlock      uint64
+	memberList     []*auditedMember
+	batches        uint64
+	sampled        uint64
+	unknownSigners uint64
+	flagged        []FlaggedUnavailability
+}
+
+func NewAuditor(config AuditorConfig, l1Client arbutil.L1Interface, inboxAddr common.Address) (*Auditor, error) {
+	inboxContract, err := bridgegen.NewSequencerInbox(inboxAddr, l1Client)
+	if err != nil {
+		return nil, err
+	}
+	// keysets are fetched from the L1 events which set them
+	keysetReader, err := NewChainFetchReader(NewEmptyStorageService(), l1Client, inboxAddr)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newAuditor(config)
+	if err != nil {
+		return nil, err
+	}
+	a.l1Client = l1Client
+	a.inboxContract = inboxContract
+	a.inboxAddr = inboxAddr
+	a.keysetReader = keysetReader
+	return a, nil
+}
+
+func newAuditor(config AuditorConfig) (*Auditor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var memberConfigs []AuditedMemberConfig
+	if err := json.Unmarshal([]byte(config.Members), &memberConfigs); err != nil {
+		return nil, fmt.Errorf("invalid auditor members: %w", err)
+	}
+	if len(memberConfigs) == 0 {
+		return nil, errors.New("no committee members to audit")
+	}
+	a := &Auditor{
+		config:    config,
+		members:   make(map[string]*auditedMember),
+		nextBlock: config.StartBlock,
+		flagged:   []FlaggedUnavailability{},
+	}
+	for i, memberConfig := range memberConfigs {
+		pubKey, err := DecodeBase64BLSPublicKey([]byte(memberConfig.PubKeyBase64Encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pubkey of auditor member %d: %w", i, err)
+		}
+		member, err := newAuditedMember(i, memberConfig)
+		if err != nil {
+			return nil, err
+		}
+		a.members[string(blsSignatures.PublicKeyToBytes(*pubKey))] = member
+		a.memberList = append(a.memberList, member)
+	}
+	return a, nil
+}
+
+func (a *Auditor) Start(ctx context.Context) {
+	a.StopWaiter.Start(ctx)
+	a.CallIteratively(func(ctx context.Context) time.Duration {
+		caughtUp, err := a.auditMore(ctx)
+		if err != nil {
+			log.Warn("error auditing data availability", "err", err)
+			return a.config.PollInterval
+		}
+		if caughtUp {
+			return a.config.PollInterval
+		}
+		return 0
+	})
+}
+
+// auditMore audits the batches in the next range of confirmed L1 blocks, returning whether it's caught up
+func (a *Auditor) auditMore(ctx context.Context) (bool, error) {
+	header, err := a.l1Client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	head := header.Number.Uint64()
+	if head < a.config.L1Confirmations || head-a.config.L1Confirmations < a.nextBlock {
+		return true, nil
+	}
+	confirmed := head - a.config.L1Confirmations
+	toBlock := confirmed
+	if toBlock-a.nextBlock >= a.config.L1BlocksPerRead {
+		toBlock = a.nextBlock + a.config.L1BlocksPerRead - 1
+	}
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(a.nextBlock),
+		ToBlock:   new(big.Int).SetUint64(toBlock),
+		Addresses: []common.Address{a.inboxAddr},
+		Topics:    [][]common.Hash{{batchDeliveredID}},
+	}
+	logs, err := a.l1Client.FilterLogs(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	for _, deliveredLog := range logs {
+		// skip the batches already audited before an error made this range be read again
+		if a.resumeWithLog && (deliveredLog.BlockNumber < a.lastBlock || (deliveredLog.BlockNumber == a.lastBlock && deliveredLog.Index <= a.lastLogIndex)) {
+			continue
+		}
+		if err := a.auditBatch(ctx, deliveredLog); err != nil {
+			return false, err
+		}
+		a.lastBlock = deliveredLog.BlockNumber
+		a.lastLogIndex = deliveredLog.Index
+		a.resumeWithLog = true
+	}
+	a.mutex.Lock()
+	a.nextBlock = toBlock + 1
+	a.mutex.Unlock()
+	a.resumeWithLog = false
+	auditorBlockGauge.Update(int64(toBlock))
+	return toBlock == confirmed, nil
+}
+
+func (a *Auditor) auditBatch(ctx context.Context, deliveredLog types.Log) error {
+	deliveredEvent, err := a.inboxContract.ParseSequencerBatchDelivered(deliveredLog)
+	if err != nil {
+		return err
+	}
+	data, err := readBatchData(ctx, a.l1Client, a.inboxContract, a.inboxAddr, deliveredLog, deliveredEvent)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || !arbstate.IsDASMessageHeaderByte(data[0]) {
+		return nil
+	}
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(data))
+	if err != nil {
+		log.Warn("couldn't deserialize the certificate of a batch", "batch", deliveredEvent.BatchSequenceNumber, "err", err)
+		return nil
+	}
+	// members may discard data once it has expired
+	if cert.Timeout <= uint64(time.Now().Unix()) || rand.Float64() >= a.config.SampleRate {
+		a.countBatch()
+		return nil
+	}
+	keysetBytes, err := a.keysetReader.GetByHash(ctx, cert.KeysetHash)
+	if err != nil {
+		return fmt.Errorf("couldn't get keyset %v: %w", cert.KeysetHash, err)
+	}
+	keyset, err := arbstate.DeserializeKeyset(bytes.NewReader(keysetBytes))
+	if err != nil {
+		return err
+	}
+	a.countBatch()
+	a.auditCertificate(ctx, deliveredEvent.BatchSequenceNumber.Uint64(), deliveredLog.BlockNumber, cert, keyset)
+	return nil
+}
+
+func (a *Auditor) countBatch() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.batches++
+	auditorBatchesCounter.Inc(1)
+}
+
+type memberCheck struct {
+	member *auditedMember
+	err    error
+}
+
+// auditCertificate fetches the data a certificate is for from each member which signed it
+func (a *Auditor) auditCertificate(ctx context.Context, batch uint64, l1Block uint64, cert *arbstate.DataAvailabilityCertificate, keyset *arbstate.DataAvailabilityKeyset) {
+	// members storing an erasure coded batch hold the manifest of its shards and their own shard
+	key := cert.DataHash
+	if cert.Version == arbstate.ErasureCodedCertificateVersion {
+		key = cert.ShardCommitment
+	}
+	fetch := func(ctx context.Context, member *auditedMember, index int) error {
+		ctx, cancel := context.WithTimeout(ctx, a.config.RequestTimeout)
+		defer cancel()
+		if cert.Version == arbstate.ErasureCodedCertificateVersion {
+			return fetchShard(ctx, member.client, cert, index)
+		}
+		if cert.Version == 0 {
+			_, err := member.client.GetByHash(ctx, dastree.FlatHashToTreeHash(key))
+			if err == nil {
+				return nil
+			}
+		}
+		_, err := member.client.GetByHash(ctx, key)
+		return err
+	}
+
+	results := make(chan memberCheck, len(keyset.PubKeys))
+	checks := 0
+	unknownSigners := uint64(0)
+	for i, pubKey := range keyset.PubKeys {
+		if i >= 64 || cert.SignersMask&(1<<uint(i)) == 0 {
+			continue
+		}
+		member, ok := a.members[string(blsSignatures.PublicKeyToBytes(pubKey))]
+		if !ok {
+			unknownSigners++
+			continue
+		}
+		checks++
+		go func(index int) {
+			results <- memberCheck{member, fetch(ctx, member, index)}
+		}(i)
+	}
+	auditorSampledCounter.Inc(1)
+	auditorUnknownSignersCounter.Inc(int64(unknownSigners))
+	checked := make([]memberCheck, 0, checks)
+	for ; checks > 0; checks-- {
+		checked = append(checked, <-results)
+	}
+
+	now := time.Now()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.sampled++
+	a.unknownSigners += unknownSigners
+	for _, result := range checked {
+		a.record(now, result.member, result.err == nil)
+		if result.err != nil {
+			log.Warn("committee member couldn't serve data it signed for", "url", result.member.availability.URL, "batch", batch, "key", key, "err", result.err)
+			a.flagged = append(a.flagged, FlaggedUnavailability{
+				Time:                now,
+				URL:                 result.member.availability.URL,
+				BatchSequenceNumber: batch,
+				L1Block:             l1Block,
+				Key:                 key,
+				Error:               result.err.Error(),
+			})
+			if len(a.flagged) > a.config.MaxFlagged {
+				a.flagged = a.flagged[len(a.flagged)-a.config.MaxFlagged:]
+			}
+		}
+	}
+}
+
+// fetchShard checks a member which signed an erasure coded certificate serves the manifest it commits to,
+// and its own shard, which is the one at its index in the keyset, as the aggregator gives each member that shard
+func fetchShard(ctx context.Context, client *RestfulDasClient, cert *arbstate.DataAvailabilityCertificate, index int) error {
+	manifestBytes, err := client.GetByHash(ctx, cert.ShardCommitment)
+	if err != nil {
+		return fmt.Errorf("couldn't get shard manifest: %w", err)
+	}
+	if dastree.Hash(manifestBytes) != cert.ShardCommitment {
+		return fmt.Errorf("shard manifest %w", arbstate.ErrHashMismatch)
+	}
+	manifest, err := DeserializeShardManifest(manifestBytes)
+	if err != nil {
+		return err
+	}
+	if manifest.DataHash != cert.DataHash {
+		return fmt.Errorf("shard manifest is for batch %v rather than %v", manifest.DataHash, common.Hash(cert.DataHash))
+	}
+	if index >= len(manifest.ShardHashes) {
+		return fmt.Errorf("no shard %d in a manifest of %d shards", index, len(manifest.ShardHashes))
+	}
+	shard, err := client.GetByHash(ctx, manifest.ShardHashes[index])
+	if err != nil {
+		return fmt.Errorf("couldn't get shard %d: %w", index, err)
+	}
+	if dastree.Hash(shard) != manifest.ShardHashes[index] || uint64(len(shard)) != manifest.ShardSize() {
+		return fmt.Errorf("shard %d %w", index, arbstate.ErrHashMismatch)
+	}
+	return nil
+}
+
+// record must be called with the mutex held
+func (a *Auditor) record(now time.Time, member *auditedMember, available bool) {
+	availability := &member.availability
+	periodStart := now.Truncate(a.config.HistoryPeriod)
+	if len(availability.History) == 0 || availability.History[len(availability.History)-1].Start != periodStart {
+		availability.History = append(availability.History, AvailabilityPeriod{Start: periodStart})
+		if len(availability.History) > a.config.HistoryPeriods {
+			availability.History = availability.History[len(availability.History)-a.config.HistoryPeriods:]
+		}
+	}
+	period := &availability.History[len(availability.History)-1].AvailabilityCounts
+	for _, counts := range []*AvailabilityCounts{&availability.AvailabilityCounts, period} {
+		counts.Checked++
+		if available {
+			counts.Available++
+		} else {
+			counts.Unavailable++
+		}
+	}
+	member.checkedCounter.Inc(1)
+	if available {
+		member.availableCounter.Inc(1)
+	} else {
+		member.unavailableCounter.Inc(1)
+	}
+}
+
+// Report returns a snapshot of each member's availability and the most recent failures to serve signed data
+func (a *Auditor) Report() AuditReport {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	report := AuditReport{
+		GeneratedAt:    time.Now(),
+		NextBlock:      a.nextBlock,
+		Batches:        a.batches,
+		Sampled:        a.sampled,
+		UnknownSigners: a.unknownSigners,
+		Members:        make([]MemberAvailability, 0, len(a.memberList)),
+		Flagged:        append([]FlaggedUnavailability{}, a.flagged...),
+	}
+	for _, member := range a.memberList {
+		availability := member.availability
+		availability.History = append([]AvailabilityPeriod{}, availability.History...)
+		report.Members = append(report.Members, availability)
+	}
+	return report
+}
+
+func (a *Auditor) String() string {
+	return fmt.Sprintf("Auditor(%v members)", len(a.memberList))
+}
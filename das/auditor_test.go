@@ -0,0 +1,119 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/blsSignatures"
+	"github.com/tenderly/nitro/das/dastree"
+)
+
+func TestAuditorFlagsUnavailableSigners(t *testing.T) {
+	initTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keyset := &arbstate.DataAvailabilityKeyset{AssumedHonest: 1}
+	var memberConfigs []AuditedMemberConfig
+	var storages []StorageService
+	for i := 0; i < 3; i++ {
+		pubKey, _, err := blsSignatures.GenerateKeys()
+		Require(t, err)
+		keyset.PubKeys = append(keyset.PubKeys, pubKey)
+		// the last signer isn't configured to be audited
+		if i == 2 {
+			continue
+		}
+		storage := NewMemoryBackedStorageService(ctx)
+		server, port, err := NewRestfulDasServerOnRandomPort(LocalServerAddressForTest, storage)
+		Require(t, err)
+		defer func() {
+			Require(t, server.Shutdown())
+		}()
+		storages = append(storages, storage)
+		memberConfigs = append(memberConfigs, AuditedMemberConfig{
+			URL:                 fmt.Sprintf("http://%s:%d", LocalServerAddressForTest, port),
+			PubKeyBase64Encoded: base64.StdEncoding.EncodeToString(blsSignatures.PublicKeyToBytes(pubKey)),
+		})
+	}
+	members, err := json.Marshal(memberConfigs)
+	Require(t, err)
+
+	config := DefaultAuditorConfig
+	config.Members = string(members)
+	config.SampleRate = 1
+	auditor, err := newAuditor(config)
+	Require(t, err)
+
+	data := []byte("data only stored by the first member")
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+	Require(t, storages[0].Put(ctx, data, timeout))
+	time.Sleep(100 * time.Millisecond)
+
+	cert := &arbstate.DataAvailabilityCertificate{
+		DataHash:    dastree.Hash(data),
+		Timeout:     timeout,
+		SignersMask: 0b111,
+		Version:     1,
+	}
+	auditor.auditCertificate(ctx, 7, 100, cert, keyset)
+
+	report := auditor.Report()
+	if report.Sampled != 1 || report.UnknownSigners != 1 {
+		Fail(t, "unexpected report", report)
+	}
+	available := report.Members[0]
+	if available.Checked != 1 || available.Available != 1 || len(available.History) != 1 || available.History[0].Available != 1 {
+		Fail(t, "unexpected availability of the member storing the data", available)
+	}
+	unavailable := report.Members[1]
+	if unavailable.Checked != 1 || unavailable.Unavailable != 1 {
+		Fail(t, "unexpected availability of the member not storing the data", unavailable)
+	}
+	if len(report.Flagged) != 1 || report.Flagged[0].URL != unavailable.URL || report.Flagged[0].BatchSequenceNumber != 7 || report.Flagged[0].Key != cert.DataHash {
+		Fail(t, "expected the member not storing the data to be flagged", report.Flagged)
+	}
+
+	// members which didn't sign aren't checked
+	cert.SignersMask = 0b001
+	auditor.auditCertificate(ctx, 8, 101, cert, keyset)
+	report = auditor.Report()
+	if report.Members[0].Checked != 2 || report.Members[1].Checked != 1 || len(report.Flagged) != 1 {
+		Fail(t, "unexpected report after auditing a certificate signed by one member", report)
+	}
+
+	// a member which signed an erasure coded certificate must serve the manifest and its own shard
+	manifest, shards, err := EncodeShards([]byte("erasure coded data"), 2, len(keyset.PubKeys))
+	Require(t, err)
+	manifestBytes := manifest.Serialize()
+	for _, storage := range storages {
+		Require(t, storage.Put(ctx, manifestBytes, timeout))
+		// the second member only holds the first member's shard
+		Require(t, storage.Put(ctx, shards[0], timeout))
+	}
+	time.Sleep(100 * time.Millisecond)
+	shardCert := &arbstate.DataAvailabilityCertificate{
+		DataHash:        manifest.DataHash,
+		Timeout:         timeout,
+		SignersMask:     0b011,
+		Version:         arbstate.ErasureCodedCertificateVersion,
+		ShardCommitment: manifest.Commitment(),
+	}
+	auditor.auditCertificate(ctx, 9, 102, shardCert, keyset)
+	report = auditor.Report()
+	if report.Members[0].Available != 3 || report.Members[1].Unavailable != 2 {
+		Fail(t, "unexpected report after auditing an erasure coded certificate", report)
+	}
+	if len(report.Flagged) != 2 || report.Flagged[1].URL != unavailable.URL || report.Flagged[1].Key != shardCert.ShardCommitment {
+		Fail(t, "expected the member not storing its shard to be flagged", report.Flagged)
+	}
+}
@@ -64,6 +64,17 @@ func (a *CacheStorageToDASAdapter) Store(
 	return cert, nil
 }
 
+func (a *CacheStorageToDASAdapter) StoreShard(
+	ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte,
+) (*arbstate.DataAvailabilityCertificate, error) {
+	return storeShard(ctx, a.DataAvailabilityService, dataHash, commitment, manifest, index, shard, timeout, sig)
+}
+
+// Keys lists the keys held by the inner service, of which the cache holds a subset
+func (a *CacheStorageToDASAdapter) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, a.DataAvailabilityService, since, expiringAfter)
+}
+
 func (a *CacheStorageToDASAdapter) String() string {
 	return fmt.Sprintf("CacheStorageToDASAdapter{inner: %v, cache: %v}", a.DataAvailabilityService, a.cache)
 }
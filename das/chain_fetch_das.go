@@ -86,6 +86,16 @@ func NewChainFetchReaderWithSeqInbox(inner arbstate.DataAvailabilityReader, seqI
 	}, nil
 }
 
+func (this *ChainFetchDAS) StoreShard(
+	ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte,
+) (*arbstate.DataAvailabilityCertificate, error) {
+	return storeShard(ctx, this.DataAvailabilityService, dataHash, commitment, manifest, index, shard, timeout, sig)
+}
+
+func (this *ChainFetchDAS) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, this.DataAvailabilityService, since, expiringAfter)
+}
+
 func (this *ChainFetchDAS) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
 	log.Trace("das.ChainFetchDAS.GetByHash", "hash", pretty.PrettyHash(hash))
 	return chainFetchGetByHash(ctx, this.DataAvailabilityService, &this.keysetCache, this.seqInboxCaller, this.seqInboxFilterer, hash)
@@ -42,6 +42,7 @@ type DataAvailabilityConfig struct {
 	LocalDBStorageConfig   LocalDBStorageConfig   `koanf:"local-db-storage"`
 	LocalFileStorageConfig LocalFileStorageConfig `koanf:"local-file-storage"`
 	S3StorageServiceConfig S3StorageServiceConfig `koanf:"s3-storage"`
+	RetentionConfig        RetentionConfig        `koanf:"retention"`
 
 	KeyConfig KeyConfig `koanf:"key"`
 
@@ -60,6 +61,7 @@ var DefaultDataAvailabilityConfig = DataAvailabilityConfig{
 	RequestTimeout:                5 * time.Second,
 	Enable:                        false,
 	RestfulClientAggregatorConfig: DefaultRestfulClientAggregatorConfig,
+	RetentionConfig:               DefaultRetentionConfig,
 	L1ConnectionAttempts:          15,
 	PanicOnError:                  false,
 }
@@ -93,6 +95,7 @@ func DataAvailabilityConfigAddOptions(prefix string, f *flag.FlagSet) {
 	LocalDBStorageConfigAddOptions(prefix+".local-db-storage", f)
 	LocalFileStorageConfigAddOptions(prefix+".local-file-storage", f)
 	S3ConfigAddOptions(prefix+".s3-storage", f)
+	RetentionConfigAddOptions(prefix+".retention", f)
 
 	// Key config for storage
 	KeyConfigAddOptions(prefix+".key", f)
@@ -55,17 +55,31 @@ func (c *DASRPCClient) Store(ctx context.Context, message []byte, timeout uint64
 	if err := c.clnt.CallContext(ctx, &ret, "das_store", hexutil.Bytes(message), hexutil.Uint64(timeout), hexutil.Bytes(reqSig)); err != nil {
 		return nil, err
 	}
+	return ret.certificate()
+}
+
+func (c *DASRPCClient) StoreShard(ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, reqSig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	log.Trace("das.DASRPCClient.StoreShard(...)", "dataHash", dataHash, "commitment", commitment, "manifest", pretty.FirstFewBytes(manifest), "index", index, "shard", pretty.FirstFewBytes(shard), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(reqSig), "this", *c)
+	var ret StoreResult
+	if err := c.clnt.CallContext(ctx, &ret, "das_storeShard", dataHash, commitment, hexutil.Bytes(manifest), hexutil.Uint64(index), hexutil.Bytes(shard), hexutil.Uint64(timeout), hexutil.Bytes(reqSig)); err != nil {
+		return nil, err
+	}
+	return ret.certificate()
+}
+
+func (ret *StoreResult) certificate() (*arbstate.DataAvailabilityCertificate, error) {
 	respSig, err := blsSignatures.SignatureFromBytes(ret.Sig)
 	if err != nil {
 		return nil, err
 	}
 	return &arbstate.DataAvailabilityCertificate{
-		DataHash:    common.BytesToHash(ret.DataHash),
-		Timeout:     uint64(ret.Timeout),
-		SignersMask: uint64(ret.SignersMask),
-		Sig:         respSig,
-		KeysetHash:  common.BytesToHash(ret.KeysetHash),
-		Version:     byte(ret.Version),
+		DataHash:        common.BytesToHash(ret.DataHash),
+		Timeout:         uint64(ret.Timeout),
+		SignersMask:     uint64(ret.SignersMask),
+		Sig:             respSig,
+		KeysetHash:      common.BytesToHash(ret.KeysetHash),
+		Version:         byte(ret.Version),
+		ShardCommitment: common.BytesToHash(ret.ShardCommitment),
 	}, nil
 }
 
@@ -17,6 +17,7 @@ import (
 
 	"github.com/tenderly/nitro/go-ethereum/rpc"
 
+	"github.com/tenderly/nitro/arbstate"
 	"github.com/tenderly/nitro/blsSignatures"
 	"github.com/tenderly/nitro/cmd/genericconf"
 	"github.com/tenderly/nitro/das"
@@ -85,12 +86,28 @@ func StartDASRPCServerOnListener(ctx context.Context, listener net.Listener, rpc
 }
 
 type StoreResult struct {
-	DataHash    hexutil.Bytes  `json:"dataHash,omitempty"`
-	Timeout     hexutil.Uint64 `json:"timeout,omitempty"`
-	SignersMask hexutil.Uint64 `json:"signersMask,omitempty"`
-	KeysetHash  hexutil.Bytes  `json:"keysetHash,omitempty"`
-	Sig         hexutil.Bytes  `json:"sig,omitempty"`
-	Version     hexutil.Uint64 `json:"version,omitempty"`
+	DataHash        hexutil.Bytes  `json:"dataHash,omitempty"`
+	Timeout         hexutil.Uint64 `json:"timeout,omitempty"`
+	SignersMask     hexutil.Uint64 `json:"signersMask,omitempty"`
+	KeysetHash      hexutil.Bytes  `json:"keysetHash,omitempty"`
+	Sig             hexutil.Bytes  `json:"sig,omitempty"`
+	Version         hexutil.Uint64 `json:"version,omitempty"`
+	ShardCommitment hexutil.Bytes  `json:"shardCommitment,omitempty"`
+}
+
+func storeResult(cert *arbstate.DataAvailabilityCertificate) *StoreResult {
+	result := &StoreResult{
+		KeysetHash:  cert.KeysetHash[:],
+		DataHash:    cert.DataHash[:],
+		Timeout:     hexutil.Uint64(cert.Timeout),
+		SignersMask: hexutil.Uint64(cert.SignersMask),
+		Sig:         blsSignatures.SignatureToBytes(cert.Sig),
+		Version:     hexutil.Uint64(cert.Version),
+	}
+	if cert.Version == arbstate.ErasureCodedCertificateVersion {
+		result.ShardCommitment = cert.ShardCommitment[:]
+	}
+	return result
 }
 
 func (serv *DASRPCServer) Store(ctx context.Context, message hexutil.Bytes, timeout hexutil.Uint64, sig hexutil.Bytes) (*StoreResult, error) {
@@ -113,14 +130,34 @@ func (serv *DASRPCServer) Store(ctx context.Context, message hexutil.Bytes, time
 	}
 	rpcStoreStoredBytesGauge.Inc(int64(len(message)))
 	success = true
-	return &StoreResult{
-		KeysetHash:  cert.KeysetHash[:],
-		DataHash:    cert.DataHash[:],
-		Timeout:     hexutil.Uint64(cert.Timeout),
-		SignersMask: hexutil.Uint64(cert.SignersMask),
-		Sig:         blsSignatures.SignatureToBytes(cert.Sig),
-		Version:     hexutil.Uint64(cert.Version),
-	}, nil
+	return storeResult(cert), nil
+}
+
+func (serv *DASRPCServer) StoreShard(ctx context.Context, dataHash, commitment common.Hash, manifest hexutil.Bytes, index hexutil.Uint64, shard hexutil.Bytes, timeout hexutil.Uint64, sig hexutil.Bytes) (*StoreResult, error) {
+	log.Trace("dasRpc.DASRPCServer.StoreShard", "dataHash", dataHash, "commitment", commitment, "manifest", pretty.FirstFewBytes(manifest), "index", index, "shard length", len(shard), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(sig), "this", serv)
+	rpcStoreRequestGauge.Inc(1)
+	start := time.Now()
+	success := false
+	defer func() {
+		if success {
+			rpcStoreSuccessGauge.Inc(1)
+		} else {
+			rpcStoreFailureGauge.Inc(1)
+		}
+		rpcStoreDurationHistogram.Update(time.Since(start).Nanoseconds())
+	}()
+
+	storer, ok := serv.localDAS.(das.ShardStorer)
+	if !ok {
+		return nil, fmt.Errorf("%v doesn't support storing erasure coded shards", serv.localDAS)
+	}
+	cert, err := storer.StoreShard(ctx, dataHash, commitment, manifest, uint64(index), shard, uint64(timeout), sig)
+	if err != nil {
+		return nil, err
+	}
+	rpcStoreStoredBytesGauge.Inc(int64(len(shard)))
+	success = true
+	return storeResult(cert), nil
 }
 
 func (serv *DASRPCServer) GetByHash(ctx context.Context, certBytes hexutil.Bytes) (hexutil.Bytes, error) {
@@ -114,6 +114,63 @@ func (dbs *DBStorageService) Put(ctx context.Context, data []byte, timeout uint6
 	})
 }
 
+// Expiry returns the expiry of the data with the given key, which is only recorded when data is discarded after its timeout
+func (dbs *DBStorageService) Expiry(ctx context.Context, key common.Hash) (uint64, error) {
+	var expiry uint64
+	err := dbs.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key.Bytes())
+		if err != nil {
+			return err
+		}
+		expiry = item.ExpiresAt()
+		return nil
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, ErrNotFound
+	}
+	return expiry, err
+}
+
+const dbKeysPageSize = 1000
+
+// Keys lists the keys in the database, filtering by expiry when data is discarded after its timeout
+func (dbs *DBStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return newPagedKeyIterator(since, func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error) {
+		var keys []common.Hash
+		more := true
+		// keep scanning until a page has some keys, as the keys of expiring data may be skipped
+		for len(keys) == 0 && more {
+			scanned := 0
+			err := dbs.db.View(func(txn *badger.Txn) error {
+				options := badger.DefaultIteratorOptions
+				options.PrefetchValues = false
+				it := txn.NewIterator(options)
+				defer it.Close()
+				for it.Seek(after.Bytes()); it.Valid() && scanned < dbKeysPageSize; it.Next() {
+					item := it.Item()
+					key := item.Key()
+					if len(key) != common.HashLength || bytes.Equal(key, after.Bytes()) {
+						continue
+					}
+					scanned++
+					after = common.BytesToHash(key)
+					expiresAt := item.ExpiresAt()
+					if expiringAfter != 0 && expiresAt != 0 && expiresAt <= expiringAfter {
+						continue
+					}
+					keys = append(keys, after)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, false, err
+			}
+			more = scanned == dbKeysPageSize
+		}
+		return keys, more, nil
+	}), nil
+}
+
 func (dbs *DBStorageService) Sync(ctx context.Context) error {
 	return dbs.db.Sync()
 }
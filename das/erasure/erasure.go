@@ -0,0 +1,189 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package erasure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Systematic Reed-Solomon coding over GF(2^8). The first K shards are the data itself, split into equal parts,
+// and the remaining N-K are parity shards, each a linear combination of the data shards given by a row of a
+// Cauchy matrix. Every K×K submatrix of the resulting N×K encoding matrix is invertible, so any K shards
+// are enough to recover the data.
+
+const MaxShards = 256
+
+// field arithmetic modulo the polynomial x^8 + x^4 + x^3 + x^2 + 1, with generator 2
+var expTable [510]byte
+var logTable [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func inv(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// coefficients returns the row of the encoding matrix for the given shard
+func coefficients(shard, dataShards int) []byte {
+	row := make([]byte, dataShards)
+	if shard < dataShards {
+		row[shard] = 1
+		return row
+	}
+	for i := range row {
+		// the shard index and data shard indices are distinct, so this is never the inverse of 0
+		row[i] = inv(byte(shard) ^ byte(i))
+	}
+	return row
+}
+
+func checkShardCounts(dataShards, totalShards int) error {
+	if dataShards <= 0 || dataShards > totalShards || totalShards > MaxShards {
+		return fmt.Errorf("invalid erasure coding of %v data shards into %v total", dataShards, totalShards)
+	}
+	return nil
+}
+
+// ShardSize returns the size of each shard the data is encoded into
+func ShardSize(dataLength uint64, dataShards int) uint64 {
+	size := (dataLength + uint64(dataShards) - 1) / uint64(dataShards)
+	if size == 0 {
+		return 1
+	}
+	return size
+}
+
+// Encode splits data into dataShards equal shards, padding the last with zeros, and adds parity shards up to totalShards
+func Encode(data []byte, dataShards, totalShards int) ([][]byte, error) {
+	if err := checkShardCounts(dataShards, totalShards); err != nil {
+		return nil, err
+	}
+	size := int(ShardSize(uint64(len(data)), dataShards))
+	padded := make([]byte, size*dataShards)
+	copy(padded, data)
+
+	shards := make([][]byte, totalShards)
+	for i := 0; i < dataShards; i++ {
+		shards[i] = padded[i*size : (i+1)*size]
+	}
+	for i := dataShards; i < totalShards; i++ {
+		shard := make([]byte, size)
+		for j, coefficient := range coefficients(i, dataShards) {
+			for k, b := range shards[j] {
+				shard[k] ^= mul(coefficient, b)
+			}
+		}
+		shards[i] = shard
+	}
+	return shards, nil
+}
+
+// invert returns the inverse of a square matrix by Gauss-Jordan elimination
+func invert(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	work := make([][]byte, n)
+	for i, row := range matrix {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], row)
+		work[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular erasure coding matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		scale := inv(work[col][col])
+		for k := range work[col] {
+			work[col][k] = mul(work[col][k], scale)
+		}
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			for k := range work[row] {
+				work[row][k] ^= mul(factor, work[col][k])
+			}
+		}
+	}
+	inverse := make([][]byte, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+	return inverse, nil
+}
+
+// Reconstruct recovers the first dataLength bytes of the encoded data from any dataShards of the shards,
+// where those which are missing are nil
+func Reconstruct(shards [][]byte, dataShards int, dataLength uint64) ([]byte, error) {
+	if err := checkShardCounts(dataShards, len(shards)); err != nil {
+		return nil, err
+	}
+	size := ShardSize(dataLength, dataShards)
+	var indices []int
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if uint64(len(shard)) != size {
+			return nil, fmt.Errorf("shard %v has size %v, expected %v", i, len(shard), size)
+		}
+		if len(indices) < dataShards {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) < dataShards {
+		return nil, fmt.Errorf("only %v of the %v shards required to reconstruct the data are present", len(indices), dataShards)
+	}
+
+	data := make([]byte, size*uint64(dataShards))
+	if indices[dataShards-1] == dataShards-1 {
+		// all the data shards are present
+		for i := 0; i < dataShards; i++ {
+			copy(data[uint64(i)*size:], shards[i])
+		}
+		return data[:dataLength], nil
+	}
+
+	matrix := make([][]byte, dataShards)
+	for i, index := range indices {
+		matrix[i] = coefficients(index, dataShards)
+	}
+	decoding, err := invert(matrix)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range decoding {
+		out := data[uint64(i)*size : uint64(i+1)*size]
+		for j, coefficient := range row {
+			for k, b := range shards[indices[j]] {
+				out[k] ^= mul(coefficient, b)
+			}
+		}
+	}
+	return data[:dataLength], nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package erasure
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestErasureCoding(t *testing.T) {
+	for _, params := range [][3]int{{1, 1, 10}, {1, 3, 0}, {2, 3, 1}, {3, 5, 1000}, {4, 10, 12345}, {10, 20, 65537}} {
+		dataShards, totalShards, length := params[0], params[1], params[2]
+		data := make([]byte, length)
+		rand.Read(data)
+		shards, err := Encode(data, dataShards, totalShards)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shards) != totalShards {
+			t.Fatal("expected", totalShards, "shards, got", len(shards))
+		}
+
+		for trial := 0; trial < 20; trial++ {
+			// drop all but a random choice of dataShards shards
+			present := make([][]byte, totalShards)
+			for _, i := range rand.Perm(totalShards)[:dataShards] {
+				present[i] = shards[i]
+			}
+			reconstructed, err := Reconstruct(present, dataShards, uint64(length))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(reconstructed, data) {
+				t.Fatal("reconstructed data doesn't match for params", params)
+			}
+		}
+
+		if dataShards > 1 {
+			present := make([][]byte, totalShards)
+			copy(present, shards[:dataShards-1])
+			if _, err := Reconstruct(present, dataShards, uint64(length)); err == nil {
+				t.Fatal("reconstructed data from too few shards")
+			}
+		}
+	}
+}
+
+func TestErasureCodingParameters(t *testing.T) {
+	if _, err := Encode([]byte{1}, 0, 1); err == nil {
+		t.Fatal("encoded into zero data shards")
+	}
+	if _, err := Encode([]byte{1}, 3, 2); err == nil {
+		t.Fatal("encoded into more data shards than shards")
+	}
+	if _, err := Encode([]byte{1}, 1, MaxShards+1); err == nil {
+		t.Fatal("encoded into too many shards")
+	}
+	if _, err := Reconstruct([][]byte{{1, 2}, nil}, 1, 1); err == nil {
+		t.Fatal("reconstructed from a shard of the wrong size")
+	}
+}
@@ -5,16 +5,23 @@ package das
 
 import (
 	"context"
+	"errors"
 )
 
 // Create any storage services that persist to files, database, cloud storage,
 // and group them together into a RedundantStorage instance if there is more than one.
+// If retention is enabled, the result records the expiry of the data stored, and sweeps
+// expired data from the services which don't discard it themselves.
 func CreatePersistentStorageService(
 	ctx context.Context,
 	config *DataAvailabilityConfig,
 ) (StorageService, *LifecycleManager, error) {
 	storageServices := make([]StorageService, 0, 10)
+	var sweptServices []DeletableStorageService
 	var lifecycleManager LifecycleManager
+	if config.LocalFileStorageConfig.DiscardAfterTimeout && !config.RetentionConfig.Enable {
+		return nil, nil, errors.New("local-file-storage.discard-after-timeout requires retention to be enabled")
+	}
 	if config.LocalDBStorageConfig.Enable {
 		s, err := NewDBStorageService(ctx, config.LocalDBStorageConfig.DataDir, config.LocalDBStorageConfig.DiscardAfterTimeout)
 		if err != nil {
@@ -25,12 +32,13 @@ func CreatePersistentStorageService(
 	}
 
 	if config.LocalFileStorageConfig.Enable {
-		s, err := NewLocalFileStorageService(config.LocalFileStorageConfig.DataDir)
+		s, err := NewLocalFileStorageService(config.LocalFileStorageConfig.DataDir, config.LocalFileStorageConfig.DiscardAfterTimeout)
 		if err != nil {
 			return nil, nil, err
 		}
 		lifecycleManager.Register(s)
 		storageServices = append(storageServices, s)
+		sweptServices = append(sweptServices, s.(DeletableStorageService))
 	}
 
 	if config.S3StorageServiceConfig.Enable {
@@ -40,18 +48,28 @@ func CreatePersistentStorageService(
 		}
 		lifecycleManager.Register(s)
 		storageServices = append(storageServices, s)
+		sweptServices = append(sweptServices, s.(DeletableStorageService))
 	}
 
+	var storageService StorageService
 	if len(storageServices) > 1 {
 		s, err := NewRedundantStorageService(ctx, storageServices)
 		if err != nil {
 			return nil, nil, err
 		}
 		lifecycleManager.Register(s)
-		return s, &lifecycleManager, nil
+		storageService = s
+	} else if len(storageServices) == 1 {
+		storageService = storageServices[0]
 	}
-	if len(storageServices) == 1 {
-		return storageServices[0], &lifecycleManager, nil
+
+	if storageService != nil && config.RetentionConfig.Enable {
+		s, err := NewRetentionStorageService(ctx, storageService, config.RetentionConfig, sweptServices)
+		if err != nil {
+			return nil, nil, err
+		}
+		lifecycleManager.Register(s)
+		storageService = s
 	}
-	return nil, &lifecycleManager, nil
+	return storageService, &lifecycleManager, nil
 }
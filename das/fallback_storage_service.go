@@ -47,6 +47,11 @@ func NewFallbackStorageService(
 	}
 }
 
+// Keys lists the keys held by the primary, not the backup
+func (f *FallbackStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, f.StorageService, since, expiringAfter)
+}
+
 func (f *FallbackStorageService) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
 	log.Trace("das.FallbackStorageService.GetByHash", "key", pretty.PrettyHash(key), "this", f)
 	if f.preventRecursiveGets {
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
@@ -22,8 +23,9 @@ import (
 )
 
 type LocalFileStorageConfig struct {
-	Enable  bool   `koanf:"enable"`
-	DataDir string `koanf:"data-dir"`
+	Enable              bool   `koanf:"enable"`
+	DataDir             string `koanf:"data-dir"`
+	DiscardAfterTimeout bool   `koanf:"discard-after-timeout"`
 }
 
 var DefaultLocalFileStorageConfig = LocalFileStorageConfig{
@@ -33,17 +35,19 @@ var DefaultLocalFileStorageConfig = LocalFileStorageConfig{
 func LocalFileStorageConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Bool(prefix+".enable", DefaultLocalFileStorageConfig.Enable, "enable storage/retrieval of sequencer batch data from a directory of files, one per batch")
 	f.String(prefix+".data-dir", DefaultLocalFileStorageConfig.DataDir, "local data directory")
+	f.Bool(prefix+".discard-after-timeout", DefaultLocalFileStorageConfig.DiscardAfterTimeout, "discard data after its expiry timeout; this requires data-availability.retention to be enabled")
 }
 
 type LocalFileStorageService struct {
-	dataDir string
+	dataDir             string
+	discardAfterTimeout bool
 }
 
-func NewLocalFileStorageService(dataDir string) (StorageService, error) {
+func NewLocalFileStorageService(dataDir string, discardAfterTimeout bool) (StorageService, error) {
 	if unix.Access(dataDir, unix.W_OK|unix.R_OK) != nil {
 		return nil, fmt.Errorf("Couldn't start LocalFileStorageService, directory '%s' must be readable and writeable", dataDir)
 	}
-	return &LocalFileStorageService{dataDir: dataDir}, nil
+	return &LocalFileStorageService{dataDir: dataDir, discardAfterTimeout: discardAfterTimeout}, nil
 }
 
 func (s *LocalFileStorageService) GetByHash(ctx context.Context, key common.Hash) ([]byte, error) {
@@ -92,6 +96,87 @@ func (s *LocalFileStorageService) Put(ctx context.Context, data []byte, timeout
 
 }
 
+func (s *LocalFileStorageService) Delete(ctx context.Context, key common.Hash) error {
+	log.Trace("das.LocalFileStorageService.Delete", "key", pretty.PrettyHash(key), "this", s)
+	for _, fileName := range []string{EncodeStorageServiceKey(key), base32.StdEncoding.EncodeToString(key.Bytes())} {
+		err := os.Remove(s.dataDir + "/" + fileName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+const localFileKeysPageSize = 1000
+
+// Keys lists all the keys in the directory, as the expiry of the data isn't recorded.
+// The directory is read once, on the first page, as file names aren't in key order.
+func (s *LocalFileStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	var keys []common.Hash
+	listed := false
+	return newPagedKeyIterator(since, func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error) {
+		if !listed {
+			var err error
+			keys, err = s.listKeys()
+			if err != nil {
+				return nil, false, err
+			}
+			listed = true
+		}
+		start := sort.Search(len(keys), func(i int) bool {
+			return compareKeys(keys[i], after) > 0
+		})
+		if len(keys)-start <= localFileKeysPageSize {
+			return keys[start:], false, nil
+		}
+		return keys[start : start+localFileKeysPageSize], true, nil
+	}), nil
+}
+
+// listKeys returns the keys of the files in the directory in ascending order, listing each once
+// even if it's stored under both the current and the legacy naming
+func (s *LocalFileStorageService) listKeys() ([]common.Hash, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[common.Hash]bool)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if key, ok := decodeLocalFileName(entry.Name()); ok {
+			found[key] = true
+		}
+	}
+	keys := make([]common.Hash, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	return keys, nil
+}
+
+// decodeLocalFileName returns the key stored in a file with the given name, under either the current hex
+// or the legacy base32 naming, skipping anything else in the directory such as partially written temp files
+func decodeLocalFileName(name string) (common.Hash, bool) {
+	if len(name) == 2*common.HashLength {
+		key, err := DecodeStorageServiceKey(name)
+		if err == nil {
+			return key, true
+		}
+	}
+	if len(name) == base32.StdEncoding.EncodedLen(common.HashLength) {
+		key, err := base32.StdEncoding.DecodeString(name)
+		if err == nil {
+			return common.BytesToHash(key), true
+		}
+	}
+	return common.Hash{}, false
+}
+
 func (s *LocalFileStorageService) Sync(ctx context.Context) error {
 	return nil
 }
@@ -101,7 +186,11 @@ func (s *LocalFileStorageService) Close(ctx context.Context) error {
 }
 
 func (s *LocalFileStorageService) ExpirationPolicy(ctx context.Context) (arbstate.ExpirationPolicy, error) {
-	return arbstate.KeepForever, nil
+	if s.discardAfterTimeout {
+		return arbstate.DiscardAfterDataTimeout, nil
+	} else {
+		return arbstate.KeepForever, nil
+	}
 }
 
 func (s *LocalFileStorageService) String() string {
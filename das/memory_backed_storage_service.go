@@ -6,6 +6,7 @@ package das
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
@@ -15,16 +16,18 @@ import (
 )
 
 type MemoryBackedStorageService struct { // intended for testing and debugging
-	contents map[[32]byte][]byte
-	rwmutex  sync.RWMutex
-	closed   bool
+	contents    map[[32]byte][]byte
+	expirations map[[32]byte]uint64
+	rwmutex     sync.RWMutex
+	closed      bool
 }
 
 var ErrClosed = errors.New("cannot access a StorageService that has been Closed")
 
 func NewMemoryBackedStorageService(ctx context.Context) StorageService {
 	return &MemoryBackedStorageService{
-		contents: make(map[[32]byte][]byte),
+		contents:    make(map[[32]byte][]byte),
+		expirations: make(map[[32]byte]uint64),
 	}
 }
 
@@ -49,10 +52,38 @@ func (m *MemoryBackedStorageService) Put(ctx context.Context, data []byte, expir
 	if m.closed {
 		return ErrClosed
 	}
-	m.contents[dastree.Hash(data)] = append([]byte{}, data...)
+	key := dastree.Hash(data)
+	m.contents[key] = append([]byte{}, data...)
+	if expirationTime > m.expirations[key] {
+		m.expirations[key] = expirationTime
+	}
 	return nil
 }
 
+func (m *MemoryBackedStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	m.rwmutex.RLock()
+	defer m.rwmutex.RUnlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	keys := make([]common.Hash, 0, len(m.contents))
+	for key := range m.contents {
+		if compareKeys(key, since) <= 0 {
+			continue
+		}
+		if expiringAfter != 0 && m.expirations[key] <= expiringAfter {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	return newPagedKeyIterator(since, func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error) {
+		return keys, false, nil
+	}), nil
+}
+
 func (m *MemoryBackedStorageService) Sync(ctx context.Context) error {
 	m.rwmutex.RLock()
 	defer m.rwmutex.RUnlock()
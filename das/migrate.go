@@ -0,0 +1,247 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/log"
+)
+
+type MigrationOptions struct {
+	// Checkpoint is the file recording how far the migration has got, so that it can be resumed; empty for none
+	Checkpoint         string
+	CheckpointInterval time.Duration
+	Workers            int
+	// VerifyOnly checks that the destination holds everything the source does, without copying anything
+	VerifyOnly bool
+	// Expiry is the expiration time given to the destination for data whose expiry the source doesn't record,
+	// which otherwise keeps its expiry. If it's 0, such data can only be copied to a destination which keeps data forever.
+	Expiry uint64
+}
+
+type MigrationResult struct {
+	Migrated int
+	Failed   int
+}
+
+// migrationProgress tracks the keys in flight to find the last key before which every key has been migrated,
+// which is what the checkpoint records. Keys which fail are never completed, so a resumed migration retries them.
+type migrationProgress struct {
+	mutex      sync.Mutex
+	inFlight   []common.Hash
+	completed  map[common.Hash]bool
+	checkpoint common.Hash
+}
+
+func (p *migrationProgress) start(key common.Hash) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.inFlight = append(p.inFlight, key)
+}
+
+func (p *migrationProgress) complete(key common.Hash) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.completed[key] = true
+	for len(p.inFlight) > 0 && p.completed[p.inFlight[0]] {
+		p.checkpoint = p.inFlight[0]
+		delete(p.completed, p.inFlight[0])
+		p.inFlight = p.inFlight[1:]
+	}
+}
+
+func (p *migrationProgress) lastCheckpoint() common.Hash {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.checkpoint
+}
+
+func ReadMigrationCheckpoint(path string) (common.Hash, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return common.Hash{}, nil
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+	name := strings.TrimSpace(string(contents))
+	if len(name) != 2*common.HashLength {
+		return common.Hash{}, fmt.Errorf("invalid migration checkpoint %q in %s", name, path)
+	}
+	return DecodeStorageServiceKey(name)
+}
+
+func writeMigrationCheckpoint(path string, key common.Hash) error {
+	// Use a temp file and rename to achieve atomic writes.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(EncodeStorageServiceKey(key) + "\n")
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// MigrateStorage copies every key in the source to the destination, checking that the data matches its key,
+// or in verify-only mode checks that the destination holds the same data as the source.
+// If a checkpoint file is given, the migration resumes from it and periodically records its progress in it.
+func MigrateStorage(ctx context.Context, source IterableStorageService, destination StorageService, options MigrationOptions) (MigrationResult, error) {
+	var result MigrationResult
+	if options.Workers <= 0 {
+		return result, fmt.Errorf("invalid number of migration workers %d", options.Workers)
+	}
+	needsExpiry := false
+	if !options.VerifyOnly {
+		policy, err := destination.ExpirationPolicy(ctx)
+		if err != nil {
+			return result, err
+		}
+		needsExpiry = policy != arbstate.KeepForever
+		if _, ok := source.(ExpiryReader); needsExpiry && !ok && options.Expiry == 0 {
+			return result, fmt.Errorf("destination %v discards data after its expiry, which source %v doesn't record, so an expiry must be given", destination, source)
+		}
+	}
+	since := common.Hash{}
+	if options.Checkpoint != "" {
+		var err error
+		since, err = ReadMigrationCheckpoint(options.Checkpoint)
+		if err != nil {
+			return result, err
+		}
+		if since != (common.Hash{}) {
+			log.Info("resuming data availability migration", "checkpoint", since)
+		}
+	}
+	keys, err := source.Keys(ctx, since, 0)
+	if err != nil {
+		return result, err
+	}
+
+	progress := &migrationProgress{completed: make(map[common.Hash]bool), checkpoint: since}
+	var resultMutex sync.Mutex
+	work := make(chan common.Hash, options.Workers)
+	var workers sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for key := range work {
+				err := migrateKey(ctx, source, destination, key, needsExpiry, options)
+				resultMutex.Lock()
+				if err != nil {
+					log.Warn("failed to migrate data availability data", "key", key, "err", err)
+					result.Failed++
+				} else {
+					result.Migrated++
+				}
+				resultMutex.Unlock()
+				if err == nil {
+					progress.complete(key)
+				}
+			}
+		}()
+	}
+
+	checkpointer := func() error {
+		if options.Checkpoint == "" {
+			return nil
+		}
+		// the checkpoint must only cover data which has been persisted
+		checkpoint := progress.lastCheckpoint()
+		if !options.VerifyOnly {
+			if err := destination.Sync(ctx); err != nil {
+				return err
+			}
+		}
+		return writeMigrationCheckpoint(options.Checkpoint, checkpoint)
+	}
+	lastCheckpoint := time.Now()
+	var iterErr error
+	for {
+		var key common.Hash
+		key, iterErr = keys.Next(ctx)
+		if iterErr != nil {
+			break
+		}
+		progress.start(key)
+		work <- key
+		if options.CheckpointInterval > 0 && time.Since(lastCheckpoint) >= options.CheckpointInterval {
+			if err := checkpointer(); err != nil {
+				log.Warn("failed to write data availability migration checkpoint", "err", err)
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+	close(work)
+	workers.Wait()
+
+	if err := checkpointer(); err != nil {
+		return result, err
+	}
+	if !errors.Is(iterErr, io.EOF) {
+		return result, iterErr
+	}
+	if result.Failed > 0 {
+		return result, fmt.Errorf("%d of %d keys failed to migrate", result.Failed, result.Failed+result.Migrated)
+	}
+	return result, nil
+}
+
+func migrateKey(ctx context.Context, source, destination StorageService, key common.Hash, needsExpiry bool, options MigrationOptions) error {
+	data, err := source.GetByHash(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !dastree.ValidHash(key, data) {
+		return errors.New("source data doesn't match its hash")
+	}
+	if !options.VerifyOnly {
+		expiry, err := migrationExpiry(ctx, source, key, options)
+		if err != nil {
+			return err
+		}
+		if expiry == 0 && needsExpiry {
+			return errors.New("the source doesn't record the data's expiry, and the destination discards data after its expiry")
+		}
+		return destination.Put(ctx, data, expiry)
+	}
+	stored, err := destination.GetByHash(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored, data) {
+		return errors.New("destination data doesn't match the source")
+	}
+	return nil
+}
+
+// migrationExpiry returns the expiry the source records for the data with the given key, or else the configured one
+func migrationExpiry(ctx context.Context, source StorageService, key common.Hash, options MigrationOptions) (uint64, error) {
+	if reader, ok := source.(ExpiryReader); ok {
+		expiry, err := reader.Expiry(ctx, key)
+		if err != nil || expiry != 0 {
+			return expiry, err
+		}
+	}
+	return options.Expiry, nil
+}
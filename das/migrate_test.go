@@ -0,0 +1,147 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/go-ethereum/common"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sourceDir := t.TempDir()
+	source, err := NewLocalFileStorageService(sourceDir, false)
+	Require(t, err)
+	expiry := uint64(time.Now().Add(time.Hour).Unix())
+	var values [][]byte
+	for i := 0; i < 20; i++ {
+		value := []byte{byte(i), 'd', 'a', 't', 'a'}
+		values = append(values, value)
+		Require(t, source.Put(ctx, value, expiry))
+	}
+
+	keys, err := source.(IterableStorageService).Keys(ctx, common.Hash{}, 0)
+	Require(t, err)
+	var previous common.Hash
+	count := 0
+	for {
+		key, err := keys.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		Require(t, err)
+		if bytes.Compare(key[:], previous[:]) <= 0 {
+			Fail(t, "keys weren't in ascending order", previous, key)
+		}
+		previous = key
+		count++
+	}
+	if count != len(values) {
+		Fail(t, "expected", len(values), "keys, got", count)
+	}
+
+	destination, err := NewLocalFileStorageService(t.TempDir(), false)
+	Require(t, err)
+	options := MigrationOptions{
+		Checkpoint: filepath.Join(t.TempDir(), "checkpoint"),
+		Workers:    4,
+		VerifyOnly: true,
+		Expiry:     expiry,
+	}
+	result, err := MigrateStorage(ctx, source.(IterableStorageService), destination, options)
+	if err == nil || result.Failed != len(values) {
+		Fail(t, "verified an empty destination", result, err)
+	}
+
+	options.VerifyOnly = false
+	result, err = MigrateStorage(ctx, source.(IterableStorageService), destination, options)
+	Require(t, err)
+	if result.Migrated != len(values) {
+		Fail(t, "expected", len(values), "keys to be migrated, got", result)
+	}
+	for _, value := range values {
+		stored, err := destination.GetByHash(ctx, dastree.Hash(value))
+		Require(t, err)
+		if !bytes.Equal(stored, value) {
+			Fail(t, "unexpected data migrated", stored)
+		}
+	}
+
+	// resuming from the checkpoint only migrates keys added after the last one migrated
+	var extra []byte
+	for i := 0; ; i++ {
+		extra = []byte(fmt.Sprintf("extra data %d", i))
+		if key := dastree.Hash(extra); key[0] == 0xff && key[1] == 0xff {
+			break
+		}
+	}
+	Require(t, source.Put(ctx, extra, expiry))
+	result, err = MigrateStorage(ctx, source.(IterableStorageService), destination, options)
+	Require(t, err)
+	if result.Migrated != 1 {
+		Fail(t, "expected one key to be migrated on resuming, got", result)
+	}
+
+	// corrupt data in the source isn't migrated
+	Require(t, os.Remove(options.Checkpoint))
+	corruptKey := dastree.Hash([]byte("the original data"))
+	Require(t, os.WriteFile(filepath.Join(sourceDir, EncodeStorageServiceKey(corruptKey)), []byte("corrupted data"), 0600))
+	result, err = MigrateStorage(ctx, source.(IterableStorageService), destination, options)
+	if err == nil || result.Failed != 1 || result.Migrated != len(values)+1 {
+		Fail(t, "expected corrupt data to fail to migrate", result, err)
+	}
+	if _, err := destination.GetByHash(ctx, corruptKey); !errors.Is(err, ErrNotFound) {
+		Fail(t, "corrupt data was migrated", err)
+	}
+}
+
+func TestMigrateStorageExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source, err := NewDBStorageService(ctx, t.TempDir(), true)
+	Require(t, err)
+	defer source.Close(ctx)
+	destination, err := NewDBStorageService(ctx, t.TempDir(), true)
+	Require(t, err)
+	defer destination.Close(ctx)
+
+	// the source's expiry is kept, rather than the one given for data whose expiry the source doesn't record
+	now := time.Now()
+	data := []byte("data expiring in an hour")
+	expiry := uint64(now.Add(time.Hour).Unix())
+	Require(t, source.Put(ctx, data, expiry))
+	options := MigrationOptions{
+		Workers: 1,
+		Expiry:  uint64(now.Add(15 * 24 * time.Hour).Unix()),
+	}
+	_, err = MigrateStorage(ctx, source.(IterableStorageService), destination, options)
+	Require(t, err)
+	migratedExpiry, err := destination.(ExpiryReader).Expiry(ctx, dastree.Hash(data))
+	Require(t, err)
+	if migratedExpiry != expiry {
+		Fail(t, "expected the migrated data to expire at", expiry, "but it expires at", migratedExpiry)
+	}
+
+	// data whose expiry isn't recorded can't go to a destination which discards it, unless an expiry is given
+	unrecorded, err := NewLocalFileStorageService(t.TempDir(), false)
+	Require(t, err)
+	Require(t, unrecorded.Put(ctx, data, 0))
+	options.Expiry = 0
+	if _, err := MigrateStorage(ctx, unrecorded.(IterableStorageService), destination, options); err == nil {
+		Fail(t, "migrated data without an expiry to a destination which discards data")
+	}
+}
@@ -30,11 +30,32 @@ func (w *PanicWrapper) GetByHash(ctx context.Context, hash common.Hash) ([]byte,
 			log.Error("DAS hash lookup failed from cancelled context")
 			return nil, err
 		}
+		if arbstate.HasShardFallback(ctx) {
+			// the batch is erasure coded, so it's reconstructed from shards through GetByShards next
+			log.Debug("DAS hash lookup of erasure coded batch failed, leaving it to be reconstructed from shards", "hash", hash, "err", err)
+			return nil, err
+		}
 		panic(fmt.Sprintf("panic wrapper GetByHash: %v", err))
 	}
 	return data, nil
 }
 
+func (w *PanicWrapper) GetByShards(ctx context.Context, dataHash common.Hash, commitment common.Hash) ([]byte, error) {
+	shardedReader, ok := w.DataAvailabilityService.(arbstate.ShardedDataAvailabilityReader)
+	if !ok {
+		panic(fmt.Sprintf("panic wrapper GetByShards: %v can't reconstruct erasure coded batches", w.DataAvailabilityService))
+	}
+	data, err := shardedReader.GetByShards(ctx, dataHash, commitment)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Error("DAS shard reconstruction failed from cancelled context")
+			return nil, err
+		}
+		panic(fmt.Sprintf("panic wrapper GetByShards: %v", err))
+	}
+	return data, nil
+}
+
 func (w *PanicWrapper) Store(ctx context.Context, message []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
 	cert, err := w.DataAvailabilityService.Store(ctx, message, timeout, sig)
 	if err != nil {
@@ -0,0 +1,64 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/das/dastree"
+)
+
+func TestPanicWrapperReconstructsErasureCodedBatches(t *testing.T) {
+	initTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := []byte("erasure coded batch no one has whole")
+	manifest, shards, err := EncodeShards(data, 2, 3)
+	Require(t, err)
+	storage := NewMemoryBackedStorageService(ctx)
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+	Require(t, storage.Put(ctx, manifest.Serialize(), timeout))
+	Require(t, storage.Put(ctx, shards[0], timeout))
+	Require(t, storage.Put(ctx, shards[2], timeout))
+
+	dataHash := dastree.Hash(data)
+	reader := NewPanicWrapper(NewShardReconstructingDAS(NewReadLimitedDataAvailabilityService(storage)))
+	requirePanic := func(name string, get func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				Fail(t, name, "didn't panic")
+			}
+		}()
+		get()
+	}
+
+	// failing to get the whole batch is left to be handled by reconstructing it from shards
+	if _, err := reader.GetByHash(arbstate.WithShardFallback(ctx), dataHash); err == nil {
+		Fail(t, "got erasure coded batch no one has whole")
+	}
+	requirePanic("GetByHash", func() {
+		_, _ = reader.GetByHash(ctx, dataHash)
+	})
+
+	shardedReader, ok := reader.(arbstate.ShardedDataAvailabilityReader)
+	if !ok {
+		Fail(t, "panic wrapper can't reconstruct erasure coded batches")
+	}
+	reconstructed, err := shardedReader.GetByShards(ctx, dataHash, manifest.Commitment())
+	Require(t, err)
+	if string(reconstructed) != string(data) {
+		Fail(t, "reconstructed batch doesn't match", string(reconstructed))
+	}
+	requirePanic("GetByShards", func() {
+		_, _ = shardedReader.GetByShards(ctx, dataHash, common.Hash{})
+	})
+}
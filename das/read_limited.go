@@ -8,6 +8,7 @@ import (
 	"fmt"
 
 	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/go-ethereum/common"
 )
 
 // These classes are wrappers implementing das.StorageService and das.DataAvailabilityService.
@@ -36,6 +37,10 @@ func (s *readLimitedStorageService) Close(ctx context.Context) error {
 	return nil
 }
 
+func (s *readLimitedStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, s.DataAvailabilityReader, since, expiringAfter)
+}
+
 func (s *readLimitedStorageService) String() string {
 	return fmt.Sprintf("readLimitedStorageService(%v)", s.DataAvailabilityReader)
 
@@ -53,6 +58,10 @@ func (*readLimitedDataAvailabilityService) Store(ctx context.Context, message []
 	panic("Logic error: readLimitedDataAvailabilityService.Store shouldn't be called.")
 }
 
+func (s *readLimitedDataAvailabilityService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, s.DataAvailabilityReader, since, expiringAfter)
+}
+
 func (s *readLimitedDataAvailabilityService) String() string {
 	return fmt.Sprintf("ReadLimitedDataAvailabilityService(%v)", s.DataAvailabilityReader)
 }
@@ -7,6 +7,7 @@ import (
 	"context"
 	"crypto/hmac"
 	"fmt"
+	"sort"
 	"time"
 
 	"golang.org/x/crypto/sha3"
@@ -134,6 +135,52 @@ func (rs *RedisStorageService) Put(ctx context.Context, value []byte, timeout ui
 	return err
 }
 
+// Delete only removes the data from Redis, since its base storage service is swept separately
+func (rs *RedisStorageService) Delete(ctx context.Context, key common.Hash) error {
+	log.Trace("das.RedisStorageService.Delete", "key", pretty.PrettyHash(key), "this", rs)
+	return rs.client.Del(ctx, string(key.Bytes())).Err()
+}
+
+const redisScanCount = 1000
+
+// Keys lists the keys cached in Redis, which doesn't record the expiry of the data, only of its cache entry
+func (rs *RedisStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return newPagedKeyIterator(since, func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error) {
+		// Redis scans in no particular order, possibly returning a key more than once,
+		// so every key has to be scanned to sort them
+		found := make(map[common.Hash]bool)
+		var cursor uint64
+		for {
+			var page []string
+			var err error
+			page, cursor, err = rs.client.Scan(ctx, cursor, "", redisScanCount).Result()
+			if err != nil {
+				return nil, false, err
+			}
+			for _, name := range page {
+				if len(name) != common.HashLength {
+					continue
+				}
+				key := common.BytesToHash([]byte(name))
+				if compareKeys(key, after) > 0 {
+					found[key] = true
+				}
+			}
+			if cursor == 0 {
+				break
+			}
+		}
+		keys := make([]common.Hash, 0, len(found))
+		for key := range found {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return compareKeys(keys[i], keys[j]) < 0
+		})
+		return keys, false, nil
+	}), nil
+}
+
 func (rs *RedisStorageService) Sync(ctx context.Context) error {
 	return rs.baseStorageService.Sync(ctx)
 }
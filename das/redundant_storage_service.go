@@ -81,6 +81,19 @@ func (r *RedundantStorageService) Put(ctx context.Context, data []byte, expirati
 	return anyError
 }
 
+// Keys lists the keys held by any of the inner services
+func (r *RedundantStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	iterators := make([]KeyIterator, 0, len(r.innerServices))
+	for _, serv := range r.innerServices {
+		it, err := listKeys(ctx, serv, since, expiringAfter)
+		if err != nil {
+			return nil, err
+		}
+		iterators = append(iterators, it)
+	}
+	return newMergedKeyIterator(iterators), nil
+}
+
 func (r *RedundantStorageService) Sync(ctx context.Context) error {
 	var wg sync.WaitGroup
 	var errorMutex sync.Mutex
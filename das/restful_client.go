@@ -8,9 +8,12 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
@@ -39,11 +42,20 @@ func NewRestfulDasClientFromURL(url string) (*RestfulDasClient, error) {
 	}, nil
 }
 
+func (c *RestfulDasClient) get(ctx context.Context, requestPath string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+requestPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
 func (c *RestfulDasClient) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
-	res, err := http.Get(c.url + getByHashRequestPath + EncodeStorageServiceKey(hash))
+	res, err := c.get(ctx, getByHashRequestPath+EncodeStorageServiceKey(hash))
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HTTP error with status %d returned by server: %s", res.StatusCode, http.StatusText(res.StatusCode))
 	}
@@ -71,6 +83,66 @@ func (c *RestfulDasClient) GetByHash(ctx context.Context, hash common.Hash) ([]b
 	return decodedBytes, nil
 }
 
+// Inventory returns a page of the keys the server holds after since, skipping data it records as expiring
+// at or before expiringAfter if that's non-zero, whether there may be more keys after the page's last,
+// and the cursor to list the next page with. Given the previous page's cursor, it continues the listing
+// from there, or from since if the server has dropped the cursor.
+func (c *RestfulDasClient) Inventory(ctx context.Context, since common.Hash, cursor string, expiringAfter uint64, limit int) ([]common.Hash, bool, string, error) {
+	query := url.Values{}
+	if limit != 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+		keys, more, nextCursor, err := c.inventoryPage(ctx, query)
+		if !errors.Is(err, errInventoryCursorGone) {
+			return keys, more, nextCursor, err
+		}
+		query.Del("cursor")
+	}
+	query.Set("since", EncodeStorageServiceKey(since))
+	if expiringAfter != 0 {
+		query.Set("expiring-after", strconv.FormatUint(expiringAfter, 10))
+	}
+	return c.inventoryPage(ctx, query)
+}
+
+var errInventoryCursorGone = errors.New("inventory cursor no longer held by the server")
+
+func (c *RestfulDasClient) inventoryPage(ctx context.Context, query url.Values) ([]common.Hash, bool, string, error) {
+	res, err := c.get(ctx, inventoryRequestPath+"?"+query.Encode())
+	if err != nil {
+		return nil, false, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusGone {
+		return nil, false, "", errInventoryCursorGone
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, false, "", fmt.Errorf("HTTP error with status %d returned by server: %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	var response RestfulDasInventoryResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, false, "", err
+	}
+	keys := make([]common.Hash, 0, len(response.Keys))
+	for _, encoded := range response.Keys {
+		key, err := DecodeStorageServiceKey(encoded)
+		if err != nil {
+			return nil, false, "", err
+		}
+		keys = append(keys, key)
+	}
+	return keys, response.More, response.Cursor, nil
+}
+
 func (c *RestfulDasClient) HealthCheck(ctx context.Context) error {
 	res, err := http.Get(c.url + healthRequestPath)
 	if err != nil {
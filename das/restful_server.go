@@ -4,14 +4,19 @@
 package das
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
@@ -40,21 +45,29 @@ type RestfulDasServer struct {
 	storage              arbstate.DataAvailabilityReader
 	httpServerExitedChan chan interface{}
 	httpServerError      error
+
+	enableInventory bool
+	cursorsMutex    sync.Mutex
+	cursors         map[string]*inventoryCursor
 }
 
-func NewRestfulDasServer(address string, port uint64, restServerTimeouts genericconf.HTTPServerTimeoutConfig, storageService arbstate.DataAvailabilityReader) (*RestfulDasServer, error) {
+// NewRestfulDasServer starts a REST server for the storage service, which also lists the keys it holds
+// at the inventory endpoint if enableInventory is set
+func NewRestfulDasServer(address string, port uint64, restServerTimeouts genericconf.HTTPServerTimeoutConfig, enableInventory bool, storageService arbstate.DataAvailabilityReader) (*RestfulDasServer, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", address, port))
 	if err != nil {
 		return nil, err
 	}
-	return NewRestfulDasServerOnListener(listener, restServerTimeouts, storageService)
+	return NewRestfulDasServerOnListener(listener, restServerTimeouts, enableInventory, storageService)
 }
 
-func NewRestfulDasServerOnListener(listener net.Listener, restServerTimeouts genericconf.HTTPServerTimeoutConfig, storageService arbstate.DataAvailabilityReader) (*RestfulDasServer, error) {
+func NewRestfulDasServerOnListener(listener net.Listener, restServerTimeouts genericconf.HTTPServerTimeoutConfig, enableInventory bool, storageService arbstate.DataAvailabilityReader) (*RestfulDasServer, error) {
 
 	ret := &RestfulDasServer{
 		storage:              storageService,
 		httpServerExitedChan: make(chan interface{}),
+		enableInventory:      enableInventory,
+		cursors:              make(map[string]*inventoryCursor),
 	}
 
 	ret.server = &http.Server{
@@ -81,12 +94,37 @@ type RestfulDasServerResponse struct {
 	ExpirationPolicy string `json:"expirationPolicy,omitempty"`
 }
 
+// RestfulDasInventoryResponse is a page of the keys a server holds, in ascending order.
+// If More is set, the next page is requested with the cursor, or if the server has
+// dropped the cursor or didn't give one, with the last key as since.
+type RestfulDasInventoryResponse struct {
+	Keys   []string `json:"keys"`
+	More   bool     `json:"more,omitempty"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
 var cacheControlKey = http.CanonicalHeaderKey("cache-control")
 
 const cacheControlValue = "public, max-age=2419200, immutable" // cache for up to 28 days
 const healthRequestPath = "/health"
 const expirationPolicyRequestPath = "/expiration-policy/"
 const getByHashRequestPath = "/get-by-hash/"
+const inventoryRequestPath = "/inventory"
+
+const defaultInventoryLimit = 1000
+const maxInventoryLimit = 10000
+
+// how long an inventory cursor is kept after its last page was listed, and the most kept at once
+const inventoryCursorTimeout = time.Minute
+const maxInventoryCursors = 100
+
+// inventoryCursor continues listing keys from where the last page left off, so that each page
+// doesn't have to list the keys before it again
+type inventoryCursor struct {
+	keys     KeyIterator
+	next     *common.Hash // the first key of the next page, read to find there was one
+	lastUsed time.Time
+}
 
 func (rds *RestfulDasServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestPath := path.Clean(r.URL.Path)
@@ -98,6 +136,8 @@ func (rds *RestfulDasServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		rds.ExpirationPolicyHandler(w, r, requestPath)
 	case strings.HasPrefix(requestPath, getByHashRequestPath):
 		rds.GetByHashHandler(w, r, requestPath)
+	case requestPath == inventoryRequestPath && rds.enableInventory:
+		rds.InventoryHandler(w, r, requestPath)
 	default:
 		log.Warn("Unknown requestPath", "requestPath", requestPath)
 		w.WriteHeader(http.StatusBadRequest)
@@ -188,6 +228,142 @@ func (rds *RestfulDasServer) GetByHashHandler(w http.ResponseWriter, r *http.Req
 	success = true
 }
 
+// InventoryHandler lists a page of the keys held, so they can be audited against the batches posted to L1.
+// The query parameters are since, the hex key to list the keys after, expiring-after, a unix time at or before
+// which the data expires to skip, and limit, the most keys to list. A later page is listed by passing the
+// previous page's cursor instead of since, which continues the listing without starting it again.
+func (rds *RestfulDasServer) InventoryHandler(w http.ResponseWriter, r *http.Request, requestPath string) {
+	query := r.URL.Query()
+	var err error
+	limit := defaultInventoryLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxInventoryLimit {
+			log.Warn("Invalid inventory limit", "path", requestPath, "limit", query.Get("limit"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var cursor *inventoryCursor
+	cursorId := query.Get("cursor")
+	if cursorId != "" {
+		cursor = rds.takeCursor(cursorId)
+		if cursor == nil {
+			log.Debug("Inventory cursor not found", "path", requestPath, "cursor", cursorId)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+	} else {
+		var since common.Hash
+		if query.Get("since") != "" {
+			since, err = DecodeStorageServiceKey(query.Get("since"))
+			if err != nil {
+				log.Warn("Failed to decode hex-encoded since key", "path", requestPath, "err", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		var expiringAfter uint64
+		if query.Get("expiring-after") != "" {
+			expiringAfter, err = strconv.ParseUint(query.Get("expiring-after"), 10, 64)
+			if err != nil {
+				log.Warn("Failed to parse expiring-after", "path", requestPath, "err", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		keys, err := listKeys(r.Context(), rds.storage, since, expiringAfter)
+		if errors.Is(err, ErrKeysNotSupported) {
+			log.Warn("Inventory requested from storage which can't list its keys", "path", requestPath, "err", err)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			log.Warn("Error listing keys", "path", requestPath, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		cursor = &inventoryCursor{keys: keys}
+	}
+
+	response := RestfulDasInventoryResponse{Keys: []string{}}
+	if cursor.next != nil {
+		response.Keys = append(response.Keys, EncodeStorageServiceKey(*cursor.next))
+		cursor.next = nil
+	}
+	for {
+		key, err := cursor.keys.Next(r.Context())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Warn("Error listing keys", "path", requestPath, "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(response.Keys) == limit {
+			response.More = true
+			cursor.next = &key
+			break
+		}
+		response.Keys = append(response.Keys, EncodeStorageServiceKey(key))
+	}
+	if response.More {
+		response.Cursor = rds.keepCursor(cursorId, cursor)
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Warn("Failed encoding and writing response", "path", requestPath, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// takeCursor removes the cursor with the given id so that only one request uses it at a time, returning nil
+// if there isn't one, as it's expired, been evicted, or is in use
+func (rds *RestfulDasServer) takeCursor(id string) *inventoryCursor {
+	rds.cursorsMutex.Lock()
+	defer rds.cursorsMutex.Unlock()
+	cursor := rds.cursors[id]
+	delete(rds.cursors, id)
+	if cursor != nil && time.Since(cursor.lastUsed) > inventoryCursorTimeout {
+		return nil
+	}
+	return cursor
+}
+
+// keepCursor stores a cursor to list the next page with, under the given id or a new one if that's empty,
+// evicting expired cursors and, if there are still too many, the least recently used
+func (rds *RestfulDasServer) keepCursor(id string, cursor *inventoryCursor) string {
+	rds.cursorsMutex.Lock()
+	defer rds.cursorsMutex.Unlock()
+	now := time.Now()
+	var oldestId string
+	for existingId, existing := range rds.cursors {
+		if now.Sub(existing.lastUsed) > inventoryCursorTimeout {
+			delete(rds.cursors, existingId)
+		} else if oldestId == "" || existing.lastUsed.Before(rds.cursors[oldestId].lastUsed) {
+			oldestId = existingId
+		}
+	}
+	if len(rds.cursors) >= maxInventoryCursors {
+		delete(rds.cursors, oldestId)
+	}
+	if id == "" {
+		var idBytes [16]byte
+		if _, err := rand.Read(idBytes[:]); err != nil {
+			log.Warn("Failed to generate inventory cursor", "err", err)
+			return ""
+		}
+		id = hex.EncodeToString(idBytes[:])
+	}
+	cursor.lastUsed = now
+	rds.cursors[id] = cursor
+	return id
+}
+
 func (rds *RestfulDasServer) GetServerExitedChan() <-chan interface{} { // channel will close when server terminates
 	return rds.httpServerExitedChan
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/tenderly/nitro/arbstate"
 	"github.com/tenderly/nitro/cmd/genericconf"
 	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/go-ethereum/common"
 )
 
 const LocalServerAddressForTest = "localhost"
@@ -29,7 +30,7 @@ func NewRestfulDasServerOnRandomPort(address string, storageService arbstate.Dat
 	if !ok {
 		return nil, 0, errors.New("attempt to listen on TCP returned non-TCP address")
 	}
-	rds, err := NewRestfulDasServerOnListener(listener, genericconf.HTTPServerTimeoutConfigDefault, storageService)
+	rds, err := NewRestfulDasServerOnListener(listener, genericconf.HTTPServerTimeoutConfigDefault, false, storageService)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -69,3 +70,92 @@ func TestRestfulClientServer(t *testing.T) {
 	err = server.Shutdown()
 	Require(t, err)
 }
+
+func TestRestfulServerInventory(t *testing.T) {
+	initTest(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage := NewMemoryBackedStorageService(ctx)
+	listener, err := net.Listen("tcp", LocalServerAddressForTest+":0")
+	Require(t, err)
+	server, err := NewRestfulDasServerOnListener(listener, genericconf.HTTPServerTimeoutConfigDefault, true, storage)
+	Require(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	now := uint64(time.Now().Unix())
+	expected := make(map[common.Hash]bool)
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf("unexpired data %d", i))
+		Require(t, storage.Put(ctx, data, now+3600))
+		expected[dastree.Hash(data)] = true
+	}
+	Require(t, storage.Put(ctx, []byte("expired data"), now-3600))
+
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewRestfulDasClient("http", LocalServerAddressForTest, port)
+	var since common.Hash
+	var cursor string
+	pages := 0
+	for {
+		var keys []common.Hash
+		var more bool
+		keys, more, cursor, err = client.Inventory(ctx, since, cursor, now, 2)
+		Require(t, err)
+		if more && cursor == "" {
+			Fail(t, "no cursor given for the next page")
+		}
+		pages++
+		for _, key := range keys {
+			if !expected[key] {
+				Fail(t, "unexpected key", key)
+			}
+			if bytes.Compare(key[:], since[:]) <= 0 {
+				Fail(t, "keys weren't in ascending order")
+			}
+			delete(expected, key)
+			since = key
+		}
+		if !more {
+			break
+		}
+	}
+	if len(expected) != 0 {
+		Fail(t, "keys missing from the inventory", expected)
+	}
+	if pages != 3 {
+		Fail(t, "expected 3 pages, got", pages)
+	}
+
+	keys, _, _, err := client.Inventory(ctx, common.Hash{}, "", 0, 0)
+	Require(t, err)
+	if len(keys) != 6 {
+		Fail(t, "expected the unfiltered inventory to include expired data, got", len(keys), "keys")
+	}
+
+	// a cursor the server doesn't hold falls back to listing after since
+	keys, _, _, err = client.Inventory(ctx, keys[3], "unknown", 0, 0)
+	Require(t, err)
+	if len(keys) != 2 {
+		Fail(t, "expected two keys after the fourth, got", len(keys))
+	}
+
+	// the inventory is only served at its exact path, and only if it's enabled
+	badClient, err := NewRestfulDasClientFromURL(fmt.Sprintf("http://%s:%d/inventory", LocalServerAddressForTest, port))
+	Require(t, err)
+	if _, _, _, err := badClient.Inventory(ctx, common.Hash{}, "", 0, 0); err == nil {
+		Fail(t, "inventory served under another path")
+	}
+	disabledServer, disabledPort, err := NewRestfulDasServerOnRandomPort(LocalServerAddressForTest, storage)
+	Require(t, err)
+	disabledClient := NewRestfulDasClient("http", LocalServerAddressForTest, disabledPort)
+	if _, _, _, err := disabledClient.Inventory(ctx, common.Hash{}, "", 0, 0); err == nil {
+		Fail(t, "inventory served without being enabled")
+	}
+	Require(t, disabledServer.Shutdown())
+
+	err = server.Shutdown()
+	Require(t, err)
+}
@@ -0,0 +1,387 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v3"
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/metrics"
+	"github.com/tenderly/nitro/util/stopwaiter"
+)
+
+var (
+	retentionExpiredGauge    = metrics.NewRegisteredGauge("arb/das/retention/expired", nil)
+	retentionDeletedCounter  = metrics.NewRegisteredCounter("arb/das/retention/deleted", nil)
+	retentionFailuresCounter = metrics.NewRegisteredCounter("arb/das/retention/failures", nil)
+)
+
+const (
+	RetentionModeDelete  = "delete"
+	RetentionModeDryRun  = "dry-run"
+	RetentionModeMetrics = "metrics"
+)
+
+type RetentionConfig struct {
+	Enable             bool          `koanf:"enable"`
+	IndexDir           string        `koanf:"index-dir"`
+	Mode               string        `koanf:"mode"`
+	SweepInterval      time.Duration `koanf:"sweep-interval"`
+	GracePeriod        time.Duration `koanf:"grace-period"`
+	MaxDeletesPerSweep int           `koanf:"max-deletes-per-sweep"`
+}
+
+var DefaultRetentionConfig = RetentionConfig{
+	Enable:             false,
+	IndexDir:           "",
+	Mode:               RetentionModeDelete,
+	SweepInterval:      time.Hour,
+	GracePeriod:        24 * time.Hour,
+	MaxDeletesPerSweep: 10000,
+}
+
+func RetentionConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultRetentionConfig.Enable, "enable indexing the expiry of stored sequencer batch data and periodically deleting expired data from the storage backends which discard it after its timeout; only data stored while this is enabled is indexed, as there's no backfill of data stored before")
+	f.String(prefix+".index-dir", DefaultRetentionConfig.IndexDir, "directory in which to store the expiry index")
+	f.String(prefix+".mode", DefaultRetentionConfig.Mode, "what to do with expired data: 'delete' it, log it as a 'dry-run' without deleting it, or only update the 'metrics' of how much has expired")
+	f.Duration(prefix+".sweep-interval", DefaultRetentionConfig.SweepInterval, "how often to look for expired data")
+	f.Duration(prefix+".grace-period", DefaultRetentionConfig.GracePeriod, "how long after its expiry to keep data")
+	f.Int(prefix+".max-deletes-per-sweep", DefaultRetentionConfig.MaxDeletesPerSweep, "the most expired entries to handle in one sweep")
+}
+
+func (c *RetentionConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.IndexDir == "" {
+		return errors.New("data availability retention requires an index-dir")
+	}
+	switch strings.ToLower(c.Mode) {
+	case RetentionModeDelete, RetentionModeDryRun, RetentionModeMetrics:
+	default:
+		return fmt.Errorf("invalid data availability retention mode '%s'", c.Mode)
+	}
+	if c.SweepInterval <= 0 {
+		return fmt.Errorf("invalid data availability retention sweep interval %v", c.SweepInterval)
+	}
+	if c.MaxDeletesPerSweep <= 0 {
+		return fmt.Errorf("invalid data availability retention max deletes per sweep %v", c.MaxDeletesPerSweep)
+	}
+	return nil
+}
+
+// DeletableStorageService is implemented by storage services the retention sweeper can delete expired data from
+type DeletableStorageService interface {
+	StorageService
+	Delete(ctx context.Context, key common.Hash) error
+}
+
+// The expiry index has an entry under expiryIndexPrefix, the big endian expiry time, then the data's hash,
+// so that iterating over them finds the earliest expiring data first, and an entry under hashIndexPrefix then
+// the hash, holding the expiry, so that the latest expiry of data stored more than once can be kept.
+var (
+	expiryIndexPrefix = []byte("e")
+	hashIndexPrefix   = []byte("h")
+)
+
+type expiryIndexEntry struct {
+	key    common.Hash
+	expiry uint64
+}
+
+func (e *expiryIndexEntry) expiryIndexKey() []byte {
+	key := make([]byte, len(expiryIndexPrefix)+8, len(expiryIndexPrefix)+8+32)
+	copy(key, expiryIndexPrefix)
+	binary.BigEndian.PutUint64(key[len(expiryIndexPrefix):], e.expiry)
+	return append(key, e.key[:]...)
+}
+
+func hashIndexKey(key common.Hash) []byte {
+	return append(append([]byte{}, hashIndexPrefix...), key[:]...)
+}
+
+// RetentionStorageService records the expiry of everything Put to the storage service it wraps,
+// and periodically sweeps the backends it's given, deleting data whose expiry and grace period have passed.
+// Backends whose expiration policy is to keep data, such as archives, are never swept.
+// There's no backfill: the backends don't expose the expiry of what they already hold, so data stored
+// before the index was created is never swept, and has to be cleaned up by the backend's own means.
+type RetentionStorageService struct {
+	StorageService
+	config     RetentionConfig
+	index      *badger.DB
+	stopWaiter stopwaiter.StopWaiterSafe
+
+	backendsMutex sync.Mutex
+	backends      []DeletableStorageService
+}
+
+func NewRetentionStorageService(ctx context.Context, inner StorageService, config RetentionConfig, backends []DeletableStorageService) (*RetentionStorageService, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	index, err := badger.Open(badger.DefaultOptions(config.IndexDir))
+	if err != nil {
+		return nil, err
+	}
+	s := &RetentionStorageService{
+		StorageService: inner,
+		config:         config,
+		index:          index,
+		backends:       backends,
+	}
+	if err := s.stopWaiter.Start(ctx); err != nil {
+		return nil, err
+	}
+	err = s.stopWaiter.LaunchThread(func(ctx context.Context) {
+		ticker := time.NewTicker(s.config.SweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.Sweep(ctx, time.Now()); err != nil {
+					log.Warn("error sweeping expired data availability data", "err", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddBackend adds a storage service outside of the one wrapped, such as a cache, to be swept
+func (s *RetentionStorageService) AddBackend(backend DeletableStorageService) {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	s.backends = append(s.backends, backend)
+}
+
+func (s *RetentionStorageService) Put(ctx context.Context, data []byte, expirationTime uint64) error {
+	if err := s.StorageService.Put(ctx, data, expirationTime); err != nil {
+		return err
+	}
+	return s.recordExpiry(dastree.Hash(data), expirationTime)
+}
+
+func (s *RetentionStorageService) recordExpiry(key common.Hash, expiry uint64) error {
+	return s.index.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(hashIndexKey(key))
+		if err == nil {
+			var previous []byte
+			previous, err = item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			old := expiryIndexEntry{key, binary.BigEndian.Uint64(previous)}
+			if old.expiry >= expiry {
+				return nil
+			}
+			if err := txn.Delete(old.expiryIndexKey()); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		entry := expiryIndexEntry{key, expiry}
+		if err := txn.Set(entry.expiryIndexKey(), nil); err != nil {
+			return err
+		}
+		var expiryBuf [8]byte
+		binary.BigEndian.PutUint64(expiryBuf[:], expiry)
+		return txn.Set(hashIndexKey(key), expiryBuf[:])
+	})
+}
+
+// Keys lists the keys held by the wrapped storage service, skipping those the index records as expiring at or before expiringAfter
+func (s *RetentionStorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	inner, err := listKeys(ctx, s.StorageService, since, expiringAfter)
+	if err != nil || expiringAfter == 0 {
+		return inner, err
+	}
+	return &filteredKeyIterator{
+		inner: inner,
+		keep: func(ctx context.Context, key common.Hash) (bool, error) {
+			expiry, found, err := s.recordedExpiry(key)
+			return !found || expiry > expiringAfter, err
+		},
+	}, nil
+}
+
+func (s *RetentionStorageService) recordedExpiry(key common.Hash) (uint64, bool, error) {
+	var expiry uint64
+	err := s.index.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(hashIndexKey(key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			expiry = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	return expiry, err == nil, err
+}
+
+// Expiry returns the expiry the index records for the data with the given key, or else the wrapped storage service's
+func (s *RetentionStorageService) Expiry(ctx context.Context, key common.Hash) (uint64, error) {
+	expiry, found, err := s.recordedExpiry(key)
+	if err != nil || found {
+		return expiry, err
+	}
+	if reader, ok := s.StorageService.(ExpiryReader); ok {
+		return reader.Expiry(ctx, key)
+	}
+	return 0, nil
+}
+
+// expired returns up to limit entries which expired before the cutoff, earliest first, and how many there are in all
+func (s *RetentionStorageService) expired(cutoff uint64, limit int) ([]expiryIndexEntry, int, error) {
+	var entries []expiryIndexEntry
+	var total int
+	err := s.index.View(func(txn *badger.Txn) error {
+		options := badger.DefaultIteratorOptions
+		options.PrefetchValues = false
+		options.Prefix = expiryIndexPrefix
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()[len(expiryIndexPrefix):]
+			entry := expiryIndexEntry{
+				key:    common.BytesToHash(key[8:]),
+				expiry: binary.BigEndian.Uint64(key[:8]),
+			}
+			if entry.expiry >= cutoff {
+				break
+			}
+			total++
+			if len(entries) < limit {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, total, err
+}
+
+func (s *RetentionStorageService) removeFromIndex(entry expiryIndexEntry) error {
+	return s.index.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(entry.expiryIndexKey()); err != nil {
+			return err
+		}
+		// the data may have been stored again with a later expiry since it was swept
+		item, err := txn.Get(hashIndexKey(entry.key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		current, err := item.ValueCopy(nil)
+		if err != nil || binary.BigEndian.Uint64(current) != entry.expiry {
+			return err
+		}
+		return txn.Delete(hashIndexKey(entry.key))
+	})
+}
+
+// sweptBackends returns the backends whose expiration policy lets them discard expired data
+func (s *RetentionStorageService) sweptBackends(ctx context.Context) ([]DeletableStorageService, error) {
+	s.backendsMutex.Lock()
+	defer s.backendsMutex.Unlock()
+	var swept []DeletableStorageService
+	for _, backend := range s.backends {
+		policy, err := backend.ExpirationPolicy(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if policy == arbstate.DiscardAfterDataTimeout || policy == arbstate.DiscardImmediately {
+			swept = append(swept, backend)
+		}
+	}
+	return swept, nil
+}
+
+// Sweep handles the data which expired more than the grace period before now according to the configured mode,
+// returning how many entries it handled
+func (s *RetentionStorageService) Sweep(ctx context.Context, now time.Time) (int, error) {
+	backends, err := s.sweptBackends(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(backends) == 0 {
+		retentionExpiredGauge.Update(0)
+		return 0, nil
+	}
+	cutoff := now.Add(-s.config.GracePeriod).Unix()
+	if cutoff <= 0 {
+		return 0, nil
+	}
+	entries, total, err := s.expired(uint64(cutoff), s.config.MaxDeletesPerSweep)
+	if err != nil {
+		return 0, err
+	}
+	retentionExpiredGauge.Update(int64(total))
+
+	mode := strings.ToLower(s.config.Mode)
+	if mode == RetentionModeMetrics {
+		return len(entries), nil
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if mode == RetentionModeDryRun {
+			log.Info("would delete expired data availability data", "key", entry.key, "expiry", time.Unix(int64(entry.expiry), 0), "backends", backends)
+			continue
+		}
+		deleted := true
+		for _, backend := range backends {
+			if err := backend.Delete(ctx, entry.key); err != nil {
+				log.Warn("error deleting expired data availability data", "key", entry.key, "backend", backend, "err", err)
+				retentionFailuresCounter.Inc(1)
+				deleted = false
+			}
+		}
+		// leave data which couldn't be deleted everywhere in the index to try again next sweep
+		if !deleted {
+			continue
+		}
+		if err := s.removeFromIndex(entry); err != nil {
+			return 0, err
+		}
+		retentionDeletedCounter.Inc(1)
+	}
+	if len(entries) > 0 {
+		log.Info("swept expired data availability data", "entries", len(entries), "expired", total, "mode", mode)
+	}
+	return len(entries), nil
+}
+
+// Close stops sweeping and closes the index, but not the wrapped storage service, which has its own lifecycle
+func (s *RetentionStorageService) Close(ctx context.Context) error {
+	s.stopWaiter.StopAndWait()
+	return s.index.Close()
+}
+
+func (s *RetentionStorageService) String() string {
+	return fmt.Sprintf("RetentionStorageService(%v)", s.StorageService)
+}
@@ -0,0 +1,100 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/das/dastree"
+)
+
+func TestRetentionSweep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	discarding, err := NewLocalFileStorageService(t.TempDir(), true)
+	Require(t, err)
+	keeping, err := NewLocalFileStorageService(t.TempDir(), false)
+	Require(t, err)
+	redundant, err := NewRedundantStorageService(ctx, []StorageService{discarding, keeping})
+	Require(t, err)
+
+	config := DefaultRetentionConfig
+	config.Enable = true
+	config.IndexDir = t.TempDir()
+	config.Mode = RetentionModeDryRun
+	config.GracePeriod = time.Minute
+	backends := []DeletableStorageService{discarding.(DeletableStorageService), keeping.(DeletableStorageService)}
+	retention, err := NewRetentionStorageService(ctx, redundant, config, backends)
+	Require(t, err)
+
+	now := time.Now()
+	expired := []byte("expired")
+	unexpired := []byte("unexpired")
+	extended := []byte("stored again with a later expiry")
+	inGracePeriod := []byte("expired within the grace period")
+	Require(t, retention.Put(ctx, expired, uint64(now.Add(-time.Hour).Unix())))
+	Require(t, retention.Put(ctx, unexpired, uint64(now.Add(time.Hour).Unix())))
+	Require(t, retention.Put(ctx, extended, uint64(now.Add(-time.Hour).Unix())))
+	Require(t, retention.Put(ctx, extended, uint64(now.Add(time.Hour).Unix())))
+	Require(t, retention.Put(ctx, inGracePeriod, uint64(now.Add(-time.Second).Unix())))
+
+	count, err := retention.Sweep(ctx, now)
+	Require(t, err)
+	if count != 1 {
+		Fail(t, "expected one expired entry, got", count)
+	}
+	if _, err := discarding.GetByHash(ctx, dastree.Hash(expired)); err != nil {
+		Fail(t, "dry run deleted expired data", err)
+	}
+	// a sweep handles a limited number of entries, but the metric counts everything expired
+	retention.config.MaxDeletesPerSweep = 2
+	count, err = retention.Sweep(ctx, now.Add(2*time.Hour))
+	Require(t, err)
+	if count != 2 {
+		Fail(t, "expected a sweep to handle two expired entries, got", count)
+	}
+	if expiredCount := retentionExpiredGauge.Value(); expiredCount != 4 {
+		Fail(t, "expected four expired entries to be reported, got", expiredCount)
+	}
+	retention.config.MaxDeletesPerSweep = config.MaxDeletesPerSweep
+
+	retention.config.Mode = RetentionModeDelete
+	count, err = retention.Sweep(ctx, now)
+	Require(t, err)
+	if count != 1 {
+		Fail(t, "expected one expired entry, got", count)
+	}
+	if _, err := discarding.GetByHash(ctx, dastree.Hash(expired)); !errors.Is(err, ErrNotFound) {
+		Fail(t, "expired data wasn't deleted", err)
+	}
+	for _, data := range [][]byte{unexpired, extended, inGracePeriod} {
+		stored, err := discarding.GetByHash(ctx, dastree.Hash(data))
+		Require(t, err, "unexpired data was deleted")
+		if !bytes.Equal(stored, data) {
+			Fail(t, "unexpected data stored", stored)
+		}
+	}
+	// the backend which keeps data forever isn't swept
+	if _, err := keeping.GetByHash(ctx, dastree.Hash(expired)); err != nil {
+		Fail(t, "expired data was deleted from a backend which keeps it", err)
+	}
+
+	count, err = retention.Sweep(ctx, now)
+	Require(t, err)
+	if count != 0 {
+		Fail(t, "expected deleted data to be removed from the index, but found", count, "expired entries")
+	}
+	count, err = retention.Sweep(ctx, now.Add(2*time.Hour))
+	Require(t, err)
+	if count != 3 {
+		Fail(t, "expected three expired entries, got", count)
+	}
+
+	Require(t, retention.Close(ctx))
+}
@@ -66,6 +66,31 @@ func (w *RetryWrapper) Store(ctx context.Context, message []byte, timeout uint64
 	return res, nil
 }
 
+func (w *RetryWrapper) StoreShard(
+	ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte,
+) (*arbstate.DataAvailabilityCertificate, error) {
+	storer, ok := w.DataAvailabilityService.(ShardStorer)
+	if !ok {
+		return nil, fmt.Errorf("%v doesn't support storing erasure coded shards", w.DataAvailabilityService)
+	}
+	var res *arbstate.DataAvailabilityCertificate
+	err := backoff.Retry(func() error {
+		if ctx.Err() != nil {
+			return backoff.Permanent(ctx.Err())
+		}
+		data, err := storer.StoreShard(ctx, dataHash, commitment, manifest, index, shard, timeout, sig)
+		if err != nil {
+			return err
+		}
+		res = data
+		return nil
+	}, w.backoffPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (w *RetryWrapper) String() string {
 	return fmt.Sprintf("RetryWrapper{%v}", w.DataAvailabilityService)
 }
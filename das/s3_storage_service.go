@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -109,6 +110,49 @@ func (s3s *S3StorageService) Put(ctx context.Context, value []byte, timeout uint
 	return err
 }
 
+func (s3s *S3StorageService) Delete(ctx context.Context, key common.Hash) error {
+	log.Trace("das.S3StorageService.Delete", "key", pretty.PrettyHash(key), "this", s3s)
+	_, err := s3s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(s3s.objectPrefix + EncodeStorageServiceKey(key)),
+	})
+	return err
+}
+
+// Keys lists all the keys in the bucket under the object prefix, as the expiry of the data can't be listed
+func (s3s *S3StorageService) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return newPagedKeyIterator(since, func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error) {
+		input := &s3.ListObjectsV2Input{
+			Bucket:     aws.String(s3s.bucket),
+			Prefix:     aws.String(s3s.objectPrefix),
+			StartAfter: aws.String(s3s.objectPrefix + EncodeStorageServiceKey(after)),
+		}
+		// keep listing until a page has some keys, as objects which aren't named by a key are skipped
+		for {
+			output, err := s3s.client.ListObjectsV2(ctx, input)
+			if err != nil {
+				return nil, false, err
+			}
+			var keys []common.Hash
+			for _, object := range output.Contents {
+				name := strings.TrimPrefix(aws.ToString(object.Key), s3s.objectPrefix)
+				if len(name) != 2*common.HashLength {
+					continue
+				}
+				key, err := DecodeStorageServiceKey(name)
+				if err != nil {
+					continue
+				}
+				keys = append(keys, key)
+			}
+			if len(keys) > 0 || !output.IsTruncated {
+				return keys, output.IsTruncated, nil
+			}
+			input.ContinuationToken = output.NextContinuationToken
+		}
+	}), nil
+}
+
 func (s3s *S3StorageService) Sync(ctx context.Context) error {
 	return nil
 }
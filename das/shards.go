@@ -0,0 +1,199 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/log"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/das/dastree"
+	"github.com/tenderly/nitro/das/erasure"
+)
+
+// the most shards a batch can be split into, one for each possible committee member
+const maxShards = 64
+
+// ShardManifest describes how a batch was erasure coded into shards, one for each committee member,
+// any DataShards of which are enough to reconstruct it. Members store the manifest along with their shard,
+// and its dastree hash is the shard commitment in erasure coded certificates.
+type ShardManifest struct {
+	DataHash    common.Hash
+	DataLength  uint64
+	DataShards  int
+	ShardHashes []common.Hash
+}
+
+func (m *ShardManifest) Serialize() []byte {
+	buf := make([]byte, 0, 32+8+2+32*len(m.ShardHashes))
+	buf = append(buf, m.DataHash[:]...)
+	var lengthBuf [8]byte
+	binary.BigEndian.PutUint64(lengthBuf[:], m.DataLength)
+	buf = append(buf, lengthBuf[:]...)
+	buf = append(buf, byte(m.DataShards), byte(len(m.ShardHashes)))
+	for _, hash := range m.ShardHashes {
+		buf = append(buf, hash[:]...)
+	}
+	return buf
+}
+
+func (m *ShardManifest) Commitment() common.Hash {
+	return dastree.Hash(m.Serialize())
+}
+
+func DeserializeShardManifest(buf []byte) (*ShardManifest, error) {
+	if len(buf) < 32+8+2 {
+		return nil, errors.New("shard manifest too short")
+	}
+	m := &ShardManifest{
+		DataHash:   common.BytesToHash(buf[:32]),
+		DataLength: binary.BigEndian.Uint64(buf[32:40]),
+		DataShards: int(buf[40]),
+	}
+	numShards := int(buf[41])
+	if m.DataShards == 0 || m.DataShards > numShards || numShards > maxShards {
+		return nil, fmt.Errorf("invalid shard manifest of %v data shards out of %v", m.DataShards, numShards)
+	}
+	if len(buf) != 32+8+2+32*numShards {
+		return nil, errors.New("shard manifest has the wrong length")
+	}
+	for i := 0; i < numShards; i++ {
+		m.ShardHashes = append(m.ShardHashes, common.BytesToHash(buf[42+32*i:42+32*(i+1)]))
+	}
+	return m, nil
+}
+
+// ShardSize returns the size each of the manifest's shards must be
+func (m *ShardManifest) ShardSize() uint64 {
+	return erasure.ShardSize(m.DataLength, m.DataShards)
+}
+
+// EncodeShards erasure codes a batch into totalShards shards, any dataShards of which can reconstruct it
+func EncodeShards(message []byte, dataShards, totalShards int) (*ShardManifest, [][]byte, error) {
+	if totalShards > maxShards {
+		return nil, nil, fmt.Errorf("can't split a batch into more than %v shards", maxShards)
+	}
+	shards, err := erasure.Encode(message, dataShards, totalShards)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := &ShardManifest{
+		DataHash:   dastree.Hash(message),
+		DataLength: uint64(len(message)),
+		DataShards: dataShards,
+	}
+	for _, shard := range shards {
+		manifest.ShardHashes = append(manifest.ShardHashes, dastree.Hash(shard))
+	}
+	return manifest, shards, nil
+}
+
+type shardResponse struct {
+	index int
+	shard []byte
+	err   error
+}
+
+// ReconstructFromShards gets the manifest with the given commitment, then the manifest's shards in parallel
+// until it has enough to reconstruct the batch with the given hash.
+func ReconstructFromShards(ctx context.Context, reader arbstate.DataAvailabilityReader, dataHash common.Hash, commitment common.Hash) ([]byte, error) {
+	manifestBytes, err := reader.GetByHash(ctx, commitment)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get shard manifest: %w", err)
+	}
+	if !dastree.ValidHash(commitment, manifestBytes) {
+		return nil, fmt.Errorf("shard manifest %w", arbstate.ErrHashMismatch)
+	}
+	manifest, err := DeserializeShardManifest(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.DataHash != dataHash {
+		return nil, fmt.Errorf("shard manifest is for batch %v rather than %v", manifest.DataHash, dataHash)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	responses := make(chan shardResponse, len(manifest.ShardHashes))
+	for i, hash := range manifest.ShardHashes {
+		go func(i int, hash common.Hash) {
+			shard, err := reader.GetByHash(subCtx, hash)
+			if err == nil && (!dastree.ValidHash(hash, shard) || uint64(len(shard)) != manifest.ShardSize()) {
+				err = fmt.Errorf("shard %w", arbstate.ErrHashMismatch)
+			}
+			responses <- shardResponse{i, shard, err}
+		}(i, hash)
+	}
+
+	shards := make([][]byte, len(manifest.ShardHashes))
+	var found int
+	var errs []error
+	for range manifest.ShardHashes {
+		var r shardResponse
+		select {
+		case r = <-responses:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if r.err != nil {
+			log.Debug("couldn't get batch shard", "index", r.index, "hash", manifest.ShardHashes[r.index], "err", r.err)
+			errs = append(errs, r.err)
+			continue
+		}
+		shards[r.index] = r.shard
+		found++
+		if found < manifest.DataShards {
+			continue
+		}
+		data, err := erasure.Reconstruct(shards, manifest.DataShards, manifest.DataLength)
+		if err != nil {
+			return nil, err
+		}
+		if dastree.Hash(data) != dataHash {
+			return nil, fmt.Errorf("reconstructed batch %w", arbstate.ErrHashMismatch)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("only got %v of the %v shards needed to reconstruct batch %v: %v", found, manifest.DataShards, dataHash, errs)
+}
+
+// ShardStorer is implemented by committee members which can store a single shard of an erasure coded batch,
+// returning a certificate for the batch with the given hash and shard commitment, which the manifest must match.
+// The signature is the batch poster's over the manifest, since the member doesn't see the whole batch.
+type ShardStorer interface {
+	StoreShard(ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error)
+}
+
+func storeShard(
+	ctx context.Context, inner DataAvailabilityService, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte,
+) (*arbstate.DataAvailabilityCertificate, error) {
+	storer, ok := inner.(ShardStorer)
+	if !ok {
+		return nil, fmt.Errorf("%v doesn't support storing erasure coded shards", inner)
+	}
+	return storer.StoreShard(ctx, dataHash, commitment, manifest, index, shard, timeout, sig)
+}
+
+// ShardReconstructingDAS lets erasure coded batches be read through a DAS
+// by reconstructing them from the shards it can get.
+type ShardReconstructingDAS struct {
+	DataAvailabilityService
+}
+
+func NewShardReconstructingDAS(inner DataAvailabilityService) *ShardReconstructingDAS {
+	return &ShardReconstructingDAS{inner}
+}
+
+func (d *ShardReconstructingDAS) GetByShards(ctx context.Context, dataHash common.Hash, commitment common.Hash) ([]byte, error) {
+	return ReconstructFromShards(ctx, d.DataAvailabilityService, dataHash, commitment)
+}
+
+func (d *ShardReconstructingDAS) String() string {
+	return fmt.Sprintf("ShardReconstructingDAS{%v}", d.DataAvailabilityService)
+}
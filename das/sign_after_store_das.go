@@ -182,10 +182,88 @@ func (d *SignAfterStoreDAS) Store(
 	return c, nil
 }
 
+// StoreShard stores one shard of an erasure coded batch, along with the manifest of its shards, and signs an
+// erasure coded certificate for the batch with the given hash and shard commitment. Before signing, the member
+// checks the manifest is signed by the batch poster, that it's the one committed to and is for the batch with
+// the given hash, and that the shard is the one it lists at the given index. It can't check the batch's hash
+// matches the batch, or that the aggregator gave each member a different shard, so these rely on the batch poster.
+func (d *SignAfterStoreDAS) StoreShard(
+	ctx context.Context, dataHash, commitment common.Hash, manifest []byte, index uint64, shard []byte, timeout uint64, sig []byte,
+) (c *arbstate.DataAvailabilityCertificate, err error) {
+	log.Trace("das.SignAfterStoreDAS.StoreShard", "dataHash", dataHash, "commitment", commitment, "manifest", pretty.FirstFewBytes(manifest), "index", index, "shard", pretty.FirstFewBytes(shard), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(sig), "this", d)
+	// a shard can't be checked against the batch, so unlike Store, this never skips checking it's from the batch poster
+	if d.bpVerifier == nil {
+		return nil, errors.New("can't store erasure coded shards without the sequencer inbox to check the batch poster's signature")
+	}
+	actualSigner, err := DasRecoverSigner(manifest, timeout, sig)
+	if err != nil {
+		return nil, err
+	}
+	isBatchPoster, err := d.bpVerifier.IsBatchPoster(ctx, actualSigner)
+	if err != nil {
+		return nil, err
+	}
+	if !isBatchPoster {
+		return nil, errors.New("store shard request not properly signed")
+	}
+
+	if dastree.Hash(manifest) != commitment {
+		return nil, fmt.Errorf("shard manifest %w", arbstate.ErrHashMismatch)
+	}
+	m, err := DeserializeShardManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if m.DataHash != dataHash {
+		return nil, fmt.Errorf("shard manifest is for batch %v rather than %v", m.DataHash, dataHash)
+	}
+	if index >= uint64(len(m.ShardHashes)) {
+		return nil, fmt.Errorf("shard index %d out of range for %d shards", index, len(m.ShardHashes))
+	}
+	if uint64(len(shard)) != m.ShardSize() || dastree.Hash(shard) != m.ShardHashes[index] {
+		return nil, fmt.Errorf("shard doesn't match the manifest's shard %d", index)
+	}
+
+	c = &arbstate.DataAvailabilityCertificate{
+		Timeout:         timeout,
+		DataHash:        dataHash,
+		Version:         arbstate.ErasureCodedCertificateVersion,
+		ShardCommitment: commitment,
+		SignersMask:     1, // The aggregator will override this.
+	}
+
+	fields := c.SerializeSignableFields()
+	c.Sig, err = blsSignatures.SignMessage(*d.privKey, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.storageService.Put(ctx, shard, timeout)
+	if err != nil {
+		return nil, err
+	}
+	err = d.storageService.Put(ctx, manifest, timeout)
+	if err != nil {
+		return nil, err
+	}
+	err = d.storageService.Sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.KeysetHash = d.keysetHash
+
+	return c, nil
+}
+
 func (d *SignAfterStoreDAS) GetByHash(ctx context.Context, hash common.Hash) ([]byte, error) {
 	return d.storageService.GetByHash(ctx, hash)
 }
 
+func (d *SignAfterStoreDAS) Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	return listKeys(ctx, d.storageService, since, expiringAfter)
+}
+
 func (d *SignAfterStoreDAS) String() string {
 	return fmt.Sprintf("SignAfterStoreDAS{config:%v}", d.config)
 }
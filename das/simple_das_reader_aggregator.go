@@ -242,6 +242,13 @@ func (a *SimpleDASReaderAggregator) GetByHash(ctx context.Context, hash common.H
 	return nil, fmt.Errorf("Data wasn't able to be retrieved from any DAS Reader: %v", errorCollection)
 }
 
+// GetByShards reconstructs an erasure coded batch which no reader has in full. Each shard is only expected to be
+// found on one of the readers, so the batch is reconstructed from whichever shards are found first.
+func (a *SimpleDASReaderAggregator) GetByShards(ctx context.Context, dataHash common.Hash, commitment common.Hash) ([]byte, error) {
+	log.Trace("das.SimpleDASReaderAggregator.GetByShards", "key", pretty.PrettyHash(dataHash), "commitment", pretty.PrettyHash(commitment), "this", a)
+	return ReconstructFromShards(ctx, a, dataHash, commitment)
+}
+
 func (a *SimpleDASReaderAggregator) tryGetByHash(
 	ctx context.Context, hash common.Hash, reader arbstate.DataAvailabilityReader,
 ) ([]byte, error) {
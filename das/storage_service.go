@@ -4,9 +4,11 @@
 package das
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/tenderly/nitro/go-ethereum/common"
@@ -25,6 +27,78 @@ type StorageService interface {
 	HealthCheck(ctx context.Context) error
 }
 
+var ErrKeysNotSupported = errors.New("listing keys isn't supported")
+
+// KeyLister is implemented by storage services, and the services wrapping them, which can list the keys of the data they hold
+type KeyLister interface {
+	// Keys returns an iterator over the keys greater than since, in ascending order; the zero hash starts
+	// from the beginning. If expiringAfter is non-zero, the keys of data which the storage records as expiring
+	// at or before it are skipped; storage which doesn't record when data expires lists all its keys.
+	Keys(ctx context.Context, since common.Hash, expiringAfter uint64) (KeyIterator, error)
+}
+
+type IterableStorageService interface {
+	StorageService
+	KeyLister
+}
+
+// ExpiryReader is implemented by storage services which record when the data they hold expires
+type ExpiryReader interface {
+	// Expiry returns the expiration time of the data with the given key, or 0 if none is recorded
+	Expiry(ctx context.Context, key common.Hash) (uint64, error)
+}
+
+type KeyIterator interface {
+	// Next returns the next key, or io.EOF once there are no more
+	Next(ctx context.Context) (common.Hash, error)
+}
+
+func listKeys(ctx context.Context, inner interface{}, since common.Hash, expiringAfter uint64) (KeyIterator, error) {
+	lister, ok := inner.(KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("%w by %v", ErrKeysNotSupported, inner)
+	}
+	return lister.Keys(ctx, since, expiringAfter)
+}
+
+func compareKeys(a, b common.Hash) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// keyPageFetcher returns keys greater than after, in ascending order, and whether there may be more after them;
+// a page is only empty if there are no more
+type keyPageFetcher func(ctx context.Context, after common.Hash) ([]common.Hash, bool, error)
+
+// pagedKeyIterator iterates over keys fetched a page at a time, so that no resources are held between calls to Next
+type pagedKeyIterator struct {
+	fetch keyPageFetcher
+	after common.Hash
+	page  []common.Hash
+	done  bool
+}
+
+func newPagedKeyIterator(since common.Hash, fetch keyPageFetcher) *pagedKeyIterator {
+	return &pagedKeyIterator{fetch: fetch, after: since}
+}
+
+func (it *pagedKeyIterator) Next(ctx context.Context) (common.Hash, error) {
+	for len(it.page) == 0 {
+		if it.done {
+			return common.Hash{}, io.EOF
+		}
+		page, more, err := it.fetch(ctx, it.after)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		it.page = page
+		it.done = !more || len(page) == 0
+	}
+	key := it.page[0]
+	it.page = it.page[1:]
+	it.after = key
+	return key, nil
+}
+
 func EncodeStorageServiceKey(key common.Hash) string {
 	return key.Hex()[2:]
 }
@@ -39,3 +113,81 @@ func DecodeStorageServiceKey(input string) (common.Hash, error) {
 	}
 	return common.BytesToHash(key), nil
 }
+
+// filteredKeyIterator skips the keys of another iterator which keep returns false for
+type filteredKeyIterator struct {
+	inner KeyIterator
+	keep  func(ctx context.Context, key common.Hash) (bool, error)
+}
+
+func (it *filteredKeyIterator) Next(ctx context.Context) (common.Hash, error) {
+	for {
+		key, err := it.inner.Next(ctx)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		keep, err := it.keep(ctx, key)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if keep {
+			return key, nil
+		}
+	}
+}
+
+// mergedKeyIterator iterates over the keys of several iterators in ascending order, listing keys they share once
+type mergedKeyIterator struct {
+	iterators []KeyIterator
+	heads     []common.Hash
+	done      []bool
+	started   bool
+}
+
+func newMergedKeyIterator(iterators []KeyIterator) *mergedKeyIterator {
+	return &mergedKeyIterator{
+		iterators: iterators,
+		heads:     make([]common.Hash, len(iterators)),
+		done:      make([]bool, len(iterators)),
+	}
+}
+
+func (it *mergedKeyIterator) advance(ctx context.Context, i int) error {
+	key, err := it.iterators[i].Next(ctx)
+	if errors.Is(err, io.EOF) {
+		it.done[i] = true
+		return nil
+	}
+	it.heads[i] = key
+	return err
+}
+
+func (it *mergedKeyIterator) Next(ctx context.Context) (common.Hash, error) {
+	if !it.started {
+		for i := range it.iterators {
+			if err := it.advance(ctx, i); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		it.started = true
+	}
+	var next common.Hash
+	found := false
+	for i, head := range it.heads {
+		if !it.done[i] && (!found || compareKeys(head, next) < 0) {
+			next = head
+			found = true
+		}
+	}
+	if !found {
+		return common.Hash{}, io.EOF
+	}
+	for i, head := range it.heads {
+		if !it.done[i] && head == next {
+			if err := it.advance(ctx, i); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+	return next, nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/tenderly/nitro/go-ethereum/core/types"
 	"github.com/tenderly/nitro/go-ethereum/log"
 	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/solgen/go/bridgegen"
 	"github.com/tenderly/nitro/util/arbmath"
 	"github.com/tenderly/nitro/util/headerreader"
@@ -120,7 +121,6 @@ func newl1SyncService(config *SyncToStorageConfig, syncTo StorageService, dataSo
 }
 
 func (s *l1SyncService) processBatchDelivered(ctx context.Context, batchDeliveredLog types.Log) error {
-	data := []byte{}
 	deliveredEvent, err := s.inboxContract.ParseSequencerBatchDelivered(batchDeliveredLog)
 	if err != nil {
 		return err
@@ -131,39 +131,9 @@ func (s *l1SyncService) processBatchDelivered(ctx context.Context, batchDelivere
 		// old batch - no need to store
 		return nil
 	}
-	if deliveredEvent.DataLocation == uint8(batchDataSeparateEvent) {
-		query := ethereum.FilterQuery{
-			BlockHash: &batchDeliveredLog.BlockHash,
-			Addresses: []common.Address{s.inboxAddr},
-			Topics:    [][]common.Hash{{sequencerBatchDataABI.ID}, {common.BigToHash(deliveredEvent.BatchSequenceNumber)}},
-		}
-		logs, err := s.l1Reader.Client().FilterLogs(ctx, query)
-		if err != nil {
-			return err
-		}
-		if len(logs) != 1 {
-			return fmt.Errorf("found %d data logs for sequence 0x%x (expected 1)", len(logs), deliveredEvent.BatchSequenceNumber)
-		}
-		dataEvent, err := s.inboxContract.ParseSequencerBatchData(logs[0])
-		if err != nil {
-			return err
-		}
-		data = dataEvent.Data
-	} else if deliveredEvent.DataLocation == uint8(batchDataTxInput) {
-		tx, err := s.l1Reader.Client().TransactionInBlock(ctx, batchDeliveredLog.BlockHash, batchDeliveredLog.TxIndex)
-		if err != nil {
-			return err
-		}
-		args := make(map[string]interface{})
-		err = addSequencerL2BatchFromOriginCallABI.Inputs.UnpackIntoMap(args, tx.Data()[4:])
-		if err != nil {
-			return err
-		}
-		var ok bool
-		data, ok = args["data"].([]byte)
-		if !ok {
-			return fmt.Errorf("couldn't parse data for sequence 0x%x", deliveredEvent.BatchSequenceNumber)
-		}
+	data, err := readBatchData(ctx, s.l1Reader.Client(), s.inboxContract, s.inboxAddr, batchDeliveredLog, deliveredEvent)
+	if err != nil {
+		return err
 	}
 	if len(data) < 1 {
 		// no data - nothing to do
@@ -210,6 +180,54 @@ func (s *l1SyncService) processBatchDelivered(ctx context.Context, batchDelivere
 	return nil
 }
 
+// readBatchData returns the data of the batch a SequencerBatchDelivered event was emitted for,
+// from either the separate SequencerBatchData event or the batch poster's transaction
+func readBatchData(
+	ctx context.Context,
+	l1Client arbutil.L1Interface,
+	inboxContract *bridgegen.SequencerInbox,
+	inboxAddr common.Address,
+	batchDeliveredLog types.Log,
+	deliveredEvent *bridgegen.SequencerInboxSequencerBatchDelivered,
+) ([]byte, error) {
+	data := []byte{}
+	if deliveredEvent.DataLocation == uint8(batchDataSeparateEvent) {
+		query := ethereum.FilterQuery{
+			BlockHash: &batchDeliveredLog.BlockHash,
+			Addresses: []common.Address{inboxAddr},
+			Topics:    [][]common.Hash{{sequencerBatchDataABI.ID}, {common.BigToHash(deliveredEvent.BatchSequenceNumber)}},
+		}
+		logs, err := l1Client.FilterLogs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(logs) != 1 {
+			return nil, fmt.Errorf("found %d data logs for sequence 0x%x (expected 1)", len(logs), deliveredEvent.BatchSequenceNumber)
+		}
+		dataEvent, err := inboxContract.ParseSequencerBatchData(logs[0])
+		if err != nil {
+			return nil, err
+		}
+		data = dataEvent.Data
+	} else if deliveredEvent.DataLocation == uint8(batchDataTxInput) {
+		tx, err := l1Client.TransactionInBlock(ctx, batchDeliveredLog.BlockHash, batchDeliveredLog.TxIndex)
+		if err != nil {
+			return nil, err
+		}
+		args := make(map[string]interface{})
+		err = addSequencerL2BatchFromOriginCallABI.Inputs.UnpackIntoMap(args, tx.Data()[4:])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		data, ok = args["data"].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("couldn't parse data for sequence 0x%x", deliveredEvent.BatchSequenceNumber)
+		}
+	}
+	return data, nil
+}
+
 func (s *l1SyncService) processBlockRange(ctx context.Context, lowerBound, higherBound uint64) error {
 	query := ethereum.FilterQuery{
 		FromBlock: new(big.Int).SetUint64(lowerBound),
@@ -115,13 +115,6 @@ func (a *APIBackend) GetAPIs() []rpc.API {
 		Public:    true,
 	})
 
-	apis = append(apis, rpc.API{
-		Namespace: "txpool",
-		Version:   "1.0",
-		Service:   NewPublicTxPoolAPI(),
-		Public:    true,
-	})
-
 	apis = append(apis, tracers.APIs(a)...)
 
 	return apis
@@ -453,13 +446,19 @@ func (a *APIBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*t
 }
 
 func (a *APIBackend) GetPoolTransactions() (types.Transactions, error) {
-	// Arbitrum doesn't have a pool
-	return types.Transactions{}, nil
+	pool := a.b.txPool()
+	if pool == nil {
+		return types.Transactions{}, nil
+	}
+	return pool.PendingTransactions(), nil
 }
 
 func (a *APIBackend) GetPoolTransaction(txHash common.Hash) *types.Transaction {
-	// Arbitrum doesn't have a pool
-	return nil
+	pool := a.b.txPool()
+	if pool == nil {
+		return nil
+	}
+	return pool.PendingTransaction(txHash)
 }
 
 func (a *APIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
@@ -467,19 +466,32 @@ func (a *APIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uin
 	if err != nil {
 		return 0, err
 	}
-	return stateDB.GetNonce(addr), nil
+	nonce := stateDB.GetNonce(addr)
+	pending, _ := a.poolContent(&addr)
+	if txs := pending[addr]; len(txs) > 0 {
+		nonce = txs[len(txs)-1].Nonce() + 1
+	}
+	return nonce, nil
 }
 
 func (a *APIBackend) Stats() (pending int, queued int) {
-	panic("not implemented") // TODO: Implement
+	pendingTxs, queuedTxs := a.poolContent(nil)
+	for _, txs := range pendingTxs {
+		pending += len(txs)
+	}
+	for _, txs := range queuedTxs {
+		queued += len(txs)
+	}
+	return pending, queued
 }
 
 func (a *APIBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
-	panic("not implemented") // TODO: Implement
+	return a.poolContent(nil)
 }
 
 func (a *APIBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
-	panic("not implemented") // TODO: Implement
+	pending, queued := a.poolContent(&addr)
+	return pending[addr], queued[addr]
 }
 
 func (a *APIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
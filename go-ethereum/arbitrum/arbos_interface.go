@@ -3,8 +3,10 @@ package arbitrum
 import (
 	"context"
 
+	"github.com/tenderly/nitro/go-ethereum/common"
 	"github.com/tenderly/nitro/go-ethereum/core"
 	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/event"
 )
 
 type ArbInterface interface {
@@ -12,3 +14,11 @@ type ArbInterface interface {
 	BlockChain() *core.BlockChain
 	ArbNode() interface{}
 }
+
+// ArbTxPool is optionally implemented by an ArbInterface which keeps track of
+// transactions that have been published but not yet included in a block.
+type ArbTxPool interface {
+	PendingTransactions() types.Transactions
+	PendingTransaction(txHash common.Hash) *types.Transaction
+	SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription
+}
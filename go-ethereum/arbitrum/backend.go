@@ -65,9 +65,21 @@ func (b *Backend) EnqueueL2Message(ctx context.Context, tx *types.Transaction) e
 }
 
 func (b *Backend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	if pool := b.txPool(); pool != nil {
+		return b.scope.Track(pool.SubscribeNewTxsEvent(ch))
+	}
 	return b.scope.Track(b.txFeed.Subscribe(ch))
 }
 
+// txPool returns the pool of transactions that are published but not yet included, or nil if there's none
+func (b *Backend) txPool() ArbTxPool {
+	pool, ok := b.arb.(ArbTxPool)
+	if !ok {
+		return nil
+	}
+	return pool
+}
+
 func (b *Backend) Stack() *node.Node {
 	return b.stack
 }
@@ -1,17 +1,50 @@
 package arbitrum
 
-// PublicNetAPI offers network related RPC methods
-type PublicTxPoolAPI struct{}
+import (
+	"sort"
 
-// NewPublicNetAPI creates a new net API instance.
-func NewPublicTxPoolAPI() *PublicTxPoolAPI {
-	return &PublicTxPoolAPI{}
-}
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+)
 
-// Version returns the current ethereum protocol version.
-func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*struct{} {
-	return map[string]map[string]map[string]*struct{}{
-		"pending": make(map[string]map[string]*struct{}),
-		"queued":  make(map[string]map[string]*struct{}),
+// poolContent groups the pool's transactions by sender, splitting them into pending ones,
+// which are executable in nonce order on top of the latest state, and queued ones,
+// which are waiting for a nonce gap to be filled.
+// If from is non-nil, only transactions of that sender are returned.
+func (a *APIBackend) poolContent(from *common.Address) (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	pending := make(map[common.Address]types.Transactions)
+	queued := make(map[common.Address]types.Transactions)
+	pool := a.b.txPool()
+	if pool == nil {
+		return pending, queued
+	}
+	stateDB, err := a.blockChain().State()
+	if err != nil {
+		return pending, queued
+	}
+	signer := types.LatestSigner(a.ChainConfig())
+	bySender := make(map[common.Address]types.Transactions)
+	for _, tx := range pool.PendingTransactions() {
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		if from != nil && sender != *from {
+			continue
+		}
+		bySender[sender] = append(bySender[sender], tx)
+	}
+	for sender, txs := range bySender {
+		sort.Sort(types.TxByNonce(txs))
+		nextNonce := stateDB.GetNonce(sender)
+		for _, tx := range txs {
+			if tx.Nonce() == nextNonce {
+				pending[sender] = append(pending[sender], tx)
+				nextNonce++
+			} else {
+				queued[sender] = append(queued[sender], tx)
+			}
+		}
 	}
+	return pending, queued
 }
@@ -538,6 +538,9 @@ func toBlockNumArg(number *big.Int) string {
 	if number.Cmp(pending) == 0 {
 		return "pending"
 	}
+	if number.Cmp(big.NewInt(rpc.FinalizedBlockNumber.Int64())) == 0 {
+		return "finalized"
+	}
 	return hexutil.EncodeBig(number)
 }
 
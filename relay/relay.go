@@ -6,10 +6,15 @@ package relay
 import (
 	"context"
 	"errors"
+	"math/big"
 	"net"
+	"sync"
 	"time"
 
-	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/go-ethereum/core/rawdb"
+	"github.com/tenderly/nitro/go-ethereum/ethdb"
+	"github.com/tenderly/nitro/go-ethereum/log"
+
 	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/broadcastclient"
 	"github.com/tenderly/nitro/broadcaster"
@@ -19,51 +24,126 @@ import (
 
 type Relay struct {
 	stopwaiter.StopWaiter
-	broadcastClients            []*broadcastclient.BroadcastClient
 	broadcaster                 *broadcaster.Broadcaster
 	confirmedSequenceNumberChan chan arbutil.MessageIndex
-	messageChan                 chan broadcastFeedMessage
+	messageChan                 chan *broadcaster.BroadcastFeedMessage
+	backlogDb                   ethdb.Database
+	clientConfig                broadcastclient.BroadcastClientConfig
+	treeConfig                  TreeConfig
+
+	// Protects upstreams, parent and the sequence numbers
+	upstreamsMutex  sync.Mutex
+	upstreams       []*upstream
+	parent          int // the index of the only upstream connected to in tree mode
+	lastSeqNum      arbutil.MessageIndex
+	relayed         bool // whether lastSeqNum is set
+	confirmedSeqNum arbutil.MessageIndex
+	confirmed       bool // whether confirmedSeqNum is set
 }
 
-type broadcastFeedMessage struct {
-	message        arbstate.MessageWithMetadata
-	sequenceNumber arbutil.MessageIndex
-}
+// NewRelay creates a relay, which needs the L2 chain id if it's to accept filtered subscriptions.
+// In tree mode it takes messages from one upstream at a time, otherwise from all of them.
+func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig, backlogConf broadcaster.BacklogConfig, treeConf TreeConfig, chainId *big.Int) (*Relay, error) {
+	if err := treeConf.Validate(); err != nil {
+		return nil, err
+	}
+	if treeConf.Enable && !clientConf.Enable() {
+		return nil, errors.New("relay tree mode needs at least one upstream feed")
+	}
 
-type RelayMessageQueue struct {
-	queue chan broadcastFeedMessage
-}
+	var backlogDb ethdb.Database
+	var backlog *broadcaster.FeedBacklog
+	r := &Relay{
+		confirmedSequenceNumberChan: make(chan arbutil.MessageIndex, 10),
+		messageChan:                 make(chan *broadcaster.BroadcastFeedMessage, 100),
+		clientConfig:                clientConf,
+		treeConfig:                  treeConf,
+	}
+	if backlogConf.Enable {
+		var err error
+		backlogDb, err = rawdb.NewLevelDBDatabase(backlogConf.Dir, 0, 0, "relay/backlog", false)
+		if err != nil {
+			return nil, err
+		}
+		backlog, err = broadcaster.NewFeedBacklog(backlogDb, backlogConf)
+		if err != nil {
+			_ = backlogDb.Close()
+			return nil, err
+		}
+		// resume from the end of the backlog rather than taking whatever the upstream feed has buffered
+		if _, last, ok := backlog.Range(); ok {
+			r.lastSeqNum = last
+			r.relayed = true
+		}
+	}
+	r.backlogDb = backlogDb
 
-func (q *RelayMessageQueue) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
-	for i, message := range messages {
-		q.queue <- broadcastFeedMessage{
-			sequenceNumber: pos + arbutil.MessageIndex(i),
-			message:        message,
+	for _, address := range clientConf.URLs {
+		r.upstreams = append(r.upstreams, &upstream{url: address})
+	}
+	for i := range r.upstreams {
+		if treeConf.Enable && i != r.parent {
+			continue
+		}
+		if err := r.newUpstreamClient(i); err != nil {
+			if backlogDb != nil {
+				_ = backlogDb.Close()
+			}
+			return nil, err
 		}
 	}
 
-	return nil
+	// messages are relayed with the sequencer's signatures, so the relay doesn't sign them itself
+	r.broadcaster = broadcaster.NewBroadcasterWithBacklog(serverConf, chainId, nil, backlog)
+	return r, nil
 }
 
-func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig) *Relay {
-	var broadcastClients []*broadcastclient.BroadcastClient
-
-	q := RelayMessageQueue{make(chan broadcastFeedMessage, 100)}
-
-	confirmedSequenceNumberListener := make(chan arbutil.MessageIndex, 10)
+// newUpstreamClient creates a client for an upstream, which resumes from the last message relayed
+func (r *Relay) newUpstreamClient(index int) error {
+	r.upstreamsMutex.Lock()
+	defer r.upstreamsMutex.Unlock()
+	u := r.upstreams[index]
+	var lastSeqNum *big.Int
+	if r.relayed {
+		lastSeqNum = new(big.Int).SetUint64(uint64(r.lastSeqNum))
+		u.highestSeqNum = r.lastSeqNum
+		u.received = true
+	}
+	client, err := broadcastclient.NewBroadcastClient(r.clientConfig, u.url, lastSeqNum, &upstreamStreamer{r, u})
+	if err != nil {
+		return err
+	}
+	client.ConfirmedSequenceNumberListener = r.confirmedSequenceNumberChan
+	u.client = client
+	u.lastRetryCount = 0
+	u.disconnects = nil
+	u.lastReceived = time.Now()
+	return nil
+}
 
-	for _, address := range clientConf.URLs {
-		client := broadcastclient.NewBroadcastClient(address, nil, clientConf.Timeout, &q)
-		client.ConfirmedSequenceNumberListener = confirmedSequenceNumberListener
-		broadcastClients = append(broadcastClients, client)
+// connectUpstream creates and starts a client for the new parent
+func (r *Relay) connectUpstream(ctx context.Context, index int) error {
+	if err := r.newUpstreamClient(index); err != nil {
+		return err
 	}
+	r.upstreamsMutex.Lock()
+	client := r.upstreams[index].client
+	r.upstreamsMutex.Unlock()
+	client.Start(ctx)
+	return nil
+}
 
-	return &Relay{
-		broadcaster:                 broadcaster.NewBroadcaster(serverConf),
-		broadcastClients:            broadcastClients,
-		confirmedSequenceNumberChan: confirmedSequenceNumberListener,
-		messageChan:                 q.queue,
+// clients returns the clients of the upstreams currently connected to
+func (r *Relay) clients() []*broadcastclient.BroadcastClient {
+	r.upstreamsMutex.Lock()
+	defer r.upstreamsMutex.Unlock()
+	var clients []*broadcastclient.BroadcastClient
+	for _, u := range r.upstreams {
+		if u.client != nil {
+			clients = append(clients, u.client)
+		}
 	}
+	return clients
 }
 
 const RECENT_FEED_ITEM_TTL time.Duration = time.Second * 10
@@ -75,7 +155,7 @@ func (r *Relay) Start(ctx context.Context) error {
 		return errors.New("broadcast unable to start")
 	}
 
-	for _, client := range r.broadcastClients {
+	for _, client := range r.clients() {
 		client.Start(ctx)
 	}
 
@@ -88,12 +168,27 @@ func (r *Relay) Start(ctx context.Context) error {
 			case <-ctx.Done():
 				return
 			case msg := <-r.messageChan:
-				if recentFeedItems[msg.sequenceNumber] != (time.Time{}) {
+				if recentFeedItems[msg.SequenceNumber] != (time.Time{}) {
 					continue
 				}
-				recentFeedItems[msg.sequenceNumber] = time.Now()
-				r.broadcaster.BroadcastSingle(msg.message, msg.sequenceNumber)
+				recentFeedItems[msg.SequenceNumber] = time.Now()
+				r.broadcaster.Broadcast(broadcaster.BroadcastMessage{
+					Version:  1,
+					Messages: []*broadcaster.BroadcastFeedMessage{msg},
+				})
+				r.upstreamsMutex.Lock()
+				if !r.relayed || msg.SequenceNumber > r.lastSeqNum {
+					r.lastSeqNum = msg.SequenceNumber
+					r.relayed = true
+				}
+				r.upstreamsMutex.Unlock()
 			case cs := <-r.confirmedSequenceNumberChan:
+				r.upstreamsMutex.Lock()
+				if !r.confirmed || cs > r.confirmedSeqNum {
+					r.confirmedSeqNum = cs
+					r.confirmed = true
+				}
+				r.upstreamsMutex.Unlock()
 				r.broadcaster.Confirm(cs)
 			case <-recentFeedItemsCleanup.C:
 				// Clear expired items from recentFeedItems
@@ -107,6 +202,11 @@ func (r *Relay) Start(ctx context.Context) error {
 		}
 	})
 
+	r.CallIteratively(r.checkUpstreams)
+	if r.treeConfig.StatusAddr != "" {
+		r.LaunchThread(r.launchStatusServer)
+	}
+
 	return nil
 }
 
@@ -116,8 +216,13 @@ func (r *Relay) GetListenerAddr() net.Addr {
 
 func (r *Relay) StopAndWait() {
 	r.StopWaiter.StopAndWait()
-	for _, client := range r.broadcastClients {
+	for _, client := range r.clients() {
 		client.StopAndWait()
 	}
 	r.broadcaster.StopAndWait()
+	if r.backlogDb != nil {
+		if err := r.backlogDb.Close(); err != nil {
+			log.Warn("error closing feed backlog", "err", err)
+		}
+	}
 }
@@ -0,0 +1,132 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/arbstate"
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/broadcastclient"
+	"github.com/tenderly/nitro/broadcaster"
+	"github.com/tenderly/nitro/wsbroadcastserver"
+)
+
+func feedUrl(b *broadcaster.Broadcaster) string {
+	return "ws://127.0.0.1:" + strconv.Itoa(b.ListenerAddr().(*net.TCPAddr).Port)
+}
+
+func waitForStatus(t *testing.T, r *Relay, check func(Status) bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if check(r.Status()) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("relay didn't reach the expected status", r.Status())
+}
+
+func TestRelayReparentsWhenUpstreamDegrades(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	upstreams := make([]*broadcaster.Broadcaster, 2)
+	for i := range upstreams {
+		upstreams[i] = broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil, nil)
+		if err := upstreams[i].Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer upstreams[1].StopAndWait()
+
+	clientConfig := broadcastclient.DefaultBroadcastClientConfig
+	clientConfig.URLs = []string{feedUrl(upstreams[0]), feedUrl(upstreams[1])}
+	relay, err := NewRelay(wsbroadcastserver.DefaultTestBroadcasterConfig, clientConfig, broadcaster.BacklogConfig{}, TestTreeConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := relay.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer relay.StopAndWait()
+
+	if status := relay.Status(); status.Parent != clientConfig.URLs[0] || !status.Upstreams[0].Connected || status.Upstreams[1].Connected {
+		t.Fatal("expected relay to only connect to the first upstream", status)
+	}
+	upstreams[0].BroadcastSingle(arbstate.MessageWithMetadata{}, 1)
+	waitForStatus(t, relay, func(status Status) bool {
+		return status.LastSequenceNumber == 1
+	})
+
+	// the relay's client keeps failing to reconnect to the stopped upstream, so it switches to the other
+	upstreams[0].StopAndWait()
+	waitForStatus(t, relay, func(status Status) bool {
+		return status.Parent == clientConfig.URLs[1] && status.Upstreams[1].Connected
+	})
+	upstreams[1].BroadcastSingle(arbstate.MessageWithMetadata{}, 1)
+	upstreams[1].BroadcastSingle(arbstate.MessageWithMetadata{}, 2)
+	waitForStatus(t, relay, func(status Status) bool {
+		return status.LastSequenceNumber == 2
+	})
+
+	recorder := httptest.NewRecorder()
+	relay.ServeHTTP(recorder, httptest.NewRequest("GET", statusRequestPath, nil))
+	var status Status
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Tree || status.Parent != clientConfig.URLs[1] || status.Upstreams[0].RecentDegradations != 1 || status.LastSequenceNumber != arbutil.MessageIndex(2) {
+		t.Fatal("unexpected status served", status)
+	}
+}
+
+func TestUpstreamLagAndStall(t *testing.T) {
+	config := TestTreeConfig
+	config.StallTimeout = time.Minute
+	r := &Relay{treeConfig: config}
+	now := time.Now()
+	parent := &upstream{url: "ws://parent", client: &broadcastclient.BroadcastClient{}, received: true, highestSeqNum: 100, lastReceived: now}
+	other := &upstream{url: "ws://other", received: true, highestSeqNum: 100}
+	r.upstreams = []*upstream{parent, other}
+	r.lastSeqNum = 100
+	r.relayed = true
+	if reason := r.updateHealth(parent, now); reason != "" {
+		t.Fatal("healthy upstream degraded", reason)
+	}
+
+	// an upstream falling behind the messages relayed from another is degraded without any confirmations
+	r.lastSeqNum = 111
+	if reason := r.updateHealth(other, now); reason == "" || r.lag(other) != 11 {
+		t.Fatal("lagging upstream not degraded", r.lag(other))
+	}
+	r.lastSeqNum = 100
+
+	// as is one behind the latest confirmation
+	r.confirmedSeqNum = 111
+	r.confirmed = true
+	if reason := r.updateHealth(other, now); reason == "" {
+		t.Fatal("upstream missing confirmed messages not degraded")
+	}
+	r.confirmedSeqNum = 100
+
+	// a parent which stops sending messages can't fall behind anything, so it's degraded once it's stalled
+	if reason := r.updateHealth(parent, now.Add(config.StallTimeout/2)); reason != "" {
+		t.Fatal("upstream degraded before the stall timeout", reason)
+	}
+	if reason := r.updateHealth(parent, now.Add(config.StallTimeout+time.Second)); reason == "" {
+		t.Fatal("stalled parent not degraded")
+	}
+	// an upstream which isn't connected to isn't expected to send anything
+	if reason := r.updateHealth(other, now.Add(config.StallTimeout+time.Second)); reason != "" {
+		t.Fatal("disconnected upstream degraded for stalling", reason)
+	}
+}
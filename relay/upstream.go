@@ -0,0 +1,304 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/arbutil"
+	"github.com/tenderly/nitro/broadcastclient"
+	"github.com/tenderly/nitro/broadcaster"
+	"github.com/tenderly/nitro/go-ethereum/log"
+)
+
+type TreeConfig struct {
+	Enable           bool          `koanf:"enable"`
+	CheckInterval    time.Duration `koanf:"check-interval"`
+	MaxLag           uint64        `koanf:"max-lag"`
+	StallTimeout     time.Duration `koanf:"stall-timeout"`
+	MaxDisconnects   int           `koanf:"max-disconnects"`
+	DisconnectWindow time.Duration `koanf:"disconnect-window"`
+	DegradedPenalty  time.Duration `koanf:"degraded-penalty"`
+	StatusAddr       string        `koanf:"status-addr"`
+}
+
+func TreeConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultTreeConfig.Enable, "connect to a single upstream feed at a time, in order of preference from the input URLs, and re-parent to another when it degrades")
+	f.Duration(prefix+".check-interval", DefaultTreeConfig.CheckInterval, "how often to check the health of the upstream feeds")
+	f.Uint64(prefix+".max-lag", DefaultTreeConfig.MaxLag, "number of messages an upstream can be behind the latest confirmed or relayed message, from any upstream, before it's degraded (0 to not check)")
+	f.Duration(prefix+".stall-timeout", DefaultTreeConfig.StallTimeout, "how long a connected upstream can go without sending a message before it's degraded, as the parent is the only source of newer messages to compare it with (0 to not check, as on a chain which can go that long without a message)")
+	f.Int(prefix+".max-disconnects", DefaultTreeConfig.MaxDisconnects, "number of disconnects or failed connection attempts within the disconnect window above which an upstream is degraded (0 to not check)")
+	f.Duration(prefix+".disconnect-window", DefaultTreeConfig.DisconnectWindow, "period disconnects are counted over")
+	f.Duration(prefix+".degraded-penalty", DefaultTreeConfig.DegradedPenalty, "how long an upstream having degraded counts against it when choosing a new parent")
+	f.String(prefix+".status-addr", DefaultTreeConfig.StatusAddr, "address to serve the relay's status as JSON on at /status (empty to disable)")
+}
+
+var DefaultTreeConfig = TreeConfig{
+	Enable:           false,
+	CheckInterval:    5 * time.Second,
+	MaxLag:           100,
+	StallTimeout:     time.Minute,
+	MaxDisconnects:   5,
+	DisconnectWindow: time.Minute,
+	DegradedPenalty:  10 * time.Minute,
+	StatusAddr:       "",
+}
+
+var TestTreeConfig = TreeConfig{
+	Enable:           true,
+	CheckInterval:    100 * time.Millisecond,
+	MaxLag:           10,
+	StallTimeout:     time.Minute,
+	MaxDisconnects:   1,
+	DisconnectWindow: time.Minute,
+	DegradedPenalty:  time.Minute,
+}
+
+func (c *TreeConfig) Validate() error {
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("invalid upstream check interval %v", c.CheckInterval)
+	}
+	if c.StallTimeout < 0 {
+		return fmt.Errorf("invalid upstream stall timeout %v", c.StallTimeout)
+	}
+	if c.MaxDisconnects > 0 && c.DisconnectWindow <= 0 {
+		return fmt.Errorf("invalid disconnect window %v", c.DisconnectWindow)
+	}
+	return nil
+}
+
+// upstream is a feed the relay can take messages from, along with how healthy it's been
+type upstream struct {
+	url    string
+	client *broadcastclient.BroadcastClient // nil while not connected to
+
+	received       bool
+	highestSeqNum  arbutil.MessageIndex
+	lastReceived   time.Time // when the upstream last sent a message, or was connected to if it hasn't since
+	lastRetryCount int64
+	disconnects    []time.Time
+	degradations   []time.Time
+	degradedReason string
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	for len(times) > 0 && times[0].Before(cutoff) {
+		times = times[1:]
+	}
+	return times
+}
+
+// upstreamStreamer passes on an upstream's messages, recording how far it's got
+type upstreamStreamer struct {
+	relay    *Relay
+	upstream *upstream
+}
+
+func (s *upstreamStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	s.relay.upstreamsMutex.Lock()
+	for _, feedMessage := range feedMessages {
+		if !s.upstream.received || feedMessage.SequenceNumber > s.upstream.highestSeqNum {
+			s.upstream.highestSeqNum = feedMessage.SequenceNumber
+			s.upstream.received = true
+		}
+	}
+	if len(feedMessages) > 0 {
+		s.upstream.lastReceived = time.Now()
+	}
+	s.relay.upstreamsMutex.Unlock()
+	// give up if the relay stops, so that the client can too
+	ctx := s.relay.GetContext()
+	for _, feedMessage := range feedMessages {
+		select {
+		case s.relay.messageChan <- feedMessage:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// lag returns how many messages an upstream is behind the latest confirmed message or the latest relayed from any upstream.
+// In tree mode, confirmations only come from the parent, so a stalled parent also has to be caught by the stall timeout.
+// must hold upstreamsMutex
+func (r *Relay) lag(u *upstream) uint64 {
+	if !u.received {
+		return 0
+	}
+	var latest arbutil.MessageIndex
+	if r.confirmed {
+		latest = r.confirmedSeqNum
+	}
+	if r.relayed && r.lastSeqNum > latest {
+		latest = r.lastSeqNum
+	}
+	if latest <= u.highestSeqNum {
+		return 0
+	}
+	return uint64(latest - u.highestSeqNum)
+}
+
+// updateHealth records an upstream's disconnects since the last check, and returns why it's degraded, or "" if it isn't
+// must hold upstreamsMutex
+func (r *Relay) updateHealth(u *upstream, now time.Time) string {
+	if u.client != nil {
+		retryCount := u.client.GetRetryCount()
+		for ; u.lastRetryCount < retryCount; u.lastRetryCount++ {
+			u.disconnects = append(u.disconnects, now)
+		}
+	}
+	u.disconnects = pruneBefore(u.disconnects, now.Add(-r.treeConfig.DisconnectWindow))
+	u.degradations = pruneBefore(u.degradations, now.Add(-r.treeConfig.DegradedPenalty))
+	if r.treeConfig.MaxDisconnects > 0 && len(u.disconnects) > r.treeConfig.MaxDisconnects {
+		return fmt.Sprintf("%v disconnects in the last %v", len(u.disconnects), r.treeConfig.DisconnectWindow)
+	}
+	if lag := r.lag(u); r.treeConfig.MaxLag > 0 && lag > r.treeConfig.MaxLag {
+		return fmt.Sprintf("%v messages behind", lag)
+	}
+	if r.treeConfig.StallTimeout > 0 && u.client != nil && now.Sub(u.lastReceived) > r.treeConfig.StallTimeout {
+		return fmt.Sprintf("no messages for %v", now.Sub(u.lastReceived).Truncate(time.Second))
+	}
+	return ""
+}
+
+// chooseParent returns the upstream other than the current parent which has degraded least recently,
+// preferring those listed first, or -1 if there's no other upstream
+// must hold upstreamsMutex
+func (r *Relay) chooseParent() int {
+	best := -1
+	for i, u := range r.upstreams {
+		if i == r.parent {
+			continue
+		}
+		if best == -1 || len(u.degradations) < len(r.upstreams[best].degradations) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (r *Relay) checkUpstreams(ctx context.Context) time.Duration {
+	now := time.Now()
+	r.upstreamsMutex.Lock()
+	for _, u := range r.upstreams {
+		reason := r.updateHealth(u, now)
+		if reason != "" && u.degradedReason == "" {
+			log.Warn("upstream feed degraded", "url", u.url, "reason", reason)
+		}
+		u.degradedReason = reason
+	}
+	next := -1
+	var old *broadcastclient.BroadcastClient
+	if r.treeConfig.Enable {
+		parent := r.upstreams[r.parent]
+		if parent.degradedReason != "" {
+			next = r.chooseParent()
+		}
+		if next >= 0 {
+			log.Warn("re-parenting relay", "from", parent.url, "to", r.upstreams[next].url, "reason", parent.degradedReason)
+			parent.degradations = append(parent.degradations, now)
+			old = parent.client
+			parent.client = nil
+			r.parent = next
+		}
+	}
+	r.upstreamsMutex.Unlock()
+
+	if next >= 0 {
+		// the old client may be waiting to pass on a message, so it's stopped without holding the mutex
+		old.StopAndWait()
+		if err := r.connectUpstream(ctx, next); err != nil {
+			log.Error("error connecting to new parent feed", "url", r.upstreams[next].url, "err", err)
+		}
+	}
+	return r.treeConfig.CheckInterval
+}
+
+type UpstreamStatus struct {
+	URL                   string               `json:"url"`
+	Connected             bool                 `json:"connected"`
+	HighestSequenceNumber arbutil.MessageIndex `json:"highestSequenceNumber"`
+	Lag                   uint64               `json:"lag"`
+	RecentDisconnects     int                  `json:"recentDisconnects"`
+	RecentDegradations    int                  `json:"recentDegradations"`
+	Degraded              string               `json:"degraded,omitempty"`
+}
+
+// Status describes a relay's place in the feed tree: which upstreams it's taking messages from and how they're doing,
+// and how many clients it's feeding
+type Status struct {
+	Tree                    bool                 `json:"tree"`
+	Parent                  string               `json:"parent,omitempty"`
+	Clients                 int32                `json:"clients"`
+	LastSequenceNumber      arbutil.MessageIndex `json:"lastSequenceNumber"`
+	ConfirmedSequenceNumber arbutil.MessageIndex `json:"confirmedSequenceNumber"`
+	Upstreams               []UpstreamStatus     `json:"upstreams"`
+}
+
+func (r *Relay) Status() Status {
+	r.upstreamsMutex.Lock()
+	defer r.upstreamsMutex.Unlock()
+	status := Status{
+		Tree:                    r.treeConfig.Enable,
+		Clients:                 r.broadcaster.ClientCount(),
+		LastSequenceNumber:      r.lastSeqNum,
+		ConfirmedSequenceNumber: r.confirmedSeqNum,
+	}
+	if r.treeConfig.Enable {
+		status.Parent = r.upstreams[r.parent].url
+	}
+	for _, u := range r.upstreams {
+		status.Upstreams = append(status.Upstreams, UpstreamStatus{
+			URL:                   u.url,
+			Connected:             u.client != nil,
+			HighestSequenceNumber: u.highestSeqNum,
+			Lag:                   r.lag(u),
+			RecentDisconnects:     len(u.disconnects),
+			RecentDegradations:    len(u.degradations),
+			Degraded:              u.degradedReason,
+		})
+	}
+	return status
+}
+
+const statusRequestPath = "/status"
+
+func (r *Relay) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != statusRequestPath {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(response).Encode(r.Status()); err != nil {
+		log.Warn("failed encoding and writing relay status", "err", err)
+	}
+}
+
+func (r *Relay) launchStatusServer(ctx context.Context) {
+	server := &http.Server{
+		Addr:              r.treeConfig.StatusAddr,
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		err := server.Shutdown(context.Background())
+		if err != nil {
+			log.Warn("error shutting down relay status server", "err", err)
+		}
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Warn("error serving relay status", "err", err)
+	}
+}
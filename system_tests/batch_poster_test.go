@@ -0,0 +1,131 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/crypto"
+	"github.com/tenderly/nitro/go-ethereum/params"
+	"github.com/tenderly/nitro/arbnode"
+	"github.com/tenderly/nitro/solgen/go/bridgegen"
+)
+
+func TestBatchPosterExtraKeys(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l1info, l1client, l1backend, l1stack := CreateTestL1BlockChain(t, nil)
+	defer requireClose(t, l1stack)
+	chainConfig := params.ArbitrumDevTestChainConfig()
+	l2info, l2stack, l2chainDb, l2arbDb, l2blockchain := createL2BlockChain(t, nil, "", chainConfig)
+	addresses := DeployOnTestL1(t, ctx, l1info, l1client, chainConfig.ChainID)
+
+	// fund the extra batch poster and allow it to post to the sequencer inbox
+	l1info.GenerateAccount("ExtraBatchPoster")
+	SendWaitTestTransactions(t, ctx, l1client, []*types.Transaction{
+		l1info.PrepareTx("Faucet", "ExtraBatchPoster", 30000, big.NewInt(params.Ether), nil),
+	})
+	seqInbox, err := bridgegen.NewSequencerInbox(addresses.SequencerInbox, l1client)
+	Require(t, err)
+	ownerOpts := l1info.GetDefaultTransactOpts("RollupOwner", ctx)
+	tx, err := seqInbox.SetIsBatchPoster(&ownerOpts, l1info.GetAddress("ExtraBatchPoster"), true)
+	Require(t, err)
+	_, err = EnsureTxSucceeded(ctx, l1client, tx)
+	Require(t, err)
+
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.MaxInFlightBatches = 3
+	extraKey := l1info.GetInfoWithPrivKey("ExtraBatchPoster").PrivateKey
+	conf.BatchPoster.ExtraPrivateKeys = []string{common.Bytes2Hex(crypto.FromECDSA(extraKey))}
+	sequencerTxOpts := l1info.GetDefaultTransactOpts("Sequencer", ctx)
+	node, err := arbnode.CreateNode(ctx, l2stack, l2chainDb, l2arbDb, conf, l2blockchain, l1client, addresses, &sequencerTxOpts, nil)
+	Require(t, err)
+	Require(t, l2stack.Start())
+	defer requireClose(t, l2stack)
+	l2client := ClientForStack(t, l2stack)
+
+	l2clientB, _, l2stackB := Create2ndNode(t, ctx, node, l1stack, &l2info.ArbInitData, nil)
+	defer requireClose(t, l2stackB)
+
+	l2info.GenerateAccount("User2")
+	var txs []*types.Transaction
+	sendTx := func() {
+		tx := l2info.PrepareTx("Owner", "User2", l2info.TransferGas, big.NewInt(1e12), nil)
+		Require(t, l2client.SendTransaction(ctx, tx))
+		_, err = EnsureTxSucceeded(ctx, l2client, tx)
+		Require(t, err)
+		txs = append(txs, tx)
+	}
+	// keeps L1 blocks coming for the data posters and the second node's inbox reader until it has every transaction
+	waitForTxs := func() {
+		for _, tx := range txs {
+			for i := 0; ; i++ {
+				_, err = WaitForTx(ctx, l2clientB, tx.Hash(), time.Second)
+				if err == nil {
+					break
+				}
+				if i >= 30 {
+					Fail(t, "transaction not read from L1", tx.Hash(), err)
+				}
+				SendWaitTestTransactions(t, ctx, l1client, []*types.Transaction{
+					l1info.PrepareTx("Faucet", "User", 30000, big.NewInt(1e12), nil),
+				})
+			}
+		}
+	}
+	sendTx()
+	waitForTxs()
+
+	posters := []common.Address{l1info.GetAddress("Sequencer"), l1info.GetAddress("ExtraBatchPoster")}
+	startNonces := make([]uint64, len(posters))
+	for i, poster := range posters {
+		startNonces[i], err = l1client.PendingNonceAt(ctx, poster)
+		Require(t, err)
+	}
+	postedBatches := func() []uint64 {
+		posted := make([]uint64, len(posters))
+		for i, poster := range posters {
+			nonce, err := l1client.PendingNonceAt(ctx, poster)
+			Require(t, err)
+			posted[i] = nonce - startNonces[i]
+		}
+		return posted
+	}
+
+	// With L1 blocks stalled the first batch stays in flight, so the next one is posted by the other key.
+	// Once mined, the two may be included in either order, and a batch which reverted for it is posted again.
+	l1backend.StopMining()
+	for batch := uint64(1); batch <= 2; batch++ {
+		sendTx()
+		for i := 0; ; i++ {
+			if i >= 500 {
+				Fail(t, "batch", batch, "not posted")
+			}
+			posted := postedBatches()
+			if posted[0]+posted[1] >= batch {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	posted := postedBatches()
+	if posted[0] != 1 || posted[1] != 1 {
+		Fail(t, "in-flight batches not spread across batch poster keys", posted)
+	}
+	Require(t, l1backend.StartMining(1))
+	waitForTxs()
+
+	l2balance, err := l2clientB.BalanceAt(ctx, l2info.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(int64(len(txs))*1e12)) != 0 {
+		Fail(t, "Unexpected balance:", l2balance)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/go-ethereum/common/hexutil"
+	"github.com/tenderly/nitro/go-ethereum/core/types"
+	"github.com/tenderly/nitro/go-ethereum/params"
+	"github.com/tenderly/nitro/arbnode"
+)
+
+func encodeBundle(t *testing.T, txs ...*types.Transaction) []hexutil.Bytes {
+	encodedTxs := make([]hexutil.Bytes, 0, len(txs))
+	for _, tx := range txs {
+		txBytes, err := tx.MarshalBinary()
+		Require(t, err)
+		encodedTxs = append(encodedTxs, txBytes)
+	}
+	return encodedTxs
+}
+
+func TestSendBundle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l2info, _, client, l2stack := CreateTestL2(t, ctx)
+	defer requireClose(t, l2stack)
+	rpcClient, err := l2stack.Attach()
+	Require(t, err)
+
+	l2info.GenerateAccount("User2")
+	l2info.GenerateAccount("Poor")
+	owner := l2info.GetAddress("Owner")
+	first := l2info.PrepareTx("Owner", "User2", l2info.TransferGas, big.NewInt(1e12), nil)
+	second := l2info.PrepareTx("Owner", "User2", l2info.TransferGas, big.NewInt(1e12), nil)
+	unfunded := l2info.PrepareTx("Poor", "User2", l2info.TransferGas, big.NewInt(params.Ether), nil)
+
+	// nothing in the bundle is included if any of its transactions fails
+	var hashes []common.Hash
+	err = rpcClient.CallContext(ctx, &hashes, "arb_sendBundle", encodeBundle(t, first, unfunded), nil)
+	if err == nil || !strings.Contains(err.Error(), arbnode.ErrBundleNotIncluded.Error()) {
+		Fail(t, "bundle with a failing transaction not rejected", err)
+	}
+	nonce, err := client.NonceAt(ctx, owner, nil)
+	Require(t, err)
+	if nonce != first.Nonce() {
+		Fail(t, "transaction of a rejected bundle was included")
+	}
+
+	// the bundle isn't included if its target block has passed
+	blockNum, err := client.BlockNumber(ctx)
+	Require(t, err)
+	target := hexutil.Uint64(blockNum)
+	err = rpcClient.CallContext(ctx, &hashes, "arb_sendBundle", encodeBundle(t, first, second), &target)
+	if err == nil || !strings.Contains(err.Error(), arbnode.ErrBundleTargetBlockPassed.Error()) {
+		Fail(t, "bundle sequenced after its target block", err)
+	}
+	nonce, err = client.NonceAt(ctx, owner, nil)
+	Require(t, err)
+	if nonce != first.Nonce() {
+		Fail(t, "transaction of a bundle past its target block was included")
+	}
+
+	// a successful bundle is included contiguously and in order in a single block
+	target = hexutil.Uint64(blockNum + 10)
+	err = rpcClient.CallContext(ctx, &hashes, "arb_sendBundle", encodeBundle(t, first, second), &target)
+	Require(t, err)
+	if len(hashes) != 2 || hashes[0] != first.Hash() || hashes[1] != second.Hash() {
+		Fail(t, "unexpected bundle hashes", hashes)
+	}
+	firstReceipt, err := EnsureTxSucceeded(ctx, client, first)
+	Require(t, err)
+	secondReceipt, err := EnsureTxSucceeded(ctx, client, second)
+	Require(t, err)
+	if firstReceipt.BlockNumber.Cmp(secondReceipt.BlockNumber) != 0 {
+		Fail(t, "bundle split across blocks", firstReceipt.BlockNumber, secondReceipt.BlockNumber)
+	}
+	if secondReceipt.TransactionIndex != firstReceipt.TransactionIndex+1 {
+		Fail(t, "bundle not contiguous", firstReceipt.TransactionIndex, secondReceipt.TransactionIndex)
+	}
+	if firstReceipt.BlockNumber.Uint64() > uint64(target) {
+		Fail(t, "bundle included after its target block", firstReceipt.BlockNumber)
+	}
+}
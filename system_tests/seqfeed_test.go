@@ -11,8 +11,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tenderly/nitro/go-ethereum/ethclient"
+	"github.com/tenderly/nitro/go-ethereum/params"
 	"github.com/tenderly/nitro/arbnode"
 	"github.com/tenderly/nitro/broadcastclient"
+	"github.com/tenderly/nitro/broadcaster"
 	"github.com/tenderly/nitro/relay"
 	"github.com/tenderly/nitro/wsbroadcastserver"
 )
@@ -26,8 +29,9 @@ func newBroadcasterConfigTest(port string) *wsbroadcastserver.BroadcasterConfig
 
 func newBroadcastClientConfigTest(port int) *broadcastclient.BroadcastClientConfig {
 	return &broadcastclient.BroadcastClientConfig{
-		URLs:    []string{fmt.Sprintf("ws://localhost:%d/feed", port)},
-		Timeout: 20 * time.Second,
+		URLs:       []string{fmt.Sprintf("ws://localhost:%d/feed", port)},
+		Timeout:    20 * time.Second,
+		GapTimeout: broadcastclient.DefaultBroadcastClientConfig.GapTimeout,
 	}
 }
 
@@ -80,8 +84,9 @@ func TestRelayedSequencerFeed(t *testing.T) {
 	port := nodeA.BroadcastServer.ListenerAddr().(*net.TCPAddr).Port
 	relayClientConf := *newBroadcastClientConfigTest(port)
 
-	relay := relay.NewRelay(relayServerConf, relayClientConf)
-	err := relay.Start(ctx)
+	relay, err := relay.NewRelay(relayServerConf, relayClientConf, broadcaster.BacklogConfig{}, relay.DefaultTreeConfig, nil)
+	Require(t, err)
+	err = relay.Start(ctx)
 	Require(t, err)
 	defer relay.StopAndWait()
 
@@ -213,3 +218,62 @@ func TestLyingSequencer(t *testing.T) {
 func TestLyingSequencerLocalDAS(t *testing.T) {
 	testLyingSequencer(t, "files")
 }
+
+func TestSequencerFeedResumesFromMessageCount(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seqNodeConfig := arbnode.ConfigDefaultL2Test()
+	seqNodeConfig.Feed.Output = *newBroadcasterConfigTest("0")
+	l2info1, nodeA, client1, l2stackA := CreateTestL2WithConfig(t, ctx, nil, seqNodeConfig, true)
+	defer requireClose(t, l2stackA)
+	clientNodeConfig := arbnode.ConfigDefaultL2Test()
+	port := nodeA.BroadcastServer.ListenerAddr().(*net.TCPAddr).Port
+	clientNodeConfig.Feed.Input = *newBroadcastClientConfigTest(port)
+
+	l2info1.GenerateAccount("User2")
+	sendTx := func(client *ethclient.Client) {
+		tx := l2info1.PrepareTx("Owner", "User2", l2info1.TransferGas, big.NewInt(1e12), nil)
+		Require(t, client1.SendTransaction(ctx, tx))
+		_, err := EnsureTxSucceeded(ctx, client1, tx)
+		Require(t, err)
+		_, err = WaitForTx(ctx, client, tx.Hash(), time.Second*5)
+		Require(t, err)
+	}
+
+	// the client node gets some messages from the feed, then restarts on the same database
+	dataDir := t.TempDir()
+	_, l2stackB, chainDbB, arbDbB, blockchainB := createL2BlockChain(t, l2info1, dataDir, params.ArbitrumDevTestChainConfig())
+	nodeB, err := arbnode.CreateNode(ctx, l2stackB, chainDbB, arbDbB, clientNodeConfig, blockchainB, nil, nil, nil, nil)
+	Require(t, err)
+	Require(t, nodeB.TxStreamer.AddFakeInitMessage())
+	Require(t, l2stackB.Start())
+	sendTx(ClientForStack(t, l2stackB))
+	sendTx(ClientForStack(t, l2stackB))
+	Require(t, l2stackB.Close())
+
+	_, l2stackB, chainDbB, arbDbB, blockchainB = createL2BlockChain(t, l2info1, dataDir, params.ArbitrumDevTestChainConfig())
+	nodeB, err = arbnode.CreateNode(ctx, l2stackB, chainDbB, arbDbB, clientNodeConfig, blockchainB, nil, nil, nil, nil)
+	Require(t, err)
+	messageCount, err := nodeB.TxStreamer.GetMessageCount()
+	Require(t, err)
+	if messageCount < 3 {
+		Fail(t, "restarted node lost its messages", messageCount)
+	}
+	for _, client := range nodeB.BroadcastClients.Clients() {
+		if client.GetNextSeqNum() != messageCount {
+			Fail(t, "feed client starts from", client.GetNextSeqNum(), "instead of the message count", messageCount)
+		}
+	}
+	Require(t, l2stackB.Start())
+	defer requireClose(t, l2stackB)
+	client2 := ClientForStack(t, l2stackB)
+	sendTx(client2)
+
+	l2balance, err := client2.BalanceAt(ctx, l2info1.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(3e12)) != 0 {
+		t.Fatal("Unexpected balance:", l2balance)
+	}
+}
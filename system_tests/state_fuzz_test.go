@@ -62,6 +62,7 @@ type inboxBackend struct {
 	batches               [][]byte
 	positionWithinMessage uint64
 	delayedMessages       [][]byte
+	arbOSVersion          uint64
 }
 
 func (b *inboxBackend) PeekSequencerInbox() ([]byte, error) {
@@ -97,6 +98,10 @@ func (b *inboxBackend) ReadDelayedInbox(seqNum uint64) ([]byte, error) {
 	return b.delayedMessages[seqNum], nil
 }
 
+func (b *inboxBackend) GetBatchArbOSVersion() (uint64, error) {
+	return b.arbOSVersion, nil
+}
+
 // A chain context with no information
 type noopChainContext struct{}
 
@@ -153,6 +158,7 @@ func FuzzStateTransition(f *testing.F) {
 			batches:               [][]byte{seqBatch},
 			positionWithinMessage: 0,
 			delayedMessages:       delayedMessages,
+			arbOSVersion:          arbstate.LatestBatchFormatArbOSVersion,
 		}
 		_, err = BuildBlock(statedb, genesis, noopChainContext{}, params.ArbitrumOneChainConfig(), inbox, seqBatch)
 		if err != nil {
@@ -0,0 +1,82 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/tenderly/nitro/go-ethereum/common"
+	"github.com/tenderly/nitro/arbnode"
+)
+
+type txPoolContent map[string]map[string]map[string]struct {
+	Hash common.Hash `json:"hash"`
+}
+
+func TestTxPoolContentWithNonceGap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := arbnode.ConfigDefaultL2Test()
+	config.Sequencer.NonceGapHoldTime = time.Minute
+	l2info, node, client, l2stack := CreateTestL2WithConfig(t, ctx, nil, config, true)
+	defer requireClose(t, l2stack)
+	rpcClient, err := l2stack.Attach()
+	Require(t, err)
+
+	l2info.GenerateAccount("User2")
+	owner := l2info.GetAddress("Owner")
+	first := l2info.PrepareTx("Owner", "User2", l2info.TransferGas, big.NewInt(1e12), nil)
+	second := l2info.PrepareTx("Owner", "User2", l2info.TransferGas, big.NewInt(1e12), nil)
+
+	// the second transaction is held by the sequencer until the first fills its nonce gap
+	secondErr := make(chan error, 1)
+	go func() {
+		secondErr <- client.SendTransaction(ctx, second)
+	}()
+	var content txPoolContent
+	for i := 0; ; i++ {
+		if i >= 100 {
+			Fail(t, "transaction with a nonce gap never reported as queued")
+		}
+		time.Sleep(20 * time.Millisecond)
+		err = rpcClient.CallContext(ctx, &content, "txpool_content")
+		Require(t, err)
+		if len(content["queued"][owner.Hex()]) > 0 {
+			break
+		}
+	}
+	queued := content["queued"][owner.Hex()][fmt.Sprint(second.Nonce())]
+	if queued.Hash != second.Hash() {
+		Fail(t, "unexpected queued content", content["queued"])
+	}
+	if len(content["pending"][owner.Hex()]) != 0 {
+		Fail(t, "transaction with a nonce gap reported as pending", content["pending"])
+	}
+	if pending := node.TxPublisher.PendingTxs().Transaction(second.Hash()); pending == nil {
+		Fail(t, "queued transaction missing from the sequencer's pending set")
+	}
+	nonce, err := client.PendingNonceAt(ctx, owner)
+	Require(t, err)
+	if nonce != first.Nonce() {
+		Fail(t, "pending nonce", nonce, "skipped over the nonce gap at", first.Nonce())
+	}
+
+	err = client.SendTransaction(ctx, first)
+	Require(t, err)
+	Require(t, <-secondErr)
+	_, err = EnsureTxSucceeded(ctx, client, second)
+	Require(t, err)
+
+	content = txPoolContent{}
+	err = rpcClient.CallContext(ctx, &content, "txpool_content")
+	Require(t, err)
+	if len(content["pending"]) != 0 || len(content["queued"]) != 0 {
+		Fail(t, "sequenced transactions still reported in the pool", content)
+	}
+}
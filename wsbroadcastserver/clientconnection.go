@@ -5,7 +5,6 @@ package wsbroadcastserver
 
 import (
 	"context"
-	"encoding/json"
 	"math/rand"
 	"net"
 	"strconv"
@@ -14,8 +13,8 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
+	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/util/stopwaiter"
 )
 
@@ -32,16 +31,47 @@ type ClientConnection struct {
 
 	lastHeardUnix int64
 	out           chan []byte
+	clientIp      net.IP // the address the connection limits apply to
+
+	requestedSeqNum arbutil.MessageIndex
+	compression     bool         // whether permessage-deflate was negotiated
+	binary          bool         // whether the binary feed protocol was negotiated
+	filter          ClientFilter // nil unless the client subscribed with a filter
+	// run on the client's own thread before it sends anything queued, so catching up doesn't hold up other clients
+	catchup func(context.Context) error
 }
 
-func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager) *ClientConnection {
+func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager, clientIp net.IP, requestedSeqNum arbutil.MessageIndex, compression bool, binary bool, filter ClientFilter) *ClientConnection {
 	return &ClientConnection{
-		conn:          conn,
-		desc:          desc,
-		Name:          conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
-		clientManager: clientManager,
-		lastHeardUnix: time.Now().Unix(),
-		out:           make(chan []byte, clientManager.settings.MaxSendQueue),
+		conn:            conn,
+		desc:            desc,
+		Name:            conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
+		clientManager:   clientManager,
+		lastHeardUnix:   time.Now().Unix(),
+		out:             make(chan []byte, clientManager.settings.MaxSendQueue),
+		clientIp:        clientIp,
+		requestedSeqNum: requestedSeqNum,
+		compression:     compression,
+		binary:          binary,
+		filter:          filter,
+	}
+}
+
+// RequestedSeqNum returns the sequence number the client asked the feed to start from, or 0 if it didn't ask
+func (cc *ClientConnection) RequestedSeqNum() arbutil.MessageIndex {
+	return cc.requestedSeqNum
+}
+
+// SetCatchup sets what the client sends when it starts, ahead of the messages broadcast after it was registered.
+// It must be called before the client is started.
+func (cc *ClientConnection) SetCatchup(catchup func(context.Context) error) {
+	cc.catchup = catchup
+}
+
+func (cc *ClientConnection) encoding() messageEncoding {
+	return messageEncoding{
+		compression: cc.compression,
+		binary:      cc.binary,
 	}
 }
 
@@ -49,6 +79,13 @@ func (cc *ClientConnection) Start(parentCtx context.Context) {
 	cc.StopWaiter.Start(parentCtx)
 	cc.LaunchThread(func(ctx context.Context) {
 		defer close(cc.out)
+		if cc.catchup != nil {
+			if err := cc.catchup(ctx); err != nil {
+				logWarn(err, "error catching up client")
+				cc.removeAndDrain(ctx)
+				return
+			}
+		}
 		for {
 			select {
 			case <-ctx.Done():
@@ -57,21 +94,26 @@ func (cc *ClientConnection) Start(parentCtx context.Context) {
 				err := cc.writeRaw(data)
 				if err != nil {
 					logWarn(err, "error writing data to client")
-					cc.clientManager.Remove(cc)
-					for {
-						// Consume and ignore channel data until client properly stopped to prevent deadlock
-						select {
-						case <-ctx.Done():
-							return
-						case <-cc.out:
-						}
-					}
+					cc.removeAndDrain(ctx)
+					return
 				}
 			}
 		}
 	})
 }
 
+func (cc *ClientConnection) removeAndDrain(ctx context.Context) {
+	cc.clientManager.Remove(cc)
+	for {
+		// Consume and ignore channel data until client properly stopped to prevent deadlock
+		select {
+		case <-ctx.Done():
+			return
+		case <-cc.out:
+		}
+	}
+}
+
 func (cc *ClientConnection) StopAndWait() {
 	if !cc.Started() {
 		// If client connection never started, need to close channel
@@ -103,21 +145,27 @@ func (cc *ClientConnection) readRequest(ctx context.Context, timeout time.Durati
 
 	atomic.StoreInt64(&cc.lastHeardUnix, time.Now().Unix())
 
-	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide)
+	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide, cc.compression)
 }
 
+// Write sends a message to the client, or what its filter selects from the message if it has one
 func (cc *ClientConnection) Write(x interface{}) error {
-	writer := wsutil.NewWriter(cc.conn, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
+	if cc.filter != nil {
+		x = cc.filter.Filter(cc.clientManager.filters.Decode(x))
+		if x == nil {
+			return nil
+		}
+	}
+	data, err := serializeMessage(x, cc.compression, cc.binary, ws.StateServerSide)
+	if err != nil {
+		return err
+	}
 
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
 
-	if err := encoder.Encode(x); err != nil {
-		return err
-	}
-
-	return writer.Flush()
+	_, err = cc.conn.Write(data)
+	return err
 }
 
 func (cc *ClientConnection) writeRaw(p []byte) error {
@@ -4,30 +4,47 @@
 package wsbroadcastserver
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
+	"net/url"
 	"sync/atomic"
 	"time"
 
+	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/go-ethereum/log"
 	"github.com/tenderly/nitro/util/stopwaiter"
 	"github.com/pkg/errors"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
 
 /* Protocol-specific client catch-up logic can be injected using this interface. */
 type CatchupBuffer interface {
+	// CheckRequestedSequenceNumber is called during the websocket upgrade of a client asking to start from a sequence number,
+	// and returns an error if the buffer can't start there. It may be called concurrently with the other methods.
+	CheckRequestedSequenceNumber(arbutil.MessageIndex) error
 	OnRegisterClient(context.Context, *ClientConnection) error
 	OnDoBroadcast(interface{}) error
 	GetMessageCount() int
 }
 
+/* Protocol-specific filtered subscriptions can be injected using this interface. */
+type ClientFilters interface {
+	// NewFilter creates the filter for a client subscribing with the query parameters of its request
+	NewFilter(url.Values) (ClientFilter, error)
+	// Decode is called once for each message sent while there are filtered clients, before each of their filters
+	Decode(interface{}) interface{}
+	// Heartbeat returns the message periodically sent to filtered clients, or nil to send nothing
+	Heartbeat() interface{}
+}
+
+type ClientFilter interface {
+	// Filter returns what to send the client in place of a decoded message, or nil to skip it
+	Filter(interface{}) interface{}
+}
+
 // ClientManager manages client connections
 type ClientManager struct {
 	stopwaiter.StopWaiter
@@ -40,6 +57,9 @@ type ClientManager struct {
 	clientAction  chan ClientConnectionAction
 	settings      BroadcasterConfig
 	catchupBuffer CatchupBuffer
+	filters       ClientFilters
+	filtered      int // number of clients with a filter
+	limiter       *connectionLimiter
 }
 
 type ClientConnectionAction struct {
@@ -47,7 +67,7 @@ type ClientConnectionAction struct {
 	create bool
 }
 
-func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchupBuffer CatchupBuffer) *ClientManager {
+func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchupBuffer CatchupBuffer, filters ClientFilters) *ClientManager {
 	return &ClientManager{
 		poller:        poller,
 		pool:          gopool.NewPool(settings.Workers, settings.Queue, 1),
@@ -56,6 +76,8 @@ func NewClientManager(poller netpoll.Poller, settings BroadcasterConfig, catchup
 		clientAction:  make(chan ClientConnectionAction, 128),
 		settings:      settings,
 		catchupBuffer: catchupBuffer,
+		filters:       filters,
+		limiter:       newConnectionLimiter(settings.ConnectionLimits),
 	}
 }
 
@@ -66,15 +88,19 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 
 	clientConnection.Start(ctx)
 	cm.clientPtrMap[clientConnection] = true
+	if clientConnection.filter != nil {
+		cm.filtered++
+	}
 	atomic.AddInt32(&cm.clientCount, 1)
 
 	return nil
 }
 
 // Register registers new connection as a Client.
-func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc) *ClientConnection {
+// The client's connection limits are released for clientIp when it's removed.
+func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc, clientIp net.IP, requestedSeqNum arbutil.MessageIndex, compression bool, binary bool, filter ClientFilter) *ClientConnection {
 	createClient := ClientConnectionAction{
-		NewClientConnection(conn, desc, cm),
+		NewClientConnection(conn, desc, cm, clientIp, requestedSeqNum, compression, binary, filter),
 		true,
 	}
 
@@ -104,6 +130,7 @@ func (cm *ClientManager) removeClientImpl(clientConnection *ClientConnection) {
 		log.Warn("Failed to close client connection", "err", err)
 	}
 
+	cm.limiter.release(clientConnection.clientIp)
 	atomic.AddInt32(&cm.clientCount, -1)
 }
 
@@ -115,6 +142,9 @@ func (cm *ClientManager) removeClient(clientConnection *ClientConnection) {
 	cm.removeClientImpl(clientConnection)
 
 	delete(cm.clientPtrMap, clientConnection)
+	if clientConnection.filter != nil {
+		cm.filtered--
+	}
 }
 
 func (cm *ClientManager) Remove(clientConnection *ClientConnection) {
@@ -138,14 +168,14 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	writer := wsutil.NewWriter(&buf, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-	if err := encoder.Encode(bm); err != nil {
+	serialized := newSerializedMessage(bm)
+	if _, err := serialized.forEncoding(messageEncoding{}); err != nil {
 		return nil, errors.Wrap(err, "unable to encode message")
 	}
-	if err := writer.Flush(); err != nil {
-		return nil, errors.Wrap(err, "unable to flush message")
+
+	var decoded interface{}
+	if cm.filtered > 0 {
+		decoded = cm.filters.Decode(bm)
 	}
 
 	clientDeleteList := make([]*ClientConnection, 0, len(cm.clientPtrMap))
@@ -154,8 +184,24 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 			// Queue for client too backed up, disconnect instead of blocking on channel send
 			log.Info("disconnecting because send queue too large", "client", client.Name, "size", len(client.out))
 			clientDeleteList = append(clientDeleteList, client)
+		} else if client.filter != nil {
+			filtered := client.filter.Filter(decoded)
+			if filtered == nil {
+				continue
+			}
+			data, err := serializeMessage(filtered, client.compression, client.binary, ws.StateServerSide)
+			if err != nil {
+				log.Warn("unable to encode filtered message", "client", client.Name, "err", err)
+				continue
+			}
+			client.out <- data
 		} else {
-			client.out <- buf.Bytes()
+			data, err := serialized.forEncoding(client.encoding())
+			if err != nil {
+				log.Warn("unable to encode message", "client", client.Name, "err", err)
+				continue
+			}
+			client.out <- data
 		}
 	}
 
@@ -185,9 +231,34 @@ func (cm *ClientManager) verifyClients() []*ClientConnection {
 		}
 	}
 
+	cm.sendHeartbeats()
+
 	return clientDeleteList
 }
 
+// sendHeartbeats sends filtered clients, which may go a long time without a matching message, the filters' heartbeat
+func (cm *ClientManager) sendHeartbeats() {
+	if cm.filtered == 0 {
+		return
+	}
+	heartbeat := cm.filters.Heartbeat()
+	if heartbeat == nil {
+		return
+	}
+	serialized := newSerializedMessage(heartbeat)
+	for client := range cm.clientPtrMap {
+		if client.filter == nil || len(client.out) == cm.settings.MaxSendQueue {
+			continue
+		}
+		data, err := serialized.forEncoding(client.encoding())
+		if err != nil {
+			log.Warn("unable to encode heartbeat", "err", err)
+			return
+		}
+		client.out <- data
+	}
+}
+
 func (cm *ClientManager) Start(parentCtx context.Context) {
 	cm.StopWaiter.Start(parentCtx)
 
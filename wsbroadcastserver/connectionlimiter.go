@@ -0,0 +1,251 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	flag "github.com/spf13/pflag"
+
+	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/tenderly/nitro/go-ethereum/metrics"
+)
+
+var (
+	rejectedMaxClientsCounter = metrics.NewRegisteredCounter("arb/feed/clients/rejected/max", nil)
+	rejectedPerIpCounter      = metrics.NewRegisteredCounter("arb/feed/clients/rejected/ip", nil)
+	rejectedPerSubnetCounter  = metrics.NewRegisteredCounter("arb/feed/clients/rejected/subnet", nil)
+	rejectedRateCounter       = metrics.NewRegisteredCounter("arb/feed/clients/rejected/rate", nil)
+)
+
+type ConnectionLimiterConfig struct {
+	MaxClients      int           `koanf:"max-clients"`
+	PerIpLimit      int           `koanf:"per-ip-limit"`
+	PerSubnetLimit  int           `koanf:"per-subnet-limit"`
+	Ipv4SubnetBits  int           `koanf:"ipv4-subnet-bits"`
+	Ipv6SubnetBits  int           `koanf:"ipv6-subnet-bits"`
+	PerIpRateLimit  int           `koanf:"per-ip-rate-limit"`
+	RateLimitPeriod time.Duration `koanf:"rate-limit-period"`
+	TrustedProxies  []string      `koanf:"trusted-proxies"`
+}
+
+func ConnectionLimiterConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Int(prefix+".max-clients", DefaultConnectionLimiterConfig.MaxClients, "maximum number of connected clients (0 for no limit)")
+	f.Int(prefix+".per-ip-limit", DefaultConnectionLimiterConfig.PerIpLimit, "maximum number of clients connected from a single IP address (0 for no limit)")
+	f.Int(prefix+".per-subnet-limit", DefaultConnectionLimiterConfig.PerSubnetLimit, "maximum number of clients connected from a single subnet (0 for no limit)")
+	f.Int(prefix+".ipv4-subnet-bits", DefaultConnectionLimiterConfig.Ipv4SubnetBits, "prefix length of the IPv4 subnets the per subnet limit applies to")
+	f.Int(prefix+".ipv6-subnet-bits", DefaultConnectionLimiterConfig.Ipv6SubnetBits, "prefix length of the IPv6 subnets the per subnet limit applies to")
+	f.Int(prefix+".per-ip-rate-limit", DefaultConnectionLimiterConfig.PerIpRateLimit, "maximum number of connection attempts from a single IP address in each rate limit period (0 for no limit)")
+	f.Duration(prefix+".rate-limit-period", DefaultConnectionLimiterConfig.RateLimitPeriod, "period the per IP rate limit applies to")
+	f.StringSlice(prefix+".trusted-proxies", DefaultConnectionLimiterConfig.TrustedProxies, "IP addresses or CIDR ranges of proxies in front of the feed, whose X-Real-IP or X-Forwarded-For headers give the client IP address the limits apply to (if empty, the connection's address is always used)")
+}
+
+var DefaultConnectionLimiterConfig = ConnectionLimiterConfig{
+	MaxClients:      0,
+	PerIpLimit:      0,
+	PerSubnetLimit:  0,
+	Ipv4SubnetBits:  24,
+	Ipv6SubnetBits:  64,
+	PerIpRateLimit:  0,
+	RateLimitPeriod: time.Minute,
+	TrustedProxies:  []string{},
+}
+
+func (c *ConnectionLimiterConfig) Validate() error {
+	if c.Ipv4SubnetBits < 0 || c.Ipv4SubnetBits > 32 {
+		return fmt.Errorf("invalid IPv4 subnet prefix length %v", c.Ipv4SubnetBits)
+	}
+	if c.Ipv6SubnetBits < 0 || c.Ipv6SubnetBits > 128 {
+		return fmt.Errorf("invalid IPv6 subnet prefix length %v", c.Ipv6SubnetBits)
+	}
+	if c.PerIpRateLimit > 0 && c.RateLimitPeriod <= 0 {
+		return fmt.Errorf("invalid rate limit period %v", c.RateLimitPeriod)
+	}
+	_, err := parseTrustedProxies(c.TrustedProxies)
+	return err
+}
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges into networks
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address \"%v\"", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ipv4 := ip.To4(); ipv4 != nil {
+				ip = ipv4
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy range \"%v\": %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+type rateWindow struct {
+	start    time.Time
+	attempts int
+}
+
+// connectionLimiter counts connected clients by IP and subnet, and connection attempts by IP
+type connectionLimiter struct {
+	config         ConnectionLimiterConfig
+	trustedProxies []*net.IPNet
+
+	mutex       sync.Mutex
+	total       int
+	perIp       map[string]int
+	perSubnet   map[string]int
+	attempts    map[string]*rateWindow
+	lastCleanup time.Time
+}
+
+// newConnectionLimiter creates a limiter for a config which has been validated
+func newConnectionLimiter(config ConnectionLimiterConfig) *connectionLimiter {
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		log.Error("ignoring invalid trusted proxies", "err", err)
+	}
+	return &connectionLimiter{
+		config:         config,
+		trustedProxies: trustedProxies,
+		perIp:          make(map[string]int),
+		perSubnet:      make(map[string]int),
+		attempts:       make(map[string]*rateWindow),
+	}
+}
+
+func remoteIp(conn net.Conn) net.IP {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+func (l *connectionLimiter) trusted(ip net.IP) bool {
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIp returns the IP address a client connecting from peer is limited by. That's peer itself unless it's a
+// trusted proxy, in which case it's the X-Real-IP header, or else the last address in the X-Forwarded-For headers
+// which isn't also a trusted proxy.
+func (l *connectionLimiter) clientIp(peer net.IP, realIp string, forwardedFor []string) net.IP {
+	if peer == nil || !l.trusted(peer) {
+		return peer
+	}
+	if ip := net.ParseIP(strings.TrimSpace(realIp)); ip != nil {
+		return ip
+	}
+	var forwarded []net.IP
+	for _, header := range forwardedFor {
+		for _, address := range strings.Split(header, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(address)); ip != nil {
+				forwarded = append(forwarded, ip)
+			}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if !l.trusted(forwarded[i]) || i == 0 {
+			return forwarded[i]
+		}
+	}
+	return peer
+}
+
+func (l *connectionLimiter) subnet(ip net.IP) string {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(l.config.Ipv4SubnetBits, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(l.config.Ipv6SubnetBits, 128)).String()
+}
+
+func rejection(counter metrics.Counter, status int, reason string) error {
+	counter.Inc(1)
+	return ws.RejectConnectionError(ws.RejectionStatus(status), ws.RejectionReason(reason))
+}
+
+// reserve counts a client connecting from ip until it's released, or returns an error rejecting the websocket upgrade
+func (l *connectionLimiter) reserve(ip net.IP, now time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ipKey := ip.String()
+	subnetKey := l.subnet(ip)
+
+	if l.config.PerIpRateLimit > 0 {
+		if now.Sub(l.lastCleanup) > l.config.RateLimitPeriod {
+			for key, window := range l.attempts {
+				if now.Sub(window.start) > l.config.RateLimitPeriod {
+					delete(l.attempts, key)
+				}
+			}
+			l.lastCleanup = now
+		}
+		window := l.attempts[ipKey]
+		if window == nil || now.Sub(window.start) > l.config.RateLimitPeriod {
+			window = &rateWindow{start: now}
+			l.attempts[ipKey] = window
+		}
+		window.attempts++
+		if window.attempts > l.config.PerIpRateLimit {
+			return rejection(rejectedRateCounter, http.StatusTooManyRequests, "too many connection attempts from this IP address")
+		}
+	}
+	if l.config.MaxClients > 0 && l.total >= l.config.MaxClients {
+		return rejection(rejectedMaxClientsCounter, http.StatusServiceUnavailable, "too many clients connected")
+	}
+	if l.config.PerIpLimit > 0 && l.perIp[ipKey] >= l.config.PerIpLimit {
+		return rejection(rejectedPerIpCounter, http.StatusTooManyRequests, "too many clients connected from this IP address")
+	}
+	if l.config.PerSubnetLimit > 0 && l.perSubnet[subnetKey] >= l.config.PerSubnetLimit {
+		return rejection(rejectedPerSubnetCounter, http.StatusTooManyRequests, "too many clients connected from this subnet")
+	}
+
+	l.total++
+	l.perIp[ipKey]++
+	l.perSubnet[subnetKey]++
+	return nil
+}
+
+func (l *connectionLimiter) release(ip net.IP) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ipKey := ip.String()
+	subnetKey := l.subnet(ip)
+	l.total--
+	l.perIp[ipKey]--
+	if l.perIp[ipKey] <= 0 {
+		delete(l.perIp, ipKey)
+	}
+	l.perSubnet[subnetKey]--
+	if l.perSubnet[subnetKey] <= 0 {
+		delete(l.perSubnet, subnetKey)
+	}
+}
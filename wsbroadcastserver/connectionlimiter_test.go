@@ -0,0 +1,120 @@
+// Copyright 2021-2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+func expectRejection(t *testing.T, err error, status int) {
+	t.Helper()
+	var rejection *ws.ConnectionRejectedError
+	if !errors.As(err, &rejection) || rejection.StatusCode() != status {
+		t.Fatal("expected connection to be rejected with status", status, "got", err)
+	}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	config := DefaultConnectionLimiterConfig
+	config.MaxClients = 4
+	config.PerIpLimit = 2
+	config.PerSubnetLimit = 3
+	limiter := newConnectionLimiter(config)
+	now := time.Now()
+
+	first := net.ParseIP("10.0.0.1")
+	second := net.ParseIP("10.0.0.2")
+	for i := 0; i < 2; i++ {
+		if err := limiter.reserve(first, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectRejection(t, limiter.reserve(first, now), http.StatusTooManyRequests)
+
+	if err := limiter.reserve(second, now); err != nil {
+		t.Fatal(err)
+	}
+	// the /24 subnet is full, though the IP isn't
+	expectRejection(t, limiter.reserve(second, now), http.StatusTooManyRequests)
+
+	if err := limiter.reserve(net.ParseIP("2001:db8::1"), now); err != nil {
+		t.Fatal(err)
+	}
+	expectRejection(t, limiter.reserve(net.ParseIP("10.1.0.1"), now), http.StatusServiceUnavailable)
+
+	// disconnecting frees up space
+	limiter.release(first)
+	if err := limiter.reserve(second, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionRateLimit(t *testing.T) {
+	config := DefaultConnectionLimiterConfig
+	config.PerIpRateLimit = 2
+	limiter := newConnectionLimiter(config)
+	ip := net.ParseIP("10.0.0.1")
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.reserve(ip, now); err != nil {
+			t.Fatal(err)
+		}
+		limiter.release(ip)
+	}
+	expectRejection(t, limiter.reserve(ip, now.Add(time.Second)), http.StatusTooManyRequests)
+	if err := limiter.reserve(net.ParseIP("10.0.0.2"), now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.reserve(ip, now.Add(config.RateLimitPeriod+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrustedProxyClientIp(t *testing.T) {
+	config := DefaultConnectionLimiterConfig
+	config.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16"}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	limiter := newConnectionLimiter(config)
+	proxy := net.ParseIP("10.0.0.1")
+	client := net.ParseIP("203.0.113.7")
+
+	expectIp := func(got net.IP, expected net.IP) {
+		t.Helper()
+		if !got.Equal(expected) {
+			t.Fatal("unexpected client IP", got, "expected", expected)
+		}
+	}
+	// headers from untrusted connections are ignored, so clients can't pick the address they're limited by
+	expectIp(limiter.clientIp(client, "198.51.100.1", []string{"198.51.100.2"}), client)
+	expectIp(limiter.clientIp(proxy, "", nil), proxy)
+	expectIp(limiter.clientIp(proxy, client.String(), nil), client)
+	// the client's own X-Forwarded-For entries are skipped by taking the last one which isn't a trusted proxy
+	expectIp(limiter.clientIp(proxy, "", []string{"198.51.100.1, " + client.String(), "192.168.1.1"}), client)
+	expectIp(limiter.clientIp(proxy, "", []string{"192.168.1.2, 192.168.1.1"}), net.ParseIP("192.168.1.2"))
+
+	// a proxy's clients are limited separately
+	config.PerIpLimit = 1
+	limiter = newConnectionLimiter(config)
+	if err := limiter.reserve(limiter.clientIp(proxy, client.String(), nil), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.reserve(limiter.clientIp(proxy, "203.0.113.8", nil), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expectRejection(t, limiter.reserve(limiter.clientIp(proxy, client.String(), nil), time.Now()), http.StatusTooManyRequests)
+
+	config.TrustedProxies = []string{"not an address"}
+	if config.Validate() == nil {
+		t.Fatal("invalid trusted proxy accepted")
+	}
+}
@@ -4,8 +4,13 @@
 package wsbroadcastserver
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
+	"encoding"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
@@ -13,7 +18,9 @@ import (
 	"time"
 
 	"github.com/tenderly/nitro/go-ethereum/log"
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 )
 
@@ -63,16 +70,117 @@ func (cr *chainedReader) add(r io.Reader) *chainedReader {
 	return cr
 }
 
-func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State) ([]byte, ws.OpCode, error) {
+// serializeMessage encodes a message as a JSON text frame, or as a binary frame if binary is set, which needs the message
+// to implement encoding.BinaryMarshaler. The frame's compressed with permessage-deflate if compress is set.
+func serializeMessage(x interface{}, compress bool, binary bool, state ws.State) ([]byte, error) {
+	if !compress && !binary {
+		var buf bytes.Buffer
+		writer := wsutil.NewWriter(&buf, state, ws.OpText)
+		if err := json.NewEncoder(writer).Encode(x); err != nil {
+			return nil, err
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	opCode := ws.OpText
+	var payload []byte
+	if binary {
+		marshaler, ok := x.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("message of type %T has no binary encoding", x)
+		}
+		var err error
+		payload, err = marshaler.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		opCode = ws.OpBinary
+	} else {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(x); err != nil {
+			return nil, err
+		}
+		payload = buf.Bytes()
+	}
+	frame := ws.NewFrame(opCode, true, payload)
+	if compress {
+		var err error
+		frame, err = wsflate.CompressFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if state.ClientSide() {
+		frame = ws.MaskFrameInPlace(frame)
+	}
+	var buf bytes.Buffer
+	if err := ws.WriteFrame(&buf, frame); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// messageEncoding is how a message is serialized for a client
+type messageEncoding struct {
+	compression bool
+	binary      bool
+}
 
+// serializedMessage serializes a message sent to many clients once for each encoding they use
+type serializedMessage struct {
+	message interface{}
+	encoded map[messageEncoding][]byte
+}
+
+func newSerializedMessage(x interface{}) *serializedMessage {
+	return &serializedMessage{
+		message: x,
+		encoded: make(map[messageEncoding][]byte),
+	}
+}
+
+func (m *serializedMessage) forEncoding(encoding messageEncoding) ([]byte, error) {
+	if data, ok := m.encoded[encoding]; ok {
+		return data, nil
+	}
+	data, err := serializeMessage(m.message, encoding.compression, encoding.binary, ws.StateServerSide)
+	if err != nil {
+		return nil, err
+	}
+	m.encoded[encoding] = data
+	return data, nil
+}
+
+// CompressionAccepted reports whether permessage-deflate was negotiated in a handshake
+func CompressionAccepted(extensions []httphead.Option) bool {
+	for _, extension := range extensions {
+		var params wsflate.Parameters
+		if bytes.Equal(extension.Name, wsflate.ExtensionNameBytes) && params.Parse(extension) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadData reads the next data message from conn, decompressing it if it was sent with permessage-deflate,
+// which must only be allowed if compression was negotiated
+func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State, compression bool) ([]byte, ws.OpCode, error) {
+
+	var msg wsflate.MessageState
 	controlHandler := wsutil.ControlFrameHandler(conn, state)
 	reader := wsutil.Reader{
 		Source:          (&chainedReader{}).add(earlyFrameData).add(conn),
 		State:           state,
-		CheckUTF8:       true,
+		CheckUTF8:       !compression, // compressed payloads aren't valid UTF-8
 		SkipHeaderCheck: false,
 		OnIntermediate:  controlHandler,
 	}
+	if compression {
+		reader.State |= ws.StateExtended
+		reader.Extensions = []wsutil.RecvExtension{&msg}
+	}
 
 	// Remove timeout when leaving this function
 	defer func(conn net.Conn) {
@@ -119,6 +227,14 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 			continue
 		}
 
+		if msg.IsCompressed() {
+			flateReader := wsflate.NewReader(&reader, func(r io.Reader) wsflate.Decompressor {
+				return flate.NewReader(r)
+			})
+			data, err := ioutil.ReadAll(flateReader)
+			return data, header.OpCode, err
+		}
+
 		data, err := ioutil.ReadAll(&reader)
 
 		return data, header.OpCode, err
@@ -8,27 +8,50 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/tenderly/nitro/arbutil"
 	"github.com/tenderly/nitro/go-ethereum/log"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
 	flag "github.com/spf13/pflag"
 )
 
+// HTTPHeaderRequestedSequenceNumber is the websocket upgrade request header a client sets to the sequence number
+// it expects next, so that the server only sends it the buffered messages from there on.
+const HTTPHeaderRequestedSequenceNumber = "Arbitrum-Requested-Sequence-Number"
+
+// FilteredSubscriptionPath is the path clients subscribe to with a filter in the query parameters of the websocket
+// upgrade request, to be sent only what the filter selects instead of every message
+const FilteredSubscriptionPath = "/filtered"
+
+// BinaryFeedProtocol is the websocket subprotocol a client asks for to be sent binary encoded messages instead of JSON
+const BinaryFeedProtocol = "arbitrum-feed-binary-v1"
+
 type BroadcasterConfig struct {
-	Enable        bool          `koanf:"enable"`
-	Addr          string        `koanf:"addr"`
-	IOTimeout     time.Duration `koanf:"io-timeout"`
-	Port          string        `koanf:"port"`
-	Ping          time.Duration `koanf:"ping"`
-	ClientTimeout time.Duration `koanf:"client-timeout"`
-	Queue         int           `koanf:"queue"`
-	Workers       int           `koanf:"workers"`
-	MaxSendQueue  int           `koanf:"max-send-queue"`
+	Enable            bool                    `koanf:"enable"`
+	Addr              string                  `koanf:"addr"`
+	IOTimeout         time.Duration           `koanf:"io-timeout"`
+	Port              string                  `koanf:"port"`
+	Ping              time.Duration           `koanf:"ping"`
+	ClientTimeout     time.Duration           `koanf:"client-timeout"`
+	Queue             int                     `koanf:"queue"`
+	Workers           int                     `koanf:"workers"`
+	MaxSendQueue      int                     `koanf:"max-send-queue"`
+	Signed            bool                    `koanf:"signed"`
+	SigningKey        string                  `koanf:"signing-key"`
+	SignWithL1Wallet  bool                    `koanf:"sign-with-l1-wallet"`
+	EnableCompression bool                    `koanf:"enable-compression"`
+	EnableFilters     bool                    `koanf:"enable-filters"`
+	EnableBinary      bool                    `koanf:"enable-binary"`
+	ConnectionLimits  ConnectionLimiterConfig `koanf:"connection-limits"`
 }
 
 func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -41,30 +64,45 @@ func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".queue", DefaultBroadcasterConfig.Queue, "queue size")
 	f.Int(prefix+".workers", DefaultBroadcasterConfig.Workers, "number of threads to reserve for HTTP to WS upgrade")
 	f.Int(prefix+".max-send-queue", DefaultBroadcasterConfig.MaxSendQueue, "maximum number of messages allowed to accumulate before client is disconnected")
+	f.Bool(prefix+".signed", DefaultBroadcasterConfig.Signed, "sign broadcast messages with the feed signing key")
+	f.String(prefix+".signing-key", DefaultBroadcasterConfig.SigningKey, "hex encoded private key, or the path to a file containing it, to sign broadcast messages with")
+	f.Bool(prefix+".sign-with-l1-wallet", DefaultBroadcasterConfig.SignWithL1Wallet, "sign broadcast messages with the node's L1 wallet key if no signing key is set, making feed clients trust the batch posting key")
+	f.Bool(prefix+".enable-compression", DefaultBroadcasterConfig.EnableCompression, "compress messages with permessage-deflate for clients which support it")
+	f.Bool(prefix+".enable-filters", DefaultBroadcasterConfig.EnableFilters, "accept filtered subscriptions on "+FilteredSubscriptionPath+", which are only sent the matching transactions")
+	f.Bool(prefix+".enable-binary", DefaultBroadcasterConfig.EnableBinary, "send binary encoded messages to clients which ask for them, rather than JSON")
+	ConnectionLimiterConfigAddOptions(prefix+".connection-limits", f)
 }
 
 var DefaultBroadcasterConfig = BroadcasterConfig{
-	Enable:        false,
-	Addr:          "",
-	IOTimeout:     5 * time.Second,
-	Port:          "9642",
-	Ping:          5 * time.Second,
-	ClientTimeout: 15 * time.Second,
-	Queue:         100,
-	Workers:       100,
-	MaxSendQueue:  4096,
+	Enable:            false,
+	Addr:              "",
+	IOTimeout:         5 * time.Second,
+	Port:              "9642",
+	Ping:              5 * time.Second,
+	ClientTimeout:     15 * time.Second,
+	Queue:             100,
+	Workers:           100,
+	MaxSendQueue:      4096,
+	Signed:            false,
+	SigningKey:        "",
+	SignWithL1Wallet:  false,
+	EnableCompression: false,
+	EnableFilters:     false,
+	EnableBinary:      false,
+	ConnectionLimits:  DefaultConnectionLimiterConfig,
 }
 
 var DefaultTestBroadcasterConfig = BroadcasterConfig{
-	Enable:        false,
-	Addr:          "0.0.0.0",
-	IOTimeout:     2 * time.Second,
-	Port:          "0",
-	Ping:          5 * time.Second,
-	ClientTimeout: 15 * time.Second,
-	Queue:         1,
-	Workers:       100,
-	MaxSendQueue:  4096,
+	Enable:           false,
+	Addr:             "0.0.0.0",
+	IOTimeout:        2 * time.Second,
+	Port:             "0",
+	Ping:             5 * time.Second,
+	ClientTimeout:    15 * time.Second,
+	Queue:            1,
+	Workers:          100,
+	MaxSendQueue:     4096,
+	ConnectionLimits: DefaultConnectionLimiterConfig,
 }
 
 type WSBroadcastServer struct {
@@ -76,14 +114,17 @@ type WSBroadcastServer struct {
 	started       bool
 	clientManager *ClientManager
 	catchupBuffer CatchupBuffer
+	filters       ClientFilters
 }
 
-func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffer) *WSBroadcastServer {
+// NewWSBroadcastServer creates a server, which accepts filtered subscriptions if they're enabled and filters is non-nil
+func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffer, filters ClientFilters) *WSBroadcastServer {
 	return &WSBroadcastServer{
 		startMutex:    &sync.Mutex{},
 		settings:      settings,
 		started:       false,
 		catchupBuffer: catchupBuffer,
+		filters:       filters,
 	}
 }
 
@@ -93,6 +134,12 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 	if s.started {
 		return errors.New("broadcast server already started")
 	}
+	if err := s.settings.ConnectionLimits.Validate(); err != nil {
+		return err
+	}
+	if s.settings.EnableFilters && s.filters == nil {
+		return errors.New("filtered subscriptions enabled, but not supported by this feed")
+	}
 
 	var err error
 	s.poller, err = netpoll.New(nil)
@@ -103,7 +150,7 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 
 	// Make pool of X size, Y sized work queue and one pre-spawned
 	// goroutine.
-	var clientManager = NewClientManager(s.poller, s.settings, s.catchupBuffer)
+	var clientManager = NewClientManager(s.poller, s.settings, s.catchupBuffer, s.filters)
 	clientManager.Start(ctx)
 
 	s.clientManager = clientManager // maintain the pointer in this instance... used for testing
@@ -117,10 +164,90 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 
 		safeConn := deadliner{conn, s.settings.IOTimeout}
 
+		var requestedSeqNum arbutil.MessageIndex
+		var filter ClientFilter
+		// only used if the connection is from a trusted proxy
+		var realIp string
+		var forwardedFor []string
+		compression := wsflate.Extension{
+			Parameters: wsflate.DefaultParameters,
+		}
+		upgrader := ws.Upgrader{
+			OnRequest: func(uri []byte) error {
+				requestUri, err := url.ParseRequestURI(string(uri))
+				if err != nil {
+					return ws.RejectConnectionError(ws.RejectionStatus(http.StatusBadRequest), ws.RejectionReason(err.Error()))
+				}
+				if requestUri.Path != FilteredSubscriptionPath {
+					return nil
+				}
+				if !s.settings.EnableFilters {
+					return ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusNotFound),
+						ws.RejectionReason("filtered subscriptions aren't enabled on this feed"),
+					)
+				}
+				filter, err = s.filters.NewFilter(requestUri.Query())
+				if err != nil {
+					return ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusBadRequest),
+						ws.RejectionReason(fmt.Sprintf("invalid filter: %v", err)),
+					)
+				}
+				return nil
+			},
+			OnHeader: func(key, value []byte) error {
+				if strings.EqualFold(string(key), "X-Real-IP") {
+					realIp = string(value)
+					return nil
+				}
+				if strings.EqualFold(string(key), "X-Forwarded-For") {
+					forwardedFor = append(forwardedFor, string(value))
+					return nil
+				}
+				if !strings.EqualFold(string(key), HTTPHeaderRequestedSequenceNumber) {
+					return nil
+				}
+				num, err := strconv.ParseUint(string(value), 10, 64)
+				if err != nil {
+					return ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusBadRequest),
+						ws.RejectionReason(fmt.Sprintf("invalid %v header: %v", HTTPHeaderRequestedSequenceNumber, err)),
+					)
+				}
+				requestedSeqNum = arbutil.MessageIndex(num)
+				if err := s.catchupBuffer.CheckRequestedSequenceNumber(requestedSeqNum); err != nil {
+					return ws.RejectConnectionError(ws.RejectionStatus(http.StatusGone), ws.RejectionReason(err.Error()))
+				}
+				return nil
+			},
+		}
+		if s.settings.EnableCompression {
+			upgrader.Negotiate = compression.Negotiate
+		}
+		if s.settings.EnableBinary {
+			upgrader.Protocol = func(protocol []byte) bool {
+				return string(protocol) == BinaryFeedProtocol
+			}
+		}
+		clientIp := remoteIp(conn)
+		reserved := false
+		upgrader.OnBeforeUpgrade = func() (ws.HandshakeHeader, error) {
+			clientIp = clientManager.limiter.clientIp(clientIp, realIp, forwardedFor)
+			if err := clientManager.limiter.reserve(clientIp, time.Now()); err != nil {
+				return nil, err
+			}
+			reserved = true
+			return nil, nil
+		}
+
 		// Zero-copy upgrade to WebSocket connection.
-		hs, err := ws.Upgrade(safeConn)
+		hs, err := upgrader.Upgrade(safeConn)
 		if err != nil {
 			log.Warn("websocket upgrade error", "connection_name", nameConn(safeConn), "err", err)
+			if reserved {
+				clientManager.limiter.release(clientIp)
+			}
 			_ = safeConn.Close()
 			return
 		}
@@ -131,12 +258,15 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 		desc, err := netpoll.HandleRead(conn)
 		if err != nil {
 			log.Warn("error in HandleRead", "connection-name", nameConn(safeConn), "err", err)
+			clientManager.limiter.release(clientIp)
 			_ = conn.Close()
 			return
 		}
 
 		// Register incoming client in clientManager.
-		client := clientManager.Register(safeConn, desc)
+		_, compressionAccepted := compression.Accepted()
+		binary := hs.Protocol == BinaryFeedProtocol
+		client := clientManager.Register(safeConn, desc, clientIp, requestedSeqNum, compressionAccepted, binary, filter)
 
 		// Subscribe to events about conn.
 		err = s.poller.Start(desc, func(ev netpoll.Event) {